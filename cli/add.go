@@ -16,6 +16,7 @@ type AddCommandInput struct {
 	ProfileName string
 	FromEnv     bool
 	AddConfig   bool
+	Interactive bool
 }
 
 func ConfigureAddCommand(app *kingpin.Application, a *AwsVault) {
@@ -25,11 +26,16 @@ func ConfigureAddCommand(app *kingpin.Application, a *AwsVault) {
 
 	cmd.Arg("profile", "Name of the profile").
 		Required().
+		HintAction(a.MustGetProfileNames).
 		StringVar(&input.ProfileName)
 
 	cmd.Flag("env", "Read the credentials from the environment (AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)").
 		BoolVar(&input.FromEnv)
 
+	cmd.Flag("interactive", "Walk through entering the access key, or importing it from a CSV file, and setting the MFA device, region and session duration of the profile").
+		Short('i').
+		BoolVar(&input.Interactive)
+
 	cmd.Flag("add-config", "Add a profile to ~/.aws/config if one doesn't exist").
 		Default("true").
 		BoolVar(&input.AddConfig)
@@ -44,7 +50,7 @@ func ConfigureAddCommand(app *kingpin.Application, a *AwsVault) {
 			return err
 		}
 		err = AddCommand(input, keyring, awsConfigFile)
-		app.FatalIfError(err, "add")
+		fatalIfError(app, err, "add")
 		return nil
 	})
 }
@@ -52,12 +58,31 @@ func ConfigureAddCommand(app *kingpin.Application, a *AwsVault) {
 func AddCommand(input AddCommandInput, keyring keyring.Keyring, awsConfigFile *vault.ConfigFile) error {
 	var accessKeyID, secretKey string
 
-	p, _ := awsConfigFile.ProfileSection(input.ProfileName)
+	p, hasProfile := awsConfigFile.ProfileSection(input.ProfileName)
 	if p.SourceProfile != "" {
 		return fmt.Errorf("Your profile has a source_profile of %s, adding credentials to %s won't have any effect",
 			p.SourceProfile, input.ProfileName)
 	}
 
+	if input.Interactive {
+		if input.FromEnv {
+			return fmt.Errorf("Can't use --interactive with --env")
+		}
+		creds, profile, err := newAddWizard(p).run(p)
+		if err != nil {
+			return err
+		}
+		if err = addCredentials(input.ProfileName, creds, keyring); err != nil {
+			return err
+		}
+		log.Printf("Writing profile %s to config at %s", input.ProfileName, awsConfigFile.Path)
+		if err = awsConfigFile.Add(profile); err != nil {
+			return fmt.Errorf("Error writing profile: %w", err)
+		}
+		fmt.Printf("Wrote profile %s to %s\n", input.ProfileName, awsConfigFile.Path)
+		return nil
+	}
+
 	if input.FromEnv {
 		if accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID"); accessKeyID == "" {
 			return fmt.Errorf("Missing value for AWS_ACCESS_KEY_ID")
@@ -76,20 +101,11 @@ func AddCommand(input AddCommandInput, keyring keyring.Keyring, awsConfigFile *v
 	}
 
 	creds := aws.Credentials{AccessKeyID: accessKeyID, SecretAccessKey: secretKey}
-
-	ckr := &vault.CredentialKeyring{Keyring: keyring}
-	if err := ckr.Set(input.ProfileName, creds); err != nil {
+	if err := addCredentials(input.ProfileName, creds, keyring); err != nil {
 		return err
 	}
 
-	fmt.Printf("Added credentials to profile %q in vault\n", input.ProfileName)
-
-	sk := &vault.SessionKeyring{Keyring: keyring}
-	if n, _ := sk.RemoveForProfile(input.ProfileName); n > 0 {
-		fmt.Printf("Deleted %d existing sessions.\n", n)
-	}
-
-	if _, hasProfile := awsConfigFile.ProfileSection(input.ProfileName); !hasProfile {
+	if !hasProfile {
 		if input.AddConfig {
 			newProfileSection := vault.ProfileSection{
 				Name: input.ProfileName,
@@ -103,3 +119,19 @@ func AddCommand(input AddCommandInput, keyring keyring.Keyring, awsConfigFile *v
 
 	return nil
 }
+
+// addCredentials stores the credentials of the profile, removing the sessions made with the old ones
+func addCredentials(profileName string, creds aws.Credentials, keyring keyring.Keyring) error {
+	ckr := &vault.CredentialKeyring{Keyring: keyring}
+	if err := ckr.Set(profileName, creds); err != nil {
+		return err
+	}
+
+	fmt.Printf("Added credentials to profile %q in vault\n", profileName)
+
+	sk := &vault.SessionKeyring{Keyring: keyring}
+	if n, _ := sk.RemoveForProfile(profileName); n > 0 {
+		fmt.Printf("Deleted %d existing sessions.\n", n)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package cli
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/prompt"
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// addWizardRegion is the region of the STS and IAM calls that check the access key, as its
+// profile has no region yet
+const addWizardRegion = "us-east-1"
+
+var (
+	accessKeyIDAnswerRegexp = regexp.MustCompile(`^AKIA[A-Z0-9]{16}$`)
+	mfaSerialRegexp         = regexp.MustCompile(`^arn:aws[a-z-]*:iam::\d{12}:(mfa|u2f)/.+$`)
+	regionRegexp            = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+)
+
+// addWizard walks through adding an access key and the settings of its profile with add --interactive,
+// checking each answer and asking again when it's invalid
+type addWizard struct {
+	ask       func(message string) (string, error)
+	askSecret func(message string) (string, error)
+	confirm   func(message string) (bool, error)
+	out       io.Writer
+
+	// identity and mfaDevices call AWS with the access key entered
+	identity   func(creds aws.Credentials) (string, error)
+	mfaDevices func(creds aws.Credentials) ([]string, error)
+}
+
+func newAddWizard(profile vault.ProfileSection) *addWizard {
+	proxyConfig := &vault.Config{HTTPSProxy: profile.HTTPSProxy, NoProxy: profile.NoProxy}
+	newAwsConfig := func(creds aws.Credentials) aws.Config {
+		cfg := vault.NewAwsConfigWithCredsProvider(credentials.StaticCredentialsProvider{Value: creds}, addWizardRegion, "")
+		vault.AddProfileProxy(&cfg, proxyConfig)
+		return cfg
+	}
+
+	return &addWizard{
+		ask:       prompt.TerminalPrompt,
+		askSecret: prompt.TerminalSecretPrompt,
+		confirm: func(message string) (bool, error) {
+			return prompt.Confirm("terminal", message)
+		},
+		out: os.Stderr,
+		identity: func(creds aws.Credentials) (string, error) {
+			identity, err := sts.NewFromConfig(newAwsConfig(creds)).GetCallerIdentity(rootCtx, &sts.GetCallerIdentityInput{})
+			if err != nil {
+				return "", err
+			}
+			return aws.ToString(identity.Arn), nil
+		},
+		mfaDevices: func(creds aws.Credentials) ([]string, error) {
+			out, err := iam.NewFromConfig(newAwsConfig(creds)).ListMFADevices(rootCtx, &iam.ListMFADevicesInput{})
+			if err != nil {
+				return nil, err
+			}
+			serials := []string{}
+			for _, device := range out.MFADevices {
+				serials = append(serials, aws.ToString(device.SerialNumber))
+			}
+			return serials, nil
+		},
+	}
+}
+
+// run asks for the access key and the settings of the profile, starting from those it already has
+func (w *addWizard) run(profile vault.ProfileSection) (aws.Credentials, vault.ProfileSection, error) {
+	creds, err := w.askCredentials()
+	if err != nil {
+		return creds, profile, err
+	}
+
+	if profile.MfaSerial, err = w.askMfaSerial(creds, profile.MfaSerial); err != nil {
+		return creds, profile, err
+	}
+	if profile.Region, err = w.askRegion(profile.Region); err != nil {
+		return creds, profile, err
+	}
+
+	current := vault.DefaultSessionDuration
+	if profile.DurationSeconds > 0 {
+		current = time.Duration(profile.DurationSeconds) * time.Second
+	}
+	duration, err := w.askDuration(current)
+	if err != nil {
+		return creds, profile, err
+	}
+	if duration != vault.DefaultSessionDuration || profile.DurationSeconds > 0 {
+		profile.DurationSeconds = uint(duration.Seconds())
+	}
+
+	return creds, profile, nil
+}
+
+// askUntilValid asks until the answer is valid, returning def for an empty answer
+func (w *addWizard) askUntilValid(ask func(string) (string, error), message, def string, check func(string) error) (string, error) {
+	if def != "" {
+		message = fmt.Sprintf("%s [%s]", message, def)
+	}
+	for {
+		answer, err := ask(message + ": ")
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			answer = def
+		}
+		if err = check(answer); err == nil {
+			return answer, nil
+		}
+		fmt.Fprintf(w.out, "%s\n", err)
+	}
+}
+
+// askCredentials asks for an access key, or the CSV file of one downloaded from the IAM console,
+// until AWS accepts it
+func (w *addWizard) askCredentials() (aws.Credentials, error) {
+	for {
+		var creds aws.Credentials
+		_, err := w.askUntilValid(w.ask, "Access Key ID, or the path of the CSV file of the access key from the IAM console", "", func(answer string) error {
+			if accessKeyIDAnswerRegexp.MatchString(answer) {
+				creds.AccessKeyID = answer
+				return nil
+			}
+			path, err := expandHomeDir(answer)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(path); err != nil {
+				return fmt.Errorf("%q isn't an Access Key ID, which starts with AKIA and has 20 characters, or a file", answer)
+			}
+			creds, err = readAccessKeyCSV(path)
+			return err
+		})
+		if err != nil {
+			return creds, err
+		}
+
+		if creds.SecretAccessKey == "" {
+			_, err = w.askUntilValid(w.askSecret, "Secret Access Key", "", func(answer string) error {
+				if len(answer) != 40 {
+					return errors.New("A Secret Access Key has 40 characters")
+				}
+				creds.SecretAccessKey = answer
+				return nil
+			})
+			if err != nil {
+				return creds, err
+			}
+		}
+		fmt.Fprintf(w.out, "Checking the access key %s\n", vault.FormatKeyForDisplay(creds.AccessKeyID))
+
+		arn, err := w.identity(creds)
+		if err == nil {
+			fmt.Fprintf(w.out, "The access key is for %s\n", arn)
+			return creds, nil
+		}
+		fmt.Fprintf(w.out, "The access key doesn't work: %s\n", err)
+		again, confirmErr := w.confirm("Enter another access key?")
+		if confirmErr != nil {
+			return creds, confirmErr
+		}
+		if !again {
+			return creds, fmt.Errorf("The access key %s doesn't work: %w", vault.FormatKeyForDisplay(creds.AccessKeyID), err)
+		}
+	}
+}
+
+// readAccessKeyCSV reads the access key from the CSV file downloaded when creating it in the IAM console
+func readAccessKeyCSV(path string) (aws.Credentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("Can't read %s as CSV: %w", path, err)
+	}
+	if len(records) < 2 {
+		return aws.Credentials{}, fmt.Errorf("%s has no access key", path)
+	}
+
+	idColumn, secretColumn := -1, -1
+	for i, name := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) {
+		case "access key id":
+			idColumn = i
+		case "secret access key":
+			secretColumn = i
+		}
+	}
+	if idColumn < 0 || secretColumn < 0 || len(records[1]) <= idColumn || len(records[1]) <= secretColumn {
+		return aws.Credentials{}, fmt.Errorf("%s doesn't have the Access key ID and Secret access key columns of an access key from the IAM console", path)
+	}
+
+	return aws.Credentials{
+		AccessKeyID:     strings.TrimSpace(records[1][idColumn]),
+		SecretAccessKey: strings.TrimSpace(records[1][secretColumn]),
+	}, nil
+}
+
+// askMfaSerial offers the MFA devices of the user to choose from, or asks for the ARN of one
+// when they can't be listed
+func (w *addWizard) askMfaSerial(creds aws.Credentials, current string) (string, error) {
+	devices, err := w.mfaDevices(creds)
+	if err != nil {
+		fmt.Fprintf(w.out, "Can't list your MFA devices: %s\n", err)
+	}
+
+	if len(devices) == 0 {
+		return w.askUntilValid(w.ask, "MFA device ARN, or empty for none", current, func(answer string) error {
+			if answer != "" && !mfaSerialRegexp.MatchString(answer) {
+				return fmt.Errorf("%q isn't the ARN of an MFA device, such as arn:aws:iam::111111111111:mfa/jane", answer)
+			}
+			return nil
+		})
+	}
+
+	fmt.Fprintln(w.out, "MFA devices:")
+	fmt.Fprintln(w.out, "  0: none")
+	def := "1"
+	for i, serial := range devices {
+		fmt.Fprintf(w.out, "  %d: %s\n", i+1, serial)
+		if serial == current {
+			def = strconv.Itoa(i + 1)
+		}
+	}
+	answer, err := w.askUntilValid(w.ask, "MFA device", def, func(answer string) error {
+		if n, err := strconv.Atoi(answer); err != nil || n < 0 || n > len(devices) {
+			return fmt.Errorf("Choose a device from 0 to %d", len(devices))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if n, _ := strconv.Atoi(answer); n > 0 {
+		return devices[n-1], nil
+	}
+	return "", nil
+}
+
+// askRegion asks for the region of the profile, defaulting to its current one or that of the environment
+func (w *addWizard) askRegion(current string) (string, error) {
+	if current == "" {
+		current = os.Getenv("AWS_REGION")
+	}
+	if current == "" {
+		current = addWizardRegion
+	}
+	return w.askUntilValid(w.ask, "Region", current, func(answer string) error {
+		if !regionRegexp.MatchString(answer) {
+			return fmt.Errorf("%q isn't a region, such as us-east-1 or eu-west-2", answer)
+		}
+		return nil
+	})
+}
+
+// askDuration asks for the duration of the sessions of the profile, within the range of GetSessionToken
+func (w *addWizard) askDuration(current time.Duration) (time.Duration, error) {
+	var duration time.Duration
+	_, err := w.askUntilValid(w.ask, "Session duration", vault.FormatDuration(current), func(answer string) error {
+		d, err := vault.ParseDuration(answer)
+		if err != nil {
+			return err
+		}
+		if d < vault.MinSessionDuration || d > vault.MaxSessionTokenDuration {
+			return fmt.Errorf("The session duration needs to be from %s to %s",
+				vault.FormatDuration(vault.MinSessionDuration), vault.FormatDuration(vault.MaxSessionTokenDuration))
+		}
+		duration = d
+		return nil
+	})
+	return duration, err
+}
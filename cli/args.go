@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+)
+
+// commandArgName is the name of the argument of commands such as exec that run another command
+const commandArgName = "cmd"
+
+// SeparateCommandArgs inserts a `--` before the command to run with exec and isolated-exec, so that
+// flags after it are passed to the command rather than parsed by aws-vault. Args that already
+// have a `--`, that run no command or that are being completed are returned as they are
+func SeparateCommandArgs(app *kingpin.Application, args []string) []string {
+	model := app.Model()
+	flags := model.Flags
+	commands := model.Commands
+
+	var cmd *kingpin.CmdModel
+	positional := 0
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "--completion-bash" {
+			return args
+		}
+		if len(arg) > 1 && strings.HasPrefix(arg, "-") {
+			if flagConsumesNextArg(arg, flags) {
+				i++
+			}
+			continue
+		}
+
+		if cmd == nil {
+			cmd = findCommandModel(commands, arg)
+			if cmd == nil {
+				return args
+			}
+			flags = append(append([]*kingpin.FlagModel{}, flags...), cmd.Flags...)
+			if len(cmd.Commands) > 0 {
+				commands = cmd.Commands
+				cmd = nil
+			}
+			continue
+		}
+
+		if positional >= len(cmd.Args) {
+			return args
+		}
+		if cmd.Args[positional].Name == commandArgName {
+			separated := make([]string, 0, len(args)+1)
+			separated = append(separated, args[:i]...)
+			separated = append(separated, "--")
+			return append(separated, args[i:]...)
+		}
+		positional++
+	}
+
+	return args
+}
+
+func findCommandModel(commands []*kingpin.CmdModel, name string) *kingpin.CmdModel {
+	for _, cmd := range commands {
+		if cmd.Name == name || containsString(cmd.Aliases, name) {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// flagConsumesNextArg is whether the flag takes a value that is in the next arg, as in `--region us-east-1`
+// or `-d 1h`. Unknown flags are treated as booleans
+func flagConsumesNextArg(arg string, flags []*kingpin.FlagModel) bool {
+	if strings.HasPrefix(arg, "--") {
+		name := strings.TrimPrefix(arg, "--")
+		if strings.Contains(name, "=") {
+			return false
+		}
+		for _, flag := range flags {
+			if flag.Name == name {
+				return !flag.IsBoolFlag()
+			}
+		}
+		return false
+	}
+
+	// short flags can be combined, and the last may take a value from the rest of the arg, as in -nd1h
+	shorts := []rune(strings.TrimPrefix(arg, "-"))
+	for i, short := range shorts {
+		for _, flag := range flags {
+			if flag.Short == short && !flag.IsBoolFlag() {
+				return i == len(shorts)-1
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alecthomas/kingpin"
+)
+
+func TestSeparateCommandArgs(t *testing.T) {
+	app := kingpin.New("aws-vault", "")
+	a := ConfigureGlobals(app)
+	ConfigureExecCommand(app, a)
+	ConfigureExportCommand(app, a)
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{
+			[]string{"exec", "p", "aws", "s3", "ls", "--recursive"},
+			[]string{"exec", "p", "--", "aws", "s3", "ls", "--recursive"},
+		},
+		{
+			[]string{"--backend", "file", "exec", "-d", "1h", "--no-session", "p", "aws", "--region", "x"},
+			[]string{"--backend", "file", "exec", "-d", "1h", "--no-session", "p", "--", "aws", "--region", "x"},
+		},
+		{
+			[]string{"exec", "--region=us-east-1", "-nd1h", "p", "env"},
+			[]string{"exec", "--region=us-east-1", "-nd1h", "p", "--", "env"},
+		},
+		{
+			[]string{"exec", "p", "--", "aws", "--version"},
+			[]string{"exec", "p", "--", "aws", "--version"},
+		},
+		{
+			[]string{"exec", "p"},
+			[]string{"exec", "p"},
+		},
+		{
+			[]string{"export", "p", "--format", "json"},
+			[]string{"export", "p", "--format", "json"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := SeparateCommandArgs(app, tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SeparateCommandArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/99designs/keyring"
+	"github.com/alecthomas/kingpin"
+)
+
+func ConfigureBackendsCommand(app *kingpin.Application, a *AwsVault) {
+	cmd := app.Command("backends", "Show which keyring backends can be opened, and which one would be used.")
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		err := BackendsCommand(a)
+		fatalIfError(app, err, "backends")
+		return nil
+	})
+}
+
+// keyringBackendsAvailable lists the backends of the keyring library compiled in for this OS, most specific first
+func keyringBackendsAvailable() []string {
+	backends := []string{}
+	for _, backendType := range keyring.AvailableBackends() {
+		backends = append(backends, string(backendType))
+	}
+	return backends
+}
+
+// parseBackendOrder parses the comma separated backends of --backend-order
+func parseBackendOrder(s string, available []string) ([]string, error) {
+	order := []string{}
+	for _, backend := range strings.Split(s, ",") {
+		backend = strings.TrimSpace(backend)
+		if backend == "" {
+			continue
+		}
+		if !containsString(available, backend) {
+			return nil, fmt.Errorf("Unknown backend '%s' in --backend-order, valid values are %s", backend, strings.Join(available, ", "))
+		}
+		if !containsString(order, backend) {
+			order = append(order, backend)
+		}
+	}
+	if len(order) == 0 {
+		return nil, fmt.Errorf("--backend-order is empty")
+	}
+
+	return order, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// backendStatus is whether a backend can be opened, and why it would or wouldn't be used
+type backendStatus struct {
+	Backend  string
+	Status   string
+	CanOpen  bool
+	Selected bool
+}
+
+// probeBackends opens each backend in --backend-order, and the one set with --backend, to find those
+// that can be used and the one that would be selected
+func (a *AwsVault) probeBackends() ([]backendStatus, string, error) {
+	order, err := parseBackendOrder(a.BackendOrder, a.backendsAvailable)
+	if err != nil {
+		return nil, "", err
+	}
+
+	probed := order
+	if a.KeyringBackend != "" && !containsString(order, a.KeyringBackend) {
+		probed = append([]string{a.KeyringBackend}, order...)
+	}
+
+	statuses := []backendStatus{}
+	selected := ""
+	for _, backend := range probed {
+		s := backendStatus{Backend: backend, Status: "available", CanOpen: true}
+		if _, err := a.openBackend(backend); err != nil {
+			s.Status = "can't be opened: " + err.Error()
+			s.CanOpen = false
+		} else if backend == a.KeyringBackend || (a.KeyringBackend == "" && selected == "") {
+			selected = backend
+			s.Selected = true
+		}
+		if backend == a.KeyringBackend {
+			s.Status = "set with --backend, " + s.Status
+		} else if s.Selected {
+			s.Status = "selected, the first in --backend-order that can be opened"
+		}
+		statuses = append(statuses, s)
+	}
+	for _, backend := range a.backendsAvailable {
+		if !containsString(probed, backend) {
+			statuses = append(statuses, backendStatus{Backend: backend, Status: "not in --backend-order"})
+		}
+	}
+
+	return statuses, selected, nil
+}
+
+func printBackendStatuses(statuses []backendStatus) error {
+	w := tabwriter.NewWriter(os.Stdout, 16, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Backend\tStatus\t")
+	fmt.Fprintln(w, "=======\t======\t")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t\n", s.Backend, s.Status)
+	}
+	return w.Flush()
+}
+
+func BackendsCommand(a *AwsVault) error {
+	statuses, selected, err := a.probeBackends()
+	if err != nil {
+		return err
+	}
+	if err := printBackendStatuses(statuses); err != nil {
+		return err
+	}
+
+	if selected == "" && a.KeyringBackend != "" {
+		return fmt.Errorf("The %s backend set with --backend can't be opened", a.KeyringBackend)
+	} else if selected == "" {
+		return fmt.Errorf("None of the backends in --backend-order can be opened")
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBackendOrder(t *testing.T) {
+	available := []string{"keychain", "pass", "file"}
+
+	order, err := parseBackendOrder(" file, keychain,,file ", available)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"file", "keychain"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("Expected %v, got %v", want, order)
+	}
+
+	if _, err = parseBackendOrder("file,wincred", available); err == nil {
+		t.Fatal("Expected an error for a backend that isn't available")
+	}
+
+	if _, err = parseBackendOrder(",", available); err == nil {
+		t.Fatal("Expected an error for an empty order")
+	}
+}
+
+func TestHelperBackendNeedsCommand(t *testing.T) {
+	a := &AwsVault{}
+	if _, err := a.openBackend(HelperBackend); err == nil {
+		t.Fatal("Expected an error without --keyring-helper")
+	}
+
+	a.KeyringHelper = "my-keyring-helper --vault aws"
+	if _, err := a.openBackend(HelperBackend); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -32,13 +32,13 @@ func ConfigureClearCommand(app *kingpin.Application, a *AwsVault) {
 		}
 
 		err = ClearCommand(input, awsConfigFile, keyring)
-		app.FatalIfError(err, "clear")
+		fatalIfError(app, err, "clear")
 		return nil
 	})
 }
 
 func ClearCommand(input ClearCommandInput, awsConfigFile *vault.ConfigFile, keyring keyring.Keyring) error {
-	sessions := &vault.SessionKeyring{Keyring: keyring}
+	sessions := &vault.SessionKeyring{Keyring: keyring, Hooks: awsConfigFile.HooksSection()}
 	oidcTokens := &vault.OIDCTokenKeyring{Keyring: keyring}
 	var oldSessionsRemoved, numSessionsRemoved, numTokensRemoved int
 	var err error
@@ -62,8 +62,9 @@ func ClearCommand(input ClearCommandInput, awsConfigFile *vault.ConfigFile, keyr
 		}
 
 		if profileSection, ok := awsConfigFile.ProfileSection(input.ProfileName); ok {
-			if exists, _ := oidcTokens.Has(profileSection.SSOStartURL); exists {
-				err = oidcTokens.Remove(profileSection.SSOStartURL)
+			startURL := profileSSOStartURL(awsConfigFile, profileSection)
+			if exists, _ := oidcTokens.Has(startURL); startURL != "" && exists {
+				err = oidcTokens.Remove(startURL)
 				if err != nil {
 					return err
 				}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardCommands are the commands that copy stdin to the clipboard and print the clipboard
+type clipboardCommands struct {
+	copy  []string
+	paste []string
+}
+
+// findClipboardCommands finds the clipboard tools for this OS, and on Linux and BSDs for the display server
+func findClipboardCommands() (clipboardCommands, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return clipboardCommands{[]string{"pbcopy"}, []string{"pbpaste"}}, nil
+	case "windows":
+		return clipboardCommands{
+			[]string{"clip.exe"},
+			[]string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", "Get-Clipboard -Raw"},
+		}, nil
+	}
+
+	candidates := []clipboardCommands{
+		{[]string{"xclip", "-selection", "clipboard"}, []string{"xclip", "-selection", "clipboard", "-o"}},
+		{[]string{"xsel", "--clipboard", "--input"}, []string{"xsel", "--clipboard", "--output"}},
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		candidates = append([]clipboardCommands{{[]string{"wl-copy"}, []string{"wl-paste", "--no-newline"}}}, candidates...)
+	}
+	for _, c := range candidates {
+		if _, err := osexec.LookPath(c.copy[0]); err == nil {
+			return c, nil
+		}
+	}
+
+	return clipboardCommands{}, fmt.Errorf("No clipboard tool found, install wl-clipboard, xclip or xsel")
+}
+
+func (c clipboardCommands) Copy(s string) error {
+	cmd := osexec.Command(c.copy[0], c.copy[1:]...)
+	cmd.Stdin = strings.NewReader(s)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to copy to the clipboard with %s: %w", c.copy[0], err)
+	}
+	return nil
+}
+
+func (c clipboardCommands) Paste() (string, error) {
+	out, err := osexec.Command(c.paste[0], c.paste[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("Failed to read the clipboard with %s: %w", c.paste[0], err)
+	}
+	return string(out), nil
+}
+
+// ClearIfUnchanged empties the clipboard if it still holds s, so anything copied since is left alone
+func (c clipboardCommands) ClearIfUnchanged(s string) error {
+	current, err := c.Paste()
+	if err != nil {
+		return err
+	}
+	if strings.TrimRight(current, "\r\n") != strings.TrimRight(s, "\r\n") {
+		return nil
+	}
+	return c.Copy("")
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fileClipboard is a clipboard kept in a file, using sh and cat in place of the clipboard tools
+func fileClipboard(t *testing.T, contents string) (clipboardCommands, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the clipboard is faked with sh")
+	}
+	path := filepath.Join(t.TempDir(), "clipboard")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return clipboardCommands{
+		copy:  []string{"sh", "-c", `cat > "$0"`, path},
+		paste: []string{"cat", path},
+	}, path
+}
+
+func TestClearIfUnchanged(t *testing.T) {
+	cases := []struct {
+		clipboard string
+		copied    string
+		expected  string
+	}{
+		{"https://signin.aws.amazon.com/federation?SigninToken=abc", "https://signin.aws.amazon.com/federation?SigninToken=abc", ""},
+		// some clipboard tools add a line ending
+		{"https://signin.aws.amazon.com/federation?SigninToken=abc\r\n", "https://signin.aws.amazon.com/federation?SigninToken=abc", ""},
+		{"copied since", "https://signin.aws.amazon.com/federation?SigninToken=abc", "copied since"},
+	}
+	for _, c := range cases {
+		clipboard, path := fileClipboard(t, c.clipboard)
+		if err := clipboard.ClearIfUnchanged(c.copied); err != nil {
+			t.Fatal(err)
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != c.expected {
+			t.Errorf("Expected the clipboard holding %q to be %q, got %q", c.clipboard, c.expected, contents)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+)
+
+// Stdio is the standard input and outputs of a command
+type Stdio struct {
+	In  io.Reader
+	Out io.Writer
+	Err io.Writer
+}
+
+// isOS is whether the stdio is the process's own
+func (s Stdio) isOS() bool {
+	return s.In == os.Stdin && s.Out == os.Stdout && s.Err == os.Stderr
+}
+
+// CommandEnv is what a command uses from the program running it. Commands constructed with one, such as
+// with NewExport, can be embedded in other programs, or tested, with a keyring, AWS config and stdio of
+// their own rather than those of aws-vault
+type CommandEnv struct {
+	// Keyring stores the credentials and sessions, any keyring.Keyring such as keyring.NewArrayKeyring
+	Keyring keyring.Keyring
+
+	// ConfigFile is the AWS config the profiles are read from, such as one from vault.LoadConfig
+	ConfigFile *vault.ConfigFile
+
+	// Stdio is the command's stdio. Any that's nil is the process's own
+	Stdio Stdio
+
+	// Context is what the command runs in. Cancelling it cancels the command's requests and stops its
+	// credential servers. When nil, it's aws-vault's own, which is cancelled when aws-vault is interrupted
+	Context context.Context
+
+	// replaceProcess lets exec replace the process with the command, rather than wait for it. Only
+	// aws-vault sets it, as programs embedding the command carry on once it has finished
+	replaceProcess bool
+}
+
+// withDefaults fills in the stdio that isn't set with the process's own
+func (e CommandEnv) withDefaults() CommandEnv {
+	if e.Stdio.In == nil {
+		e.Stdio.In = os.Stdin
+	}
+	if e.Stdio.Out == nil {
+		e.Stdio.Out = os.Stdout
+	}
+	if e.Stdio.Err == nil {
+		e.Stdio.Err = os.Stderr
+	}
+	if e.Context == nil {
+		e.Context = rootCtx
+	}
+	return e
+}
@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/alecthomas/kingpin"
+)
+
+type CompletionCommandInput struct {
+	Shell string
+}
+
+// awsRegions are suggested when completing --region
+var awsRegions = []string{
+	"af-south-1",
+	"ap-east-1",
+	"ap-northeast-1",
+	"ap-northeast-2",
+	"ap-northeast-3",
+	"ap-south-1",
+	"ap-south-2",
+	"ap-southeast-1",
+	"ap-southeast-2",
+	"ap-southeast-3",
+	"ap-southeast-4",
+	"ca-central-1",
+	"cn-north-1",
+	"cn-northwest-1",
+	"eu-central-1",
+	"eu-central-2",
+	"eu-north-1",
+	"eu-south-1",
+	"eu-south-2",
+	"eu-west-1",
+	"eu-west-2",
+	"eu-west-3",
+	"me-central-1",
+	"me-south-1",
+	"sa-east-1",
+	"us-east-1",
+	"us-east-2",
+	"us-gov-east-1",
+	"us-gov-west-1",
+	"us-west-1",
+	"us-west-2",
+}
+
+func ConfigureCompletionCommand(app *kingpin.Application, a *AwsVault) {
+	input := CompletionCommandInput{}
+
+	cmd := app.Command("completion", "Print the shell completion script for bash, zsh, fish or powershell.")
+
+	cmd.Arg("shell", "The shell to print the completion script for").
+		Required().
+		HintOptions("bash", "zsh", "fish", "powershell").
+		EnumVar(&input.Shell, "bash", "zsh", "fish", "powershell")
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		err := CompletionCommand(input)
+		fatalIfError(app, err, "completion")
+		return nil
+	})
+}
+
+func CompletionCommand(input CompletionCommandInput) error {
+	switch input.Shell {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	case "powershell":
+		fmt.Print(powershellCompletion)
+	default:
+		return fmt.Errorf("Unknown shell '%s'", input.Shell)
+	}
+	return nil
+}
+
+// The completion scripts ask aws-vault for the candidates with --completion-bash, and complete the
+// command after a `--` with the shell's own completion. They match the scripts in contrib/completions
+
+var bashCompletion = `_aws-vault_bash_autocomplete() {
+    local i cur prev opts base
+
+    for (( i=1; i < COMP_CWORD; i++ )); do
+        if [[ ${COMP_WORDS[i]} == -- ]]; then
+            _command_offset $i+1
+            return
+        fi
+    done
+
+    COMPREPLY=()
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    opts=$( ${COMP_WORDS[0]} --completion-bash "${COMP_WORDS[@]:1:$COMP_CWORD}" )
+    COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+    return 0
+}
+complete -F _aws-vault_bash_autocomplete -o default aws-vault
+`
+
+var zshCompletion = `#compdef aws-vault
+
+_aws-vault() {
+    local i
+    for (( i=2; i < CURRENT; i++ )); do
+        if [[ ${words[i]} == -- ]]; then
+            shift $i words
+            (( CURRENT -= i ))
+            _normal
+            return
+        fi
+    done
+
+    local matches=($(${words[1]} --completion-bash ${(@)words[2,$CURRENT]}))
+    compadd -a matches
+
+    if [[ $compstate[nmatches] -eq 0 && $words[$CURRENT] != -* ]]; then
+        _files
+    fi
+}
+
+if [[ "$(basename -- ${(%):-%x})" != "_aws-vault" ]]; then
+    compdef _aws-vault aws-vault
+fi
+`
+
+var fishCompletion = `if status --is-interactive
+  complete -ec aws-vault
+
+  # switch based on seeing a ` + "`--`" + `
+  complete -c aws-vault -n 'not __fish_aws_vault_is_commandline' -xa '(__fish_aws_vault_complete_arg)'
+  complete -c aws-vault -n '__fish_aws_vault_is_commandline' -xa '(__fish_aws_vault_complete_commandline)'
+
+  function __fish_aws_vault_is_commandline
+    string match -q -r '^--$' -- (commandline -opc)
+  end
+
+  function __fish_aws_vault_complete_arg
+    set -l parts (commandline -opc)
+    set -e parts[1]
+
+    aws-vault --completion-bash $parts
+  end
+
+  function __fish_aws_vault_complete_commandline
+    set -l parts (string split --max 1 '--' -- (commandline -pc))
+
+    complete "-C$parts[2]"
+  end
+end
+`
+
+var powershellCompletion = `Register-ArgumentCompleter -Native -CommandName aws-vault, aws-vault.exe -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($words -contains '--') {
+        return
+    }
+    # aws-vault completes the word being typed, which is the last one before the cursor
+    if ($wordToComplete -ne '' -and $words.Count -gt 0) {
+        $words = @($words | Select-Object -SkipLast 1)
+    }
+
+    & $commandAst.CommandElements[0].ToString() --completion-bash @words $wordToComplete |
+        Where-Object { $_ -like "$wordToComplete*" } |
+        ForEach-Object { [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_) }
+}
+`
@@ -0,0 +1,275 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/99designs/aws-vault/v7/server"
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	"github.com/alecthomas/kingpin"
+)
+
+type ComposeEnvCommandInput struct {
+	ProfileName string
+	Format      string
+	Services    []string
+	Listen      string
+	Host        string
+	OutputFile  string
+	ServerURL   string
+	Token       string
+	Config      vault.Config
+	Lazy        bool
+}
+
+// dockerHostName is the host name of the host in Docker Desktop containers, which needs mapping on Linux
+const dockerHostName = "host.docker.internal"
+
+var (
+	ComposeEnvFormatCompose      = "compose"
+	ComposeEnvFormatDevcontainer = "devcontainer"
+)
+
+func ConfigureComposeEnvCommand(app *kingpin.Application, a *AwsVault) {
+	input := ComposeEnvCommandInput{}
+
+	cmd := app.Command("compose-env", "Start an ECS credential server that containers can reach, and print a docker-compose override or devcontainer.json snippet that uses it.")
+
+	cmd.Flag("format", fmt.Sprintf("Format of the snippet. Valid values are %s and %s", ComposeEnvFormatCompose, ComposeEnvFormatDevcontainer)).
+		Default(ComposeEnvFormatCompose).
+		EnumVar(&input.Format, ComposeEnvFormatCompose, ComposeEnvFormatDevcontainer)
+
+	cmd.Flag("service", "Name of a docker-compose service to give credentials to. Can be repeated").
+		Short('s').
+		StringsVar(&input.Services)
+
+	cmd.Flag("listen", "Address for the server to listen on. Defaults to the docker0 bridge on Linux, and 127.0.0.1 elsewhere").
+		StringVar(&input.Listen)
+
+	cmd.Flag("host", "Host name of the server as seen from containers").
+		Default(dockerHostName).
+		StringVar(&input.Host)
+
+	cmd.Flag("output", "Write the snippet to this file instead of stdout").
+		Short('o').
+		StringVar(&input.OutputFile)
+
+	cmd.Flag("server-url", "Use an ECS credential server that is already running instead of starting one").
+		StringVar(&input.ServerURL)
+
+	cmd.Flag("token", "The authorization token of the server set with --server-url").
+		Envar("AWS_CONTAINER_AUTHORIZATION_TOKEN").
+		StringVar(&input.Token)
+
+	cmd.Flag("region", "The AWS region").
+		HintOptions(awsRegions...).
+		StringVar(&input.Config.Region)
+
+	cmd.Flag("lazy", "Get credentials when they're first requested, rather than when the server starts").
+		BoolVar(&input.Lazy)
+
+	cmd.Arg("profile", "Name of the profile").
+		Required().
+		HintAction(a.MustGetProfileNames).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) (err error) {
+		input.Config.MfaPromptMethod = a.PromptDriver(false)
+
+		input.Config = a.globalConfig(input.Config)
+
+		f, err := a.AwsConfigFile()
+		if err != nil {
+			return err
+		}
+		keyring, err := a.Keyring()
+		if err != nil {
+			return err
+		}
+
+		err = ComposeEnvCommand(input, f, keyring)
+		fatalIfError(app, err, "compose-env")
+		return nil
+	})
+}
+
+func ComposeEnvCommand(input ComposeEnvCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
+	if input.Format == ComposeEnvFormatCompose && len(input.Services) == 0 {
+		return fmt.Errorf("Set the docker-compose services to give credentials to with --service")
+	}
+	if input.ServerURL != "" && input.Token == "" {
+		return fmt.Errorf("--server-url needs the token of the server, set with --token or AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	}
+
+	var err error
+	input.ProfileName, err = resolveProfileName(input.ProfileName, f, keyring, input.Config)
+	if err != nil {
+		return err
+	}
+
+	configLoader := vault.ConfigLoader{
+		File:          f,
+		BaseConfig:    input.Config,
+		ActiveProfile: input.ProfileName,
+	}
+	config, err := configLoader.LoadFromProfile(input.ProfileName)
+	if err != nil {
+		return fmt.Errorf("Error loading config: %w", err)
+	}
+
+	if input.ServerURL != "" {
+		return writeComposeEnv(input, config.Region, input.ServerURL, input.Token)
+	}
+
+	if input.Listen == "" {
+		if input.Listen, err = defaultComposeEnvListenAddr(); err != nil {
+			return err
+		}
+	}
+
+	ckr := &vault.CredentialKeyring{Keyring: keyring}
+	credsProvider, err := vault.NewTempCredentialsProvider(config, ckr)
+	if err != nil {
+		return fmt.Errorf("Error getting temporary credentials: %w", err)
+	}
+
+	ecsServer, err := server.NewEcsServerOnAddr(rootCtx, credsProvider, config, "", input.Listen, input.Lazy)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := ecsServer.Serve()
+		if err != http.ErrServerClosed { // ErrServerClosed is a graceful close
+			log.Fatalf("ecs server: %s", err.Error())
+		}
+	}()
+
+	serverURL := fmt.Sprintf("http://%s/", net.JoinHostPort(input.Host, strconv.Itoa(ecsServer.Port())))
+	if err = writeComposeEnv(input, config.Region, serverURL, ecsServer.AuthToken()); err != nil {
+		return err
+	}
+
+	listenHost, _, _ := net.SplitHostPort(input.Listen)
+	infof("Serving credentials for %s on %s, press Ctrl-C to stop", input.ProfileName, net.JoinHostPort(listenHost, strconv.Itoa(ecsServer.Port())))
+
+	<-interrupted()
+	shutdownServer("ecs", ecsServer.Shutdown)
+
+	return nil
+}
+
+// defaultComposeEnvListenAddr is an address containers can reach. Docker Desktop forwards host.docker.internal
+// to the loopback interface of the host, but on Linux it's the docker0 bridge
+func defaultComposeEnvListenAddr() (string, error) {
+	if runtime.GOOS != "linux" {
+		return "127.0.0.1:0", nil
+	}
+
+	iface, err := net.InterfaceByName("docker0")
+	if err != nil {
+		return "", fmt.Errorf("Can't find the docker0 bridge, set the address for the server to listen on with --listen: %w", err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return net.JoinHostPort(ipNet.IP.String(), "0"), nil
+		}
+	}
+
+	return "", fmt.Errorf("The docker0 bridge has no IPv4 address, set the address for the server to listen on with --listen")
+}
+
+func writeComposeEnv(input ComposeEnvCommandInput, region, serverURL, token string) error {
+	var w io.Writer = os.Stdout
+	if input.OutputFile != "" {
+		file, err := os.OpenFile(input.OutputFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	env := [][2]string{
+		{"AWS_CONTAINER_CREDENTIALS_FULL_URI", serverURL},
+		{"AWS_CONTAINER_AUTHORIZATION_TOKEN", token},
+	}
+	if region != "" {
+		env = append(env, [2]string{"AWS_REGION", region}, [2]string{"AWS_DEFAULT_REGION", region})
+	}
+
+	if input.Format == ComposeEnvFormatDevcontainer {
+		return printDevcontainerEnv(w, input.Host, env)
+	}
+	return printComposeEnv(w, input.ProfileName, input.Services, input.Host, env)
+}
+
+// printComposeEnv prints a docker-compose override file. The host-gateway entry lets containers reach the
+// host as host.docker.internal on Linux, as they can in Docker Desktop
+func printComposeEnv(w io.Writer, profileName string, services []string, host string, env [][2]string) error {
+	return printComposeServicesEnv(w, "compose-env "+profileName, services, host, func(string) [][2]string { return env })
+}
+
+// printComposeServicesEnv prints a docker-compose override file giving each service its own environment
+func printComposeServicesEnv(w io.Writer, generatedBy string, services []string, host string, envFor func(service string) [][2]string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by aws-vault %s, valid while it's running\n", generatedBy)
+	fmt.Fprintln(&b, "services:")
+	for _, service := range services {
+		fmt.Fprintf(&b, "  %s:\n", service)
+		fmt.Fprintln(&b, "    environment:")
+		for _, v := range envFor(service) {
+			fmt.Fprintf(&b, "      %s: %s\n", v[0], yamlQuote(v[1]))
+		}
+		if host == dockerHostName {
+			fmt.Fprintln(&b, "    extra_hosts:")
+			fmt.Fprintf(&b, "      - \"%s:host-gateway\"\n", dockerHostName)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// printDevcontainerEnv prints the properties to add to devcontainer.json
+func printDevcontainerEnv(w io.Writer, host string, env [][2]string) error {
+	type devcontainer struct {
+		ContainerEnv map[string]string `json:"containerEnv"`
+		RunArgs      []string          `json:"runArgs,omitempty"`
+	}
+
+	d := devcontainer{
+		ContainerEnv: map[string]string{},
+	}
+	if host == dockerHostName {
+		d.RunArgs = []string{"--add-host=" + dockerHostName + ":host-gateway"}
+	}
+	for _, v := range env {
+		d.ContainerEnv[v[0]] = v[1]
+	}
+
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+// yamlQuote quotes s as a YAML string. JSON strings are valid YAML
+func yamlQuote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
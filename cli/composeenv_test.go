@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"os"
+)
+
+func ExampleComposeEnvCommand() {
+	env := [][2]string{
+		{"AWS_CONTAINER_CREDENTIALS_FULL_URI", "http://host.docker.internal:50000/"},
+		{"AWS_CONTAINER_AUTHORIZATION_TOKEN", "token"},
+	}
+	_ = printComposeEnv(os.Stdout, "llamas", []string{"app"}, dockerHostName, env)
+	_ = printDevcontainerEnv(os.Stdout, "172.17.0.1", env)
+
+	// Output:
+	// # Generated by aws-vault compose-env llamas, valid while it's running
+	// services:
+	//   app:
+	//     environment:
+	//       AWS_CONTAINER_CREDENTIALS_FULL_URI: "http://host.docker.internal:50000/"
+	//       AWS_CONTAINER_AUTHORIZATION_TOKEN: "token"
+	//     extra_hosts:
+	//       - "host.docker.internal:host-gateway"
+	// {
+	//   "containerEnv": {
+	//     "AWS_CONTAINER_AUTHORIZATION_TOKEN": "token",
+	//     "AWS_CONTAINER_CREDENTIALS_FULL_URI": "http://host.docker.internal:50000/"
+	//   }
+	// }
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/99designs/aws-vault/v7/prompt"
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	"github.com/alecthomas/kingpin"
+)
+
+type ConfigureCliCommandInput struct {
+	ProfileNames []string
+	Suffix       string
+	Command      string
+	Prompt       string
+	DryRun       bool
+}
+
+func ConfigureConfigureCliCommand(app *kingpin.Application, a *AwsVault) {
+	input := ConfigureCliCommandInput{}
+
+	cmd := app.Command("configure-cli", "Add profiles to the AWS config that get credentials from aws-vault with credential_process, for the AWS CLI and SDKs.")
+
+	cmd.Flag("suffix", "Suffix of the name of the profile added for each profile").
+		Default("-vault").
+		StringVar(&input.Suffix)
+
+	cmd.Flag("command", "The aws-vault executable to run in credential_process").
+		Default("aws-vault").
+		StringVar(&input.Command)
+
+	cmd.Flag("dry-run", "Print the profiles instead of writing them to the AWS config").
+		BoolVar(&input.DryRun)
+
+	cmd.Arg("profile", "Names of the profiles to add profiles for. Defaults to every profile aws-vault can get credentials for").
+		HintAction(a.MustGetProfileNames).
+		StringsVar(&input.ProfileNames)
+
+	cmd.Action(func(c *kingpin.ParseContext) (err error) {
+		// credential_process doesn't run in a terminal, so a prompt driver set with --prompt is passed on
+		input.Prompt = a.promptDriver
+
+		f, err := a.AwsConfigFile()
+		if err != nil {
+			return err
+		}
+		keyring, err := a.Keyring()
+		if err != nil {
+			return err
+		}
+
+		err = ConfigureCliCommand(input, f, keyring)
+		fatalIfError(app, err, "configure-cli")
+		return nil
+	})
+}
+
+func ConfigureCliCommand(input ConfigureCliCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
+	if input.Suffix == "" {
+		// a profile with credential_process pointing at aws-vault for the same profile would call itself
+		return fmt.Errorf("--suffix can't be empty")
+	}
+	if input.Prompt != "" && !containsString(prompt.Available(), input.Prompt) {
+		return fmt.Errorf("Unknown prompt driver '%s', valid values are %s", input.Prompt, strings.Join(prompt.Available(), ", "))
+	}
+
+	profileNames := input.ProfileNames
+	if len(profileNames) == 0 {
+		var err error
+		if profileNames, err = vaultManagedProfileNames(f, keyring); err != nil {
+			return err
+		}
+	} else {
+		for i, name := range profileNames {
+			resolved, err := resolveProfileName(name, f, keyring, vault.Config{})
+			if err != nil {
+				return err
+			}
+			profileNames[i] = resolved
+		}
+	}
+
+	changed := false
+	for _, name := range profileNames {
+		profile, _ := f.ProfileSection(name)
+		managed := vault.ProfileSection{
+			Name:              name + input.Suffix,
+			Region:            profile.Region,
+			CredentialProcess: credentialProcessCommand(input.Command, input.Prompt, name),
+		}
+
+		if input.DryRun {
+			fmt.Printf("%s\n[profile %s]\ncredential_process = %s\n", vault.ManagedProfileMarker, managed.Name, managed.CredentialProcess)
+			if managed.Region != "" {
+				fmt.Printf("region = %s\n", managed.Region)
+			}
+			fmt.Println()
+			continue
+		}
+
+		if err := f.SetManagedProfile(managed); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", name, err.Error())
+			continue
+		}
+		fmt.Printf("Configured profile %s to use aws-vault with %s\n", managed.Name, name)
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return f.Save()
+}
+
+// vaultManagedProfileNames are the profiles in the config and the credentials in the keyring, leaving
+// out profiles that already use credential_process, including those written by configure-cli
+func vaultManagedProfileNames(f *vault.ConfigFile, k keyring.Keyring) ([]string, error) {
+	credentialNames, err := (&vault.CredentialKeyring{Keyring: k}).Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, profile := range f.ProfileSections() {
+		if profile.CredentialProcess == "" {
+			names = append(names, profile.Name)
+		}
+	}
+	for _, name := range credentialNames {
+		if _, ok := f.ProfileSection(name); !ok && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// credentialProcessCommand is the credential_process that exports the profile from aws-vault
+func credentialProcessCommand(command, promptDriver, profileName string) string {
+	args := []string{quoteCredentialProcessArg(command)}
+	if promptDriver != "" {
+		args = append(args, "--prompt="+promptDriver)
+	}
+	args = append(args, "export", "--format=json", quoteCredentialProcessArg(profileName))
+
+	return strings.Join(args, " ")
+}
+
+// quoteCredentialProcessArg quotes an argument containing spaces, as the AWS CLI and SDKs split credential_process on them
+func quoteCredentialProcessArg(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/alecthomas/kingpin"
+)
+
+type DoctorCommandInput struct {
+	Region string
+}
+
+type doctorStatus string
+
+const (
+	doctorOK   doctorStatus = "OK"
+	doctorWarn doctorStatus = "WARN"
+	doctorFail doctorStatus = "FAIL"
+)
+
+// doctorResult is the outcome of a single check, along with a suggestion on how to fix any problem found
+type doctorResult struct {
+	Status     doctorStatus
+	Check      string
+	Message    string
+	Suggestion string
+}
+
+// maxClockSkew is how far the local clock can drift from AWS before requests are rejected
+const maxClockSkew = 5 * time.Minute
+
+func ConfigureDoctorCommand(app *kingpin.Application, a *AwsVault) {
+	input := DoctorCommandInput{}
+
+	cmd := app.Command("doctor", "Check the environment for common problems.")
+
+	cmd.Flag("region", "The AWS region of the STS endpoint to check").
+		Envar("AWS_REGION").
+		HintOptions(awsRegions...).
+		StringVar(&input.Region)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		err := DoctorCommand(input, a)
+		fatalIfError(app, err, "doctor")
+		return nil
+	})
+}
+
+func DoctorCommand(input DoctorCommandInput, a *AwsVault) error {
+	results := []doctorResult{}
+	results = append(results, checkKeyring(a)...)
+	results = append(results, checkConfig(a)...)
+	results = append(results, checkEnv(a)...)
+	results = append(results, checkSTS(input.Region)...)
+
+	failures := 0
+	for _, r := range results {
+		fmt.Printf("[%s] %s: %s\n", r.Status, r.Check, r.Message)
+		if r.Suggestion != "" {
+			fmt.Printf("       %s\n", r.Suggestion)
+		}
+		if r.Status == doctorFail {
+			failures++
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d checks failed", failures)
+	}
+	return nil
+}
+
+func checkKeyring(a *AwsVault) []doctorResult {
+	kr, err := a.Keyring()
+	if err != nil {
+		if a.KeyringBackend == "" {
+			return []doctorResult{{doctorFail, "keyring", err.Error(), "Run 'aws-vault backends' to see why each backend can't be opened"}}
+		}
+		return []doctorResult{{doctorFail, "keyring", fmt.Sprintf("Can't open the %s backend: %s", a.KeyringBackend, err.Error()),
+			"Choose a different backend with --backend or AWS_VAULT_BACKEND"}}
+	}
+
+	if _, err = kr.Keys(); err != nil {
+		return []doctorResult{{doctorFail, "keyring", fmt.Sprintf("Can't read from the %s backend: %s", a.KeyringBackend, err.Error()),
+			"Check the keyring is unlocked and that aws-vault is allowed to access it"}}
+	}
+
+	results := []doctorResult{{doctorOK, "keyring", fmt.Sprintf("The %s backend is reachable", a.KeyringBackend), ""}}
+
+	sessions, err := (&vault.SessionKeyring{Keyring: kr}).GetAllMetadata()
+	if err != nil {
+		return append(results, doctorResult{doctorWarn, "sessions", fmt.Sprintf("Can't read sessions: %s", err.Error()),
+			"Run 'aws-vault clear' to remove all sessions"})
+	}
+	expired := 0
+	for _, s := range sessions {
+		if time.Now().After(s.Expiration) {
+			expired++
+		}
+	}
+	if expired > 0 {
+		results = append(results, doctorResult{doctorWarn, "sessions", fmt.Sprintf("%d of %d sessions have expired", expired, len(sessions)),
+			"Run 'aws-vault clear' to remove them"})
+	} else {
+		results = append(results, doctorResult{doctorOK, "sessions", fmt.Sprintf("%d sessions, none expired", len(sessions)), ""})
+	}
+
+	return results
+}
+
+func checkConfig(a *AwsVault) []doctorResult {
+	f, err := a.AwsConfigFile()
+	if err != nil {
+		return []doctorResult{{doctorFail, "config", err.Error(), "Fix the syntax of your AWS config file"}}
+	}
+
+	results := []doctorResult{}
+	for _, profileName := range f.ProfileNames() {
+		configLoader := vault.ConfigLoader{File: f, ActiveProfile: profileName}
+		if _, err := configLoader.LoadFromProfile(profileName); err != nil {
+			results = append(results, doctorResult{doctorFail, "config", fmt.Sprintf("Profile %s: %s", profileName, err.Error()),
+				fmt.Sprintf("Run 'aws-vault tree %s' to see how the profile is resolved", profileName)})
+		}
+	}
+	if len(results) == 0 {
+		results = append(results, doctorResult{doctorOK, "config", fmt.Sprintf("%d profiles loaded from %s", len(f.ProfileNames()), f.Path), ""})
+	}
+
+	return results
+}
+
+func checkEnv(a *AwsVault) []doctorResult {
+	results := []doctorResult{}
+	warn := func(message, suggestion string) {
+		results = append(results, doctorResult{doctorWarn, "environment", message, suggestion})
+	}
+
+	if v := os.Getenv("AWS_VAULT"); v != "" {
+		warn(fmt.Sprintf("Running inside an aws-vault session for %s", v), "Exit the subshell, or use --force to start a session inside it")
+	}
+
+	_, hasKeyID := os.LookupEnv("AWS_ACCESS_KEY_ID")
+	_, hasSecret := os.LookupEnv("AWS_SECRET_ACCESS_KEY")
+	if hasKeyID != hasSecret {
+		warn("Only one of AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY is set", "Set both, or unset both")
+	}
+	if hasKeyID && (os.Getenv("AWS_PROFILE") != "" || os.Getenv("AWS_DEFAULT_PROFILE") != "") {
+		warn("AWS_ACCESS_KEY_ID is set along with AWS_PROFILE, so the AWS SDKs ignore the profile", "Unset AWS_ACCESS_KEY_ID or AWS_PROFILE")
+	}
+	if !hasKeyID && (os.Getenv("AWS_SESSION_TOKEN") != "" || os.Getenv("AWS_SECURITY_TOKEN") != "") {
+		warn("AWS_SESSION_TOKEN is set without AWS_ACCESS_KEY_ID", "Unset AWS_SESSION_TOKEN and AWS_SECURITY_TOKEN")
+	}
+
+	region, defaultRegion := os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")
+	if region != "" && defaultRegion != "" && region != defaultRegion {
+		warn(fmt.Sprintf("AWS_REGION (%s) and AWS_DEFAULT_REGION (%s) differ", region, defaultRegion), "Set them to the same region, or unset one")
+	}
+
+	if f, err := a.AwsConfigFile(); err == nil {
+		for _, envVar := range []string{"AWS_PROFILE", "AWS_DEFAULT_PROFILE"} {
+			if p := os.Getenv(envVar); p != "" {
+				if _, ok := f.ProfileSection(p); !ok {
+					warn(fmt.Sprintf("%s is set to %s, which isn't in the config file", envVar, p), fmt.Sprintf("Unset %s or add the profile", envVar))
+				}
+			}
+		}
+	}
+
+	if len(results) == 0 {
+		results = append(results, doctorResult{doctorOK, "environment", "No conflicting AWS environment variables", ""})
+	}
+
+	return results
+}
+
+// stsEndpoint returns the STS endpoint URL for the region
+func stsEndpoint(region string) string {
+	if region == "" {
+		return "https://sts.amazonaws.com/"
+	}
+	return fmt.Sprintf("https://sts.%s.amazonaws.com/", region)
+}
+
+func checkSTS(region string) []doctorResult {
+	endpoint := stsEndpoint(region)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+	if err != nil {
+		return []doctorResult{{doctorFail, "network", err.Error(), ""}}
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return []doctorResult{{doctorFail, "network", fmt.Sprintf("Can't reach %s: %s", endpoint, err.Error()),
+			"Check your network connection, and HTTPS_PROXY and NO_PROXY if you use a proxy"}}
+	}
+	resp.Body.Close()
+
+	results := []doctorResult{{doctorOK, "network", fmt.Sprintf("Reached %s in %s", endpoint, time.Since(start).Truncate(time.Millisecond)), ""}}
+
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return append(results, doctorResult{doctorWarn, "clock", "Couldn't determine the time from the STS response", ""})
+	}
+
+	skew := time.Since(serverTime).Truncate(time.Second)
+	if skew < 0 {
+		skew = -skew
+	}
+	switch {
+	case skew > maxClockSkew:
+		results = append(results, doctorResult{doctorFail, "clock", fmt.Sprintf("The local clock is %s away from AWS, requests will be rejected", skew),
+			"Synchronise your clock, e.g. by enabling NTP"})
+	case skew > time.Minute:
+		results = append(results, doctorResult{doctorWarn, "clock", fmt.Sprintf("The local clock is %s away from AWS", skew),
+			"Synchronise your clock, e.g. by enabling NTP"})
+	default:
+		results = append(results, doctorResult{doctorOK, "clock", "The local clock is in sync with AWS", ""})
+	}
+
+	return results
+}
@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/alecthomas/kingpin"
+)
+
+// durationValue is a flag value parsed with vault.ParseDuration, which also accepts days such as 1d
+// and a number of seconds
+type durationValue time.Duration
+
+func newDurationValue(target *time.Duration) kingpin.Value {
+	return (*durationValue)(target)
+}
+
+func (d *durationValue) Set(s string) error {
+	v, err := vault.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = durationValue(v)
+	return nil
+}
+
+func (d *durationValue) String() string {
+	return vault.FormatDuration(time.Duration(*d))
+}
@@ -8,9 +8,9 @@ import (
 	"os"
 	osexec "os/exec"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/99designs/aws-vault/v7/iso8601"
@@ -19,6 +19,7 @@ import (
 	"github.com/99designs/keyring"
 	"github.com/alecthomas/kingpin"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	ini "gopkg.in/ini.v1"
 )
 
 type ExecCommandInput struct {
@@ -28,11 +29,40 @@ type ExecCommandInput struct {
 	StartEc2Server  bool
 	StartEcsServer  bool
 	Lazy            bool
+	TokenRotation   time.Duration
+	TokenInEnv      bool
+	Ec2AllowedPaths []string
+	Ec2ServerIPv6   bool
+	Ec2ServerProxy  bool
+	RateLimit       int
+	MaxClients      int
+	EnforceLimits   bool
+	IsolateNetwork  bool
+	RestrictToChild bool
+	PseudoConsole   bool
+	UnsetEnv        []string
+	KeepEnv         []string
+	EnvFile         string
+	EnvFileRemove   bool
+	Fifo            bool
+	Format          string
+	DisableIMDS     bool
+	SDKLoadConfig   bool
+	SetProfile      bool
+	LoginShell      bool
+	Nesting         NestingInput
 	JSONDeprecated  bool
 	Config          vault.Config
 	SessionDuration time.Duration
 	NoSession       bool
 	UseStdout       bool
+	DryRun          bool
+
+	// mergedConfigFile is the AWS config given to the command, when aws-vault merged several files
+	mergedConfigFile string
+
+	// run is how the command is run
+	run cmdOptions
 }
 
 func (input ExecCommandInput) validate() error {
@@ -51,6 +81,71 @@ func (input ExecCommandInput) validate() error {
 	if input.StartEcsServer && input.NoSession {
 		return fmt.Errorf("Can't use --ecs-server with --no-session")
 	}
+	if (input.RateLimit > 0 || input.MaxClients > 0 || input.EnforceLimits) && !hasBackgroundServer(input) {
+		return fmt.Errorf("Can't use --server-rate-limit, --server-max-clients or --server-enforce-limits without --ec2-server or --ecs-server")
+	}
+	if input.RestrictToChild && !hasBackgroundServer(input) {
+		return fmt.Errorf("Can't use --server-restrict-to-child without --ec2-server or --ecs-server")
+	}
+	if input.RestrictToChild && input.Ec2ServerProxy {
+		// requests come from the endpoint proxy, which isn't started by the command
+		return fmt.Errorf("Can't use --server-restrict-to-child with --ec2-server-proxy")
+	}
+	if input.RestrictToChild && !server.SupportsProcessTree() {
+		return fmt.Errorf("--server-restrict-to-child isn't supported on %s", runtime.GOOS)
+	}
+	if len(input.Ec2AllowedPaths) > 0 && !input.StartEc2Server {
+		return fmt.Errorf("Can't use --ec2-server-allow-path without --ec2-server")
+	}
+	if input.Ec2ServerIPv6 && !input.StartEc2Server {
+		return fmt.Errorf("Can't use --ec2-server-ipv6 without --ec2-server")
+	}
+	if input.Ec2ServerProxy && !input.StartEc2Server {
+		return fmt.Errorf("Can't use --ec2-server-proxy without --ec2-server")
+	}
+	if input.TokenRotation > 0 && !input.StartEcsServer {
+		return fmt.Errorf("Can't use --ecs-token-rotation without --ecs-server")
+	}
+	if input.TokenInEnv && !input.StartEcsServer {
+		return fmt.Errorf("Can't use --ecs-token-env without --ecs-server")
+	}
+	if input.TokenInEnv && input.TokenRotation > 0 {
+		return fmt.Errorf("Can't use --ecs-token-env with --ecs-token-rotation, which passes the token in a file")
+	}
+	if input.IsolateNetwork && !supportsIsolatedNetwork() {
+		return fmt.Errorf("--isolate-network is only supported on Linux")
+	}
+	if input.PseudoConsole && !supportsPseudoConsole() {
+		return fmt.Errorf("--pty is only supported on Windows 10 1809 and later")
+	}
+	if input.EnvFileRemove && input.EnvFile == "" {
+		return fmt.Errorf("Can't use --env-file-remove without --env-file")
+	}
+	if input.Fifo && !supportsFifo() {
+		return fmt.Errorf("--fifo isn't supported on %s", runtime.GOOS)
+	}
+	if input.Fifo && hasBackgroundServer(input) {
+		return fmt.Errorf("Can't use --fifo with --ec2-server or --ecs-server")
+	}
+	if input.DisableIMDS && input.StartEc2Server {
+		return fmt.Errorf("Can't use --disable-imds with --ec2-server")
+	}
+	if input.Format == ExecFormatFiles && hasBackgroundServer(input) {
+		return fmt.Errorf("Can't use --format=%s with --ec2-server or --ecs-server", ExecFormatFiles)
+	}
+	if input.Format == ExecFormatFiles && input.SetProfile {
+		// SDKs would look for the profile's credentials in the file, or use its role settings
+		return fmt.Errorf("Can't use --format=%s with --set-profile", ExecFormatFiles)
+	}
+	if input.Format == ExecFormatFiles && input.Fifo {
+		return fmt.Errorf("Can't use --format=%s with --fifo", ExecFormatFiles)
+	}
+	if input.IsolateNetwork && input.StartEc2Server {
+		return fmt.Errorf("Can't use --isolate-network with --ec2-server")
+	}
+	if input.DryRun && input.JSONDeprecated {
+		return fmt.Errorf("Can't use --dry-run with --json")
+	}
 	if input.StartEcsServer && input.Config.MfaPromptMethod == "terminal" {
 		return fmt.Errorf("Can't use --prompt=terminal with --ecs-server. Specify a different prompt driver")
 	}
@@ -61,6 +156,12 @@ func (input ExecCommandInput) validate() error {
 	return nil
 }
 
+// Ways of passing credentials to the command with exec --format
+var (
+	ExecFormatEnv   = "env"
+	ExecFormatFiles = "files"
+)
+
 func hasBackgroundServer(input ExecCommandInput) bool {
 	return input.StartEcsServer || input.StartEc2Server
 }
@@ -72,13 +173,17 @@ func ConfigureExecCommand(app *kingpin.Application, a *AwsVault) {
 
 	cmd.Flag("duration", "Duration of the temporary or assume-role session. Defaults to 1h").
 		Short('d').
-		DurationVar(&input.SessionDuration)
+		SetValue(newDurationValue(&input.SessionDuration))
+
+	cmd.Flag("renew-before", "Renew cached sessions that expire within this duration. Defaults to 5m, or AWS_MIN_TTL").
+		SetValue(newDurationValue(&input.Config.RenewBefore))
 
 	cmd.Flag("no-session", "Skip creating STS session with GetSessionToken").
 		Short('n').
 		BoolVar(&input.NoSession)
 
 	cmd.Flag("region", "The AWS region").
+		HintOptions(awsRegions...).
 		StringVar(&input.Config.Region)
 
 	cmd.Flag("mfa-token", "The MFA token to use").
@@ -97,15 +202,98 @@ func ConfigureExecCommand(app *kingpin.Application, a *AwsVault) {
 	cmd.Flag("ec2-server", "Run a EC2 metadata server in the background for credentials").
 		BoolVar(&input.StartEc2Server)
 
+	cmd.Flag("ec2-server-allow-path", fmt.Sprintf("When using --ec2-server, a metadata path prefix to respond to. Can be repeated. Defaults to %s", strings.Join(server.DefaultEc2AllowedPaths, ", "))).
+		StringsVar(&input.Ec2AllowedPaths)
+
+	cmd.Flag("ec2-server-ipv6", "When using --ec2-server, serve it over IPv6, and point the command's SDKs at it in IPv6 endpoint mode").
+		BoolVar(&input.Ec2ServerIPv6)
+
+	cmd.Flag("ec2-server-proxy", "When using --ec2-server, serve it on 169.254.169.254 through a proxy run as root, for SDKs that ignore AWS_EC2_METADATA_SERVICE_ENDPOINT").
+		Envar("AWS_VAULT_EC2_SERVER_PROXY").
+		BoolVar(&input.Ec2ServerProxy)
+
 	cmd.Flag("ecs-server", "Run a ECS credential server in the background for credentials (the SDK or app must support AWS_CONTAINER_CREDENTIALS_FULL_URI)").
 		BoolVar(&input.StartEcsServer)
 
 	cmd.Flag("lazy", "When using --ecs-server, lazily fetch credentials").
 		BoolVar(&input.Lazy)
 
+	cmd.Flag("ecs-token-rotation", "When using --ecs-server, replace the auth token at this interval").
+		SetValue(newDurationValue(&input.TokenRotation))
+
+	cmd.Flag("ecs-token-env", "When using --ecs-server, pass the auth token in AWS_CONTAINER_AUTHORIZATION_TOKEN, for SDKs that don't support AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE").
+		Envar("AWS_VAULT_ECS_TOKEN_ENV").
+		BoolVar(&input.TokenInEnv)
+
+	cmd.Flag("server-rate-limit", "When using --ec2-server or --ecs-server, the number of requests per minute to allow before logging a warning").
+		IntVar(&input.RateLimit)
+
+	cmd.Flag("server-max-clients", "When using --ec2-server or --ecs-server, the number of distinct clients to allow before logging a warning").
+		IntVar(&input.MaxClients)
+
+	cmd.Flag("server-enforce-limits", "Refuse requests over --server-rate-limit and --server-max-clients instead of only logging them").
+		BoolVar(&input.EnforceLimits)
+
+	cmd.Flag("isolate-network", "Run the command in its own network namespace, only able to reach AWS endpoints and the credential server. Linux only").
+		BoolVar(&input.IsolateNetwork)
+
+	cmd.Flag("pty", "Run the command in a pseudo console, so interactive terminal programs get VT sequences and resizing. Windows only").
+		BoolVar(&input.PseudoConsole)
+
+	cmd.Flag("unset-env", "Also remove this variable from the environment of the command. Can be repeated, and can end with * to match a prefix").
+		Envar("AWS_VAULT_UNSET_ENV").
+		StringsVar(&input.UnsetEnv)
+
+	cmd.Flag("keep-env", fmt.Sprintf("Keep this variable, which is otherwise removed from the environment of the command. Can be repeated. Removed by default are %s", strings.Join(defaultUnsetEnv, ", "))).
+		Envar("AWS_VAULT_KEEP_ENV").
+		StringsVar(&input.KeepEnv)
+
+	cmd.Flag("env-file", "Also write the AWS_* variables of the command's environment to this file, only readable by you, e.g. for docker --env-file").
+		StringVar(&input.EnvFile)
+
+	cmd.Flag("env-file-remove", "Remove the --env-file when the command exits").
+		BoolVar(&input.EnvFileRemove)
+
+	cmd.Flag("format", fmt.Sprintf("How to pass credentials to the command. Valid values are %s, and %s for a temporary file in AWS_SHARED_CREDENTIALS_FILE", ExecFormatEnv, ExecFormatFiles)).
+		Default(ExecFormatEnv).
+		EnumVar(&input.Format, ExecFormatEnv, ExecFormatFiles)
+
+	cmd.Flag("fifo", fmt.Sprintf("Pass the credentials to the command once through a FIFO at the path in %s, rather than in its environment", credentialsFifoEnv)).
+		BoolVar(&input.Fifo)
+
+	cmd.Flag("disable-imds", "Set AWS_EC2_METADATA_DISABLED=true for the command, so SDKs don't fall back to the EC2 instance metadata service").
+		Envar("AWS_VAULT_DISABLE_IMDS").
+		BoolVar(&input.DisableIMDS)
+
+	cmd.Flag("sdk-load-config", "Set AWS_SDK_LOAD_CONFIG=1 for the command, so SDKs read settings such as the region from the AWS config").
+		Envar("AWS_VAULT_SDK_LOAD_CONFIG").
+		BoolVar(&input.SDKLoadConfig)
+
+	cmd.Flag("set-profile", "Set AWS_PROFILE to the profile for the command, so SDKs read its settings from the AWS config").
+		Envar("AWS_VAULT_SET_PROFILE").
+		BoolVar(&input.SetProfile)
+
+	cmd.Flag("login-shell", "When starting a subshell, start it as a login shell, so it reads the same startup files as a terminal").
+		Envar("AWS_VAULT_LOGIN_SHELL").
+		BoolVar(&input.LoginShell)
+
+	cmd.Flag("shell-rc", "When starting a subshell, source this file after the shell's startup files. Overrides shell_rc in the profile").
+		StringVar(&input.Config.ShellRC)
+
+	input.Nesting.configureFlags(cmd)
+
+	cmd.Flag("dry-run", "Print how the credentials would be got, with the role hops, MFA, durations and cached sessions, without requesting them or running the command").
+		BoolVar(&input.DryRun)
+
+	cmd.Flag("server-restrict-to-child", "When using --ec2-server or --ecs-server, only respond to requests from the command and the processes it starts").
+		BoolVar(&input.RestrictToChild)
+
 	cmd.Flag("stdout", "Print the SSO link to the terminal without automatically opening the browser").
 		BoolVar(&input.UseStdout)
 
+	cmd.Flag("browser", "Command to open the SSO link with, rather than the default browser. Overrides sso_browser_command in the profile").
+		StringVar(&input.Config.SSOBrowserCommand)
+
 	cmd.Arg("profile", "Name of the profile").
 		Required().
 		HintAction(a.MustGetProfileNames).
@@ -123,6 +311,8 @@ func ConfigureExecCommand(app *kingpin.Application, a *AwsVault) {
 		input.Config.AssumeRoleDuration = input.SessionDuration
 		input.Config.SSOUseStdout = input.UseStdout
 
+		input.Config = a.globalConfig(input.Config)
+
 		f, err := a.AwsConfigFile()
 		if err != nil {
 			return err
@@ -132,13 +322,14 @@ func ConfigureExecCommand(app *kingpin.Application, a *AwsVault) {
 			return err
 		}
 
-		if input.JSONDeprecated {
+		if input.JSONDeprecated && !input.DryRun {
 			exportCommandInput := ExportCommandInput{
 				ProfileName:     input.ProfileName,
 				Format:          "json",
 				Config:          input.Config,
 				SessionDuration: input.SessionDuration,
 				NoSession:       input.NoSession,
+				Nesting:         input.Nesting,
 			}
 
 			err = ExportCommand(exportCommandInput, f, keyring)
@@ -146,22 +337,45 @@ func ConfigureExecCommand(app *kingpin.Application, a *AwsVault) {
 			err = ExecCommand(input, f, keyring)
 		}
 
-		app.FatalIfError(err, "exec")
+		fatalIfError(app, err, "exec")
 		return nil
 	})
 }
 
+// Exec runs a command with the credentials of a profile, see NewExec. When the command fails, Run returns
+// an *ExitError with its exit status
+type Exec struct {
+	env CommandEnv
+}
+
+// NewExec returns the exec command, using the keyring, AWS config and stdio of the env
+func NewExec(env CommandEnv) *Exec {
+	return &Exec{env: env.withDefaults()}
+}
+
 func ExecCommand(input ExecCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
-	if os.Getenv("AWS_VAULT") != "" {
-		return fmt.Errorf("aws-vault sessions should be nested with care, unset AWS_VAULT to force")
-	}
+	return NewExec(CommandEnv{Keyring: keyring, ConfigFile: f, replaceProcess: true}).Run(input)
+}
 
+// Run runs the command of the input with the credentials of its profile
+func (c *Exec) Run(input ExecCommandInput) error {
+	ctx, f, keyring := c.env.Context, c.env.ConfigFile, c.env.Keyring
+	input.run = cmdOptions{stdio: c.env.Stdio, pseudoConsole: input.PseudoConsole}
 	err := input.validate()
 	if err != nil {
 		return err
 	}
 
-	vault.UseSession = !input.NoSession
+	if err = input.Nesting.checkNesting(); err != nil {
+		return err
+	}
+
+	input.ProfileName, err = resolveProfileName(input.ProfileName, f, keyring, input.Config)
+	if err != nil {
+		return err
+	}
+
+	input.Config.NoSession = input.NoSession
 
 	configLoader := vault.ConfigLoader{
 		File:          f,
@@ -173,115 +387,390 @@ func ExecCommand(input ExecCommandInput, f *vault.ConfigFile, keyring keyring.Ke
 		return fmt.Errorf("Error loading config: %w", err)
 	}
 
+	if input.DryRun {
+		return printExecDryRun(c.env.Stdio.Out, input, config, keyring)
+	}
+
+	// the AWS SDKs and CLI read only one config file, so the command is given the files merged into one
+	if len(f.Paths) > 1 {
+		if input.mergedConfigFile, err = writeMergedConfigFile(f); err != nil {
+			return err
+		}
+	}
+
 	ckr := &vault.CredentialKeyring{Keyring: keyring}
-	credsProvider, err := vault.NewTempCredentialsProvider(config, ckr)
+	credsProvider, err := input.Nesting.credentialsProvider(config, ckr)
 	if err != nil {
 		return fmt.Errorf("Error getting temporary credentials: %w", err)
 	}
 
+	ctx = server.ContextWithWarnings(ctx, warningWriter(c.env.Stdio.Err))
+	if input.RateLimit > 0 || input.MaxClients > 0 {
+		ctx = server.ContextWithRequestGuard(ctx, &server.RequestGuard{
+			RequestsPerMinute: input.RateLimit,
+			Burst:             input.RateLimit,
+			MaxClients:        input.MaxClients,
+			Enforce:           input.EnforceLimits,
+		})
+	}
+
+	if input.RestrictToChild {
+		input.run.processTree = &server.ProcessTreeFilter{}
+		ctx = server.ContextWithProcessTreeFilter(ctx, input.run.processTree)
+	}
+
 	if input.StartEc2Server {
-		return execEc2Server(input, config, credsProvider)
+		return execEc2Server(ctx, input, config, credsProvider)
 	}
 
 	if input.StartEcsServer {
-		return execEcsServer(input, config, credsProvider)
+		return execEcsServer(ctx, input, config, credsProvider)
 	}
 
-	return execEnvironment(input, config, credsProvider)
+	return execEnvironment(ctx, input, config, credsProvider, c.env.replaceProcess)
 }
 
-func updateEnvForAwsVault(env environ, profileName string, region string) environ {
-	env.Unset("AWS_ACCESS_KEY_ID")
-	env.Unset("AWS_SECRET_ACCESS_KEY")
-	env.Unset("AWS_SESSION_TOKEN")
-	env.Unset("AWS_SECURITY_TOKEN")
-	env.Unset("AWS_CREDENTIAL_FILE")
-	env.Unset("AWS_DEFAULT_PROFILE")
-	env.Unset("AWS_PROFILE")
-	env.Unset("AWS_SDK_LOAD_CONFIG")
+// defaultUnsetEnv are the variables removed from the environment of the command, as they would
+// override or conflict with the credentials aws-vault provides
+var defaultUnsetEnv = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_SECURITY_TOKEN",
+	"AWS_CREDENTIAL_FILE",
+	"AWS_DEFAULT_PROFILE",
+	"AWS_PROFILE",
+	"AWS_SDK_LOAD_CONFIG",
+}
+
+// unsetEnvVars lists the variables to remove from the environment of the command, with --unset-env
+// added to the defaults and --keep-env taken out. Values of the environment variables may be comma separated
+func (input ExecCommandInput) unsetEnvVars() []string {
+	keep := splitEnvList(input.KeepEnv)
+	unset := []string{}
+	for _, key := range append(append([]string{}, defaultUnsetEnv...), splitEnvList(input.UnsetEnv)...) {
+		if !containsString(keep, key) && !containsString(unset, key) {
+			unset = append(unset, key)
+		}
+	}
+	return unset
+}
+
+func splitEnvList(values []string) []string {
+	list := []string{}
+	for _, v := range values {
+		for _, key := range strings.Split(v, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				list = append(list, key)
+			}
+		}
+	}
+	return list
+}
+
+func updateEnvForAwsVault(ctx context.Context, env environ, profileName string, region string, unset []string) environ {
+	for _, key := range unset {
+		env.UnsetMatching(key)
+	}
 
 	env.Set("AWS_VAULT", profileName)
 
 	if region != "" {
 		// AWS_REGION is used by most SDKs. But boto3 (Python SDK) uses AWS_DEFAULT_REGION
 		// See https://docs.aws.amazon.com/sdkref/latest/guide/feature-region.html
-		log.Printf("Setting subprocess env: AWS_REGION=%s, AWS_DEFAULT_REGION=%s", region, region)
+		verbosef("Setting subprocess env: AWS_REGION=%s, AWS_DEFAULT_REGION=%s", region, region)
 		env.Set("AWS_REGION", region)
 		env.Set("AWS_DEFAULT_REGION", region)
 	}
 
+	if tracer := vault.TracerFromContext(ctx); tracer != nil {
+		// lets traced SDKs in the subprocess continue the trace
+		env.Set("TRACEPARENT", tracer.Root().Traceparent())
+	}
+
 	return env
 }
 
-func execEc2Server(input ExecCommandInput, config *vault.Config, credsProvider aws.CredentialsProvider) error {
-	fmt.Fprintf(os.Stderr, "aws-vault: Starting an EC2 credential server.\n")
-	if err := server.StartEc2CredentialsServer(context.TODO(), credsProvider, config.Region); err != nil {
-		return fmt.Errorf("Failed to start credential server: %w", err)
+func execEc2Server(ctx context.Context, input ExecCommandInput, config *vault.Config, credsProvider aws.CredentialsProvider) error {
+	infof("Starting an EC2 credential server.")
+
+	var endpoint string
+	if input.Ec2ServerProxy {
+		if err := server.StartEc2CredentialsServer(ctx, credsProvider, config.Region, input.Ec2AllowedPaths, input.Ec2ServerIPv6); err != nil {
+			return fmt.Errorf("Failed to start credential server: %w", err)
+		}
+		if input.Ec2ServerIPv6 {
+			endpoint = server.Ec2MetadataEndpointIPv6URL
+		}
+	} else {
+		addr := "127.0.0.1:0"
+		if input.Ec2ServerIPv6 {
+			addr = "[::1]:0"
+		}
+		ec2Server, err := server.NewEc2Server(ctx, credsProvider, config.Region, input.Ec2AllowedPaths, addr)
+		if err != nil {
+			return fmt.Errorf("Failed to start credential server: %w", err)
+		}
+		go func() {
+			err := ec2Server.Serve()
+			if err != http.ErrServerClosed { // ErrServerClosed is a graceful close
+				log.Fatalf("ec2 server: %s", err.Error())
+			}
+		}()
+		onExit(func() { shutdownServer("ec2", ec2Server.Shutdown) })
+		endpoint = ec2Server.BaseURL()
 	}
 
 	env := environ(os.Environ())
-	env = updateEnvForAwsVault(env, input.ProfileName, config.Region)
+	env = input.updateEnv(ctx, env, config.Region)
+	if input.Ec2ServerIPv6 {
+		// for IPv6-only environments, where SDKs can't reach the IPv4 endpoint
+		verbosef("Setting subprocess env: AWS_EC2_METADATA_SERVICE_ENDPOINT_MODE=IPv6")
+		env.Set("AWS_EC2_METADATA_SERVICE_ENDPOINT_MODE", "IPv6")
+	}
+	if endpoint != "" {
+		verbosef("Setting subprocess env: AWS_EC2_METADATA_SERVICE_ENDPOINT=%s", endpoint)
+		env.Set("AWS_EC2_METADATA_SERVICE_ENDPOINT", endpoint)
+	}
+	if err := input.writeEnvFile(env); err != nil {
+		return err
+	}
 
-	return doRunCmd(input.Command, input.Args, env)
+	input, _, err := input.withSubshell(config, &env)
+	if err != nil {
+		return err
+	}
+
+	return doRunCmd(input.Command, input.Args, env, input.run)
 }
 
-func execEcsServer(input ExecCommandInput, config *vault.Config, credsProvider aws.CredentialsProvider) error {
-	ecsServer, err := server.NewEcsServer(context.TODO(), credsProvider, config, "", 0, input.Lazy)
+func execEcsServer(ctx context.Context, input ExecCommandInput, config *vault.Config, credsProvider aws.CredentialsProvider) error {
+	ecsServer, err := server.NewEcsServer(ctx, credsProvider, config, "", 0, input.Lazy)
 	if err != nil {
 		return err
 	}
 	go func() {
-		err = ecsServer.Serve()
+		err := ecsServer.Serve()
 		if err != http.ErrServerClosed { // ErrServerClosed is a graceful close
 			log.Fatalf("ecs server: %s", err.Error())
 		}
 	}()
+	onExit(func() { shutdownServer("ecs", ecsServer.Shutdown) })
 
-	log.Println("Setting subprocess env AWS_CONTAINER_CREDENTIALS_FULL_URI, AWS_CONTAINER_AUTHORIZATION_TOKEN")
 	env := environ(os.Environ())
-	env = updateEnvForAwsVault(env, input.ProfileName, config.Region)
+	env = input.updateEnv(ctx, env, config.Region)
 	env.Set("AWS_CONTAINER_CREDENTIALS_FULL_URI", ecsServer.BaseURL())
-	env.Set("AWS_CONTAINER_AUTHORIZATION_TOKEN", ecsServer.AuthToken())
+	if input.TokenInEnv {
+		verbosef("Setting subprocess env AWS_CONTAINER_CREDENTIALS_FULL_URI, AWS_CONTAINER_AUTHORIZATION_TOKEN")
+		env.Set("AWS_CONTAINER_AUTHORIZATION_TOKEN", ecsServer.AuthToken())
+	} else {
+		// the token is kept out of the environment, where other processes of the user can read it
+		tokenFile, err := startTokenFile(ctx, ecsServer, input.TokenRotation)
+		if err != nil {
+			return err
+		}
+		verbosef("Setting subprocess env AWS_CONTAINER_CREDENTIALS_FULL_URI, AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE")
+		env.Set("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", tokenFile)
+	}
+
+	if err := input.writeEnvFile(env); err != nil {
+		return err
+	}
 
 	helpMsg := "Started an ECS credential server; your app's AWS sdk must support AWS_CONTAINER_CREDENTIALS_FULL_URI."
 	if input.Command == "" {
-		fmt.Fprintf(os.Stderr, "aws-vault: %s\n", helpMsg)
+		infof("%s", helpMsg)
 	} else {
 		log.Println(helpMsg)
 	}
 
-	return doRunCmd(input.Command, input.Args, env)
+	if input, _, err = input.withSubshell(config, &env); err != nil {
+		return err
+	}
+
+	if input.IsolateNetwork {
+		return doRunIsolatedCmd(input.Command, input.Args, env, []string{strings.TrimPrefix(ecsServer.BaseURL(), "http://")}, input.run)
+	}
+
+	return doRunCmd(input.Command, input.Args, env, input.run)
 }
 
-func execEnvironment(input ExecCommandInput, config *vault.Config, credsProvider aws.CredentialsProvider) error {
-	creds, err := credsProvider.Retrieve(context.TODO())
+// execEnvironment runs the command with the credentials in its environment. With replaceProcess, aws-vault
+// is replaced by the command where it can be
+func execEnvironment(ctx context.Context, input ExecCommandInput, config *vault.Config, credsProvider aws.CredentialsProvider, replaceProcess bool) error {
+	creds, err := credsProvider.Retrieve(ctx)
 	if err != nil {
 		return fmt.Errorf("Failed to get credentials for %s: %w", input.ProfileName, err)
 	}
 
 	env := environ(os.Environ())
-	env = updateEnvForAwsVault(env, input.ProfileName, config.Region)
+	env = input.updateEnv(ctx, env, config.Region)
 
-	log.Println("Setting subprocess env: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY")
-	env.Set("AWS_ACCESS_KEY_ID", creds.AccessKeyID)
-	env.Set("AWS_SECRET_ACCESS_KEY", creds.SecretAccessKey)
+	if input.Fifo {
+		fifoPath, err := startCredentialsFifo(creds)
+		if err != nil {
+			return err
+		}
+		verbosef("Setting subprocess env: %s", credentialsFifoEnv)
+		env.Set(credentialsFifoEnv, fifoPath)
+	} else if input.Format == ExecFormatFiles {
+		credentialsFile, err := writeTempCredentialsFile(creds)
+		if err != nil {
+			return err
+		}
+		verbosef("Setting subprocess env: AWS_SHARED_CREDENTIALS_FILE")
+		env.Set("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+	} else {
+		verbosef("Setting subprocess env: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY")
+		env.Set("AWS_ACCESS_KEY_ID", creds.AccessKeyID)
+		env.Set("AWS_SECRET_ACCESS_KEY", creds.SecretAccessKey)
 
-	if creds.SessionToken != "" {
-		log.Println("Setting subprocess env: AWS_SESSION_TOKEN")
-		env.Set("AWS_SESSION_TOKEN", creds.SessionToken)
+		if creds.SessionToken != "" {
+			verbosef("Setting subprocess env: AWS_SESSION_TOKEN")
+			env.Set("AWS_SESSION_TOKEN", creds.SessionToken)
+		}
 	}
 	if creds.CanExpire {
-		log.Println("Setting subprocess env: AWS_CREDENTIAL_EXPIRATION")
+		verbosef("Setting subprocess env: AWS_CREDENTIAL_EXPIRATION")
 		env.Set("AWS_CREDENTIAL_EXPIRATION", iso8601.Format(creds.Expires))
 	}
 
-	if !supportsExecSyscall() {
-		return doRunCmd(input.Command, input.Args, env)
+	if err := input.writeEnvFile(env); err != nil {
+		return err
+	}
+
+	input, subshellFiles, err := input.withSubshell(config, &env)
+	if err != nil {
+		return err
+	}
+
+	if input.IsolateNetwork {
+		return doRunIsolatedCmd(input.Command, input.Args, env, nil, input.run)
+	}
+
+	// aws-vault waits for the command rather than being replaced by it, to write the FIFO and remove files when it exits
+	if !replaceProcess || !supportsExecSyscall() || !input.run.stdio.isOS() || input.EnvFileRemove || input.Fifo || input.Format == ExecFormatFiles || subshellFiles || input.mergedConfigFile != "" {
+		return doRunCmd(input.Command, input.Args, env, input.run)
 	}
 
 	return doExecSyscall(input.Command, input.Args, env)
 }
 
+// updateEnv prepares the environment of the command, with the options of exec applied
+func (input ExecCommandInput) updateEnv(ctx context.Context, env environ, region string) environ {
+	env = updateEnvForAwsVault(ctx, env, input.ProfileName, region, input.unsetEnvVars())
+
+	// stops SDKs falling back to the instance metadata service when the credentials don't work, which
+	// would otherwise be slow to time out on machines that aren't EC2 instances
+	if input.DisableIMDS {
+		verbosef("Setting subprocess env: AWS_EC2_METADATA_DISABLED=true")
+		env.Set("AWS_EC2_METADATA_DISABLED", "true")
+	}
+
+	// SDKs use credentials in the environment before those of the profile, so they still use aws-vault's
+	if input.SDKLoadConfig {
+		verbosef("Setting subprocess env: AWS_SDK_LOAD_CONFIG=1")
+		env.Set("AWS_SDK_LOAD_CONFIG", "1")
+	}
+	if input.SetProfile {
+		verbosef("Setting subprocess env: AWS_PROFILE=%s", input.ProfileName)
+		env.Set("AWS_PROFILE", input.ProfileName)
+	}
+	if input.mergedConfigFile != "" {
+		verbosef("Setting subprocess env: AWS_CONFIG_FILE=%s", input.mergedConfigFile)
+		env.Set("AWS_CONFIG_FILE", input.mergedConfigFile)
+	}
+
+	return env
+}
+
+// writeTempCredentialsFile writes the credentials as the default profile of a shared credentials file,
+// in a directory only accessible by the current user which is removed when aws-vault exits
+func writeTempCredentialsFile(creds aws.Credentials) (string, error) {
+	dir, err := os.MkdirTemp("", "aws-vault")
+	if err != nil {
+		return "", err
+	}
+	onExit(func() { os.RemoveAll(dir) })
+
+	f := ini.Empty()
+	s, err := f.NewSection("default")
+	if err != nil {
+		return "", err
+	}
+	mustNewKey(s, "aws_access_key_id", creds.AccessKeyID)
+	mustNewKey(s, "aws_secret_access_key", creds.SecretAccessKey)
+	mustNewKey(s, "aws_session_token", creds.SessionToken)
+
+	path := filepath.Join(dir, "credentials")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err = f.WriteTo(file); err != nil {
+		return "", fmt.Errorf("Failed to write credentials file: %w", err)
+	}
+
+	return path, nil
+}
+
+// writeMergedConfigFile writes the config files merged into one, to a temporary file that is removed when aws-vault exits
+func writeMergedConfigFile(f *vault.ConfigFile) (string, error) {
+	dir, err := os.MkdirTemp("", "aws-vault")
+	if err != nil {
+		return "", err
+	}
+	onExit(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if err = f.WriteMerged(file); err != nil {
+		return "", fmt.Errorf("Failed to write merged config file: %w", err)
+	}
+
+	return path, nil
+}
+
+// writeEnvFile writes the AWS_* variables of env to --env-file, as KEY=value lines
+func (input ExecCommandInput) writeEnvFile(env environ) error {
+	if input.EnvFile == "" {
+		return nil
+	}
+
+	var b strings.Builder
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "AWS_") && !strings.ContainsAny(kv, "\r\n") {
+			b.WriteString(kv + "\n")
+		}
+	}
+
+	file, err := os.OpenFile(input.EnvFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to write --env-file: %w", err)
+	}
+	defer file.Close()
+	// an existing file keeps its permissions when opened
+	if err = file.Chmod(0600); err != nil {
+		return fmt.Errorf("Failed to write --env-file: %w", err)
+	}
+	if _, err = file.WriteString(b.String()); err != nil {
+		return fmt.Errorf("Failed to write --env-file: %w", err)
+	}
+
+	log.Printf("Wrote AWS_* variables to %s", input.EnvFile)
+	if input.EnvFileRemove {
+		path := input.EnvFile
+		onExit(func() { os.Remove(path) })
+	}
+
+	return nil
+}
+
 // environ is a slice of strings representing the environment, in the form "key=value".
 type environ []string
 
@@ -296,12 +785,87 @@ func (e *environ) Unset(key string) {
 	}
 }
 
+// UnsetMatching unsets all environment variables with the key, or starting with the prefix if the pattern ends with *
+func (e *environ) UnsetMatching(pattern string) {
+	if !strings.HasSuffix(pattern, "*") {
+		e.Unset(pattern)
+		return
+	}
+
+	prefix := strings.TrimSuffix(pattern, "*")
+	kept := (*e)[:0]
+	for _, kv := range *e {
+		if key, _, _ := strings.Cut(kv, "="); !strings.HasPrefix(key, prefix) {
+			kept = append(kept, kv)
+		}
+	}
+	*e = kept
+}
+
 // Set adds an environment variable, replacing any existing ones of the same key
 func (e *environ) Set(key, val string) {
 	e.Unset(key)
 	*e = append(*e, key+"="+val)
 }
 
+// Get returns the value of an environment variable, and whether it's set
+func (e *environ) Get(key string) (string, bool) {
+	for _, kv := range *e {
+		if strings.HasPrefix(kv, key+"=") {
+			return strings.TrimPrefix(kv, key+"="), true
+		}
+	}
+	return "", false
+}
+
+// writeTokenFile replaces the contents of the token file in one step, so readers never see a partial token
+func writeTokenFile(path, token string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(token), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// startTokenFile writes the ECS server auth token to a file only readable by the current user,
+// and replaces it with a new token at each interval, if there is one. The file is removed when aws-vault exits
+func startTokenFile(ctx context.Context, ecsServer *server.EcsServer, interval time.Duration) (string, error) {
+	dir, err := os.MkdirTemp("", "aws-vault")
+	if err != nil {
+		return "", err
+	}
+	onExit(func() { os.RemoveAll(dir) })
+
+	tokenFile := filepath.Join(dir, "ecs-token")
+	if err = writeTokenFile(tokenFile, ecsServer.AuthToken()); err != nil {
+		return "", err
+	}
+
+	if interval <= 0 {
+		return tokenFile, nil
+	}
+
+	ticker := time.NewTicker(interval)
+	onExit(ticker.Stop)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := writeTokenFile(tokenFile, ecsServer.RotateAuthToken()); err != nil {
+				log.Printf("Failed to write rotated ECS server token: %s", err.Error())
+				continue
+			}
+			log.Printf("Rotated ECS server auth token")
+		}
+	}()
+
+	return tokenFile, nil
+}
+
 func getDefaultShell() string {
 	command := os.Getenv("SHELL")
 	if command == "" {
@@ -314,66 +878,95 @@ func getDefaultShell() string {
 	return command
 }
 
-func doRunCmd(command string, args []string, env []string) error {
+// cmdOptions are how doRunCmd runs a command
+type cmdOptions struct {
+	// stdio is given to the command
+	stdio Stdio
+
+	// pseudoConsole runs the command in a pseudo console, set with --pty
+	pseudoConsole bool
+
+	// processTree is rooted at the command once it starts, for --server-restrict-to-child
+	processTree *server.ProcessTreeFilter
+}
+
+func doRunCmd(command string, args []string, env []string, opts cmdOptions) error {
 	if command == "" {
 		command = getDefaultShell()
-		fmt.Fprintf(os.Stderr, "aws-vault: Starting a subshell %s, use `exit` to exit the subshell\n", command)
+		infof("Starting a subshell %s, use `exit` to exit the subshell", command)
 	}
 
 	log.Printf("Starting subprocess: %s %s", command, strings.Join(args, " "))
 
 	cmd := osexec.Command(command, args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
 	cmd.Env = env
+	setCmdStdio(cmd, opts.stdio)
+
+	if opts.pseudoConsole {
+		return runCmdInPseudoConsole(cmd, opts.processTree)
+	}
+	return runCmd(cmd, opts.processTree)
+}
+
+// setCmdStdio connects the command to the stdio, where it's set
+func setCmdStdio(cmd *osexec.Cmd, stdio Stdio) {
+	if stdio.In != nil {
+		cmd.Stdin = stdio.In
+	}
+	if stdio.Out != nil {
+		cmd.Stdout = stdio.Out
+	}
+	if stdio.Err != nil {
+		cmd.Stderr = stdio.Err
+	}
+}
+
+// runCmd runs the command connected to the terminal, or the stdio it's been given, passing on signals.
+// It returns an *ExitError when the command fails. The process tree is rooted at the command, if it's given
+func runCmd(cmd *osexec.Cmd, processTree *server.ProcessTreeFilter) error {
+	stopHandlingInterrupts()
+	if cmd.Stdin == nil {
+		cmd.Stdin = os.Stdin
+	}
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan)
+	defer signal.Stop(sigChan)
 
+	if err := killProcessTreeOnExit(); err != nil {
+		log.Printf("Failed to create a job object for the subprocess: %s", err)
+	}
+
+	setProcessGroup(cmd)
 	if err := cmd.Start(); err != nil {
 		return err
 	}
+	processTree.SetRoot(cmd.Process.Pid)
 
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
 		for {
-			sig := <-sigChan
-			_ = cmd.Process.Signal(sig)
+			select {
+			case sig := <-sigChan:
+				forwardSignal(cmd.Process, sig)
+			case <-done:
+				return
+			}
 		}
 	}()
 
-	if err := cmd.Wait(); err != nil {
+	code, err := waitForCmd(cmd)
+	if err != nil {
 		_ = cmd.Process.Signal(os.Kill)
 		return fmt.Errorf("Failed to wait for command termination: %v", err)
 	}
 
-	waitStatus := cmd.ProcessState.Sys().(syscall.WaitStatus)
-	os.Exit(waitStatus.ExitStatus())
-	return nil
-}
-
-func supportsExecSyscall() bool {
-	return runtime.GOOS == "linux" || runtime.GOOS == "darwin" || runtime.GOOS == "freebsd" || runtime.GOOS == "openbsd"
-}
-
-func doExecSyscall(command string, args []string, env []string) error {
-	if command == "" {
-		command = getDefaultShell()
-		fmt.Fprintf(os.Stderr, "aws-vault: Starting a subshell %s\n", command)
-	}
-
-	log.Printf("Exec command %s %s", command, strings.Join(args, " "))
-
-	argv0, err := osexec.LookPath(command)
-	if err != nil {
-		return fmt.Errorf("Couldn't find the executable '%s': %w", command, err)
-	}
-
-	log.Printf("Found executable %s", argv0)
-
-	argv := make([]string, 0, 1+len(args))
-	argv = append(argv, command)
-	argv = append(argv, args...)
-
-	return syscall.Exec(argv0, argv, env)
+	return exitError(code)
 }
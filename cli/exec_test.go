@@ -1,8 +1,20 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+
 	"github.com/alecthomas/kingpin"
+	"github.com/aws/aws-sdk-go-v2/aws"
 
+	"github.com/99designs/aws-vault/v7/vault"
 	"github.com/99designs/keyring"
 )
 
@@ -20,3 +32,137 @@ func ExampleExecCommand() {
 	// Output:
 	// ABC
 }
+
+func TestUpdateEnvForAwsVaultUnsetsConfiguredVars(t *testing.T) {
+	input := ExecCommandInput{
+		UnsetEnv: []string{"AWS_ENDPOINT_URL*", "INTERNAL_TOGGLE,OTHER"},
+		KeepEnv:  []string{"AWS_PROFILE"},
+	}
+	env := environ{
+		"AWS_ACCESS_KEY_ID=ABC",
+		"AWS_PROFILE=llamas",
+		"AWS_ENDPOINT_URL=http://localhost",
+		"AWS_ENDPOINT_URL_S3=http://localhost",
+		"INTERNAL_TOGGLE=1",
+		"HOME=/home/llamas",
+	}
+
+	env = updateEnvForAwsVault(context.Background(), env, "llamas", "", input.unsetEnvVars())
+	sort.Strings(env)
+
+	want := environ{"AWS_PROFILE=llamas", "AWS_VAULT=llamas", "HOME=/home/llamas"}
+	if !reflect.DeepEqual(env, want) {
+		t.Fatalf("Expected %v, got %v", want, env)
+	}
+}
+
+func TestWriteEnvFile(t *testing.T) {
+	input := ExecCommandInput{EnvFile: filepath.Join(t.TempDir(), "aws.env")}
+	env := environ{"HOME=/home/llamas", "AWS_VAULT=llamas", "AWS_ACCESS_KEY_ID=ABC"}
+
+	if err := input.writeEnvFile(env); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(input.EnvFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "AWS_VAULT=llamas\nAWS_ACCESS_KEY_ID=ABC\n"; string(b) != want {
+		t.Fatalf("Expected %q, got %q", want, b)
+	}
+
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(input.EnvFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0600 {
+			t.Fatalf("Expected permissions 0600, got %o", fi.Mode().Perm())
+		}
+	}
+}
+
+func TestCredentialsFifoIsReadOnce(t *testing.T) {
+	if !supportsFifo() {
+		t.Skip("FIFOs aren't supported")
+	}
+	defer Flush()
+
+	path, err := startCredentialsFifo(aws.Credentials{AccessKeyID: "ABC", SecretAccessKey: "XYZ"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Version":1,"AccessKeyId":"ABC","SecretAccessKey":"XYZ"}` + "\n"; string(b) != want {
+		t.Fatalf("Expected %q, got %q", want, b)
+	}
+
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected the FIFO to be removed after it's read, got %v", err)
+	}
+}
+
+func TestWriteTempCredentialsFile(t *testing.T) {
+	path, err := writeTempCredentialsFile(aws.Credentials{AccessKeyID: "ABC", SecretAccessKey: "XYZ", SessionToken: "TOKEN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[default]\naws_access_key_id=ABC\naws_secret_access_key=XYZ\naws_session_token=TOKEN\n"; string(b) != want {
+		t.Fatalf("Expected %q, got %q", want, b)
+	}
+
+	Flush()
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected the file to be removed on exit, got %v", err)
+	}
+}
+
+func TestUpdateEnvSetsProfileAndLoadConfig(t *testing.T) {
+	input := ExecCommandInput{ProfileName: "llamas", SDKLoadConfig: true, SetProfile: true}
+	env := input.updateEnv(context.Background(), environ{"AWS_PROFILE=alpacas", "AWS_SDK_LOAD_CONFIG=0"}, "")
+
+	got := []string(env)
+	sort.Strings(got)
+	want := []string{"AWS_PROFILE=llamas", "AWS_SDK_LOAD_CONFIG=1", "AWS_VAULT=llamas"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestNewExecReturnsExitStatus(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command is run with sh")
+	}
+
+	var out bytes.Buffer
+	exec := NewExec(CommandEnv{
+		Keyring:    keyring.NewArrayKeyring(nil),
+		ConfigFile: &vault.ConfigFile{},
+		Stdio:      Stdio{Out: &out},
+	})
+
+	err := exec.Run(ExecCommandInput{
+		ProfileName: "llamas",
+		Command:     "sh",
+		Args:        []string{"-c", `echo "$AWS_VAULT"; exit 3`},
+		Config:      vault.Config{CredentialType: vault.CredentialTypeFake},
+	})
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Fatalf("Expected exit status 3, got %v", err)
+	}
+	if out.String() != "llamas\n" {
+		t.Errorf("Expected the command's output, got %q", out.String())
+	}
+}
@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+)
+
+// dryRunLink is a step of the chain, with the session found for it in the keyring
+type dryRunLink struct {
+	vault.ChainLink
+	CachedUntil time.Time
+	Skipped     bool
+}
+
+// dryRunPlan describes how exec would get credentials for a profile, without requesting any
+type dryRunPlan struct {
+	ProfileName string
+	Links       []dryRunLink
+	Command     string
+	NoSession   bool
+	Problems    []string
+}
+
+// printExecDryRun prints the plan for the credentials of the profile and the command that would be run.
+// Nothing is requested from AWS, and only the keyring is read, to look for stored credentials and
+// cached sessions
+func printExecDryRun(w io.Writer, input ExecCommandInput, config *vault.Config, k keyring.Keyring) error {
+	plan, err := newDryRunPlan(input, config, k)
+	if err != nil {
+		return err
+	}
+	plan.print(w)
+	return nil
+}
+
+func newDryRunPlan(input ExecCommandInput, config *vault.Config, k keyring.Keyring) (*dryRunPlan, error) {
+	var links []vault.ChainLink
+	if input.Nesting.Chain {
+		// the role is assumed with the credentials of the outer session, which aren't cached
+		links = []vault.ChainLink{
+			{ProfileName: os.Getenv("AWS_VAULT"), Type: "aws-vault session"},
+			{ProfileName: config.ProfileName, Type: "sts.AssumeRole", Detail: config.RoleARN, MfaSerial: config.MfaSerial, Duration: config.AssumeRoleDuration},
+		}
+	} else {
+		var err error
+		if links, err = vault.DescribeChain(config, &vault.CredentialKeyring{Keyring: k}); err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &dryRunPlan{
+		ProfileName: config.ProfileName,
+		Links:       make([]dryRunLink, len(links)),
+		Command:     input.dryRunCommand(config),
+		NoSession:   config.NoSession,
+	}
+
+	// sessions are looked for from the last step back, and the steps before a cached session aren't taken
+	sessions := &vault.SessionKeyring{Keyring: k}
+	cached := -1
+	for i := len(links) - 1; i >= 0; i-- {
+		if links[i].SessionKey == nil {
+			continue
+		}
+		session, err := sessions.Lookup(*links[i].SessionKey)
+		if err == vault.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if time.Until(session.Expiration) > config.ExpiryWindow() {
+			cached = i
+			plan.Links[i].CachedUntil = session.Expiration
+			break
+		}
+	}
+
+	for i, l := range links {
+		plan.Links[i].ChainLink = l
+		plan.Links[i].Skipped = i < cached
+		if plan.Links[i].Skipped {
+			continue
+		}
+		if l.Missing {
+			plan.Problems = append(plan.Problems, fmt.Sprintf("profile %s: credentials missing", l.ProfileName))
+		}
+		if l.DurationError != nil {
+			plan.Problems = append(plan.Problems, l.DurationError.Error())
+		}
+	}
+
+	return plan, nil
+}
+
+// dryRunCommand is the command exec would run
+func (input ExecCommandInput) dryRunCommand(config *vault.Config) string {
+	command := strings.Join(append([]string{input.Command}, input.Args...), " ")
+	if input.Command == "" {
+		command = fmt.Sprintf("%s (subshell)", getDefaultShell())
+		if config.ShellRC != "" {
+			command = fmt.Sprintf("%s (subshell sourcing %s)", getDefaultShell(), config.ShellRC)
+		}
+	}
+	if input.StartEc2Server {
+		command += ", with an EC2 credential server"
+	} else if input.StartEcsServer {
+		command += ", with an ECS credential server"
+	}
+	return command
+}
+
+// getSessionToken describes whether GetSessionToken is used in the chain
+func (p *dryRunPlan) getSessionToken() string {
+	for _, l := range p.Links {
+		if l.Type == "sts.GetSessionToken" {
+			return fmt.Sprintf("yes, for profile %s", l.ProfileName)
+		}
+	}
+	if p.NoSession {
+		return "no, sessions are disabled"
+	}
+	return "no"
+}
+
+// mfa describes the MFA codes that would be asked for
+func (p *dryRunPlan) mfa() string {
+	serials := []string{}
+	for _, l := range p.Links {
+		if !l.Skipped && l.CachedUntil.IsZero() && l.MfaSerial != "" && !l.MfaChained && !containsString(serials, l.MfaSerial) {
+			serials = append(serials, l.MfaSerial)
+		}
+	}
+	if len(serials) == 0 {
+		return "not required"
+	}
+	return "required for " + strings.Join(serials, ", ")
+}
+
+// duration is how long the credentials given to the command last
+func (p *dryRunPlan) duration() string {
+	if len(p.Links) == 0 {
+		return "unknown"
+	}
+	last := p.Links[len(p.Links)-1]
+	if !last.CachedUntil.IsZero() {
+		return fmt.Sprintf("until %s, from the cached session", last.CachedUntil.Local().Format(time.RFC3339))
+	}
+	if last.Duration > 0 {
+		return vault.FormatDuration(last.Duration)
+	}
+	switch last.Type {
+	case "stored credentials":
+		return "no expiry, the stored credentials are used as they are"
+	case "sso.GetRoleCredentials":
+		return "as set for the SSO permission set"
+	}
+	return "as set by the credential source"
+}
+
+func (p *dryRunPlan) print(w io.Writer) {
+	roleHops := 0
+	for _, l := range p.Links {
+		if l.Type == "sts.AssumeRole" || l.Type == "sts.AssumeRoleWithWebIdentity" {
+			roleHops++
+		}
+	}
+	source := "none"
+	if len(p.Links) > 0 {
+		source = fmt.Sprintf("%s (%s)", p.Links[0].ProfileName, p.Links[0].Type)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Profile:\t%s\n", p.ProfileName)
+	fmt.Fprintf(tw, "Source:\t%s\n", source)
+	fmt.Fprintf(tw, "GetSessionToken:\t%s\n", p.getSessionToken())
+	fmt.Fprintf(tw, "Role hops:\t%d\n", roleHops)
+	fmt.Fprintf(tw, "MFA:\t%s\n", p.mfa())
+	fmt.Fprintf(tw, "Duration:\t%s\n", p.duration())
+	fmt.Fprintf(tw, "Command:\t%s\n", p.Command)
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, p.ProfileName)
+	for i := len(p.Links) - 1; i >= 0; i-- {
+		l := p.Links[i]
+		label := chainLinkLabel(l.ChainLink)
+		if l.ProfileName != p.ProfileName {
+			label = fmt.Sprintf("[%s] %s", l.ProfileName, label)
+		}
+		if l.Duration > 0 {
+			label += fmt.Sprintf(" for %s", vault.FormatDuration(l.Duration))
+		}
+		switch {
+		case !l.CachedUntil.IsZero():
+			label += fmt.Sprintf(" [CACHED until %s]", l.CachedUntil.Local().Format(time.RFC3339))
+		case l.Skipped:
+			label += " [SKIPPED]"
+		case l.SessionKey != nil:
+			label += " [NOT CACHED]"
+		}
+		fmt.Fprintf(w, "%s└── %s\n", strings.Repeat("    ", len(p.Links)-1-i), label)
+	}
+
+	if len(p.Problems) > 0 {
+		fmt.Fprintln(w)
+		for _, problem := range p.Problems {
+			fmt.Fprintf(w, "Problem: %s\n", problem)
+		}
+	}
+}
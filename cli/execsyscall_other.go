@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly && !solaris
+// +build !linux,!darwin,!freebsd,!openbsd,!netbsd,!dragonfly,!solaris
+
+package cli
+
+import (
+	"errors"
+	"runtime"
+)
+
+func supportsExecSyscall() bool {
+	return false
+}
+
+func doExecSyscall(command string, args []string, env []string) error {
+	return errors.New("exec syscall is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,42 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly || solaris
+// +build linux darwin freebsd openbsd netbsd dragonfly solaris
+
+package cli
+
+import (
+	"fmt"
+	"log"
+	osexec "os/exec"
+	"strings"
+	"syscall"
+)
+
+// supportsExecSyscall reports whether aws-vault can replace itself with the
+// command, which keeps job control and signal handling with the shell
+func supportsExecSyscall() bool {
+	return true
+}
+
+func doExecSyscall(command string, args []string, env []string) error {
+	if command == "" {
+		command = getDefaultShell()
+		infof("Starting a subshell %s", command)
+	}
+
+	log.Printf("Exec command %s %s", command, strings.Join(args, " "))
+
+	argv0, err := osexec.LookPath(command)
+	if err != nil {
+		return fmt.Errorf("Couldn't find the executable '%s': %w", command, err)
+	}
+
+	log.Printf("Found executable %s", argv0)
+
+	argv := make([]string, 0, 1+len(args))
+	argv = append(argv, command)
+	argv = append(argv, args...)
+
+	Flush()
+
+	return syscall.Exec(argv0, argv, env)
+}
@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/99designs/aws-vault/v7/prompt"
+	"github.com/99designs/keyring"
+	"github.com/alecthomas/kingpin"
+	"github.com/aws/smithy-go"
+)
+
+// exitInteractionRequired is the exit status when --no-prompt stopped aws-vault from prompting,
+// so that scripts can tell it apart from other failures
+const exitInteractionRequired = 3
+
+// Formats of the errors that aws-vault fails with, set with --error-format
+const (
+	ErrorFormatText = "text"
+	ErrorFormatJSON = "json"
+)
+
+var errorFormat = ErrorFormatText
+
+// Codes of the errors printed with --error-format json. They're stable, so that wrappers can branch on them
+const (
+	errorCodeMFARequired         = "MFA_REQUIRED"
+	errorCodeMFAInvalid          = "MFA_INVALID"
+	errorCodeSSOTokenExpired     = "SSO_TOKEN_EXPIRED"
+	errorCodeKeyringLocked       = "KEYRING_LOCKED"
+	errorCodeInteractionRequired = "INTERACTION_REQUIRED"
+	errorCodeProfileNotFound     = "PROFILE_NOT_FOUND"
+	errorCodeCredentialsNotFound = "CREDENTIALS_NOT_FOUND"
+	errorCodeExpiredToken        = "EXPIRED_TOKEN"
+	errorCodeInvalidCredentials  = "INVALID_CREDENTIALS"
+	errorCodeAccessDenied        = "ACCESS_DENIED"
+	errorCodeUnknown             = "UNKNOWN"
+)
+
+// ExitError is returned by commands that run another, such as Exec.Run, when it exits with a non-zero
+// status. aws-vault exits with the same status
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// exitError is the error for the exit status of a command that has finished, nil if it succeeded
+func exitError(code int) error {
+	if code == 0 {
+		return nil
+	}
+	return &ExitError{Code: code}
+}
+
+// exitStatus is the status to exit with for the error
+func exitStatus(err error) int {
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	if errors.Is(err, prompt.ErrInteractionRequired) {
+		return exitInteractionRequired
+	}
+	return 1
+}
+
+// errorCode is the code of the error printed with --error-format json
+func errorCode(err error) string {
+	var interactionErr *prompt.InteractionRequiredError
+	if errors.As(err, &interactionErr) {
+		switch interactionErr.Kind {
+		case prompt.InteractionMFA:
+			return errorCodeMFARequired
+		case prompt.InteractionSSO:
+			return errorCodeSSOTokenExpired
+		case prompt.InteractionPassphrase:
+			return errorCodeKeyringLocked
+		}
+		return errorCodeInteractionRequired
+	}
+
+	var lockedErr *lockedKeyringError
+	if errors.As(err, &lockedErr) {
+		return errorCodeKeyringLocked
+	}
+
+	var notFoundErr *profileNotFoundError
+	if errors.As(err, &notFoundErr) {
+		return errorCodeProfileNotFound
+	}
+
+	if errors.Is(err, keyring.ErrKeyNotFound) {
+		return errorCodeCredentialsNotFound
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "AccessDenied", "AccessDeniedException":
+			if strings.Contains(apiErr.ErrorMessage(), "MultiFactorAuthentication") {
+				return errorCodeMFAInvalid
+			}
+			return errorCodeAccessDenied
+		case "UnauthorizedException", "InvalidGrantException", "ExpiredTokenException":
+			// returned by the SSO and SSO OIDC APIs for tokens that have expired or been revoked
+			return errorCodeSSOTokenExpired
+		case "ExpiredToken":
+			return errorCodeExpiredToken
+		case "InvalidClientTokenId", "SignatureDoesNotMatch":
+			return errorCodeInvalidCredentials
+		}
+	}
+
+	return errorCodeUnknown
+}
+
+// errorReport is the error printed with --error-format json, as a line of JSON on stderr
+type errorReport struct {
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Context    string `json:"context,omitempty"`
+	ExitStatus int    `json:"exit_status"`
+}
+
+func newErrorReport(err error, context string) errorReport {
+	return errorReport{
+		Code:       errorCode(err),
+		Message:    err.Error(),
+		Context:    context,
+		ExitStatus: exitStatus(err),
+	}
+}
+
+// exit flushes and exits with the status
+func exit(status int) {
+	Flush()
+	os.Exit(status)
+}
+
+// printError prints the error on stderr, as text or with --error-format json as a line of JSON
+func printError(app *kingpin.Application, err error, context, text string) {
+	if errorFormat == ErrorFormatJSON {
+		b, _ := json.Marshal(newErrorReport(err, context))
+		fmt.Fprintln(os.Stderr, string(b))
+		return
+	}
+	app.Errorf("%s", text)
+}
+
+// fatalIfError prints the error and exits like kingpin's FatalIfError, with the status for the error
+func fatalIfError(app *kingpin.Application, err error, format string, args ...interface{}) {
+	if err == nil {
+		return
+	}
+	// the command that was run has already reported why it failed
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		exit(exitErr.Code)
+	}
+	context := fmt.Sprintf(format, args...)
+	printError(app, err, context, fmt.Sprintf("%s: %s", context, err))
+	exit(exitStatus(err))
+}
+
+// MustParse parses the args like kingpin.MustParse, printing the errors returned by commands
+// in the format set with --error-format and exiting with the status for them
+func MustParse(app *kingpin.Application, args []string) {
+	if _, err := app.Parse(args); err != nil {
+		printError(app, err, "", fmt.Sprintf("%s, try --help", err))
+		exit(exitStatus(err))
+	}
+}
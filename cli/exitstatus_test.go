@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/99designs/aws-vault/v7/prompt"
+	"github.com/99designs/keyring"
+	"github.com/aws/smithy-go"
+)
+
+func TestExitStatus(t *testing.T) {
+	prompt.Disabled = true
+	defer func() { prompt.Disabled = false }()
+
+	_, err := prompt.Method("terminal")("arn:aws:iam::111111111111:mfa/jane")
+	err = fmt.Errorf("Failed to get credentials for dev: %w", err)
+	if status := exitStatus(err); status != exitInteractionRequired {
+		t.Errorf("Expected a disabled MFA prompt to exit with %d, got %d", exitInteractionRequired, status)
+	}
+
+	if _, err = fileKeyringPassphrasePrompt("Enter passphrase"); exitStatus(err) != exitInteractionRequired {
+		t.Errorf("Expected a disabled passphrase prompt to exit with %d, got %v", exitInteractionRequired, err)
+	}
+
+	if status := exitStatus(errors.New("AccessDenied")); status != 1 {
+		t.Errorf("Expected other errors to exit with 1, got %d", status)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	prompt.Disabled = true
+	defer func() { prompt.Disabled = false }()
+
+	_, mfaErr := prompt.Method("terminal")("arn:aws:iam::111111111111:mfa/jane")
+	_, passphraseErr := fileKeyringPassphrasePrompt("Enter passphrase")
+
+	cases := []struct {
+		err  error
+		code string
+	}{
+		{fmt.Errorf("Failed to get credentials for dev: %w", mfaErr), errorCodeMFARequired},
+		{passphraseErr, errorCodeKeyringLocked},
+		{prompt.InteractionRequired(prompt.InteractionSSO, "Signing in to SSO at https://example.awsapps.com/start"), errorCodeSSOTokenExpired},
+		{prompt.InteractionRequired(prompt.InteractionConfirm, "Remove credentials?"), errorCodeInteractionRequired},
+		{&lockedKeyringError{backend: "keychain", err: errors.New("locked")}, errorCodeKeyringLocked},
+		{&profileNotFoundError{Name: "prod"}, errorCodeProfileNotFound},
+		{fmt.Errorf("Failed to get credentials for dev: %w", keyring.ErrKeyNotFound), errorCodeCredentialsNotFound},
+		{&smithy.GenericAPIError{Code: "AccessDenied", Message: "MultiFactorAuthentication failed with invalid MFA one time pass code."}, errorCodeMFAInvalid},
+		{&smithy.GenericAPIError{Code: "AccessDenied", Message: "User is not authorized to perform: sts:AssumeRole"}, errorCodeAccessDenied},
+		{&smithy.GenericAPIError{Code: "UnauthorizedException", Message: "Session token not found or invalid"}, errorCodeSSOTokenExpired},
+		{&smithy.GenericAPIError{Code: "ExpiredToken"}, errorCodeExpiredToken},
+		{&smithy.GenericAPIError{Code: "InvalidClientTokenId"}, errorCodeInvalidCredentials},
+		{errors.New("something else"), errorCodeUnknown},
+	}
+	for _, c := range cases {
+		if code := errorCode(c.err); code != c.code {
+			t.Errorf("Expected %q to have code %s, got %s", c.err, c.code, code)
+		}
+	}
+}
+
+func TestErrorReport(t *testing.T) {
+	r := newErrorReport(prompt.InteractionRequired(prompt.InteractionMFA, "Entering an MFA code"), "exec")
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"code":"MFA_REQUIRED","message":"Entering an MFA code: interaction is required, but prompts are disabled by --no-prompt","context":"exec","exit_status":3}`
+	if string(b) != expected {
+		t.Errorf("Expected %s, got %s", expected, b)
+	}
+}
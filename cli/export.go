@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/99designs/aws-vault/v7/iso8601"
@@ -13,6 +16,8 @@ import (
 	"github.com/99designs/keyring"
 	"github.com/alecthomas/kingpin"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	ini "gopkg.in/ini.v1"
 )
 
@@ -23,6 +28,10 @@ type ExportCommandInput struct {
 	SessionDuration time.Duration
 	NoSession       bool
 	UseStdout       bool
+	MinTTL          time.Duration
+	Clipboard       bool
+	ClipboardClear  time.Duration
+	Nesting         NestingInput
 }
 
 var (
@@ -30,6 +39,9 @@ var (
 	FormatTypeExportEnv  = "export-env"
 	FormatTypeExportJSON = "json"
 	FormatTypeExportINI  = "ini"
+	FormatTypeDirenv     = "direnv"
+	FormatTypeTfvars     = "tfvars"
+	FormatTypeTfEnv      = "tf-env"
 )
 
 func ConfigureExportCommand(app *kingpin.Application, a *AwsVault) {
@@ -39,26 +51,45 @@ func ConfigureExportCommand(app *kingpin.Application, a *AwsVault) {
 
 	cmd.Flag("duration", "Duration of the temporary or assume-role session. Defaults to 1h").
 		Short('d').
-		DurationVar(&input.SessionDuration)
+		SetValue(newDurationValue(&input.SessionDuration))
+
+	cmd.Flag("renew-before", "Renew cached sessions that expire within this duration. Defaults to 5m, or AWS_MIN_TTL").
+		SetValue(newDurationValue(&input.Config.RenewBefore))
+
+	cmd.Flag("min-ttl", "Renew the exported credentials if they expire within this duration, without renewing the sessions they're created from").
+		SetValue(newDurationValue(&input.MinTTL))
 
 	cmd.Flag("no-session", "Skip creating STS session with GetSessionToken").
 		Short('n').
 		BoolVar(&input.NoSession)
 
 	cmd.Flag("region", "The AWS region").
+		HintOptions(awsRegions...).
 		StringVar(&input.Config.Region)
 
 	cmd.Flag("mfa-token", "The MFA token to use").
 		Short('t').
 		StringVar(&input.Config.MfaToken)
 
-	cmd.Flag("format", fmt.Sprintf("Format to output credentials. Valid values are %s, %s and %s", FormatTypeEnv, FormatTypeExportEnv, FormatTypeExportJSON)).
+	cmd.Flag("format", fmt.Sprintf("Format to output credentials. Valid values are %s, %s, %s, %s, %s and %s", FormatTypeEnv, FormatTypeExportEnv, FormatTypeExportJSON, FormatTypeDirenv, FormatTypeTfvars, FormatTypeTfEnv)).
 		Default(FormatTypeEnv).
-		EnumVar(&input.Format, FormatTypeEnv, FormatTypeExportEnv, FormatTypeExportJSON, FormatTypeExportINI)
+		EnumVar(&input.Format, FormatTypeEnv, FormatTypeExportEnv, FormatTypeExportJSON, FormatTypeExportINI, FormatTypeDirenv, FormatTypeTfvars, FormatTypeTfEnv)
+
+	cmd.Flag("clipboard", "Copy the credentials to the clipboard instead of printing them").
+		BoolVar(&input.Clipboard)
+
+	cmd.Flag("clipboard-clear", "Clear the clipboard after this duration when using --clipboard, 0 to leave it").
+		Default("30s").
+		SetValue(newDurationValue(&input.ClipboardClear))
+
+	input.Nesting.configureFlags(cmd)
 
 	cmd.Flag("stdout", "Print the SSO link to the terminal without automatically opening the browser").
 		BoolVar(&input.UseStdout)
 
+	cmd.Flag("browser", "Command to open the SSO link with, rather than the default browser. Overrides sso_browser_command in the profile").
+		StringVar(&input.Config.SSOBrowserCommand)
+
 	cmd.Arg("profile", "Name of the profile").
 		Required().
 		HintAction(a.MustGetProfileNames).
@@ -70,6 +101,8 @@ func ConfigureExportCommand(app *kingpin.Application, a *AwsVault) {
 		input.Config.AssumeRoleDuration = input.SessionDuration
 		input.Config.SSOUseStdout = input.UseStdout
 
+		input.Config = a.globalConfig(input.Config)
+
 		f, err := a.AwsConfigFile()
 		if err != nil {
 			return err
@@ -80,17 +113,50 @@ func ConfigureExportCommand(app *kingpin.Application, a *AwsVault) {
 		}
 
 		err = ExportCommand(input, f, keyring)
-		app.FatalIfError(err, "exec")
+		fatalIfError(app, err, "exec")
 		return nil
 	})
 }
 
+// Export prints the credentials of a profile, see NewExport
+type Export struct {
+	env CommandEnv
+}
+
+// NewExport returns the export command, using the keyring, AWS config and stdio of the env
+func NewExport(env CommandEnv) *Export {
+	return &Export{env: env.withDefaults()}
+}
+
 func ExportCommand(input ExportCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
-	if os.Getenv("AWS_VAULT") != "" {
-		return fmt.Errorf("aws-vault sessions should be nested with care, unset AWS_VAULT to force")
+	return NewExport(CommandEnv{Keyring: keyring, ConfigFile: f}).Run(input)
+}
+
+// Run prints the credentials of the profile of the input
+func (c *Export) Run(input ExportCommandInput) error {
+	ctx, f, keyring := c.env.Context, c.env.ConfigFile, c.env.Keyring
+	var err error
+
+	// direnv may evaluate .envrc again with the variables from the last time still set
+	if !(input.Format == FormatTypeDirenv && os.Getenv("AWS_VAULT") == input.ProfileName) {
+		if err = input.Nesting.checkNesting(); err != nil {
+			return err
+		}
 	}
 
-	vault.UseSession = !input.NoSession
+	var clipboard clipboardCommands
+	if input.Clipboard {
+		if clipboard, err = findClipboardCommands(); err != nil {
+			return err
+		}
+	}
+
+	input.ProfileName, err = resolveProfileName(input.ProfileName, f, keyring, input.Config)
+	if err != nil {
+		return err
+	}
+
+	input.Config.NoSession = input.NoSession
 
 	configLoader := vault.ConfigLoader{
 		File:          f,
@@ -102,24 +168,85 @@ func ExportCommand(input ExportCommandInput, f *vault.ConfigFile, keyring keyrin
 		return fmt.Errorf("Error loading config: %w", err)
 	}
 
+	// the source profiles have their own config, so only the exported credentials are renewed early
+	if input.MinTTL > config.ExpiryWindow() {
+		config.RenewBefore = input.MinTTL
+	}
+
 	ckr := &vault.CredentialKeyring{Keyring: keyring}
-	credsProvider, err := vault.NewTempCredentialsProvider(config, ckr)
+	credsProvider, err := input.Nesting.credentialsProvider(config, ckr)
 	if err != nil {
 		return fmt.Errorf("Error getting temporary credentials: %w", err)
 	}
+	if input.MinTTL > 0 {
+		credsProvider = &minTTLCredentialsProvider{credsProvider, input.MinTTL, c.env.Stdio.Err}
+	}
+
+	if !input.Clipboard {
+		return printCredentials(ctx, c.env.Stdio.Out, input, credsProvider, config)
+	}
 
+	var b strings.Builder
+	if err = printCredentials(ctx, &b, input, credsProvider, config); err != nil {
+		return err
+	}
+	return copyCredentialsToClipboard(clipboard, b.String(), input.ClipboardClear)
+}
+
+func printCredentials(ctx context.Context, w io.Writer, input ExportCommandInput, credsProvider aws.CredentialsProvider, config *vault.Config) error {
 	if input.Format == FormatTypeExportJSON {
-		return printJSON(input, credsProvider)
+		return printJSON(ctx, w, input, credsProvider)
 	} else if input.Format == FormatTypeExportINI {
-		return printINI(credsProvider, input.ProfileName, config.Region)
+		return printINI(ctx, w, credsProvider, input.ProfileName, config.Region)
+	} else if input.Format == FormatTypeTfvars || input.Format == FormatTypeTfEnv {
+		return printTerraform(ctx, w, input, credsProvider, config)
+	} else if input.Format == FormatTypeDirenv {
+		return printDirenv(ctx, w, input, credsProvider, config.Region)
 	} else if input.Format == FormatTypeExportEnv {
-		return printEnv(input, credsProvider, config.Region, "export ")
+		return printEnv(ctx, w, input, credsProvider, config.Region, "export ")
 	} else {
-		return printEnv(input, credsProvider, config.Region, "")
+		return printEnv(ctx, w, input, credsProvider, config.Region, "")
+	}
+}
+
+// copyCredentialsToClipboard copies the credentials, and clears them from the clipboard after a while
+// unless something else has been copied. Ctrl-C clears them straight away
+func copyCredentialsToClipboard(clipboard clipboardCommands, credentials string, clearAfter time.Duration) error {
+	if err := clipboard.Copy(credentials); err != nil {
+		return err
+	}
+	if clearAfter <= 0 {
+		infof("Copied credentials to the clipboard")
+		return nil
+	}
+
+	infof("Copied credentials to the clipboard, clearing in %s. Press Ctrl-C to clear now", clearAfter)
+
+	select {
+	case <-interrupted():
+	case <-time.After(clearAfter):
+	}
+
+	return clipboard.ClearIfUnchanged(credentials)
+}
+
+// minTTLCredentialsProvider warns when credentials expire within the minimum TTL even after being
+// renewed, such as when the session duration is shorter, as the caller would be asking for them again soon
+type minTTLCredentialsProvider struct {
+	aws.CredentialsProvider
+	MinTTL time.Duration
+	Warn   io.Writer
+}
+
+func (p *minTTLCredentialsProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	creds, err := p.CredentialsProvider.Retrieve(ctx)
+	if err == nil && creds.CanExpire && time.Until(creds.Expires) < p.MinTTL {
+		fmt.Fprintf(p.Warn, "aws-vault: Credentials expire in %s, less than --min-ttl %s. Use a longer --duration\n", time.Until(creds.Expires).Truncate(time.Second), p.MinTTL)
 	}
+	return creds, err
 }
 
-func printJSON(input ExportCommandInput, credsProvider aws.CredentialsProvider) error {
+func printJSON(ctx context.Context, w io.Writer, input ExportCommandInput, credsProvider aws.CredentialsProvider) error {
 	// AwsCredentialHelperData is metadata for AWS CLI credential process
 	// See https://docs.aws.amazon.com/cli/latest/topic/config-vars.html#sourcing-credentials-from-external-processes
 	type AwsCredentialHelperData struct {
@@ -130,7 +257,7 @@ func printJSON(input ExportCommandInput, credsProvider aws.CredentialsProvider)
 		Expiration      string `json:"Expiration,omitempty"`
 	}
 
-	creds, err := credsProvider.Retrieve(context.TODO())
+	creds, err := credsProvider.Retrieve(ctx)
 	if err != nil {
 		return fmt.Errorf("Failed to get credentials for %s: %w", input.ProfileName, err)
 	}
@@ -151,7 +278,7 @@ func printJSON(input ExportCommandInput, credsProvider aws.CredentialsProvider)
 		return fmt.Errorf("Error creating credential json: %w", err)
 	}
 
-	fmt.Print(string(json) + "\n")
+	fmt.Fprint(w, string(json)+"\n")
 
 	return nil
 }
@@ -165,8 +292,8 @@ func mustNewKey(s *ini.Section, name, val string) {
 	}
 }
 
-func printINI(credsProvider aws.CredentialsProvider, profilename, region string) error {
-	creds, err := credsProvider.Retrieve(context.TODO())
+func printINI(ctx context.Context, w io.Writer, credsProvider aws.CredentialsProvider, profilename, region string) error {
+	creds, err := credsProvider.Retrieve(ctx)
 	if err != nil {
 		return fmt.Errorf("Failed to get credentials for %s: %w", profilename, err)
 	}
@@ -185,7 +312,7 @@ func printINI(credsProvider aws.CredentialsProvider, profilename, region string)
 	}
 	mustNewKey(s, "region", region)
 
-	_, err = f.WriteTo(os.Stdout)
+	_, err = f.WriteTo(w)
 	if err != nil {
 		return fmt.Errorf("Failed to output ini: %w", err)
 	}
@@ -193,25 +320,120 @@ func printINI(credsProvider aws.CredentialsProvider, profilename, region string)
 	return nil
 }
 
-func printEnv(input ExportCommandInput, credsProvider aws.CredentialsProvider, region, prefix string) error {
-	creds, err := credsProvider.Retrieve(context.TODO())
+func printEnv(ctx context.Context, w io.Writer, input ExportCommandInput, credsProvider aws.CredentialsProvider, region, prefix string) error {
+	creds, err := credsProvider.Retrieve(ctx)
 	if err != nil {
 		return fmt.Errorf("Failed to get credentials for %s: %w", input.ProfileName, err)
 	}
 
-	fmt.Printf("%sAWS_ACCESS_KEY_ID=%s\n", prefix, creds.AccessKeyID)
-	fmt.Printf("%sAWS_SECRET_ACCESS_KEY=%s\n", prefix, creds.SecretAccessKey)
+	fmt.Fprintf(w, "%sAWS_ACCESS_KEY_ID=%s\n", prefix, creds.AccessKeyID)
+	fmt.Fprintf(w, "%sAWS_SECRET_ACCESS_KEY=%s\n", prefix, creds.SecretAccessKey)
 
 	if creds.SessionToken != "" {
-		fmt.Printf("%sAWS_SESSION_TOKEN=%s\n", prefix, creds.SessionToken)
+		fmt.Fprintf(w, "%sAWS_SESSION_TOKEN=%s\n", prefix, creds.SessionToken)
 	}
 	if creds.CanExpire {
-		fmt.Printf("%sAWS_CREDENTIAL_EXPIRATION=%s\n", prefix, iso8601.Format(creds.Expires))
+		fmt.Fprintf(w, "%sAWS_CREDENTIAL_EXPIRATION=%s\n", prefix, iso8601.Format(creds.Expires))
 	}
 	if region != "" {
-		fmt.Printf("%sAWS_REGION=%s\n", prefix, region)
-		fmt.Printf("%sAWS_DEFAULT_REGION=%s\n", prefix, region)
+		fmt.Fprintf(w, "%sAWS_REGION=%s\n", prefix, region)
+		fmt.Fprintf(w, "%sAWS_DEFAULT_REGION=%s\n", prefix, region)
+	}
+
+	return nil
+}
+
+// printDirenv prints credentials as bash for a .envrc, quoted so that direnv can evaluate it safely
+func printDirenv(ctx context.Context, w io.Writer, input ExportCommandInput, credsProvider aws.CredentialsProvider, region string) error {
+	creds, err := credsProvider.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to get credentials for %s: %w", input.ProfileName, err)
+	}
+
+	vars := [][2]string{
+		{"AWS_VAULT", input.ProfileName},
+		{"AWS_ACCESS_KEY_ID", creds.AccessKeyID},
+		{"AWS_SECRET_ACCESS_KEY", creds.SecretAccessKey},
+		{"AWS_SESSION_TOKEN", creds.SessionToken},
+		{"AWS_SECURITY_TOKEN", ""},
+		{"AWS_CREDENTIAL_EXPIRATION", ""},
+		{"AWS_REGION", region},
+		{"AWS_DEFAULT_REGION", region},
+	}
+	if creds.CanExpire {
+		vars[5][1] = iso8601.Format(creds.Expires)
+	}
+
+	for _, v := range vars {
+		if v[1] == "" {
+			fmt.Fprintf(w, "unset %s\n", v[0])
+		} else {
+			fmt.Fprintf(w, "export %s=%s\n", v[0], shellQuote(v[1]))
+		}
 	}
 
 	return nil
 }
+
+// printTerraform prints credentials, the account ID and the region as Terraform variables, either
+// as a .tfvars file or as TF_VAR_ environment variables
+func printTerraform(ctx context.Context, w io.Writer, input ExportCommandInput, credsProvider aws.CredentialsProvider, config *vault.Config) error {
+	creds, err := credsProvider.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to get credentials for %s: %w", input.ProfileName, err)
+	}
+
+	cfg := vault.NewAwsConfigWithCredsProvider(credentials.StaticCredentialsProvider{Value: creds}, config.Region, config.STSRegionalEndpoints)
+	vault.AddProfileProxy(&cfg, config)
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("Failed to get caller identity: %w", err)
+	}
+
+	vars := terraformVars(input.ProfileName, creds, aws.ToString(identity.Account), config.Region)
+	if input.Format == FormatTypeTfEnv {
+		for _, v := range vars {
+			fmt.Fprintf(w, "TF_VAR_%s=%s\n", v[0], v[1])
+		}
+	} else {
+		for _, v := range vars {
+			fmt.Fprintf(w, "%s = %s\n", v[0], hclQuote(v[1]))
+		}
+	}
+
+	return nil
+}
+
+// terraformVars are the variables set by the tfvars and tf-env formats, empty values are left out
+func terraformVars(profileName string, creds aws.Credentials, accountID, region string) [][2]string {
+	vars := [][2]string{
+		{"aws_vault_profile", profileName},
+		{"aws_access_key_id", creds.AccessKeyID},
+		{"aws_secret_access_key", creds.SecretAccessKey},
+		{"aws_session_token", creds.SessionToken},
+		{"aws_credential_expiration", ""},
+		{"aws_account_id", accountID},
+		{"aws_region", region},
+	}
+	if creds.CanExpire {
+		vars[4][1] = iso8601.Format(creds.Expires)
+	}
+
+	nonEmpty := [][2]string{}
+	for _, v := range vars {
+		if v[1] != "" {
+			nonEmpty = append(nonEmpty, v)
+		}
+	}
+	return nonEmpty
+}
+
+// hclQuote quotes s as an HCL string, escaping template sequences so the value is taken literally
+func hclQuote(s string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(strconv.Quote(s))
+}
+
+// shellQuote quotes s for bash
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+)
+
+func ExampleExportCommand_direnv() {
+	app := kingpin.New("aws-vault", "")
+	awsVault := ConfigureGlobals(app)
+	awsVault.keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"X'YZ"}`)},
+	})
+	ConfigureExportCommand(app, awsVault)
+	kingpin.MustParse(app.Parse([]string{
+		"export", "--format", "direnv", "--no-session", "--region", "us-east-1", "llamas",
+	}))
+
+	// Output:
+	// export AWS_VAULT='llamas'
+	// export AWS_ACCESS_KEY_ID='ABC'
+	// export AWS_SECRET_ACCESS_KEY='X'\''YZ'
+	// unset AWS_SESSION_TOKEN
+	// unset AWS_SECURITY_TOKEN
+	// unset AWS_CREDENTIAL_EXPIRATION
+	// export AWS_REGION='us-east-1'
+	// export AWS_DEFAULT_REGION='us-east-1'
+}
+
+func TestNewExportWritesToStdio(t *testing.T) {
+	var out, errOut bytes.Buffer
+	export := NewExport(CommandEnv{
+		Keyring: keyring.NewArrayKeyring([]keyring.Item{
+			{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+		}),
+		ConfigFile: &vault.ConfigFile{},
+		Stdio:      Stdio{Out: &out, Err: &errOut},
+	})
+
+	err := export.Run(ExportCommandInput{
+		ProfileName: "llamas",
+		Format:      FormatTypeEnv,
+		NoSession:   true,
+		Config:      vault.Config{Region: "us-east-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "AWS_ACCESS_KEY_ID=ABC\n") {
+		t.Errorf("Expected the credentials on the command's stdout, got %q", out.String())
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected nothing on the command's stderr, got %q", errOut.String())
+	}
+}
+
+func TestTerraformVars(t *testing.T) {
+	creds := aws.Credentials{AccessKeyID: "ABC", SecretAccessKey: "XYZ", CanExpire: true, Expires: time.Date(2023, 3, 15, 5, 20, 10, 0, time.UTC)}
+
+	vars := terraformVars("llamas", creds, "111111111111", "")
+	want := [][2]string{
+		{"aws_vault_profile", "llamas"},
+		{"aws_access_key_id", "ABC"},
+		{"aws_secret_access_key", "XYZ"},
+		{"aws_credential_expiration", "2023-03-15T05:20:10Z"},
+		{"aws_account_id", "111111111111"},
+	}
+	if !reflect.DeepEqual(vars, want) {
+		t.Fatalf("Expected %v, got %v", want, vars)
+	}
+
+	if got := hclQuote(`a"${b}%{c}`); got != `"a\"$${b}%%{c}"` {
+		t.Fatalf("Unexpected quoting %s", got)
+	}
+}
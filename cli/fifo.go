@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/99designs/aws-vault/v7/iso8601"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// credentialsFifoEnv is the variable holding the path of the FIFO with --fifo
+const credentialsFifoEnv = "AWS_VAULT_CREDENTIALS_FIFO"
+
+// startCredentialsFifo creates a FIFO in a directory only accessible by the current user, and writes the
+// credentials to it once, in the credential_process format, when it's first opened. The FIFO is removed
+// after it's read, and the directory when aws-vault exits
+func startCredentialsFifo(creds aws.Credentials) (string, error) {
+	dir, err := os.MkdirTemp("", "aws-vault")
+	if err != nil {
+		return "", err
+	}
+	onExit(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "credentials")
+	if err = makeFifo(path); err != nil {
+		return "", err
+	}
+
+	data := struct {
+		Version         int    `json:"Version"`
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		SessionToken    string `json:"SessionToken,omitempty"`
+		Expiration      string `json:"Expiration,omitempty"`
+	}{
+		Version:         1,
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+	}
+	if creds.CanExpire {
+		data.Expiration = iso8601.Format(creds.Expires)
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	go func() {
+		// opening blocks until the command opens the FIFO to read it
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			log.Printf("Failed to open credentials FIFO: %s", err.Error())
+			return
+		}
+		os.Remove(path)
+		if _, err = f.Write(append(b, '\n')); err != nil {
+			log.Printf("Failed to write credentials FIFO: %s", err.Error())
+		}
+		f.Close()
+		log.Printf("Wrote credentials to FIFO")
+	}()
+
+	return path, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly && !solaris
+// +build !linux,!darwin,!freebsd,!openbsd,!netbsd,!dragonfly,!solaris
+
+package cli
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func supportsFifo() bool {
+	return false
+}
+
+func makeFifo(path string) error {
+	return fmt.Errorf("FIFOs aren't supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly || solaris
+// +build linux darwin freebsd openbsd netbsd dragonfly solaris
+
+package cli
+
+import "golang.org/x/sys/unix"
+
+func supportsFifo() bool {
+	return true
+}
+
+func makeFifo(path string) error {
+	return unix.Mkfifo(path, 0600)
+}
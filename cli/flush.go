@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+)
+
+var exitHooks []func()
+
+// onExit registers a function to clean up when aws-vault exits
+func onExit(fn func()) {
+	exitHooks = append(exitHooks, fn)
+}
+
+// Flush prints the stats and exports the traces recorded for the command, and runs the exit hooks.
+// It's called when aws-vault exits, and before handing over to a subprocess
+func Flush() {
+	cancelRootCtx()
+	printStats()
+
+	for _, fn := range exitHooks {
+		fn()
+	}
+	exitHooks = nil
+
+	if tracer := vault.TracerFromContext(rootCtx); tracer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tracer.Export(ctx); err != nil {
+			log.Printf("Failed to export traces: %s", err.Error())
+		}
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/99designs/aws-vault/v7/prompt"
+	"github.com/99designs/aws-vault/v7/server"
 	"github.com/99designs/aws-vault/v7/vault"
 	"github.com/99designs/keyring"
 	"github.com/alecthomas/kingpin"
@@ -14,6 +17,11 @@ import (
 	"golang.org/x/term"
 )
 
+const (
+	SessionCacheKeyring = "keyring"
+	SessionCacheFile    = "file"
+)
+
 var keyringConfigDefaults = keyring.Config{
 	ServiceName:              "aws-vault",
 	FilePasswordFunc:         fileKeyringPassphrasePrompt,
@@ -25,13 +33,64 @@ var keyringConfigDefaults = keyring.Config{
 }
 
 type AwsVault struct {
-	Debug          bool
-	KeyringConfig  keyring.Config
-	KeyringBackend string
-	promptDriver   string
+	Debug               bool
+	Quiet               bool
+	Verbose             int
+	KeyringConfig       keyring.Config
+	KeyringBackend      string
+	BackendOrder        string
+	Stats               bool
+	LogFormat           string
+	LogFile             string
+	ServerLog           string
+	ServerLogFormat     string
+	RequireApproval     bool
+	FakeCreds           bool
+	NoCache             bool
+	NoCacheSSO          bool
+	SSOFlow             string
+	SSOJSON             bool
+	NoPrompt            bool
+	ErrorFormat         string
+	FileArgon2          string
+	FilePassphraseCache time.Duration
+	SessionCache        string
+	SessionCacheDir     string
+	WSLBridgeCmd        string
+	KeyringHelper       string
+	KeychainACL         string
+	MatchPrefix         bool
+	AwsConfigPaths      []string
+	promptDriver        string
+
+	keyringImpl       keyring.Keyring
+	backendsAvailable []string
+	awsConfigFile     *vault.ConfigFile
+	fakeKeyring       bool
+}
 
-	keyringImpl   keyring.Keyring
-	awsConfigFile *vault.ConfigFile
+// fakeCredsCommands are the commands that --fake-creds gives fake credentials to, which don't open the keyring
+var fakeCredsCommands = map[string]bool{
+	"exec":        true,
+	"export":      true,
+	"login":       true,
+	"serve":       true,
+	"proxy":       true,
+	"compose-env": true,
+	"ssh-forward": true,
+	"ssm":         true,
+	"whoami":      true,
+}
+
+// keyringChangingCommands are the commands that store or remove credentials and sessions, which
+// --fake-creds can't be used with
+var keyringChangingCommands = map[string]bool{
+	"add":        true,
+	"remove":     true,
+	"rotate":     true,
+	"clear":      true,
+	"setup":      true,
+	"sso logout": true,
 }
 
 func isATerminal() bool {
@@ -58,20 +117,151 @@ func (a *AwsVault) PromptDriver(avoidTerminalPrompt bool) string {
 }
 
 func (a *AwsVault) Keyring() (keyring.Keyring, error) {
+	if a.keyringImpl == nil && a.fakeKeyring {
+		// fake credentials don't need anything from the keyring, so none is opened
+		a.keyringImpl = keyring.NewArrayKeyring(nil)
+	}
 	if a.keyringImpl == nil {
-		if a.KeyringBackend != "" {
-			a.KeyringConfig.AllowedBackends = []keyring.BackendType{keyring.BackendType(a.KeyringBackend)}
+		if a.KeychainACL == KeychainACLPrompt {
+			a.KeyringConfig.KeychainTrustApplication = false
 		}
 		var err error
-		a.keyringImpl, err = keyring.Open(a.KeyringConfig)
+		defer vault.RecordTiming("keyring.Open", time.Now())
+		if a.KeyringBackend != "" {
+			err = retryLockedKeyring(a.KeyringBackend, a.KeyringConfig.KeychainName, func() (err error) {
+				a.keyringImpl, err = a.openBackend(a.KeyringBackend)
+				return err
+			})
+		} else {
+			a.keyringImpl, a.KeyringBackend, err = a.openFirstBackend()
+		}
+		if err != nil {
+			return nil, err
+		}
+		a.keyringImpl = &unlockingKeyring{
+			Keyring:      a.keyringImpl,
+			backend:      a.KeyringBackend,
+			keychainName: a.KeyringConfig.KeychainName,
+		}
+		if a.KeyringBackend == string(keyring.KeychainBackend) {
+			a.keyringImpl, err = a.keychainACLKeyring(a.keyringImpl)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if a.Stats {
+			a.keyringImpl = &timedKeyring{a.keyringImpl}
+		}
+		sessionCache, err := sessionCacheFor(a.SessionCache, a.KeyringBackend)
 		if err != nil {
 			return nil, err
 		}
+		if sessionCache == SessionCacheFile {
+			a.keyringImpl = vault.NewFileSessionCache(a.keyringImpl, a.SessionCacheDir)
+		}
 	}
 
 	return a.keyringImpl, nil
 }
 
+// sessionCacheFor returns where sessions are cached with the backend. The setting is a session cache for all
+// backends, or comma separated backend=cache pairs, optionally along with the session cache of the other backends
+func sessionCacheFor(setting, backend string) (string, error) {
+	sessionCache, perBackend := SessionCacheKeyring, map[string]string{}
+	for _, entry := range strings.Split(setting, ",") {
+		name, cache, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			name, cache = "", name
+		}
+		if cache != SessionCacheKeyring && cache != SessionCacheFile {
+			return "", fmt.Errorf("Invalid session cache %q, expected %s or %s", entry, SessionCacheKeyring, SessionCacheFile)
+		}
+		if name == "" {
+			sessionCache = cache
+		} else {
+			perBackend[name] = cache
+		}
+	}
+	if cache, ok := perBackend[backend]; ok {
+		return cache, nil
+	}
+	return sessionCache, nil
+}
+
+// openBackend opens a single keyring backend
+func (a *AwsVault) openBackend(backend string) (keyring.Keyring, error) {
+	switch backend {
+	case string(keyring.FileBackend):
+		return a.fileKeyring()
+	case WSLBackend:
+		return &vault.BridgeKeyring{Command: a.WSLBridgeCmd, Args: []string{"keyring-bridge"}}, nil
+	case HelperBackend:
+		if a.KeyringHelper == "" {
+			return nil, fmt.Errorf("The %s backend needs a keyring helper command, set with --keyring-helper", HelperBackend)
+		}
+		return vault.NewKeyringHelper(a.KeyringHelper), nil
+	}
+
+	config := a.KeyringConfig
+	config.AllowedBackends = []keyring.BackendType{keyring.BackendType(backend)}
+	return keyring.Open(config)
+}
+
+// openFirstBackend opens the first backend in --backend-order that can be opened
+func (a *AwsVault) openFirstBackend() (keyring.Keyring, string, error) {
+	order, err := parseBackendOrder(a.BackendOrder, a.backendsAvailable)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, backend := range order {
+		kr, err := a.openBackend(backend)
+		if err == nil {
+			log.Printf("Using the %s backend", backend)
+			return kr, backend, nil
+		}
+		log.Printf("Can't open the %s backend: %s", backend, err.Error())
+	}
+
+	return nil, "", fmt.Errorf("None of the backends %s could be opened, run 'aws-vault backends' for details", strings.Join(order, ", "))
+}
+
+// fileKeyring replaces the keyring library's "file" backend with one that uses Argon2id, and reads its files
+func (a *AwsVault) fileKeyring() (keyring.Keyring, error) {
+	params, err := vault.ParseArgon2Params(a.FileArgon2)
+	if err != nil {
+		return nil, err
+	}
+
+	return &vault.FileKeyring{
+		Dir:                a.KeyringConfig.FileDir,
+		PasswordFunc:       a.KeyringConfig.FilePasswordFunc,
+		Params:             params,
+		PassphraseCacheTTL: a.FilePassphraseCache,
+	}, nil
+}
+
+// keychainACLKeyring sets the configured access control list on items in the macOS keychain
+func (a *AwsVault) keychainACLKeyring(kr keyring.Keyring) (keyring.Keyring, error) {
+	stateFile, err := keyring.ExpandTilde("~/.awsvault/keychain-acl")
+	if err != nil {
+		return nil, err
+	}
+
+	k := &keychainACLKeyring{
+		Keyring:   kr,
+		ACL:       a.KeychainACL,
+		Service:   a.KeyringConfig.ServiceName,
+		Keychain:  a.KeyringConfig.KeychainName + ".keychain",
+		StateFile: stateFile,
+	}
+	if err = k.reapplyIfChanged(); err != nil {
+		log.Printf("Failed to set keychain access on existing items: %s", err.Error())
+	}
+
+	return k, nil
+}
+
 func (a *AwsVault) AwsConfigFile() (*vault.ConfigFile, error) {
 	if a.awsConfigFile == nil {
 		var err error
@@ -97,21 +287,100 @@ func ConfigureGlobals(app *kingpin.Application) *AwsVault {
 		KeyringConfig: keyringConfigDefaults,
 	}
 
-	backendsAvailable := []string{}
-	for _, backendType := range keyring.AvailableBackends() {
-		backendsAvailable = append(backendsAvailable, string(backendType))
+	backendsAvailable := keyringBackendsAvailable()
+	if isWSL() {
+		backendsAvailable = append(backendsAvailable, WSLBackend)
 	}
+	backendsAvailable = append(backendsAvailable, HelperBackend)
+	a.backendsAvailable = backendsAvailable
 
 	promptsAvailable := prompt.Available()
 
 	app.Flag("debug", "Show debugging output").
 		BoolVar(&a.Debug)
 
-	app.Flag("backend", fmt.Sprintf("Secret backend to use %v", backendsAvailable)).
-		Default(backendsAvailable[0]).
+	app.Flag("quiet", "Don't print informational messages, such as that a subshell is starting").
+		Short('q').
+		Envar("AWS_VAULT_QUIET").
+		BoolVar(&a.Quiet)
+
+	app.Flag("verbose", "Also print the details of what aws-vault is doing, such as the variables it sets. Repeat as -vv for debugging output").
+		Short('v').
+		CounterVar(&a.Verbose)
+
+	app.Flag("log-format", fmt.Sprintf("Format of debugging output. Valid values are %s and %s", LogFormatText, LogFormatJSON)).
+		Default(LogFormatText).
+		Envar("AWS_VAULT_LOG_FORMAT").
+		EnumVar(&a.LogFormat, LogFormatText, LogFormatJSON)
+
+	app.Flag("log-file", "Write debugging output to a file, with secrets redacted").
+		Envar("AWS_VAULT_LOG_FILE").
+		StringVar(&a.LogFile)
+
+	app.Flag("server-log", "Log every request to the credential servers, with the client and the credentials served, to this file, or - for stderr").
+		Envar("AWS_VAULT_SERVER_LOG").
+		StringVar(&a.ServerLog)
+
+	app.Flag("server-log-format", fmt.Sprintf("Format of --server-log. Valid values are %s and %s", server.RequestLogFormatText, server.RequestLogFormatJSON)).
+		Default(server.RequestLogFormatText).
+		Envar("AWS_VAULT_SERVER_LOG_FORMAT").
+		EnumVar(&a.ServerLogFormat, server.RequestLogFormatText, server.RequestLogFormatJSON)
+
+	app.Flag("stats", "Show where time was spent when the command completes").
+		Envar("AWS_VAULT_STATS").
+		BoolVar(&a.Stats)
+
+	app.Flag("require-approval", "Ask for approval before issuing credentials for any profile").
+		Envar("AWS_VAULT_REQUIRE_APPROVAL").
+		BoolVar(&a.RequireApproval)
+
+	app.Flag("fake-creds", "Give every profile fake credentials, without opening the keyring or any requests to AWS, for testing offline").
+		Envar("AWS_VAULT_FAKE_CREDS").
+		BoolVar(&a.FakeCreds)
+
+	app.Flag("no-cache", "Ignore cached sessions and create new ones, which replace them in the cache").
+		Envar("AWS_VAULT_NO_CACHE").
+		BoolVar(&a.NoCache)
+
+	app.Flag("no-cache-sso", "Also ignore cached SSO tokens, signing in to SSO again").
+		Envar("AWS_VAULT_NO_CACHE_SSO").
+		BoolVar(&a.NoCacheSSO)
+
+	app.Flag("sso-flow", fmt.Sprintf("How to sign in to SSO. Valid values are %s, and %s to be redirected back from the browser without entering a code", vault.SSOFlowDeviceCode, vault.SSOFlowAuthCode)).
+		Default(vault.SSOFlowDeviceCode).
+		Envar("AWS_VAULT_SSO_FLOW").
+		EnumVar(&a.SSOFlow, vault.SSOFlowDeviceCode, vault.SSOFlowAuthCode)
+
+	app.Flag("sso-json", "Print the SSO device code or authorization page and the progress of signing in as lines of JSON on stderr, rather than opening a browser").
+		Envar("AWS_VAULT_SSO_JSON").
+		BoolVar(&a.SSOJSON)
+
+	app.Flag("no-prompt", "Fail rather than prompt for anything, such as an MFA code, signing in to SSO or a keyring passphrase").
+		Envar("AWS_VAULT_NO_PROMPT").
+		BoolVar(&a.NoPrompt)
+
+	app.Flag("error-format", fmt.Sprintf("Format of the error aws-vault fails with. Valid values are %s and %s, a line of JSON with a stable code such as MFA_REQUIRED", ErrorFormatText, ErrorFormatJSON)).
+		Default(ErrorFormatText).
+		Envar("AWS_VAULT_ERROR_FORMAT").
+		EnumVar(&a.ErrorFormat, ErrorFormatText, ErrorFormatJSON)
+
+	app.Flag("aws-config", "Path of the AWS config file to use, rather than AWS_CONFIG_FILE or ~/.aws/config. Repeat to merge several files, with later ones taking precedence").
+		PlaceHolder("PATH").
+		StringsVar(&a.AwsConfigPaths)
+
+	app.Flag("match-prefix", "Accept a unique prefix of a profile name").
+		Envar("AWS_VAULT_MATCH_PREFIX").
+		BoolVar(&a.MatchPrefix)
+
+	app.Flag("backend", fmt.Sprintf("Secret backend to use %v. Defaults to the first in --backend-order that can be opened", backendsAvailable)).
 		Envar("AWS_VAULT_BACKEND").
 		EnumVar(&a.KeyringBackend, backendsAvailable...)
 
+	app.Flag("backend-order", "Comma separated backends to try in order when --backend isn't set").
+		Default(strings.Join(keyringBackendsAvailable(), ",")).
+		Envar("AWS_VAULT_BACKEND_ORDER").
+		StringVar(&a.BackendOrder)
+
 	app.Flag("prompt", fmt.Sprintf("Prompt driver to use %v", promptsAvailable)).
 		Envar("AWS_VAULT_PROMPT").
 		EnumVar(&a.promptDriver, promptsAvailable...)
@@ -121,6 +390,11 @@ func ConfigureGlobals(app *kingpin.Application) *AwsVault {
 		Envar("AWS_VAULT_KEYCHAIN_NAME").
 		StringVar(&a.KeyringConfig.KeychainName)
 
+	app.Flag("keychain-acl", fmt.Sprintf("Which applications may read macOS keychain items without a prompt. Valid values are %s, %s and %s", KeychainACLAwsVault, KeychainACLAny, KeychainACLPrompt)).
+		Default(KeychainACLAwsVault).
+		Envar("AWS_VAULT_KEYCHAIN_ACL").
+		EnumVar(&a.KeychainACL, KeychainACLAwsVault, KeychainACLAny, KeychainACLPrompt)
+
 	app.Flag("secret-service-collection", "Name of secret-service collection to use, if it doesn't exist it will be created").
 		Default("awsvault").
 		Envar("AWS_VAULT_SECRET_SERVICE_COLLECTION_NAME").
@@ -143,11 +417,67 @@ func ConfigureGlobals(app *kingpin.Application) *AwsVault {
 		Envar("AWS_VAULT_FILE_DIR").
 		StringVar(&a.KeyringConfig.FileDir)
 
+	app.Flag("session-cache", fmt.Sprintf("Where to cache sessions, %s or %s, which is an encrypted file cache with its key in the keyring. Set it per backend with comma separated backend=cache pairs", SessionCacheKeyring, SessionCacheFile)).
+		Default(SessionCacheKeyring).
+		Envar("AWS_VAULT_SESSION_CACHE").
+		StringVar(&a.SessionCache)
+
+	app.Flag("session-cache-dir", "Directory for the \"file\" session cache").
+		Default("~/.awsvault/sessions/").
+		Envar("AWS_VAULT_SESSION_CACHE_DIR").
+		StringVar(&a.SessionCacheDir)
+
+	app.Flag("wsl-bridge-cmd", "Windows aws-vault executable that the \"wsl\" backend runs to use the Windows keyring").
+		Default("aws-vault.exe").
+		Envar("AWS_VAULT_WSL_BRIDGE_CMD").
+		StringVar(&a.WSLBridgeCmd)
+
+	app.Flag("keyring-helper", "Command that the \"helper\" backend runs to store secrets, speaking the keyring-bridge protocol on stdin and stdout").
+		Envar("AWS_VAULT_KEYRING_HELPER").
+		StringVar(&a.KeyringHelper)
+
+	app.Flag("file-argon2", "Argon2id parameters for the \"file\" password store, as t=<passes>,m=<KiB>,p=<threads>").
+		Default(vault.DefaultArgon2Params.String()).
+		Envar("AWS_VAULT_FILE_ARGON2").
+		StringVar(&a.FileArgon2)
+
+	app.Flag("file-passphrase-cache", "How long to cache the passphrase of the \"file\" password store in the kernel keyring, on Linux").
+		Envar("AWS_VAULT_FILE_PASSPHRASE_CACHE").
+		SetValue(newDurationValue(&a.FilePassphraseCache))
+
+	app.Terminate(exit)
+
 	app.PreAction(func(c *kingpin.ParseContext) error {
-		if !a.Debug {
-			log.SetOutput(io.Discard)
+		errorFormat = a.ErrorFormat
+		handleInterrupts()
+		if err := a.configureVerbosity(); err != nil {
+			return err
+		}
+		if err := a.configureLogging(); err != nil {
+			return err
+		}
+		if err := a.configureServerLog(); err != nil {
+			return err
+		}
+		if err := a.configureAwsConfigPaths(); err != nil {
+			return err
+		}
+		if _, err := sessionCacheFor(a.SessionCache, a.KeyringBackend); err != nil {
+			return err
+		}
+		keyring.Debug = a.Debug || a.LogFile != ""
+		if a.Stats {
+			enableStats()
+		}
+		matchProfilePrefix = a.MatchPrefix
+		prompt.Disabled = a.NoPrompt
+		if c.SelectedCommand != nil {
+			if a.FakeCreds && keyringChangingCommands[c.SelectedCommand.FullCommand()] {
+				return fmt.Errorf("--fake-creds can't be used with %s, which changes the keyring", c.SelectedCommand.FullCommand())
+			}
+			a.fakeKeyring = a.FakeCreds && fakeCredsCommands[c.SelectedCommand.FullCommand()]
+			rootCtx = vault.ContextWithTracer(rootCtx, vault.NewTracerFromEnv("aws-vault "+c.SelectedCommand.FullCommand()))
 		}
-		keyring.Debug = a.Debug
 		log.Printf("aws-vault %s", app.Model().Version)
 		return nil
 	})
@@ -155,12 +485,115 @@ func ConfigureGlobals(app *kingpin.Application) *AwsVault {
 	return a
 }
 
-func fileKeyringPassphrasePrompt(prompt string) (string, error) {
+// globalConfig applies the global flags that change how credentials are got to the config of a command
+func (a *AwsVault) globalConfig(config vault.Config) vault.Config {
+	config.RequireApproval = config.RequireApproval || a.RequireApproval
+	if a.FakeCreds {
+		config.CredentialType = vault.CredentialTypeFake
+	}
+	config.RefreshSessions = config.RefreshSessions || a.NoCache || a.NoCacheSSO
+	config.RefreshSSOTokens = config.RefreshSSOTokens || a.NoCacheSSO
+	if config.SSOFlow == "" {
+		config.SSOFlow = a.SSOFlow
+	}
+	if a.SSOJSON {
+		config.SSOEvents = os.Stderr
+	}
+	config.NoPrompt = config.NoPrompt || a.NoPrompt
+	return config
+}
+
+// configureAwsConfigPaths points AWS_CONFIG_FILE at the files set with --aws-config. Unlike the default
+// config file, they aren't created if they don't exist, as that's more likely a mistake
+func (a *AwsVault) configureAwsConfigPaths() error {
+	if len(a.AwsConfigPaths) == 0 {
+		return nil
+	}
+	for _, path := range a.AwsConfigPaths {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("Can't use --aws-config: %w", err)
+		}
+	}
+	value := strings.Join(a.AwsConfigPaths, string(os.PathListSeparator))
+	log.Printf("Using --aws-config value: %s", value)
+	return os.Setenv("AWS_CONFIG_FILE", value)
+}
+
+// configureVerbosity sets the verbosity from -q and -v, with -vv turning on --debug
+func (a *AwsVault) configureVerbosity() error {
+	if a.Quiet && a.Verbose > 0 {
+		return fmt.Errorf("Can't use --quiet with --verbose")
+	}
+	switch {
+	case a.Quiet:
+		verbosity = verbosityQuiet
+	case a.Verbose >= verbosityDebug:
+		verbosity = verbosityDebug
+		a.Debug = true
+	default:
+		verbosity = a.Verbose
+	}
+	debugToStderr = a.Debug
+	return nil
+}
+
+// configureLogging sends debugging output to stderr with --debug and to the log file with --log-file
+func (a *AwsVault) configureLogging() error {
+	writers := []io.Writer{}
+	if a.Debug {
+		writers = append(writers, os.Stderr)
+	}
+	if a.LogFile != "" {
+		f, err := os.OpenFile(a.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("Failed to open log file: %w", err)
+		}
+		writers = append(writers, &redactingWriter{w: f})
+	}
+
+	if len(writers) == 0 {
+		log.SetOutput(io.Discard)
+		return nil
+	}
+
+	w := io.MultiWriter(writers...)
+	if a.LogFormat == LogFormatJSON {
+		log.SetFlags(0)
+		w = &jsonLogWriter{w: w}
+	}
+	log.SetOutput(w)
+
+	return nil
+}
+
+// configureServerLog logs the requests to the credential servers with --server-log
+func (a *AwsVault) configureServerLog() error {
+	if a.ServerLog == "" {
+		return nil
+	}
+	var w io.Writer = os.Stderr
+	if a.ServerLog != "-" {
+		f, err := os.OpenFile(a.ServerLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("Failed to open server log: %w", err)
+		}
+		onExit(func() { f.Close() })
+		w = f
+	}
+	var err error
+	server.RequestLog, err = server.NewRequestLogger(w, a.ServerLogFormat)
+	return err
+}
+
+func fileKeyringPassphrasePrompt(message string) (string, error) {
 	if password, ok := os.LookupEnv("AWS_VAULT_FILE_PASSPHRASE"); ok {
 		return password, nil
 	}
+	if prompt.Disabled {
+		return "", prompt.InteractionRequired(prompt.InteractionPassphrase, message)
+	}
 
-	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	fmt.Fprintf(os.Stderr, "%s: ", message)
 	b, err := term.ReadPassword(int(os.Stdin.Fd()))
 	if err != nil {
 		return "", err
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/99designs/keyring"
+	"github.com/alecthomas/kingpin"
+)
+
+func TestConfigureAwsConfigPaths(t *testing.T) {
+	defer os.Setenv("AWS_CONFIG_FILE", os.Getenv("AWS_CONFIG_FILE"))
+
+	path := filepath.Join(t.TempDir(), "config")
+	a := AwsVault{AwsConfigPaths: []string{path}}
+	if err := a.configureAwsConfigPaths(); err == nil {
+		t.Error("Expected an error for an --aws-config that doesn't exist")
+	}
+
+	if err := os.WriteFile(path, []byte("[profile test]\nregion = us-east-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.configureAwsConfigPaths(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := a.AwsConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.ProfileSection("test"); !ok || f.Path != path {
+		t.Errorf("Expected the config to be loaded from %s, got %s", path, f.Path)
+	}
+}
+
+func TestFakeCredsRejectedWhenChangingTheKeyring(t *testing.T) {
+	app := kingpin.New("aws-vault", "")
+	a := ConfigureGlobals(app)
+	a.keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+	ConfigureRemoveCommand(app, a)
+
+	if _, err := app.Parse([]string{"--fake-creds", "remove", "--force", "llamas"}); err == nil {
+		t.Error("Expected an error for --fake-creds with remove")
+	}
+	if keys, _ := a.keyringImpl.Keys(); len(keys) != 1 {
+		t.Errorf("Expected the credentials to be kept, got keys %v", keys)
+	}
+}
+
+func TestSessionCacheFor(t *testing.T) {
+	cases := []struct {
+		setting, backend, expected string
+	}{
+		{"keyring", "secret-service", SessionCacheKeyring},
+		{"file", "keychain", SessionCacheFile},
+		{"secret-service=file", "secret-service", SessionCacheFile},
+		{"secret-service=file", "keychain", SessionCacheKeyring},
+		{"secret-service=file, kwallet=file", "kwallet", SessionCacheFile},
+		{"file,keychain=keyring", "keychain", SessionCacheKeyring},
+		{"keychain=keyring,file", "secret-service", SessionCacheFile},
+	}
+	for _, c := range cases {
+		cache, err := sessionCacheFor(c.setting, c.backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cache != c.expected {
+			t.Errorf("Expected %q to give %s the %s session cache, got %s", c.setting, c.backend, c.expected, cache)
+		}
+	}
+
+	for _, setting := range []string{"disk", "secret-service=disk", "secret-service="} {
+		if _, err := sessionCacheFor(setting, "secret-service"); err == nil {
+			t.Errorf("Expected an error for the session cache %q", setting)
+		}
+	}
+}
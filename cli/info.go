@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/99designs/aws-vault/v7/prompt"
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/alecthomas/kingpin"
+)
+
+type InfoCommandInput struct {
+	JSON bool
+}
+
+// Info describes the capabilities of this build of aws-vault on this platform
+type Info struct {
+	Version       string          `json:"version"`
+	GoVersion     string          `json:"go_version"`
+	OS            string          `json:"os"`
+	Arch          string          `json:"arch"`
+	Backends      []string        `json:"backends"`
+	PromptDrivers []string        `json:"prompt_drivers"`
+	Providers     []string        `json:"providers"`
+	SSOFlows      []string        `json:"sso_flows"`
+	SessionCaches []string        `json:"session_caches"`
+	Features      map[string]bool `json:"features"`
+}
+
+// infoFeatures are the features that depend on the platform
+var infoFeatures = []struct {
+	Name      string
+	Supported func() bool
+}{
+	{"exec_syscall", supportsExecSyscall},
+	{"fifo", supportsFifo},
+	{"isolate_network", supportsIsolatedNetwork},
+	{"pseudo_console", supportsPseudoConsole},
+	{"vsock", func() bool { return runtime.GOOS == "linux" }},
+	{"wsl", isWSL},
+}
+
+// infoProviders are the sources of credentials for profiles, named as in `list`
+var infoProviders = []string{"stored", "assume_role", "sso", "web_identity", "credential_process", "credential_plugin", vault.CredentialTypeFake}
+
+func ConfigureInfoCommand(app *kingpin.Application, a *AwsVault) {
+	input := InfoCommandInput{}
+
+	cmd := app.Command("info", "Show the version, backends, prompt drivers, providers and platform features of aws-vault.")
+
+	cmd.Flag("json", "Output the capabilities as JSON").
+		BoolVar(&input.JSON)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		err := InfoCommand(input, newInfo(app.Model().Version, a), os.Stdout)
+		fatalIfError(app, err, "info")
+		return nil
+	})
+}
+
+func newInfo(version string, a *AwsVault) Info {
+	features := map[string]bool{}
+	for _, f := range infoFeatures {
+		features[f.Name] = f.Supported()
+	}
+
+	return Info{
+		Version:       version,
+		GoVersion:     runtime.Version(),
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		Backends:      a.backendsAvailable,
+		PromptDrivers: prompt.Available(),
+		Providers:     infoProviders,
+		SSOFlows:      []string{vault.SSOFlowDeviceCode, vault.SSOFlowAuthCode},
+		SessionCaches: []string{SessionCacheKeyring, SessionCacheFile},
+		Features:      features,
+	}
+}
+
+func InfoCommand(input InfoCommandInput, info Info, w io.Writer) error {
+	if input.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+
+	features := []string{}
+	for _, f := range infoFeatures {
+		if info.Features[f.Name] {
+			features = append(features, f.Name)
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Version:\t%s\n", info.Version)
+	fmt.Fprintf(tw, "Go version:\t%s\n", info.GoVersion)
+	fmt.Fprintf(tw, "Platform:\t%s/%s\n", info.OS, info.Arch)
+	fmt.Fprintf(tw, "Backends:\t%s\n", strings.Join(info.Backends, ", "))
+	fmt.Fprintf(tw, "Prompt drivers:\t%s\n", strings.Join(info.PromptDrivers, ", "))
+	fmt.Fprintf(tw, "Providers:\t%s\n", strings.Join(info.Providers, ", "))
+	fmt.Fprintf(tw, "SSO flows:\t%s\n", strings.Join(info.SSOFlows, ", "))
+	fmt.Fprintf(tw, "Session caches:\t%s\n", strings.Join(info.SessionCaches, ", "))
+	fmt.Fprintf(tw, "Features:\t%s\n", strings.Join(features, ", "))
+	return tw.Flush()
+}
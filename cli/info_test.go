@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestInfoCommandJSON(t *testing.T) {
+	var b bytes.Buffer
+	err := InfoCommand(InfoCommandInput{JSON: true}, newInfo("v7.0.0", &AwsVault{backendsAvailable: []string{"file", HelperBackend}}), &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var info Info
+	if err := json.Unmarshal(b.Bytes(), &info); err != nil {
+		t.Fatalf("Expected JSON, got %q: %v", b.String(), err)
+	}
+	if info.Version != "v7.0.0" {
+		t.Errorf("Expected version v7.0.0, got %q", info.Version)
+	}
+	if len(info.Backends) != 2 || info.Backends[1] != HelperBackend {
+		t.Errorf("Unexpected backends %v", info.Backends)
+	}
+	for _, f := range infoFeatures {
+		if _, ok := info.Features[f.Name]; !ok {
+			t.Errorf("Expected the feature %s to be reported", f.Name)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/99designs/aws-vault/v7/server"
+	"github.com/alecthomas/kingpin"
+)
+
+// isolatedEgressProxyAddr is where the egress proxy is reached inside the network namespace. It's
+// on its own loopback address so it can't clash with the forwarded credential server
+const isolatedEgressProxyAddr = "127.0.0.2:3128"
+
+// doRunIsolatedCmd runs the command in a new network namespace, where only the loopback interface
+// exists. HTTPS connections to AWS endpoints go through an egress proxy that refuses other hosts,
+// and connections to forwardAddrs inside the namespace reach the same addresses outside it
+func doRunIsolatedCmd(command string, args []string, env environ, forwardAddrs []string, opts cmdOptions) error {
+	dir, err := os.MkdirTemp("", "aws-vault")
+	if err != nil {
+		return err
+	}
+	onExit(func() { os.RemoveAll(dir) })
+
+	egressSocket := filepath.Join(dir, "egress.sock")
+	l, err := net.Listen("unix", egressSocket)
+	if err != nil {
+		return err
+	}
+	go func() { _ = http.Serve(l, server.EgressProxyHandler(server.DefaultEgressAllowedHosts)) }()
+	forwards := []string{isolatedEgressProxyAddr + "=" + egressSocket}
+
+	for i, addr := range forwardAddrs {
+		socket := filepath.Join(dir, fmt.Sprintf("forward%d.sock", i))
+		l, err := net.Listen("unix", socket)
+		if err != nil {
+			return err
+		}
+		go server.ServeForward(l, "tcp", addr)
+		forwards = append(forwards, addr+"="+socket)
+	}
+
+	for _, key := range []string{"HTTPS_PROXY", "https_proxy"} {
+		env.Set(key, "http://"+isolatedEgressProxyAddr)
+	}
+	for _, key := range []string{"NO_PROXY", "no_proxy"} {
+		env.Set(key, "127.0.0.1,localhost")
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	helperArgs := []string{"isolated-exec"}
+	for _, f := range forwards {
+		helperArgs = append(helperArgs, "--forward", f)
+	}
+	helperArgs = append(helperArgs, "--")
+	if command != "" {
+		helperArgs = append(helperArgs, command)
+		helperArgs = append(helperArgs, args...)
+	}
+
+	log.Printf("Starting subprocess in an isolated network namespace: %s %s", command, strings.Join(args, " "))
+
+	cmd := osexec.Command(executable, helperArgs...)
+	cmd.Env = env
+	cmd.SysProcAttr = isolatedSysProcAttr()
+	setCmdStdio(cmd, opts.stdio)
+
+	return runCmd(cmd, opts.processTree)
+}
+
+// ConfigureIsolatedExecCommand configures the command that runs inside the network namespace
+// created by exec --isolate-network. It sets up the namespace and then runs the actual command
+func ConfigureIsolatedExecCommand(app *kingpin.Application, a *AwsVault) {
+	var forwards []string
+	var command string
+	var args []string
+
+	cmd := app.Command("isolated-exec", "Run a command inside an isolated network namespace.").
+		Hidden()
+
+	cmd.Flag("forward", "Forward a TCP address to a unix socket, as address=socket").
+		StringsVar(&forwards)
+
+	cmd.Arg("cmd", "Command to execute").
+		StringVar(&command)
+
+	cmd.Arg("args", "Command arguments").
+		StringsVar(&args)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		err := IsolatedExecCommand(forwards, command, args)
+		fatalIfError(app, err, "isolated-exec")
+		return nil
+	})
+}
+
+func IsolatedExecCommand(forwards []string, command string, args []string) error {
+	if err := bringUpLoopback(); err != nil {
+		return fmt.Errorf("Failed to set up the loopback interface: %w", err)
+	}
+
+	for _, f := range forwards {
+		addr, socket, ok := strings.Cut(f, "=")
+		if !ok {
+			return fmt.Errorf("Invalid forward %q", f)
+		}
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		go server.ServeForward(l, "unix", socket)
+	}
+
+	return doRunCmd(command, args, os.Environ(), cmdOptions{})
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package cli
+
+import (
+	"errors"
+	"syscall"
+)
+
+func supportsIsolatedNetwork() bool {
+	return false
+}
+
+func isolatedSysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+func bringUpLoopback() error {
+	return errors.New("network isolation is only supported on Linux")
+}
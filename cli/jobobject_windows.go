@@ -0,0 +1,39 @@
+//go:build windows
+// +build windows
+
+package cli
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// killProcessTreeOnExit puts aws-vault in a Job Object that kills every process in it when it's
+// closed. Processes started afterwards join the job, so when aws-vault exits, however it's terminated,
+// the handle is closed and the whole subprocess tree is torn down with it
+func killProcessTreeOnExit() error {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return err
+	}
+
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{
+		BasicLimitInformation: windows.JOBOBJECT_BASIC_LIMIT_INFORMATION{
+			LimitFlags: windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE,
+		},
+	}
+	_, err = windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)))
+	if err != nil {
+		_ = windows.CloseHandle(job)
+		return err
+	}
+
+	if err = windows.AssignProcessToJobObject(job, windows.CurrentProcess()); err != nil {
+		_ = windows.CloseHandle(job)
+		return err
+	}
+
+	// the handle is deliberately left open, so it's only closed when aws-vault exits
+	return nil
+}
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/99designs/keyring"
+)
+
+// Who may read the items aws-vault creates in the macOS keychain without being prompted
+const (
+	KeychainACLAwsVault = "aws-vault"
+	KeychainACLAny      = "any"
+	KeychainACLPrompt   = "prompt"
+)
+
+// keychainACLKeyring sets the access control list of the items it writes to the macOS keychain,
+// and sets it again on existing items after aws-vault is upgraded or the ACL setting is changed
+type keychainACLKeyring struct {
+	keyring.Keyring
+	ACL       string
+	Service   string
+	Keychain  string
+	StateFile string
+}
+
+func (k *keychainACLKeyring) Set(item keyring.Item) error {
+	if err := k.Keyring.Set(item); err != nil {
+		return err
+	}
+	if k.ACL != KeychainACLAny {
+		return nil
+	}
+
+	// the keyring library can only trust aws-vault or no application at all, so the security tool
+	// rewrites the item. The secret is passed on stdin so it isn't visible to other processes
+	_ = osexec.Command("security", "delete-generic-password", "-s", k.Service, "-a", item.Key, k.Keychain).Run()
+
+	args := []string{"add-generic-password", "-A", "-s", k.Service, "-a", item.Key, "-l", item.Label}
+	if item.Description != "" {
+		args = append(args, "-D", item.Description)
+	}
+	args = append(args, "-X", hex.EncodeToString(item.Data), k.Keychain)
+
+	cmd := osexec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(securityCommandLine(args) + "\n")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to set keychain access: %s: %w", bytes.TrimSpace(output), err)
+	}
+
+	if err := osexec.Command("security", "find-generic-password", "-s", k.Service, "-a", item.Key, k.Keychain).Run(); err != nil {
+		return fmt.Errorf("Failed to set keychain access for %s", item.Key)
+	}
+
+	return nil
+}
+
+// securityCommandLine quotes args for the interactive mode of the security tool
+func securityCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// executableState identifies the installed aws-vault binary. Upgrading it changes the state, as does changing the ACL
+func (k *keychainACLKeyring) executableState() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(exe)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s %s %d %d", k.ACL, exe, fi.Size(), fi.ModTime().Unix()), nil
+}
+
+// reapplyIfChanged writes every item again when aws-vault or the ACL setting has changed since they were
+// written. The keyring library keeps the ACL when updating an item, so each is removed and added again.
+// This may prompt once for each item, rather than every time aws-vault reads them from then on
+func (k *keychainACLKeyring) reapplyIfChanged() error {
+	state, err := k.executableState()
+	if err != nil {
+		return err
+	}
+
+	prev, err := os.ReadFile(k.StateFile)
+	if err == nil && strings.TrimSpace(string(prev)) == state {
+		return nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// items were created trusting aws-vault before the ACL could be configured
+	if err == nil || k.ACL != KeychainACLAwsVault {
+		keys, err := k.Keyring.Keys()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			log.Printf("Setting keychain access for %s to %s", key, k.ACL)
+			item, err := k.Keyring.Get(key)
+			if err != nil {
+				return err
+			}
+			if err = k.Keyring.Remove(key); err != nil {
+				return err
+			}
+			if err = k.Set(item); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.StateFile), 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(k.StateFile, []byte(state+"\n"), 0600)
+}
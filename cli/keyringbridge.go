@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/alecthomas/kingpin"
+)
+
+// WSLBackend is the backend that uses the keyring of aws-vault on the Windows host of WSL
+const WSLBackend = "wsl"
+
+// HelperBackend is the backend that uses a keyring helper, a command set with --keyring-helper
+const HelperBackend = "helper"
+
+// isWSL checks if aws-vault is running in the Windows Subsystem for Linux
+func isWSL() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	return err == nil && strings.Contains(strings.ToLower(string(release)), "microsoft")
+}
+
+func ConfigureKeyringBridgeCommand(app *kingpin.Application, a *AwsVault) {
+	cmd := app.Command("keyring-bridge", "Serve the keyring on stdin and stdout for aws-vault in WSL.").
+		Hidden()
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		err := KeyringBridgeCommand(a)
+		fatalIfError(app, err, "keyring-bridge")
+		return nil
+	})
+}
+
+func KeyringBridgeCommand(a *AwsVault) error {
+	k, err := a.Keyring()
+	if err != nil {
+		return err
+	}
+
+	return vault.ServeKeyringBridge(k, os.Stdin, os.Stdout)
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	osexec "os/exec"
+	"strings"
+
+	"github.com/99designs/aws-vault/v7/prompt"
+	"github.com/99designs/keyring"
+)
+
+// lockedKeyringError is an error from a keyring backend that's locked, or whose service isn't running,
+// with what to do about it rather than only the error of the backend
+type lockedKeyringError struct {
+	backend string
+	remedy  string
+	err     error
+}
+
+func (e *lockedKeyringError) Error() string {
+	return fmt.Sprintf("The %s backend is locked or not available (%s). %s", e.backend, strings.TrimSuffix(e.err.Error(), "."), e.remedy)
+}
+
+func (e *lockedKeyringError) Unwrap() error {
+	return e.err
+}
+
+// keyringLock is how to unlock a backend. Backends without an unlock command are retried once you've
+// unlocked them yourself
+type keyringLock struct {
+	remedy string
+	unlock []string
+}
+
+// detectLockedKeyring finds whether err is from the backend being locked, or its service not running
+func detectLockedKeyring(backend, keychainName string, err error) (keyringLock, bool) {
+	msg := strings.ToLower(err.Error())
+	contains := func(substrs ...string) bool {
+		for _, s := range substrs {
+			if strings.Contains(msg, s) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch backend {
+	case string(keyring.KeychainBackend):
+		if contains("interaction is not allowed", "passphrase you entered is not correct", "no keychain is available") {
+			keychain := keychainName + ".keychain"
+			return keyringLock{
+				remedy: fmt.Sprintf("Unlock it with 'security unlock-keychain %s', which is needed over SSH where macOS can't show its prompt", keychain),
+				unlock: []string{"security", "unlock-keychain", keychain},
+			}, true
+		}
+	case string(keyring.SecretServiceBackend):
+		if contains("org.freedesktop.secrets", "serviceunknown", "cannot autolaunch d-bus", "dbus_session_bus_address", "prompt dismissed") {
+			return keyringLock{
+				remedy: "Unlock your keyring from the desktop, or without one start it with 'dbus-run-session -- sh' " +
+					"and 'echo -n <password> | gnome-keyring-daemon --unlock', or use another backend with --backend",
+			}, true
+		}
+	case string(keyring.KWalletBackend):
+		if contains("org.kde.kwalletd", "serviceunknown") {
+			return keyringLock{
+				remedy: "Start KWallet from your desktop session, or use another backend with --backend",
+			}, true
+		}
+	}
+	return keyringLock{}, false
+}
+
+// unlockingKeyring offers to unlock the backend when it's locked, and retries, rather than failing
+// with the error of the backend
+type unlockingKeyring struct {
+	keyring.Keyring
+	backend      string
+	keychainName string
+}
+
+func (k *unlockingKeyring) Get(key string) (item keyring.Item, err error) {
+	err = k.retry(func() error {
+		item, err = k.Keyring.Get(key)
+		return err
+	})
+	return item, err
+}
+
+func (k *unlockingKeyring) GetMetadata(key string) (md keyring.Metadata, err error) {
+	err = k.retry(func() error {
+		md, err = k.Keyring.GetMetadata(key)
+		return err
+	})
+	return md, err
+}
+
+func (k *unlockingKeyring) Set(item keyring.Item) error {
+	return k.retry(func() error {
+		return k.Keyring.Set(item)
+	})
+}
+
+func (k *unlockingKeyring) Remove(key string) error {
+	return k.retry(func() error {
+		return k.Keyring.Remove(key)
+	})
+}
+
+func (k *unlockingKeyring) Keys() (keys []string, err error) {
+	err = k.retry(func() error {
+		keys, err = k.Keyring.Keys()
+		return err
+	})
+	return keys, err
+}
+
+func (k *unlockingKeyring) retry(fn func() error) error {
+	return retryLockedKeyring(k.backend, k.keychainName, fn)
+}
+
+// retryLockedKeyring runs fn, and if it fails because the backend is locked, offers to unlock it and
+// run fn again. Without a terminal to ask on, the error says how to unlock the backend
+func retryLockedKeyring(backend, keychainName string, fn func() error) error {
+	for {
+		err := fn()
+		if err == nil || err == keyring.ErrKeyNotFound {
+			return err
+		}
+		lock, ok := detectLockedKeyring(backend, keychainName, err)
+		if !ok {
+			return err
+		}
+		lockedErr := &lockedKeyringError{backend: backend, remedy: lock.remedy, err: err}
+		log.Print(lockedErr.Error())
+
+		if prompt.Disabled || !isATerminal() {
+			return lockedErr
+		}
+		question := fmt.Sprintf("The %s backend is locked. Retry once you've unlocked it?", backend)
+		if len(lock.unlock) > 0 {
+			question = fmt.Sprintf("The %s backend is locked. Unlock it with '%s' and retry?", backend, strings.Join(lock.unlock, " "))
+		}
+		retry, confirmErr := prompt.TerminalConfirm(question)
+		if confirmErr != nil || !retry {
+			return lockedErr
+		}
+
+		if len(lock.unlock) > 0 {
+			cmd := osexec.Command(lock.unlock[0], lock.unlock[1:]...)
+			cmd.Stdin = os.Stdin
+			cmd.Stdout = os.Stderr
+			cmd.Stderr = os.Stderr
+			if err = cmd.Run(); err != nil {
+				return fmt.Errorf("%w. Unlocking failed: %s", lockedErr, err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/99designs/keyring"
+)
+
+func TestDetectLockedKeyring(t *testing.T) {
+	cases := []struct {
+		backend string
+		err     string
+		locked  bool
+	}{
+		{"keychain", "User interaction is not allowed.", true},
+		{"keychain", "The specified item could not be found in the keychain.", false},
+		{"secret-service", "The name org.freedesktop.secrets was not provided by any .service files", true},
+		{"secret-service", "dbus: Cannot autolaunch D-Bus without X11 $DISPLAY", true},
+		{"file", "User interaction is not allowed.", false},
+	}
+	for _, c := range cases {
+		lock, ok := detectLockedKeyring(c.backend, "aws-vault", errors.New(c.err))
+		if ok != c.locked {
+			t.Errorf("Expected %s error %q locked to be %v", c.backend, c.err, c.locked)
+		}
+		if ok && lock.remedy == "" {
+			t.Errorf("Expected a remedy for %s error %q", c.backend, c.err)
+		}
+	}
+
+	lock, _ := detectLockedKeyring("keychain", "aws-vault", errors.New("User interaction is not allowed."))
+	if strings.Join(lock.unlock, " ") != "security unlock-keychain aws-vault.keychain" {
+		t.Errorf("Expected the keychain to be unlocked with security, got %v", lock.unlock)
+	}
+}
+
+func TestUnlockingKeyringReturnsRemedy(t *testing.T) {
+	backendErr := errors.New("User interaction is not allowed.")
+	calls := 0
+	err := retryLockedKeyring("keychain", "aws-vault", func() error {
+		calls++
+		return backendErr
+	})
+
+	var lockedErr *lockedKeyringError
+	if !errors.As(err, &lockedErr) || !errors.Is(err, backendErr) {
+		t.Fatalf("Expected a locked keyring error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "security unlock-keychain") {
+		t.Errorf("Expected the error to say how to unlock the keychain, got %q", err.Error())
+	}
+	if calls != 1 {
+		t.Errorf("Expected no retry without a terminal, got %d calls", calls)
+	}
+
+	if err = retryLockedKeyring("keychain", "aws-vault", func() error { return keyring.ErrKeyNotFound }); err != keyring.ErrKeyNotFound {
+		t.Errorf("Expected ErrKeyNotFound to be returned as is, got %v", err)
+	}
+}
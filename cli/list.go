@@ -1,8 +1,12 @@
 package cli
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"log"
 	"os"
+	"path"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -13,11 +17,37 @@ import (
 )
 
 type ListCommandInput struct {
-	OnlyProfiles    bool
-	OnlySessions    bool
-	OnlyCredentials bool
+	OnlyProfiles        bool
+	OnlySessions        bool
+	OnlyCredentials     bool
+	Format              string
+	OnlyWithProfile     bool
+	OnlyWithCredentials bool
+	OnlyWithSessions    bool
+	Pattern             string
 }
 
+// matches reports whether a row should be listed given the filtering flags
+func (input ListCommandInput) matches(name string, hasCredentials, hasSessions bool) bool {
+	if input.OnlyWithCredentials && !hasCredentials {
+		return false
+	}
+	if input.OnlyWithSessions && !hasSessions {
+		return false
+	}
+	if input.Pattern != "" {
+		matched, _ := path.Match(input.Pattern, name)
+		return matched
+	}
+	return true
+}
+
+var (
+	ListFormatTable = "table"
+	ListFormatJSON  = "json"
+	ListFormatCSV   = "csv"
+)
+
 func ConfigureListCommand(app *kingpin.Application, a *AwsVault) {
 	input := ListCommandInput{}
 
@@ -33,6 +63,22 @@ func ConfigureListCommand(app *kingpin.Application, a *AwsVault) {
 	cmd.Flag("credentials", "Show only the profiles with stored credential").
 		BoolVar(&input.OnlyCredentials)
 
+	cmd.Flag("format", fmt.Sprintf("Output format. Valid values are %s, %s and %s", ListFormatTable, ListFormatJSON, ListFormatCSV)).
+		Default(ListFormatTable).
+		EnumVar(&input.Format, ListFormatTable, ListFormatJSON, ListFormatCSV)
+
+	cmd.Flag("only-with-profile", "Don't show credentials and sessions that have no profile").
+		BoolVar(&input.OnlyWithProfile)
+
+	cmd.Flag("only-with-credentials", "Show only profiles with stored credentials").
+		BoolVar(&input.OnlyWithCredentials)
+
+	cmd.Flag("only-with-sessions", "Show only profiles with cached sessions").
+		BoolVar(&input.OnlyWithSessions)
+
+	cmd.Arg("pattern", "Show only profiles with a name matching this glob pattern, e.g. 'work-*'").
+		StringVar(&input.Pattern)
+
 	cmd.Action(func(c *kingpin.ParseContext) (err error) {
 		keyring, err := a.Keyring()
 		if err != nil {
@@ -43,7 +89,7 @@ func ConfigureListCommand(app *kingpin.Application, a *AwsVault) {
 			return err
 		}
 		err = ListCommand(input, awsConfigFile, keyring)
-		app.FatalIfError(err, "list")
+		fatalIfError(app, err, "list")
 		return nil
 	})
 }
@@ -71,10 +117,46 @@ func (ss stringslice) has(s string) bool {
 }
 
 func sessionLabel(sess vault.SessionMetadata) string {
-	return fmt.Sprintf("%s:%s", sess.Type, time.Until(sess.Expiration).Truncate(time.Second))
+	remaining := time.Until(sess.Expiration).Truncate(time.Second)
+	if remaining <= 0 {
+		return fmt.Sprintf("%s:expired", sess.Type)
+	}
+	return fmt.Sprintf("%s:%s", sess.Type, remaining)
+}
+
+// formatKeyAge formats the age of stored credentials in days, or hours for recently added ones
+func formatKeyAge(age time.Duration) string {
+	if age < 24*time.Hour {
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(age.Hours()/24))
+}
+
+// credentialLabeler returns labels for stored credentials that include the age of the key. The
+// age is only looked up when a label is needed, and is looked up once per credentials name
+func credentialLabeler(credentialKeyring *vault.CredentialKeyring) func(string) string {
+	labels := map[string]string{}
+	return func(credentialsName string) string {
+		if l, ok := labels[credentialsName]; ok {
+			return l
+		}
+		l := credentialsName
+		lastModified, err := credentialKeyring.LastModified(credentialsName)
+		if err != nil {
+			log.Printf("Couldn't get age of credentials %s: %s", credentialsName, err.Error())
+		} else if !lastModified.IsZero() {
+			l = fmt.Sprintf("%s (%s old)", credentialsName, formatKeyAge(time.Since(lastModified)))
+		}
+		labels[credentialsName] = l
+		return l
+	}
 }
 
 func ListCommand(input ListCommandInput, awsConfigFile *vault.ConfigFile, keyring keyring.Keyring) (err error) {
+	if _, err := path.Match(input.Pattern, ""); err != nil {
+		return fmt.Errorf("Invalid pattern %q: %w", input.Pattern, err)
+	}
+
 	credentialKeyring := &vault.CredentialKeyring{Keyring: keyring}
 	oidcTokenKeyring := &vault.OIDCTokenKeyring{Keyring: credentialKeyring.Keyring}
 	sessionKeyring := &vault.SessionKeyring{Keyring: credentialKeyring.Keyring}
@@ -95,35 +177,112 @@ func ListCommand(input ListCommandInput, awsConfigFile *vault.ConfigFile, keyrin
 	}
 
 	allSessionLabels := []string{}
+	tokenLabels := map[string]string{}
 	for _, t := range tokens {
-		allSessionLabels = append(allSessionLabels, fmt.Sprintf("oidc:%s", t))
+		status, err := oidcTokenKeyring.Status("", t)
+		if err != nil {
+			return err
+		}
+		tokenLabels[t] = ssoTokenLabel(status)
+		allSessionLabels = append(allSessionLabels, tokenLabels[t])
 	}
 	for _, sess := range sessions {
 		allSessionLabels = append(allSessionLabels, sessionLabel(sess))
 	}
 
+	// hasSessions is whether the profile has cached sessions, or a cached token for its SSO start URL
+	hasSessions := func(profileName string) bool {
+		for _, sess := range sessions {
+			if sess.ProfileName == profileName {
+				return true
+			}
+		}
+		profileSection, _ := awsConfigFile.ProfileSection(profileName)
+		status, ok := ssoTokenStatus(awsConfigFile, oidcTokenKeyring, profileSection)
+		return ok && status.Cached
+	}
+
+	// listed is whether the profile's row would be listed given the filtering flags
+	listed := func(profileName string, hasSessions bool) (bool, error) {
+		if _, ok := awsConfigFile.ProfileSection(profileName); !ok && input.OnlyWithProfile {
+			return false, nil
+		}
+		hasCred, err := credentialKeyring.Has(profileName)
+		if err != nil {
+			return false, err
+		}
+		return input.matches(profileName, hasCred, hasSessions), nil
+	}
+
 	if input.OnlyCredentials {
 		for _, c := range credentialsNames {
-			fmt.Println(c)
+			if ok, err := listed(c, hasSessions(c)); err != nil {
+				return err
+			} else if ok {
+				fmt.Println(c)
+			}
 		}
 		return nil
 	}
 
 	if input.OnlyProfiles {
 		for _, profileName := range awsConfigFile.ProfileNames() {
-			fmt.Println(profileName)
+			if ok, err := listed(profileName, hasSessions(profileName)); err != nil {
+				return err
+			} else if ok {
+				fmt.Println(profileName)
+			}
 		}
 		return nil
 	}
 
 	if input.OnlySessions {
-		for _, l := range allSessionLabels {
-			fmt.Println(l)
+		filtered := input.Pattern != "" || input.OnlyWithCredentials || input.OnlyWithProfile
+		for _, t := range tokens {
+			// tokens aren't of a profile, so they're listed when a profile using them is
+			ok := !filtered
+			for _, profileName := range profilesUsingSSOStartURL(awsConfigFile, t) {
+				if ok {
+					break
+				}
+				if ok, err = listed(profileName, true); err != nil {
+					return err
+				}
+			}
+			if ok {
+				fmt.Println(tokenLabels[t])
+			}
+		}
+		for _, sess := range sessions {
+			if ok, err := listed(sess.ProfileName, true); err != nil {
+				return err
+			} else if ok {
+				fmt.Println(sessionLabel(sess))
+			}
 		}
 		return nil
 	}
 
+	if input.Format == ListFormatJSON || input.Format == ListFormatCSV {
+		allListings, err := getProfileListings(awsConfigFile, credentialKeyring, oidcTokenKeyring, credentialsNames, sessions)
+		if err != nil {
+			return err
+		}
+		listings := []ProfileListing{}
+		for _, l := range allListings {
+			_, hasProfile := awsConfigFile.ProfileSection(l.Profile)
+			if (hasProfile || !input.OnlyWithProfile) && input.matches(l.Profile, l.HasCredentials, l.HasSessions) {
+				listings = append(listings, l)
+			}
+		}
+		if input.Format == ListFormatJSON {
+			return printProfileListingsJSON(listings)
+		}
+		return printProfileListingsCSV(listings)
+	}
+
 	displayedSessionLabels := []string{}
+	credentialLabel := credentialLabeler(credentialKeyring)
 
 	w := tabwriter.NewWriter(os.Stdout, 25, 4, 2, ' ', 0)
 
@@ -132,25 +291,20 @@ func ListCommand(input ListCommandInput, awsConfigFile *vault.ConfigFile, keyrin
 
 	// list out known profiles first
 	for _, profileName := range awsConfigFile.ProfileNames() {
-		fmt.Fprintf(w, "%s\t", profileName)
-
 		hasCred, err := credentialKeyring.Has(profileName)
 		if err != nil {
 			return err
 		}
 
-		if hasCred {
-			fmt.Fprintf(w, "%s\t", profileName)
-		} else {
-			fmt.Fprintf(w, "-\t")
-		}
-
 		var sessionLabels []string
 
 		// check oidc keyring
-		if profileSection, ok := awsConfigFile.ProfileSection(profileName); ok {
-			if exists, _ := oidcTokenKeyring.Has(profileSection.SSOStartURL); exists {
-				sessionLabels = append(sessionLabels, fmt.Sprintf("oidc:%s", profileSection.SSOStartURL))
+		profileSection, _ := awsConfigFile.ProfileSection(profileName)
+		if status, ok := ssoTokenStatus(awsConfigFile, oidcTokenKeyring, profileSection); ok && status.Cached {
+			sessionLabels = append(sessionLabels, ssoTokenLabel(status))
+			// an expired token in the keyring isn't listed on its own when the AWS CLI's is used instead
+			if l, ok := tokenLabels[status.StartURL]; ok {
+				displayedSessionLabels = append(displayedSessionLabels, l)
 			}
 		}
 
@@ -161,27 +315,44 @@ func ListCommand(input ListCommandInput, awsConfigFile *vault.ConfigFile, keyrin
 			}
 		}
 
+		// sessions of filtered out profiles still count as displayed, so they aren't listed without a profile below
+		displayedSessionLabels = append(displayedSessionLabels, sessionLabels...)
+
+		if !input.matches(profileName, hasCred, len(sessionLabels) > 0) {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s\t", profileName)
+
+		if hasCred {
+			fmt.Fprintf(w, "%s\t", credentialLabel(profileName))
+		} else {
+			fmt.Fprintf(w, "-\t")
+		}
+
 		if len(sessionLabels) > 0 {
 			fmt.Fprintf(w, "%s\t\n", strings.Join(sessionLabels, ", "))
 		} else {
 			fmt.Fprintf(w, "-\t\n")
 		}
-
-		displayedSessionLabels = append(displayedSessionLabels, sessionLabels...)
 	}
 
-	// show credentials that don't have profiles
-	for _, credentialName := range credentialsNames {
-		_, ok := awsConfigFile.ProfileSection(credentialName)
-		if !ok {
-			fmt.Fprintf(w, "-\t%s\t-\t\n", credentialName)
+	if !input.OnlyWithProfile {
+		// show credentials that don't have profiles
+		for _, credentialName := range credentialsNames {
+			_, ok := awsConfigFile.ProfileSection(credentialName)
+			if !ok && input.matches(credentialName, true, false) {
+				fmt.Fprintf(w, "-\t%s\t-\t\n", credentialLabel(credentialName))
+			}
 		}
-	}
 
-	// show sessions that don't have profiles
-	sessionsWithoutProfiles := stringslice(allSessionLabels).remove(displayedSessionLabels)
-	for _, s := range sessionsWithoutProfiles {
-		fmt.Fprintf(w, "-\t-\t%s\t\n", s)
+		// show sessions that don't have profiles
+		if input.Pattern == "" && !input.OnlyWithCredentials {
+			sessionsWithoutProfiles := stringslice(allSessionLabels).remove(displayedSessionLabels)
+			for _, s := range sessionsWithoutProfiles {
+				fmt.Fprintf(w, "-\t-\t%s\t\n", s)
+			}
+		}
 	}
 
 	if err = w.Flush(); err != nil {
@@ -190,3 +361,192 @@ func ListCommand(input ListCommandInput, awsConfigFile *vault.ConfigFile, keyrin
 
 	return nil
 }
+
+// ProfileListing is the structured form of a profile as printed by list --format
+type ProfileListing struct {
+	Profile                 string                  `json:"profile"`
+	CredentialType          string                  `json:"credential_type"`
+	SourceChain             []string                `json:"source_chain"`
+	Region                  string                  `json:"region"`
+	HasCredentials          bool                    `json:"has_credentials"`
+	CredentialsLastModified *time.Time              `json:"credentials_last_modified,omitempty"`
+	HasSessions             bool                    `json:"has_sessions"`
+	Sessions                []ProfileListingSession `json:"sessions"`
+}
+
+// ProfileListingSession is a cached session belonging to a ProfileListing
+type ProfileListingSession struct {
+	Type       string     `json:"type"`
+	Expiration *time.Time `json:"expiration,omitempty"`
+	// Refreshable, NeedsSignIn and FromAWSCLI describe SSO tokens
+	Refreshable bool `json:"refreshable,omitempty"`
+	NeedsSignIn bool `json:"needs_sign_in,omitempty"`
+	FromAWSCLI  bool `json:"from_aws_cli,omitempty"`
+}
+
+// ssoTokenStatus is the state of the SSO token of the profile, if it uses SSO
+func ssoTokenStatus(awsConfigFile *vault.ConfigFile, oidcTokenKeyring *vault.OIDCTokenKeyring, profileSection vault.ProfileSection) (vault.SSOTokenStatus, bool) {
+	startURL := profileSSOStartURL(awsConfigFile, profileSection)
+	if startURL == "" {
+		return vault.SSOTokenStatus{}, false
+	}
+
+	status, err := oidcTokenKeyring.Status(profileSection.SSOSession, startURL)
+	if err != nil {
+		log.Printf("Couldn't get the SSO token for %s: %s", startURL, err.Error())
+	}
+	return status, true
+}
+
+// ssoTokenLabel describes the SSO token and when it expires. An expired token that can be
+// refreshed doesn't need signing in again
+func ssoTokenLabel(status vault.SSOTokenStatus) string {
+	remaining := time.Until(status.Expiration).Truncate(time.Second)
+	switch {
+	case remaining > 0 && status.FromAWSCLI:
+		return fmt.Sprintf("oidc:%s:%s (aws cli)", status.StartURL, remaining)
+	case remaining > 0:
+		return fmt.Sprintf("oidc:%s:%s", status.StartURL, remaining)
+	case status.HasRefreshToken:
+		return fmt.Sprintf("oidc:%s:expired, refreshable", status.StartURL)
+	}
+	return fmt.Sprintf("oidc:%s:expired", status.StartURL)
+}
+
+// credentialType describes where the credentials for a profile come from
+func credentialType(profileSection vault.ProfileSection, hasCredentials bool) string {
+	switch {
+	case profileSection.SSOStartURL != "" || profileSection.SSOSession != "":
+		return "sso"
+	case profileSection.WebIdentityTokenFile != "" || profileSection.WebIdentityTokenProcess != "":
+		return "web_identity"
+	case profileSection.CredentialProcess != "":
+		return "credential_process"
+	case profileSection.CredentialPlugin != "":
+		return "credential_plugin"
+	case profileSection.RoleARN != "":
+		return "assume_role"
+	case hasCredentials:
+		return "stored"
+	}
+	return "none"
+}
+
+// sourceChain returns the chain of source_profile names followed from the given profile, stopping at loops
+func sourceChain(awsConfigFile *vault.ConfigFile, profileName string) []string {
+	chain := []string{}
+	visited := stringslice{profileName}
+	for {
+		profileSection, _ := awsConfigFile.ProfileSection(profileName)
+		next := profileSection.SourceProfile
+		if next == "" || visited.has(next) {
+			return chain
+		}
+		chain = append(chain, next)
+		visited = append(visited, next)
+		profileName = next
+	}
+}
+
+func getProfileListings(awsConfigFile *vault.ConfigFile, credentialKeyring *vault.CredentialKeyring, oidcTokenKeyring *vault.OIDCTokenKeyring, credentialsNames []string, sessions []vault.SessionMetadata) ([]ProfileListing, error) {
+	listings := []ProfileListing{}
+
+	newListing := func(profileName string, profileSection vault.ProfileSection) (ProfileListing, error) {
+		hasCred, err := credentialKeyring.Has(profileName)
+		if err != nil {
+			return ProfileListing{}, err
+		}
+
+		l := ProfileListing{
+			Profile:        profileName,
+			CredentialType: credentialType(profileSection, hasCred),
+			SourceChain:    sourceChain(awsConfigFile, profileName),
+			Region:         profileSection.Region,
+			HasCredentials: hasCred,
+			Sessions:       []ProfileListingSession{},
+		}
+
+		if status, ok := ssoTokenStatus(awsConfigFile, oidcTokenKeyring, profileSection); ok && status.Cached {
+			expiration := status.Expiration
+			l.Sessions = append(l.Sessions, ProfileListingSession{
+				Type:        "oidc",
+				Expiration:  &expiration,
+				Refreshable: status.HasRefreshToken,
+				NeedsSignIn: status.NeedsSignIn(),
+				FromAWSCLI:  status.FromAWSCLI,
+			})
+		}
+		for _, sess := range sessions {
+			if sess.ProfileName == profileName {
+				expiration := sess.Expiration
+				l.Sessions = append(l.Sessions, ProfileListingSession{Type: sess.Type, Expiration: &expiration})
+			}
+		}
+		l.HasSessions = len(l.Sessions) > 0
+
+		if hasCred {
+			lastModified, err := credentialKeyring.LastModified(profileName)
+			if err != nil {
+				log.Printf("Couldn't get age of credentials %s: %s", profileName, err.Error())
+			} else if !lastModified.IsZero() {
+				l.CredentialsLastModified = &lastModified
+			}
+		}
+
+		return l, nil
+	}
+
+	for _, profileSection := range awsConfigFile.ProfileSections() {
+		l, err := newListing(profileSection.Name, profileSection)
+		if err != nil {
+			return nil, err
+		}
+		listings = append(listings, l)
+	}
+
+	// credentials that don't have profiles
+	for _, credentialName := range credentialsNames {
+		if profileSection, ok := awsConfigFile.ProfileSection(credentialName); !ok {
+			l, err := newListing(credentialName, profileSection)
+			if err != nil {
+				return nil, err
+			}
+			listings = append(listings, l)
+		}
+	}
+
+	return listings, nil
+}
+
+func printProfileListingsJSON(listings []ProfileListing) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(listings)
+}
+
+func printProfileListingsCSV(listings []ProfileListing) error {
+	w := csv.NewWriter(os.Stdout)
+	_ = w.Write([]string{"profile", "credential_type", "source_chain", "region", "has_credentials", "credentials_last_modified", "has_sessions", "sessions"})
+	for _, l := range listings {
+		sessionTypes := []string{}
+		for _, sess := range l.Sessions {
+			sessionTypes = append(sessionTypes, sess.Type)
+		}
+		credentialsAge := ""
+		if l.CredentialsLastModified != nil {
+			credentialsAge = l.CredentialsLastModified.Format(time.RFC3339)
+		}
+		_ = w.Write([]string{
+			l.Profile,
+			l.CredentialType,
+			strings.Join(l.SourceChain, " "),
+			l.Region,
+			fmt.Sprint(l.HasCredentials),
+			credentialsAge,
+			fmt.Sprint(l.HasSessions),
+			strings.Join(sessionTypes, " "),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -1,8 +1,15 @@
 package cli
 
 import (
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
 	"github.com/alecthomas/kingpin"
 
+	"github.com/99designs/aws-vault/v7/vault"
 	"github.com/99designs/keyring"
 )
 
@@ -20,3 +27,81 @@ func ExampleListCommand() {
 	// Output:
 	// llamas
 }
+
+func ExampleListCommand_pattern() {
+	app := kingpin.New("aws-vault", "")
+	awsVault := ConfigureGlobals(app)
+	awsVault.keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+		{Key: "alpacas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+	ConfigureListCommand(app, awsVault)
+	kingpin.MustParse(app.Parse([]string{
+		"list", "--credentials", "ll*",
+	}))
+
+	// Output:
+	// llamas
+}
+
+func ExampleListCommand_filters() {
+	dir, err := os.MkdirTemp("", "aws-vault")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config")
+	if err := os.WriteFile(configPath, []byte("[profile llamas]\n[profile alpacas]\n[profile vicunas]\n"), 0600); err != nil {
+		log.Fatal(err)
+	}
+	awsConfigFile, err := vault.LoadConfig(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	alpacasSession := vault.SessionMetadata{Type: "sts.GetSessionToken", ProfileName: "alpacas", Expiration: expired}
+	guanacosSession := vault.SessionMetadata{Type: "sts.AssumeRole", ProfileName: "guanacos", Expiration: expired}
+	kr := keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+		{Key: "guanacos", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+		{Key: alpacasSession.String()},
+		{Key: guanacosSession.String()},
+	})
+
+	for _, input := range []ListCommandInput{
+		{OnlyProfiles: true, OnlyWithCredentials: true},
+		{OnlyProfiles: true, OnlyWithSessions: true},
+		{OnlyCredentials: true, OnlyWithProfile: true},
+		{OnlySessions: true, Pattern: "alp*"},
+	} {
+		if err := ListCommand(input, awsConfigFile, kr); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Output:
+	// llamas
+	// alpacas
+	// llamas
+	// sts.GetSessionToken:expired
+}
+
+func TestSSOTokenLabel(t *testing.T) {
+	startURL := "https://example.awsapps.com/start"
+	cases := []struct {
+		status   vault.SSOTokenStatus
+		expected string
+	}{
+		{vault.SSOTokenStatus{StartURL: startURL, Cached: true, Expiration: time.Now().Add(time.Hour + time.Second)}, "oidc:" + startURL + ":1h0m0s"},
+		{vault.SSOTokenStatus{StartURL: startURL, Cached: true, Expiration: time.Now().Add(time.Hour + time.Second), FromAWSCLI: true}, "oidc:" + startURL + ":1h0m0s (aws cli)"},
+		{vault.SSOTokenStatus{StartURL: startURL, Cached: true, Expiration: time.Now().Add(-time.Hour), HasRefreshToken: true}, "oidc:" + startURL + ":expired, refreshable"},
+		{vault.SSOTokenStatus{StartURL: startURL, Cached: true, Expiration: time.Now().Add(-time.Hour)}, "oidc:" + startURL + ":expired"},
+	}
+	for _, c := range cases {
+		if l := ssoTokenLabel(c.status); l != c.expected {
+			t.Errorf("Expected %q, got %q", c.expected, l)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+)
+
+var (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+var (
+	accessKeyIDRegexp = regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{12}([A-Z0-9]{4})\b`)
+
+	// secret access keys are 40 characters, session tokens are longer. The tokens of the ECS server are
+	// base64url encoded, with - and _
+	secretRegexp = regexp.MustCompile(`[A-Za-z0-9/+=_-]{40,}`)
+
+	// auth headers and tokens, which may be shorter than the secrets above. The whole value is redacted, up
+	// to the end of the line or a quote, as it can have a scheme such as Bearer before the token
+	authHeaderRegexp = regexp.MustCompile(`(?i)\b(authorization|x-amz-security-token|x-aws-ec2-metadata-token|aws_container_authorization_token|signintoken)(["']?\s*[:=]\s*["']?)[^\r\n"']+`)
+)
+
+// redactSecrets removes AWS secrets from a log message, leaving the last 4 characters of access key IDs
+func redactSecrets(msg string) string {
+	msg = authHeaderRegexp.ReplaceAllString(msg, "$1$2[REDACTED]")
+	msg = secretRegexp.ReplaceAllString(msg, "[REDACTED]")
+	return accessKeyIDRegexp.ReplaceAllString(msg, "****************$1")
+}
+
+// logLevel infers the level of a log message, as aws-vault logs with the standard library logger
+func logLevel(msg string) string {
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.HasPrefix(lower, "error"), strings.HasPrefix(lower, "failed"):
+		return "error"
+	case strings.HasPrefix(lower, "warning"):
+		return "warn"
+	}
+	return "debug"
+}
+
+// redactingWriter removes secrets from log messages before writing them
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := r.w.Write([]byte(redactSecrets(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+type logEntry struct {
+	Time     string `json:"time"`
+	Level    string `json:"level"`
+	Msg      string `json:"msg"`
+	Profile  string `json:"profile,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// jsonLogWriter writes each log message as a line of JSON. The log package makes a single
+// Write call per message, so each call is treated as one message
+type jsonLogWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (j *jsonLogWriter) Write(p []byte) (int, error) {
+	if err := j.WriteFields(strings.TrimSuffix(string(p), "\n"), vault.LogFields{}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteFields writes a message logged by vault along with its fields
+func (j *jsonLogWriter) WriteFields(msg string, fields vault.LogFields) error {
+	msg = redactSecrets(msg)
+	entry := logEntry{
+		Time:     time.Now().UTC().Format(time.RFC3339Nano),
+		Level:    logLevel(msg),
+		Msg:      msg,
+		Profile:  fields.Profile,
+		Provider: fields.Provider,
+	}
+	if fields.Duration != 0 {
+		entry.Duration = fields.Duration.Round(time.Second).String()
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.w.Write(append(b, '\n'))
+	return err
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/skratchdot/open-golang/open"
 )
 
@@ -27,6 +29,8 @@ type LoginCommandInput struct {
 	Config          vault.Config
 	SessionDuration time.Duration
 	NoSession       bool
+	PolicyARNs      []string
+	Policy          string
 }
 
 func ConfigureLoginCommand(app *kingpin.Application, a *AwsVault) {
@@ -36,7 +40,7 @@ func ConfigureLoginCommand(app *kingpin.Application, a *AwsVault) {
 
 	cmd.Flag("duration", "Duration of the assume-role or federated session. Defaults to 1h").
 		Short('d').
-		DurationVar(&input.SessionDuration)
+		SetValue(newDurationValue(&input.SessionDuration))
 
 	cmd.Flag("no-session", "Skip creating STS session with GetSessionToken").
 		Short('n').
@@ -50,8 +54,15 @@ func ConfigureLoginCommand(app *kingpin.Application, a *AwsVault) {
 		StringVar(&input.Path)
 
 	cmd.Flag("region", "The AWS region").
+		HintOptions(awsRegions...).
 		StringVar(&input.Config.Region)
 
+	cmd.Flag("policy-arn", "ARN of a managed IAM policy to scope down the console session. Can be specified multiple times").
+		StringsVar(&input.PolicyARNs)
+
+	cmd.Flag("policy", "An IAM policy document, or file://path to one, to scope down the console session").
+		StringVar(&input.Policy)
+
 	cmd.Flag("stdout", "Print login URL to stdout instead of opening in default browser").
 		Short('s').
 		BoolVar(&input.UseStdout)
@@ -69,19 +80,43 @@ func ConfigureLoginCommand(app *kingpin.Application, a *AwsVault) {
 		if err != nil {
 			return err
 		}
+		input.Config = a.globalConfig(input.Config)
+
 		f, err := a.AwsConfigFile()
 		if err != nil {
 			return err
 		}
 
 		err = LoginCommand(input, f, keyring)
-		app.FatalIfError(err, "login")
+		fatalIfError(app, err, "login")
 		return nil
 	})
 }
 
+// Login signs in to the AWS console with a profile, see NewLogin
+type Login struct {
+	env CommandEnv
+}
+
+// NewLogin returns the login command, using the keyring, AWS config and stdio of the env
+func NewLogin(env CommandEnv) *Login {
+	return &Login{env: env.withDefaults()}
+}
+
 func LoginCommand(input LoginCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
-	vault.UseSession = !input.NoSession
+	return NewLogin(CommandEnv{Keyring: keyring, ConfigFile: f}).Run(input)
+}
+
+// Run opens the AWS console signed in with the profile of the input
+func (c *Login) Run(input LoginCommandInput) error {
+	ctx, f, keyring := c.env.Context, c.env.ConfigFile, c.env.Keyring
+	var err error
+	input.ProfileName, err = resolveProfileName(input.ProfileName, f, keyring, input.Config)
+	if err != nil {
+		return err
+	}
+
+	input.Config.NoSession = input.NoSession
 
 	configLoader := vault.ConfigLoader{
 		File:          f,
@@ -93,8 +128,22 @@ func LoginCommand(input LoginCommandInput, f *vault.ConfigFile, keyring keyring.
 		return fmt.Errorf("Error loading config: %w", err)
 	}
 
+	// Session policies given on the command line only apply to the target profile, not its source profiles
+	if len(input.PolicyARNs) > 0 {
+		config.SessionPolicyARNs = input.PolicyARNs
+	}
+	if input.Policy != "" {
+		config.SessionPolicy, err = readPolicyDocument(input.Policy)
+		if err != nil {
+			return err
+		}
+	}
+
 	var credsProvider aws.CredentialsProvider
 
+	// checkSessionType is set when the credentials could be a session from GetSessionToken
+	checkSessionType := false
+
 	if input.ProfileName == "" {
 		// When no profile is specified, source credentials from the environment
 		configFromEnv, err := awsconfig.NewEnvConfig()
@@ -102,33 +151,60 @@ func LoginCommand(input LoginCommandInput, f *vault.ConfigFile, keyring keyring.
 			return fmt.Errorf("unable to authenticate to AWS through your environment variables: %w", err)
 		}
 		credsProvider = credentials.StaticCredentialsProvider{Value: configFromEnv.Credentials}
+		if configFromEnv.Credentials.SessionToken != "" && config.HasSessionPolicy() {
+			return fmt.Errorf("session policies can't be applied to the temporary credentials in your environment variables")
+		}
 		if configFromEnv.Credentials.SessionToken == "" {
-			credsProvider, err = vault.NewFederationTokenProvider(context.TODO(), credsProvider, config)
+			credsProvider, err = vault.NewFederationTokenProvider(ctx, credsProvider, config)
 			if err != nil {
 				return err
 			}
+		} else {
+			checkSessionType = true
+		}
+	} else if config.HasSSOStartURL() {
+		// The AWS access portal can sign in to the console directly for SSO roles
+		if config.HasSessionPolicy() {
+			return fmt.Errorf("profile %s: session policies aren't supported for SSO role credentials", input.ProfileName)
 		}
+		_, destination := generateLoginURL(config.Region, input.Path)
+		if input.Path == "" && config.Region == "" {
+			destination = ""
+		}
+		openLoginURL(c.env.Stdio.Out, generateSSOLoginURL(config.SSOStartURL, config.SSOAccountID, config.SSORoleName, destination), input.UseStdout)
+		return nil
 	} else {
 		// Use a profile from the AWS config file
 		ckr := &vault.CredentialKeyring{Keyring: keyring}
-		if config.HasRole() || config.HasSSOStartURL() {
-			// If AssumeRole or sso.GetRoleCredentials isn't used, GetFederationToken has to be used for IAM credentials
+		if config.HasCredentialProcess() || config.HasCredentialPlugin() {
+			// The process or plugin may return a session from GetSessionToken, which can't log in, in
+			// which case the profile's role_arn is assumed with it
+			credsProvider, err = vault.NewTempCredentialsProvider(config, ckr)
+			checkSessionType = true
+		} else if config.HasRole() {
+			// If AssumeRole isn't used, GetFederationToken has to be used for IAM credentials
 			credsProvider, err = vault.NewTempCredentialsProvider(config, ckr)
 		} else {
-			credsProvider, err = vault.NewFederationTokenCredentialsProvider(context.TODO(), input.ProfileName, ckr, config)
+			credsProvider, err = vault.NewFederationTokenCredentialsProvider(ctx, input.ProfileName, ckr, config)
 		}
 		if err != nil {
 			return fmt.Errorf("profile %s: %w", input.ProfileName, err)
 		}
 	}
 
-	creds, err := credsProvider.Retrieve(context.TODO())
+	creds, err := credsProvider.Retrieve(ctx)
 	if err != nil {
 		return fmt.Errorf("Failed to get credentials: %w", err)
 	}
 	if creds.AccessKeyID == "" && input.ProfileName == "" {
 		return fmt.Errorf("argument 'profile' not provided, nor any AWS env vars found. Try --help")
 	}
+	if checkSessionType && creds.SessionToken != "" {
+		creds, err = getSigninCredentialsForSession(ctx, creds, config)
+		if err != nil {
+			return err
+		}
+	}
 
 	jsonBytes, err := json.Marshal(map[string]string{
 		"sessionId":    creds.AccessKeyID,
@@ -140,8 +216,12 @@ func LoginCommand(input LoginCommandInput, f *vault.ConfigFile, keyring keyring.
 	}
 
 	loginURLPrefix, destination := generateLoginURL(config.Region, input.Path)
+	if config.FederationEndpoint != "" {
+		log.Printf("Using federation endpoint %s", config.FederationEndpoint)
+		loginURLPrefix = config.FederationEndpoint
+	}
 
-	req, err := http.NewRequestWithContext(context.TODO(), "GET", loginURLPrefix, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", loginURLPrefix, nil)
 	if err != nil {
 		return err
 	}
@@ -155,7 +235,7 @@ func LoginCommand(input LoginCommandInput, f *vault.ConfigFile, keyring keyring.
 	q.Add("Session", string(jsonBytes))
 	req.URL.RawQuery = q.Encode()
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := vault.HTTPClient(config).Do(req)
 	if err != nil {
 		return err
 	}
@@ -186,14 +266,86 @@ func LoginCommand(input LoginCommandInput, f *vault.ConfigFile, keyring keyring.
 	loginURL := fmt.Sprintf("%s?Action=login&Issuer=aws-vault&Destination=%s&SigninToken=%s",
 		loginURLPrefix, url.QueryEscape(destination), url.QueryEscape(signinToken))
 
-	if input.UseStdout {
-		fmt.Println(loginURL)
-	} else if err = open.Run(loginURL); err != nil {
+	openLoginURL(c.env.Stdio.Out, loginURL, input.UseStdout)
+
+	return nil
+}
+
+// getSigninCredentialsForSession returns credentials that can sign in to the console. Sessions from
+// GetSessionToken can neither sign in nor call GetFederationToken, so a role is assumed with them instead
+func getSigninCredentialsForSession(ctx context.Context, creds aws.Credentials, config *vault.Config) (aws.Credentials, error) {
+	cfg := vault.NewAwsConfigWithCredsProvider(credentials.StaticCredentialsProvider{Value: creds}, config.Region, config.STSRegionalEndpoints)
+	vault.AddProfileProxy(&cfg, config)
+
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return creds, fmt.Errorf("Failed to get caller identity: %w", err)
+	}
+	arn := aws.ToString(identity.Arn)
+	assumeRole, err := needsSigninRole(arn, config)
+	if err != nil || !assumeRole {
+		return creds, err
+	}
+
+	log.Printf("Credentials for %s are a session from GetSessionToken, using AssumeRole %s to log in", arn, config.RoleARN)
+	vault.AddCredentialsIssuedHooks(&cfg, config)
+	p := &vault.AssumeRoleProvider{
+		StsClient:       sts.NewFromConfig(cfg),
+		RoleARN:         config.RoleARN,
+		RoleSessionName: config.RoleSessionName,
+		ExternalID:      config.ExternalID,
+		Duration:        config.AssumeRoleDuration,
+		SourceIdentity:  config.SourceIdentity,
+		Policy:          config.SessionPolicy,
+		PolicyARNs:      config.SessionPolicyARNs,
+		Mfa:             vault.NewMfa(config),
+	}
+	return p.Retrieve(ctx)
+}
+
+// needsSigninRole checks whether a session for the identity arn has to assume the profile's role to log
+// in to the console. Only sessions for IAM users and the root user come from GetSessionToken
+func needsSigninRole(arn string, config *vault.Config) (bool, error) {
+	if !strings.Contains(arn, ":user/") && !strings.HasSuffix(arn, ":root") {
+		return false, nil
+	}
+	if !config.HasRole() {
+		return false, fmt.Errorf("The credentials for %s are a session from GetSessionToken, which can't be used to log in to the console. "+
+			"Set role_arn (or AWS_ROLE_ARN) to log in with a role assumed from this session instead", arn)
+	}
+	return true, nil
+}
+
+func openLoginURL(w io.Writer, loginURL string, useStdout bool) {
+	if useStdout {
+		fmt.Fprintln(w, loginURL)
+	} else if err := open.Run(loginURL); err != nil {
 		log.Println(err)
-		fmt.Println(loginURL)
+		fmt.Fprintln(w, loginURL)
 	}
+}
 
-	return nil
+// generateSSOLoginURL returns a link to the AWS access portal that signs in to the console with the given SSO role
+func generateSSOLoginURL(startURL, accountID, roleName, destination string) string {
+	q := url.Values{}
+	q.Set("account_id", accountID)
+	q.Set("role_name", roleName)
+	if destination != "" {
+		q.Set("destination", destination)
+	}
+	return fmt.Sprintf("%s/#/console?%s", strings.TrimSuffix(startURL, "/"), q.Encode())
+}
+
+// readPolicyDocument returns the policy document, reading it from a file if given as file://path
+func readPolicyDocument(policy string) (string, error) {
+	if !strings.HasPrefix(policy, "file://") {
+		return policy, nil
+	}
+	b, err := os.ReadFile(strings.TrimPrefix(policy, "file://"))
+	if err != nil {
+		return "", fmt.Errorf("Error reading policy document: %w", err)
+	}
+	return string(b), nil
 }
 
 func generateLoginURL(region string, path string) (string, string) {
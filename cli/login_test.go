@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/99designs/aws-vault/v7/vault"
+)
+
+func TestNeedsSigninRole(t *testing.T) {
+	testCases := []struct {
+		arn      string
+		roleARN  string
+		expected bool
+		err      string
+	}{
+		{arn: "arn:aws:sts::123456789012:assumed-role/admin/session", expected: false},
+		{arn: "arn:aws:sts::123456789012:federated-user/jsmith", expected: false},
+		{arn: "arn:aws:iam::123456789012:user/jsmith", err: "Set role_arn"},
+		{arn: "arn:aws:iam::123456789012:root", err: "Set role_arn"},
+		{arn: "arn:aws:iam::123456789012:user/jsmith", roleARN: "arn:aws:iam::123456789012:role/admin", expected: true},
+		{arn: "arn:aws:iam::123456789012:root", roleARN: "arn:aws:iam::123456789012:role/admin", expected: true},
+	}
+
+	for _, tc := range testCases {
+		actual, err := needsSigninRole(tc.arn, &vault.Config{RoleARN: tc.roleARN})
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", tc.arn, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.arn, err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%s with role_arn %q: expected %v, got %v", tc.arn, tc.roleARN, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/alecthomas/kingpin"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// sessionEnvVars are the variables an aws-vault session may have set, which are removed from the
+// environment of aws-vault when nesting a session with --force
+var sessionEnvVars = []string{
+	"AWS_VAULT",
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_SECURITY_TOKEN",
+	"AWS_CREDENTIAL_EXPIRATION",
+	"AWS_REGION",
+	"AWS_DEFAULT_REGION",
+	"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN",
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+	"AWS_EC2_METADATA_SERVICE_ENDPOINT",
+	"AWS_EC2_METADATA_SERVICE_ENDPOINT_MODE",
+	credentialsFifoEnv,
+}
+
+// credentialEnvVars are the variables that give credentials to the AWS SDKs, refused with --require-clean
+var credentialEnvVars = []string{
+	"AWS_VAULT",
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_SECURITY_TOKEN",
+	"AWS_PROFILE",
+	"AWS_DEFAULT_PROFILE",
+	"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+	"AWS_WEB_IDENTITY_TOKEN_FILE",
+}
+
+// NestingInput controls starting a session inside another, which is refused by default
+type NestingInput struct {
+	Force        bool
+	RequireClean bool
+	Chain        bool
+}
+
+func (n *NestingInput) configureFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("force", "Start the session inside another aws-vault session, removing the variables of the outer one").
+		Envar("AWS_VAULT_FORCE").
+		BoolVar(&n.Force)
+
+	cmd.Flag("require-clean", "Refuse to start if the environment has any AWS credentials or profile, not only an aws-vault session").
+		Envar("AWS_VAULT_REQUIRE_CLEAN").
+		BoolVar(&n.RequireClean)
+
+	cmd.Flag("chain", "Assume the role of the profile with the credentials of the aws-vault session this is run in, rather than its source profile").
+		Envar("AWS_VAULT_CHAIN").
+		BoolVar(&n.Chain)
+}
+
+// checkNesting refuses to start a session inside another aws-vault session, as the credentials of the
+// outer session would be used to get the new ones. With Force, the variables of the outer session are
+// removed and it goes ahead. With RequireClean, any credentials in the environment are refused. With
+// Chain, the outer session is required, and its credentials are used by credentialsProvider
+func (n NestingInput) checkNesting() error {
+	if n.Force && n.RequireClean {
+		return fmt.Errorf("Can't use --force with --require-clean")
+	}
+	if n.Chain && (n.Force || n.RequireClean) {
+		return fmt.Errorf("Can't use --chain with --force or --require-clean")
+	}
+
+	if n.Chain {
+		if os.Getenv("AWS_VAULT") == "" {
+			return fmt.Errorf("--chain needs to be run inside an aws-vault session")
+		}
+		if os.Getenv("AWS_ACCESS_KEY_ID") == "" || os.Getenv("AWS_SECRET_ACCESS_KEY") == "" {
+			return fmt.Errorf("The aws-vault session for %s has no credentials in the environment to chain from, "+
+				"sessions using a credential server can't be chained", os.Getenv("AWS_VAULT"))
+		}
+		return nil
+	}
+
+	if n.RequireClean {
+		set := []string{}
+		for _, key := range credentialEnvVars {
+			if os.Getenv(key) != "" {
+				set = append(set, key)
+			}
+		}
+		if len(set) > 0 {
+			return fmt.Errorf("--require-clean is set, but the environment has %s", strings.Join(set, ", "))
+		}
+		return nil
+	}
+
+	outer := os.Getenv("AWS_VAULT")
+	if outer == "" {
+		return nil
+	}
+	if !n.Force {
+		return fmt.Errorf("Already in an aws-vault session for %s. Sessions should be nested with care, use --force to start one anyway", outer)
+	}
+
+	log.Printf("Nesting inside the session for %s, removing its variables", outer)
+	for _, key := range sessionEnvVars {
+		os.Unsetenv(key)
+	}
+	return nil
+}
+
+// credentialsProvider is the provider of the credentials of the new session. With Chain, the role of the
+// profile is assumed with the credentials of the outer session, whose variables are then removed
+func (n NestingInput) credentialsProvider(config *vault.Config, ckr *vault.CredentialKeyring) (aws.CredentialsProvider, error) {
+	if !n.Chain {
+		return vault.NewTempCredentialsProvider(config, ckr)
+	}
+
+	outer := os.Getenv("AWS_VAULT")
+	parent := aws.Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Source:          "aws-vault session " + outer,
+	}
+
+	log.Printf("Chaining from the session for %s to assume %s", outer, config.RoleARN)
+	for _, key := range sessionEnvVars {
+		os.Unsetenv(key)
+	}
+
+	return vault.NewChainedAssumeRoleProvider(parent, config)
+}
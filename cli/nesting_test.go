@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCheckNesting(t *testing.T) {
+	t.Setenv("AWS_VAULT", "outer")
+	t.Setenv("AWS_ACCESS_KEY_ID", "ABC")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	if err := (NestingInput{}).checkNesting(); err == nil {
+		t.Fatal("Expected an error inside a session")
+	}
+	if err := (NestingInput{RequireClean: true}).checkNesting(); err == nil {
+		t.Fatal("Expected an error with --require-clean")
+	}
+
+	if err := (NestingInput{Force: true}).checkNesting(); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"AWS_VAULT", "AWS_ACCESS_KEY_ID", "AWS_REGION"} {
+		if _, ok := os.LookupEnv(key); ok {
+			t.Errorf("Expected %s to be removed with --force", key)
+		}
+	}
+
+	t.Setenv("AWS_PROFILE", "work")
+	if err := (NestingInput{}).checkNesting(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (NestingInput{RequireClean: true}).checkNesting(); err == nil {
+		t.Fatal("Expected an error with --require-clean and AWS_PROFILE")
+	}
+}
+
+func TestCheckNestingChain(t *testing.T) {
+	if err := (NestingInput{Chain: true}).checkNesting(); err == nil {
+		t.Fatal("Expected an error with --chain outside a session")
+	}
+
+	t.Setenv("AWS_VAULT", "outer")
+	if err := (NestingInput{Chain: true}).checkNesting(); err == nil {
+		t.Fatal("Expected an error with --chain in a session without credentials in the environment")
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "ABC")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "XYZ")
+	if err := (NestingInput{Chain: true, Force: true}).checkNesting(); err == nil {
+		t.Fatal("Expected an error with --chain and --force")
+	}
+	if err := (NestingInput{Chain: true}).checkNesting(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+)
+
+// matchProfilePrefix accepts a unique prefix of a profile name, set with --match-prefix
+var matchProfilePrefix bool
+
+// resolveProfileName checks that a profile is in the config file or has credentials in the keyring.
+// If not, it's matched as a unique prefix with --match-prefix, or the closest names are suggested. Any name
+// is accepted when the base config of the command gives every profile fake credentials
+func resolveProfileName(name string, f *vault.ConfigFile, k keyring.Keyring, base vault.Config) (string, error) {
+	if name == "" {
+		return name, nil
+	}
+	if _, ok := f.ProfileSection(name); ok || base.CredentialType == vault.CredentialTypeFake {
+		return name, nil
+	}
+
+	credentialNames, err := (&vault.CredentialKeyring{Keyring: k}).Keys()
+	if err != nil {
+		return "", err
+	}
+
+	names := f.ProfileNames()
+	for _, n := range credentialNames {
+		if n == name {
+			return name, nil
+		}
+		if !containsString(names, n) {
+			names = append(names, n)
+		}
+	}
+
+	if matchProfilePrefix {
+		matches := []string{}
+		for _, n := range names {
+			if strings.HasPrefix(n, name) {
+				matches = append(matches, n)
+			}
+		}
+		if len(matches) == 1 {
+			log.Printf("Using profile '%s' for '%s'", matches[0], name)
+			return matches[0], nil
+		}
+		if len(matches) > 1 {
+			sort.Strings(matches)
+			return "", fmt.Errorf("Profile '%s' matches more than one profile: %s", name, strings.Join(matches, ", "))
+		}
+	}
+
+	return "", &profileNotFoundError{Name: name, Suggestions: suggestProfileNames(name, names)}
+}
+
+// profileNotFoundError is the error for a profile that isn't in the config file or the keyring
+type profileNotFoundError struct {
+	Name        string
+	Suggestions []string
+}
+
+func (e *profileNotFoundError) Error() string {
+	switch len(e.Suggestions) {
+	case 0:
+		return fmt.Sprintf("Profile '%s' not found in your AWS config or the keyring", e.Name)
+	case 1:
+		return fmt.Sprintf("Profile '%s' not found, did you mean %s?", e.Name, e.Suggestions[0])
+	default:
+		return fmt.Sprintf("Profile '%s' not found, did you mean one of %s?", e.Name, strings.Join(e.Suggestions, ", "))
+	}
+}
+
+// maxProfileSuggestions is the number of profile names suggested for an unknown profile
+const maxProfileSuggestions = 3
+
+// suggestProfileNames finds the names closest to name by edit distance, and names containing it
+func suggestProfileNames(name string, names []string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+
+	maxDistance := len(name) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+
+	candidates := []candidate{}
+	for _, n := range names {
+		d := editDistance(strings.ToLower(name), strings.ToLower(n))
+		if d <= maxDistance || strings.Contains(strings.ToLower(n), strings.ToLower(name)) {
+			candidates = append(candidates, candidate{n, d})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	suggestions := []string{}
+	for i := 0; i < len(candidates) && i < maxProfileSuggestions; i++ {
+		suggestions = append(suggestions, candidates[i].name)
+	}
+	return suggestions
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggestProfileNames(t *testing.T) {
+	names := []string{"dev", "prod-admin", "prod-read", "staging-admin"}
+
+	cases := []struct {
+		name string
+		want []string
+	}{
+		{"prod-admn", []string{"prod-admin"}},
+		{"PROD-READ", []string{"prod-read"}},
+		{"admin", []string{"prod-admin", "staging-admin"}},
+		{"xyzzy", []string{}},
+	}
+
+	for _, c := range cases {
+		if got := suggestProfileNames(c.name, names); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("suggestProfileNames(%q) = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	if d := editDistance("kitten", "sitting"); d != 3 {
+		t.Errorf("Expected 3, got %d", d)
+	}
+	if d := editDistance("", "abc"); d != 3 {
+		t.Errorf("Expected 3, got %d", d)
+	}
+}
@@ -1,41 +1,226 @@
 package cli
 
 import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"strconv"
+	"strings"
 
 	"github.com/99designs/aws-vault/v7/server"
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
 	"github.com/alecthomas/kingpin"
 )
 
+type ProxyCommandInput struct {
+	Stop    bool
+	IPv6    bool
+	Routes  []string
+	RouteBy string
+	Listen  string
+	Host    string
+	Output  string
+	Lazy    bool
+	Config  vault.Config
+}
+
+// proxyRoute sends the requests of a docker-compose service or container to a profile
+type proxyRoute struct {
+	Name        string
+	ProfileName string
+}
+
 func ConfigureProxyCommand(app *kingpin.Application, a *AwsVault) {
-	stop := false
+	input := ProxyCommandInput{}
+
+	cmd := app.Command("proxy", "Start a credential server that serves a profile to each docker-compose service, or with no routes, the EC2 metadata endpoint proxy used by exec --ec2-server-proxy.").
+		Alias("server")
+
+	cmd.Flag("stop", "Stop the EC2 metadata endpoint proxy").
+		BoolVar(&input.Stop)
+
+	cmd.Flag("ipv6", "Also listen on the IPv6 EC2 metadata endpoint, fd00:ec2::254").
+		BoolVar(&input.IPv6)
+
+	cmd.Flag("route", "Serve a docker-compose service or container the credentials of a profile, as service=profile. Can be repeated").
+		StringsVar(&input.Routes)
+
+	cmd.Flag("route-by", fmt.Sprintf("How to choose the route of a request. Valid values are %s, giving each route its own Authorization token, and %s, using the container it comes from", server.RouteByToken, server.RouteByContainer)).
+		Default(server.RouteByToken).
+		EnumVar(&input.RouteBy, server.RouteByToken, server.RouteByContainer)
+
+	cmd.Flag("listen", "Address for the server to listen on. Defaults to the docker0 bridge on Linux, and 127.0.0.1 elsewhere").
+		StringVar(&input.Listen)
+
+	cmd.Flag("host", "Host name of the server as seen from containers").
+		Default(dockerHostName).
+		StringVar(&input.Host)
 
-	cmd := app.Command("proxy", "Start a proxy for the ec2 instance role server locally.").
-		Alias("server").
-		Hidden()
+	cmd.Flag("output", "Write the docker-compose override to this file instead of stdout").
+		Short('o').
+		StringVar(&input.Output)
 
-	cmd.Flag("stop", "Stop the proxy").
-		BoolVar(&stop)
+	cmd.Flag("region", "The AWS region").
+		HintOptions(awsRegions...).
+		StringVar(&input.Config.Region)
+
+	cmd.Flag("lazy", "Get credentials when they're first requested, rather than when the server starts").
+		BoolVar(&input.Lazy)
 
 	cmd.Action(func(*kingpin.ParseContext) error {
-		if stop {
-			server.StopProxy()
-			return nil
+		if len(input.Routes) == 0 {
+			if input.Stop {
+				server.StopProxy()
+				return nil
+			}
+			handleSigTerm()
+			return server.StartProxy(input.IPv6)
+		}
+
+		input.Config.MfaPromptMethod = a.PromptDriver(false)
+
+		input.Config = a.globalConfig(input.Config)
+
+		f, err := a.AwsConfigFile()
+		if err != nil {
+			return err
+		}
+		keyring, err := a.Keyring()
+		if err != nil {
+			return err
 		}
-		handleSigTerm()
-		return server.StartProxy()
+
+		err = ProxyCommand(input, f, keyring)
+		fatalIfError(app, err, "proxy")
+		return nil
 	})
 }
 
 func handleSigTerm() {
-	// shutdown
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	// shutdown, removing the network alias
+	done := interrupted()
 	go func() {
-		<-c
+		<-done
 		server.Shutdown()
-		os.Exit(1)
 	}()
 }
+
+// parseProxyRoutes parses routes given as service=profile
+func parseProxyRoutes(values []string) ([]proxyRoute, error) {
+	routes := []proxyRoute{}
+	for _, v := range values {
+		name, profileName, ok := strings.Cut(v, "=")
+		name, profileName = strings.TrimSpace(name), strings.TrimSpace(profileName)
+		if !ok || name == "" || profileName == "" {
+			return nil, fmt.Errorf("Invalid --route %q, use service=profile", v)
+		}
+		for _, r := range routes {
+			if r.Name == name {
+				return nil, fmt.Errorf("More than one --route for %s", name)
+			}
+		}
+		routes = append(routes, proxyRoute{Name: name, ProfileName: profileName})
+	}
+	return routes, nil
+}
+
+// ProxyCommand serves the credentials of several profiles on one ECS credential server, routing each
+// request to the profile of the docker-compose service it comes from, and prints a docker-compose
+// override giving the services what they need to use it
+func ProxyCommand(input ProxyCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
+	if input.Stop {
+		return fmt.Errorf("Can't use --stop with --route")
+	}
+	if input.IPv6 {
+		return fmt.Errorf("Can't use --ipv6 with --route")
+	}
+	routes, err := parseProxyRoutes(input.Routes)
+	if err != nil {
+		return err
+	}
+
+	if input.Listen == "" {
+		if input.Listen, err = defaultComposeEnvListenAddr(); err != nil {
+			return err
+		}
+	}
+
+	ckr := &vault.CredentialKeyring{Keyring: keyring}
+	ecsRoutes := []server.EcsRoute{}
+	regions := map[string]string{}
+	for _, route := range routes {
+		profileName, err := resolveProfileName(route.ProfileName, f, keyring, input.Config)
+		if err != nil {
+			return err
+		}
+		configLoader := vault.ConfigLoader{
+			File:          f,
+			BaseConfig:    input.Config,
+			ActiveProfile: profileName,
+		}
+		config, err := configLoader.LoadFromProfile(profileName)
+		if err != nil {
+			return fmt.Errorf("Error loading config for %s: %w", profileName, err)
+		}
+		credsProvider, err := vault.NewTempCredentialsProvider(config, ckr)
+		if err != nil {
+			return fmt.Errorf("Error getting temporary credentials for %s: %w", profileName, err)
+		}
+		ecsRoutes = append(ecsRoutes, server.EcsRoute{Name: route.Name, CredsProvider: credsProvider, Config: config})
+		regions[route.Name] = config.Region
+		log.Printf("Routing %s to profile %s", route.Name, profileName)
+	}
+
+	router, err := server.NewEcsRouter(rootCtx, input.Listen, input.RouteBy, ecsRoutes, input.Lazy)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := router.Serve()
+		if err != http.ErrServerClosed { // ErrServerClosed is a graceful close
+			log.Fatalf("proxy: %s", err.Error())
+		}
+	}()
+
+	serverURL := fmt.Sprintf("http://%s/", net.JoinHostPort(input.Host, strconv.Itoa(router.Port())))
+	tokens := map[string]string{}
+	services := []string{}
+	for _, route := range router.Routes() {
+		tokens[route.Name] = route.Token
+		services = append(services, route.Name)
+	}
+	var w io.Writer = os.Stdout
+	if input.Output != "" {
+		file, err := os.OpenFile(input.Output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	err = printComposeServicesEnv(w, "proxy", services, input.Host, func(service string) [][2]string {
+		env := [][2]string{
+			{"AWS_CONTAINER_CREDENTIALS_FULL_URI", serverURL},
+			{"AWS_CONTAINER_AUTHORIZATION_TOKEN", tokens[service]},
+		}
+		if region := regions[service]; region != "" {
+			env = append(env, [2]string{"AWS_REGION", region}, [2]string{"AWS_DEFAULT_REGION", region})
+		}
+		return env
+	})
+	if err != nil {
+		return err
+	}
+
+	listenHost, _, _ := net.SplitHostPort(input.Listen)
+	infof("Serving credentials for %d services on %s, press Ctrl-C to stop", len(routes), net.JoinHostPort(listenHost, strconv.Itoa(router.Port())))
+
+	<-interrupted()
+	shutdownServer("proxy", router.Shutdown)
+
+	return nil
+}
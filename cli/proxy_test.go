@@ -0,0 +1,23 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProxyRoutes(t *testing.T) {
+	routes, err := parseProxyRoutes([]string{"web=app-readonly", " worker = app-worker "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []proxyRoute{{Name: "web", ProfileName: "app-readonly"}, {Name: "worker", ProfileName: "app-worker"}}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Expected %v, got %v", expected, routes)
+	}
+
+	for _, values := range [][]string{{"web"}, {"=app"}, {"web="}, {"web=a", "web=b"}} {
+		if _, err := parseProxyRoutes(values); err == nil {
+			t.Errorf("Expected an error for %q", values)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package cli
+
+import (
+	"errors"
+	osexec "os/exec"
+
+	"github.com/99designs/aws-vault/v7/server"
+)
+
+func supportsPseudoConsole() bool {
+	return false
+}
+
+func runCmdInPseudoConsole(cmd *osexec.Cmd, processTree *server.ProcessTreeFilter) error {
+	return errors.New("pseudo consoles are only supported on Windows")
+}
@@ -0,0 +1,216 @@
+//go:build windows
+// +build windows
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	osexec "os/exec"
+	"os/signal"
+	"time"
+	"unicode/utf16"
+	"unsafe"
+
+	"github.com/99designs/aws-vault/v7/server"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32                      = windows.NewLazySystemDLL("kernel32.dll")
+	procCreatePseudoConsole       = kernel32.NewProc("CreatePseudoConsole")
+	procResizePseudoConsole       = kernel32.NewProc("ResizePseudoConsole")
+	procClosePseudoConsole        = kernel32.NewProc("ClosePseudoConsole")
+	procUpdateProcThreadAttribute = kernel32.NewProc("UpdateProcThreadAttribute")
+)
+
+const procThreadAttributePseudoConsole = 0x00020016
+
+// supportsPseudoConsole checks for ConPTY, which is available from Windows 10 1809
+func supportsPseudoConsole() bool {
+	return procCreatePseudoConsole.Find() == nil
+}
+
+func consoleSize() windows.Coord {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Stdout, &info); err != nil {
+		return windows.Coord{X: 80, Y: 25}
+	}
+	return windows.Coord{X: info.Window.Right - info.Window.Left + 1, Y: info.Window.Bottom - info.Window.Top + 1}
+}
+
+// coordArg packs a COORD into a register, as the pseudo console functions take it by value
+func coordArg(c windows.Coord) uintptr {
+	return uintptr(uint32(uint16(c.X)) | uint32(uint16(c.Y))<<16)
+}
+
+// makeConsoleRaw passes keys through to the pseudo console as VT sequences, and lets it render VT
+// sequences, returning a function that restores the previous console modes
+func makeConsoleRaw() func() {
+	var inMode, outMode uint32
+	inErr := windows.GetConsoleMode(windows.Stdin, &inMode)
+	outErr := windows.GetConsoleMode(windows.Stdout, &outMode)
+	if inErr == nil {
+		_ = windows.SetConsoleMode(windows.Stdin, windows.ENABLE_VIRTUAL_TERMINAL_INPUT)
+	}
+	if outErr == nil {
+		_ = windows.SetConsoleMode(windows.Stdout, outMode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING|windows.DISABLE_NEWLINE_AUTO_RETURN)
+	}
+	return func() {
+		if inErr == nil {
+			_ = windows.SetConsoleMode(windows.Stdin, inMode)
+		}
+		if outErr == nil {
+			_ = windows.SetConsoleMode(windows.Stdout, outMode)
+		}
+	}
+}
+
+func createEnvBlock(env []string) *uint16 {
+	if env == nil {
+		env = os.Environ()
+	}
+	var block []uint16
+	for _, kv := range env {
+		block = append(block, utf16.Encode([]rune(kv))...)
+		block = append(block, 0)
+	}
+	block = append(block, 0)
+	return &block[0]
+}
+
+// runCmdInPseudoConsole runs the command attached to a pseudo console rather than the console of
+// aws-vault, so terminal programs get VT sequences and are resized with the window. It returns an
+// *ExitError when the command fails
+func runCmdInPseudoConsole(cmd *osexec.Cmd, processTree *server.ProcessTreeFilter) error {
+	var ptyIn, inWrite, outRead, ptyOut windows.Handle
+	if err := windows.CreatePipe(&ptyIn, &inWrite, nil, 0); err != nil {
+		return err
+	}
+	defer closeHandle(&ptyIn)
+	// the files own the handles of aws-vault's ends of the pipes, and close them
+	inFile := os.NewFile(uintptr(inWrite), "pty-in")
+	defer inFile.Close()
+	if err := windows.CreatePipe(&outRead, &ptyOut, nil, 0); err != nil {
+		return err
+	}
+	defer closeHandle(&ptyOut)
+	outFile := os.NewFile(uintptr(outRead), "pty-out")
+	defer outFile.Close()
+
+	var console windows.Handle
+	size := consoleSize()
+	if r, _, _ := procCreatePseudoConsole.Call(coordArg(size), uintptr(ptyIn), uintptr(ptyOut), 0, uintptr(unsafe.Pointer(&console))); r != 0 {
+		return fmt.Errorf("Failed to create a pseudo console: HRESULT %#x", r)
+	}
+	defer closePseudoConsole(&console)
+	// the pseudo console has its own copies of its ends of the pipes
+	closeHandle(&ptyIn)
+	closeHandle(&ptyOut)
+
+	attrs, err := windows.NewProcThreadAttributeList(1)
+	if err != nil {
+		return err
+	}
+	defer attrs.Delete()
+	if r, _, err := procUpdateProcThreadAttribute.Call(uintptr(unsafe.Pointer(attrs.List())), 0, procThreadAttributePseudoConsole, uintptr(console), unsafe.Sizeof(console), 0, 0); r == 0 {
+		return fmt.Errorf("Failed to attach the pseudo console: %w", err)
+	}
+
+	si := windows.StartupInfoEx{ProcThreadAttributeList: attrs.List()}
+	si.Cb = uint32(unsafe.Sizeof(si))
+	// without this, the subprocess would inherit the standard handles of aws-vault rather than use the pseudo console
+	si.Flags = windows.STARTF_USESTDHANDLES
+
+	if err = killProcessTreeOnExit(); err != nil {
+		log.Printf("Failed to create a job object for the subprocess: %s", err)
+	}
+
+	var pi windows.ProcessInformation
+	err = windows.CreateProcess(
+		windows.StringToUTF16Ptr(cmd.Path),
+		windows.StringToUTF16Ptr(windows.ComposeCommandLine(cmd.Args)),
+		nil, nil, false,
+		windows.EXTENDED_STARTUPINFO_PRESENT|windows.CREATE_UNICODE_ENVIRONMENT,
+		createEnvBlock(cmd.Env), nil, &si.StartupInfo, &pi)
+	if err != nil {
+		return fmt.Errorf("Failed to start %s: %w", cmd.Path, err)
+	}
+	defer closeHandle(&pi.Process)
+	_ = windows.CloseHandle(pi.Thread)
+	processTree.SetRoot(int(pi.ProcessId))
+
+	// console events are handled by the pseudo console, aws-vault only has to keep running
+	stopHandlingInterrupts()
+	signal.Notify(make(chan os.Signal, 1))
+	restoreConsole := makeConsoleRaw()
+	defer restoreConsole()
+
+	// the input copy is left blocked reading stdin, and fails once the pipe is closed on return
+	go func() {
+		_, _ = io.Copy(inFile, os.Stdin)
+	}()
+	outputDone := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(os.Stdout, outFile)
+		close(outputDone)
+	}()
+
+	exited := make(chan struct{})
+	resizeDone := make(chan struct{})
+	go func() {
+		defer close(resizeDone)
+		// there's no SIGWINCH on Windows, so the console size is polled until the process exits
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-exited:
+				return
+			case <-ticker.C:
+				if newSize := consoleSize(); newSize != size {
+					size = newSize
+					_, _, _ = procResizePseudoConsole.Call(uintptr(console), coordArg(size))
+				}
+			}
+		}
+	}()
+
+	_, err = windows.WaitForSingleObject(pi.Process, windows.INFINITE)
+	close(exited)
+	<-resizeDone
+	if err != nil {
+		return err
+	}
+	var exitCode uint32
+	if err = windows.GetExitCodeProcess(pi.Process, &exitCode); err != nil {
+		return err
+	}
+
+	// closing the pseudo console flushes the rest of the output and closes the output pipe
+	closePseudoConsole(&console)
+	select {
+	case <-outputDone:
+	case <-time.After(time.Second):
+	}
+
+	return exitError(int(exitCode))
+}
+
+// closeHandle closes the handle if it's open, so it can be closed early and again by a defer
+func closeHandle(h *windows.Handle) {
+	if *h != 0 {
+		_ = windows.CloseHandle(*h)
+		*h = 0
+	}
+}
+
+// closePseudoConsole closes the pseudo console if it's open, so it can be closed early and again by a defer
+func closePseudoConsole(console *windows.Handle) {
+	if *console != 0 {
+		_, _, _ = procClosePseudoConsole.Call(uintptr(*console))
+		*console = 0
+	}
+}
@@ -41,18 +41,22 @@ func ConfigureRemoveCommand(app *kingpin.Application, a *AwsVault) {
 		if err != nil {
 			return err
 		}
-		err = RemoveCommand(input, keyring)
-		app.FatalIfError(err, "remove")
+		awsConfigFile, err := a.AwsConfigFile()
+		if err != nil {
+			return err
+		}
+		err = RemoveCommand(input, keyring, awsConfigFile)
+		fatalIfError(app, err, "remove")
 		return nil
 	})
 }
 
-func RemoveCommand(input RemoveCommandInput, keyring keyring.Keyring) error {
+func RemoveCommand(input RemoveCommandInput, keyring keyring.Keyring, awsConfigFile *vault.ConfigFile) error {
 	ckr := &vault.CredentialKeyring{Keyring: keyring}
 
 	// Legacy --sessions-only option for backwards compatibility, use aws-vault clear instead
 	if input.SessionsOnly {
-		sk := &vault.SessionKeyring{Keyring: ckr.Keyring}
+		sk := &vault.SessionKeyring{Keyring: ckr.Keyring, Hooks: awsConfigFile.HooksSection()}
 		n, err := sk.RemoveForProfile(input.ProfileName)
 		if err != nil {
 			return err
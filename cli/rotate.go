@@ -39,21 +39,45 @@ func ConfigureRotateCommand(app *kingpin.Application, a *AwsVault) {
 		if err != nil {
 			return err
 		}
+		input.Config = a.globalConfig(input.Config)
+
 		f, err := a.AwsConfigFile()
 		if err != nil {
 			return err
 		}
 
 		err = RotateCommand(input, f, keyring)
-		app.FatalIfError(err, "rotate")
+		fatalIfError(app, err, "rotate")
 		return nil
 	})
 }
 
+// Rotate rotates the access key stored for a profile, see NewRotate
+type Rotate struct {
+	env CommandEnv
+}
+
+// NewRotate returns the rotate command, using the keyring, AWS config and stdio of the env
+func NewRotate(env CommandEnv) *Rotate {
+	return &Rotate{env: env.withDefaults()}
+}
+
 func RotateCommand(input RotateCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
+	return NewRotate(CommandEnv{Keyring: keyring, ConfigFile: f}).Run(input)
+}
+
+// Run rotates the access key stored for the profile of the input
+func (c *Rotate) Run(input RotateCommandInput) error {
+	ctx, f, keyring := c.env.Context, c.env.ConfigFile, c.env.Keyring
+	var err error
+	input.ProfileName, err = resolveProfileName(input.ProfileName, f, keyring, input.Config)
+	if err != nil {
+		return err
+	}
+
 	// Can't disable sessions completely, might need to use session for MFA-Protected API Access
-	vault.UseSession = !input.NoSession
-	vault.UseSessionCache = false
+	input.Config.NoSession = input.NoSession
+	input.Config.NoSessionCache = true
 
 	configLoader := &vault.ConfigLoader{
 		File:          f,
@@ -72,20 +96,20 @@ func RotateCommand(input RotateCommandInput, f *vault.ConfigFile, keyring keyrin
 	}
 
 	if input.NoSession {
-		fmt.Printf("Rotating credentials stored for profile '%s' using master credentials (takes 10-20 seconds)\n", masterCredentialsName)
+		fmt.Fprintf(c.env.Stdio.Out, "Rotating credentials stored for profile '%s' using master credentials (takes 10-20 seconds)\n", masterCredentialsName)
 	} else {
-		fmt.Printf("Rotating credentials stored for profile '%s' using a session from profile '%s' (takes 10-20 seconds)\n", masterCredentialsName, input.ProfileName)
+		fmt.Fprintf(c.env.Stdio.Out, "Rotating credentials stored for profile '%s' using a session from profile '%s' (takes 10-20 seconds)\n", masterCredentialsName, input.ProfileName)
 	}
 
 	// Get the existing credentials access key ID
-	oldMasterCreds, err := vault.NewMasterCredentialsProvider(ckr, masterCredentialsName).Retrieve(context.TODO())
+	oldMasterCreds, err := vault.NewMasterCredentialsProvider(ckr, masterCredentialsName).Retrieve(ctx)
 	if err != nil {
 		return fmt.Errorf("Error loading source credentials for '%s': %w", masterCredentialsName, err)
 	}
 	oldMasterCredsAccessKeyID := vault.FormatKeyForDisplay(oldMasterCreds.AccessKeyID)
 	log.Printf("Rotating access key %s\n", oldMasterCredsAccessKeyID)
 
-	fmt.Println("Creating a new access key")
+	fmt.Fprintln(c.env.Stdio.Out, "Creating a new access key")
 
 	// create a session to rotate the credentials
 	var credsProvider aws.CredentialsProvider
@@ -99,22 +123,23 @@ func RotateCommand(input RotateCommandInput, f *vault.ConfigFile, keyring keyrin
 	}
 
 	cfg := vault.NewAwsConfigWithCredsProvider(credsProvider, config.Region, config.STSRegionalEndpoints)
+	vault.AddProfileProxy(&cfg, config)
 
 	// A username is needed for some IAM calls if the credentials have assumed a role
-	iamUserName, err := getUsernameIfAssumingRole(context.TODO(), cfg, config)
+	iamUserName, err := getUsernameIfAssumingRole(ctx, cfg, config)
 	if err != nil {
 		return err
 	}
 
 	iamClient := iam.NewFromConfig(cfg)
 	// Create a new access key
-	createOut, err := iamClient.CreateAccessKey(context.TODO(), &iam.CreateAccessKeyInput{
+	createOut, err := iamClient.CreateAccessKey(ctx, &iam.CreateAccessKeyInput{
 		UserName: iamUserName,
 	})
 	if err != nil {
 		return fmt.Errorf("Error creating a new access key: %w", err)
 	}
-	fmt.Printf("Created new access key %s\n", vault.FormatKeyForDisplay(*createOut.AccessKey.AccessKeyId))
+	fmt.Fprintf(c.env.Stdio.Out, "Created new access key %s\n", vault.FormatKeyForDisplay(*createOut.AccessKey.AccessKeyId))
 
 	newMasterCreds := aws.Credentials{
 		AccessKeyID:     *createOut.AccessKey.AccessKeyId,
@@ -127,18 +152,18 @@ func RotateCommand(input RotateCommandInput, f *vault.ConfigFile, keyring keyrin
 	}
 
 	// Delete old sessions
-	sk := &vault.SessionKeyring{Keyring: ckr.Keyring}
+	sk := &vault.SessionKeyring{Keyring: ckr.Keyring, Hooks: config.Hooks}
 	profileNames, err := getProfilesInChain(input.ProfileName, configLoader)
 	for _, profileName := range profileNames {
 		if n, _ := sk.RemoveForProfile(profileName); n > 0 {
-			fmt.Printf("Deleted %d sessions for %s\n", n, profileName)
+			fmt.Fprintf(c.env.Stdio.Out, "Deleted %d sessions for %s\n", n, profileName)
 		}
 	}
 
 	// Use new credentials to delete old access key
-	fmt.Printf("Deleting old access key %s\n", oldMasterCredsAccessKeyID)
+	fmt.Fprintf(c.env.Stdio.Out, "Deleting old access key %s\n", oldMasterCredsAccessKeyID)
 	err = retry(time.Second*20, time.Second*2, func() error {
-		_, err = iamClient.DeleteAccessKey(context.TODO(), &iam.DeleteAccessKeyInput{
+		_, err = iamClient.DeleteAccessKey(ctx, &iam.DeleteAccessKeyInput{
 			AccessKeyId: &oldMasterCreds.AccessKeyID,
 			UserName:    iamUserName,
 		})
@@ -147,9 +172,16 @@ func RotateCommand(input RotateCommandInput, f *vault.ConfigFile, keyring keyrin
 	if err != nil {
 		return fmt.Errorf("Can't delete old access key %s: %w", oldMasterCredsAccessKeyID, err)
 	}
-	fmt.Printf("Deleted old access key %s\n", oldMasterCredsAccessKeyID)
+	fmt.Fprintf(c.env.Stdio.Out, "Deleted old access key %s\n", oldMasterCredsAccessKeyID)
+
+	fmt.Fprintln(c.env.Stdio.Out, "Finished rotating access key")
 
-	fmt.Println("Finished rotating access key")
+	config.Hooks.Run(vault.HookRotationComplete, map[string]string{
+		"profile":           input.ProfileName,
+		"credentials_name":  masterCredentialsName,
+		"access_key_id":     vault.FormatKeyForDisplay(newMasterCreds.AccessKeyID),
+		"old_access_key_id": oldMasterCredsAccessKeyID,
+	})
 
 	return nil
 }
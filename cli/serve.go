@@ -0,0 +1,234 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/server"
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	"github.com/alecthomas/kingpin"
+)
+
+type ServeCommandInput struct {
+	ProfileName     string
+	Listen          string
+	Host            string
+	Token           string
+	TokenFile       string
+	TLSCertFile     string
+	TLSKeyFile      string
+	Lazy            bool
+	Config          vault.Config
+	SessionDuration time.Duration
+	NoSession       bool
+}
+
+func ConfigureServeCommand(app *kingpin.Application, a *AwsVault) {
+	input := ServeCommandInput{}
+
+	cmd := app.Command("serve", "Run an ECS credential server for a profile until stopped, e.g. as a sidecar for local Kubernetes clusters and VMs.")
+
+	cmd.Flag("profile", "Name of the profile to serve credentials for").
+		Required().
+		HintAction(a.MustGetProfileNames).
+		StringVar(&input.ProfileName)
+
+	cmd.Flag("listen", "Address for the server to listen on, e.g. 127.0.0.1:9911, 0.0.0.0:9911 for clients on other hosts, or vsock:9911 for VMs").
+		Required().
+		StringVar(&input.Listen)
+
+	cmd.Flag("host", "Host name of the server as seen from clients, used in the URL printed. Defaults to the host of --listen").
+		StringVar(&input.Host)
+
+	cmd.Flag("token", "The authorization token clients must send. Defaults to a random token").
+		Envar("AWS_VAULT_SERVE_TOKEN").
+		StringVar(&input.Token)
+
+	cmd.Flag("token-file", "Write the authorization token to this file, only readable by you, e.g. to mount into a VM or pod").
+		StringVar(&input.TokenFile)
+
+	cmd.Flag("tls-cert", "Serve HTTPS with the certificate in this PEM file, which clients that aren't on the loopback interface need").
+		StringVar(&input.TLSCertFile)
+
+	cmd.Flag("tls-key", "The private key of --tls-cert, in a PEM file").
+		StringVar(&input.TLSKeyFile)
+
+	cmd.Flag("lazy", "Get credentials when they're first requested, rather than when the server starts").
+		BoolVar(&input.Lazy)
+
+	cmd.Flag("duration", "Duration of the temporary or assume-role session. Defaults to 1h").
+		Short('d').
+		SetValue(newDurationValue(&input.SessionDuration))
+
+	cmd.Flag("no-session", "Skip creating STS session with GetSessionToken").
+		Short('n').
+		BoolVar(&input.NoSession)
+
+	cmd.Flag("region", "The AWS region").
+		HintOptions(awsRegions...).
+		StringVar(&input.Config.Region)
+
+	cmd.Flag("mfa-token", "The MFA token to use").
+		Short('t').
+		StringVar(&input.Config.MfaToken)
+
+	cmd.Action(func(c *kingpin.ParseContext) (err error) {
+		input.Config.MfaPromptMethod = a.PromptDriver(false)
+		input.Config.NonChainedGetSessionTokenDuration = input.SessionDuration
+		input.Config.AssumeRoleDuration = input.SessionDuration
+
+		input.Config = a.globalConfig(input.Config)
+
+		f, err := a.AwsConfigFile()
+		if err != nil {
+			return err
+		}
+		keyring, err := a.Keyring()
+		if err != nil {
+			return err
+		}
+
+		err = ServeCommand(input, f, keyring)
+		fatalIfError(app, err, "serve")
+		return nil
+	})
+}
+
+func (input ServeCommandInput) validate() error {
+	if (input.TLSCertFile == "") != (input.TLSKeyFile == "") {
+		return fmt.Errorf("--tls-cert and --tls-key need to be set together")
+	}
+	if server.IsVsockAddr(input.Listen) {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(input.Listen); err != nil {
+		return fmt.Errorf("Invalid --listen address %q: %w", input.Listen, err)
+	}
+	return nil
+}
+
+// ServeCommand serves credentials for the profile with the ECS credential protocol until it's
+// stopped. Every request is logged with the client that made it
+func ServeCommand(input ServeCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
+	if err := input.validate(); err != nil {
+		return err
+	}
+
+	var err error
+	input.ProfileName, err = resolveProfileName(input.ProfileName, f, keyring, input.Config)
+	if err != nil {
+		return err
+	}
+
+	input.Config.NoSession = input.NoSession
+
+	configLoader := vault.ConfigLoader{
+		File:          f,
+		BaseConfig:    input.Config,
+		ActiveProfile: input.ProfileName,
+	}
+	config, err := configLoader.LoadFromProfile(input.ProfileName)
+	if err != nil {
+		return fmt.Errorf("Error loading config: %w", err)
+	}
+
+	ckr := &vault.CredentialKeyring{Keyring: keyring}
+	credsProvider, err := vault.NewTempCredentialsProvider(config, ckr)
+	if err != nil {
+		return fmt.Errorf("Error getting temporary credentials: %w", err)
+	}
+
+	server.ClientLog = log.New(os.Stderr, "", log.LstdFlags)
+	ecsServer, err := server.NewEcsServerOnAddr(rootCtx, credsProvider, config, input.Token, input.Listen, input.Lazy)
+	if err != nil {
+		return err
+	}
+	go func() {
+		var err error
+		if input.TLSCertFile != "" {
+			err = ecsServer.ServeTLS(input.TLSCertFile, input.TLSKeyFile)
+		} else {
+			err = ecsServer.Serve()
+		}
+		if err != http.ErrServerClosed { // ErrServerClosed is a graceful close
+			log.Fatalf("ecs server: %s", err.Error())
+		}
+	}()
+
+	if input.TokenFile != "" {
+		if err = writeTokenFile(input.TokenFile, ecsServer.AuthToken()); err != nil {
+			return err
+		}
+	}
+
+	serverURL := input.serverURL(ecsServer.Port())
+	printServeEnv(os.Stdout, input, serverURL, ecsServer.AuthToken(), config.Region)
+
+	if input.TLSCertFile == "" && !isLoopbackHost(input.serverHost()) {
+		infof("The AWS SDKs only get credentials over HTTP from the loopback interface, use --tls-cert and --tls-key for clients on other hosts")
+	}
+	if server.IsVsockAddr(input.Listen) {
+		infof("Serving credentials for %s on %s, for VMs forwarding %s to it, press Ctrl-C to stop", input.ProfileName, input.Listen, serverURL)
+	} else {
+		infof("Serving credentials for %s on %s, press Ctrl-C to stop", input.ProfileName, serverURL)
+	}
+
+	<-interrupted()
+	shutdownServer("ecs", ecsServer.Shutdown)
+
+	return nil
+}
+
+// serverHost is the host name of the server as seen from clients
+func (input ServeCommandInput) serverHost() string {
+	if input.Host != "" {
+		return input.Host
+	}
+	if server.IsVsockAddr(input.Listen) {
+		// a VM reaches the server through a forwarder on its loopback interface
+		return "127.0.0.1"
+	}
+	host, _, _ := net.SplitHostPort(input.Listen)
+	if host == "" || net.ParseIP(host).IsUnspecified() {
+		// clients on this host can reach a server listening on all interfaces on the loopback interface
+		return "127.0.0.1"
+	}
+	return host
+}
+
+func (input ServeCommandInput) serverURL(port int) string {
+	scheme := "http"
+	if input.TLSCertFile != "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/", scheme, net.JoinHostPort(input.serverHost(), strconv.Itoa(port)))
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// printServeEnv prints the variables clients need to get credentials from the server
+func printServeEnv(w io.Writer, input ServeCommandInput, serverURL, token, region string) {
+	fmt.Fprintf(w, "AWS_CONTAINER_CREDENTIALS_FULL_URI=%s\n", serverURL)
+	if input.TokenFile != "" {
+		fmt.Fprintf(w, "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE=%s\n", input.TokenFile)
+	} else {
+		fmt.Fprintf(w, "AWS_CONTAINER_AUTHORIZATION_TOKEN=%s\n", token)
+	}
+	if region != "" {
+		fmt.Fprintf(w, "AWS_REGION=%s\n", region)
+		fmt.Fprintf(w, "AWS_DEFAULT_REGION=%s\n", region)
+	}
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestServeURL(t *testing.T) {
+	for _, tc := range []struct {
+		input    ServeCommandInput
+		expected string
+	}{
+		{ServeCommandInput{Listen: "127.0.0.1:9911"}, "http://127.0.0.1:9911/"},
+		{ServeCommandInput{Listen: "0.0.0.0:9911"}, "http://127.0.0.1:9911/"},
+		{ServeCommandInput{Listen: ":9911", Host: "host.minikube.internal", TLSCertFile: "cert.pem"}, "https://host.minikube.internal:9911/"},
+		{ServeCommandInput{Listen: "[::1]:9911"}, "http://[::1]:9911/"},
+		{ServeCommandInput{Listen: "vsock:/run/vm/v.sock:9911"}, "http://127.0.0.1:9911/"},
+	} {
+		if url := tc.input.serverURL(9911); url != tc.expected {
+			t.Errorf("Expected %s for %+v, got %s", tc.expected, tc.input, url)
+		}
+	}
+}
+
+func TestServeValidate(t *testing.T) {
+	if err := (ServeCommandInput{Listen: "127.0.0.1:9911", TLSCertFile: "cert.pem"}).validate(); err == nil {
+		t.Error("Expected an error for --tls-cert without --tls-key")
+	}
+	if err := (ServeCommandInput{Listen: "9911"}).validate(); err == nil {
+		t.Error("Expected an error for a --listen address without a port")
+	}
+}
+
+func TestPrintServeEnv(t *testing.T) {
+	var b bytes.Buffer
+	printServeEnv(&b, ServeCommandInput{TokenFile: "/run/aws-vault/token"}, "http://127.0.0.1:9911/", "secret", "eu-west-1")
+
+	expected := `AWS_CONTAINER_CREDENTIALS_FULL_URI=http://127.0.0.1:9911/
+AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE=/run/aws-vault/token
+AWS_REGION=eu-west-1
+AWS_DEFAULT_REGION=eu-west-1
+`
+	if b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+}
@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/99designs/aws-vault/v7/prompt"
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	"github.com/alecthomas/kingpin"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ini "gopkg.in/ini.v1"
+)
+
+type SetupCommandInput struct {
+	CredentialsFile string
+	Import          bool
+	VerifyProfile   string
+	NoVerify        bool
+}
+
+func ConfigureSetupCommand(app *kingpin.Application, a *AwsVault) {
+	input := SetupCommandInput{}
+
+	cmd := app.Command("setup", "Set up aws-vault: choose a keyring backend, create the vault, import plaintext credentials and check that a profile works.")
+
+	cmd.Flag("credentials-file", "The plaintext credentials file to import from. Defaults to AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials").
+		StringVar(&input.CredentialsFile)
+
+	cmd.Flag("import", "Import every profile in the credentials file without asking").
+		BoolVar(&input.Import)
+
+	cmd.Flag("verify", "The profile to check by getting its identity with sts:GetCallerIdentity. Defaults to the first profile imported").
+		HintAction(a.MustGetProfileNames).
+		StringVar(&input.VerifyProfile)
+
+	cmd.Flag("no-verify", "Don't check a profile once set up").
+		BoolVar(&input.NoVerify)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		err := SetupCommand(input, a)
+		fatalIfError(app, err, "setup")
+		return nil
+	})
+}
+
+func SetupCommand(input SetupCommandInput, a *AwsVault) error {
+	backend, err := setupBackend(a)
+	if err != nil {
+		return err
+	}
+
+	keyring, err := a.Keyring()
+	if err != nil {
+		return err
+	}
+	// listing the keys creates the vault if it doesn't exist yet, and unlocks it
+	names, err := (&vault.CredentialKeyring{Keyring: keyring}).Keys()
+	if err != nil {
+		return fmt.Errorf("Can't open the vault in the %s backend: %w", backend, err)
+	}
+	infof("The vault in the %s backend is ready, with credentials for %d profiles", backend, len(names))
+
+	f, err := a.AwsConfigFile()
+	if err != nil {
+		return err
+	}
+
+	imported, err := setupImport(input, keyring, f, names)
+	if err != nil {
+		return err
+	}
+
+	if input.NoVerify {
+		return nil
+	}
+	profileName := input.VerifyProfile
+	if profileName == "" && len(imported) > 0 {
+		profileName = imported[0]
+	}
+	if profileName == "" && !prompt.Disabled {
+		if profileName, err = prompt.TerminalPrompt("Profile to check, or empty to skip: "); err != nil {
+			return err
+		}
+	}
+	if profileName == "" {
+		return nil
+	}
+
+	infof("Checking profile %s with sts:GetCallerIdentity", profileName)
+	return WhoamiCommand(WhoamiCommandInput{
+		ProfileName: profileName,
+		Config:      vault.Config{MfaPromptMethod: a.PromptDriver(false)},
+	}, f, keyring)
+}
+
+// setupBackend shows the backends that can be used, and asks which one to use, recommending the one
+// that would be selected. The backend is then set, so that the keyring is opened with it
+func setupBackend(a *AwsVault) (string, error) {
+	statuses, selected, err := a.probeBackends()
+	if err != nil {
+		return "", err
+	}
+	if err = printBackendStatuses(statuses); err != nil {
+		return "", err
+	}
+	if selected == "" {
+		return "", fmt.Errorf("None of the keyring backends can be opened, see the Backends section of the usage guide")
+	}
+
+	available := []string{}
+	for _, s := range statuses {
+		if s.CanOpen {
+			available = append(available, s.Backend)
+		}
+	}
+
+	backend := selected
+	if len(available) > 1 && !prompt.Disabled {
+		for {
+			answer, err := prompt.TerminalPrompt(fmt.Sprintf("Backend to use, one of %s [%s]: ", strings.Join(available, ", "), selected))
+			if err != nil {
+				return "", err
+			}
+			if answer == "" || containsString(available, answer) {
+				if answer != "" {
+					backend = answer
+				}
+				break
+			}
+			fmt.Fprintf(os.Stderr, "%s can't be used, choose one of %s\n", answer, strings.Join(available, ", "))
+		}
+	}
+
+	if backend != selected || a.KeyringBackend != "" {
+		infof("Set AWS_VAULT_BACKEND=%s in your shell's startup file to keep using the %s backend", backend, backend)
+	}
+	a.KeyringBackend = backend
+	return backend, nil
+}
+
+// plaintextCredentials are the long-term credentials of a profile in the shared credentials file
+type plaintextCredentials struct {
+	ProfileName string
+	Credentials aws.Credentials
+}
+
+// credentialsFilePath is the shared credentials file of the AWS CLI and SDKs
+func credentialsFilePath() (string, error) {
+	if path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".aws", "credentials"), nil
+}
+
+// readPlaintextCredentials reads the profiles with access keys from the credentials file. Profiles
+// with a session token have temporary credentials, which aren't worth importing
+func readPlaintextCredentials(path string) ([]plaintextCredentials, error) {
+	f, err := ini.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read the credentials file %s: %w", path, err)
+	}
+
+	found := []plaintextCredentials{}
+	for _, section := range f.Sections() {
+		id := section.Key("aws_access_key_id").String()
+		secret := section.Key("aws_secret_access_key").String()
+		if id == "" || secret == "" || section.HasKey("aws_session_token") {
+			continue
+		}
+		found = append(found, plaintextCredentials{
+			ProfileName: section.Name(),
+			Credentials: aws.Credentials{AccessKeyID: id, SecretAccessKey: secret},
+		})
+	}
+	return found, nil
+}
+
+// setupImport offers to import the credentials in the plaintext credentials file that aren't in the
+// vault yet, and returns the names of the profiles imported
+func setupImport(input SetupCommandInput, keyring keyring.Keyring, f *vault.ConfigFile, existing []string) ([]string, error) {
+	path := input.CredentialsFile
+	if path == "" {
+		var err error
+		if path, err = credentialsFilePath(); err != nil {
+			return nil, err
+		}
+		if _, err = os.Stat(path); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+
+	found, err := readPlaintextCredentials(path)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := []string{}
+	for _, c := range found {
+		if containsString(existing, c.ProfileName) {
+			verbosef("Skipping %s from %s, the vault already has credentials for it", c.ProfileName, path)
+			continue
+		}
+		if !input.Import {
+			if prompt.Disabled {
+				continue
+			}
+			ok, err := prompt.Confirm("terminal", fmt.Sprintf("Import the access key %s of profile %s from %s?",
+				vault.FormatKeyForDisplay(c.Credentials.AccessKeyID), c.ProfileName, path))
+			if err != nil {
+				return imported, err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		if err = addCredentials(c.ProfileName, c.Credentials, keyring); err != nil {
+			return imported, err
+		}
+		if _, ok := f.ProfileSection(c.ProfileName); !ok {
+			if err = f.Add(vault.ProfileSection{Name: c.ProfileName}); err != nil {
+				return imported, fmt.Errorf("Error adding profile: %w", err)
+			}
+		}
+		imported = append(imported, c.ProfileName)
+	}
+
+	if len(imported) > 0 {
+		infof("Imported %d profiles. Once you've checked they work with aws-vault, remove their keys from %s, where they can still be read by anything", len(imported), path)
+	}
+	return imported, nil
+}
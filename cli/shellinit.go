@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+)
+
+type ShellInitCommandInput struct {
+	Shell string
+	Name  string
+}
+
+func ConfigureShellInitCommand(app *kingpin.Application, a *AwsVault) {
+	input := ShellInitCommandInput{}
+
+	cmd := app.Command("shell-init", "Print shell functions to switch profiles in the current shell. Load them with eval \"$(aws-vault shell-init bash)\".")
+
+	cmd.Flag("name", "Name of the shell function").
+		Default("avs").
+		StringVar(&input.Name)
+
+	cmd.Arg("shell", "The shell to print functions for: bash, zsh or fish").
+		Required().
+		HintOptions("bash", "zsh", "fish").
+		EnumVar(&input.Shell, "bash", "zsh", "fish")
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		err := ShellInitCommand(input)
+		fatalIfError(app, err, "shell-init")
+		return nil
+	})
+}
+
+var shellFunctionNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+func ShellInitCommand(input ShellInitCommandInput) error {
+	if !shellFunctionNameRegexp.MatchString(input.Name) {
+		return fmt.Errorf("Invalid function name '%s'", input.Name)
+	}
+
+	script := posixShellInit
+	if input.Shell == "fish" {
+		script = fishShellInit
+	}
+	fmt.Print(strings.ReplaceAll(script, "{{name}}", input.Name))
+
+	return nil
+}
+
+// shellInitVars are the variables set by `export --format=env` and the shell functions
+const shellInitVars = "AWS_VAULT AWS_ACCESS_KEY_ID AWS_SECRET_ACCESS_KEY AWS_SESSION_TOKEN AWS_CREDENTIAL_EXPIRATION AWS_REGION AWS_DEFAULT_REGION"
+
+var posixShellInit = `# aws-vault shell functions, load with: eval "$(aws-vault shell-init bash)"
+{{name}}() {
+  case "$1" in
+    use)
+      if [ $# -lt 2 ]; then
+        echo "usage: {{name}} use <profile> [export flags]" >&2
+        return 1
+      fi
+      local _avs_profile="$2" _avs_env
+      shift 2
+      _avs_env="$(AWS_VAULT= command aws-vault export --format=export-env "$@" "$_avs_profile")" || return
+      {{name}} off
+      eval "$_avs_env"
+      export AWS_VAULT="$_avs_profile"
+      if [ -n "$AWS_CREDENTIAL_EXPIRATION" ]; then
+        _AVS_EXPIRES="$(date -u -d "$AWS_CREDENTIAL_EXPIRATION" +%s 2>/dev/null || date -u -j -f '%Y-%m-%dT%H:%M:%SZ' "$AWS_CREDENTIAL_EXPIRATION" +%s 2>/dev/null)"
+      fi
+      ;;
+    off)
+      unset ` + shellInitVars + ` _AVS_EXPIRES
+      ;;
+    *)
+      command aws-vault "$@"
+      ;;
+  esac
+}
+
+# prints the active profile and the minutes until its credentials expire, for PS1
+{{name}}_prompt() {
+  [ -n "$AWS_VAULT" ] || return 0
+  if [ -z "$_AVS_EXPIRES" ]; then
+    printf '%s' "$AWS_VAULT"
+    return 0
+  fi
+  local _avs_left=$(( (_AVS_EXPIRES - $(date +%s)) / 60 ))
+  if [ "$_avs_left" -gt 0 ]; then
+    printf '%s (%dm)' "$AWS_VAULT" "$_avs_left"
+  else
+    printf '%s (expired)' "$AWS_VAULT"
+  fi
+}
+`
+
+var fishShellInit = `# aws-vault shell functions, load with: aws-vault shell-init fish | source
+function {{name}} --description 'Switch AWS profiles with aws-vault'
+    switch "$argv[1]"
+        case use
+            if test (count $argv) -lt 2
+                echo "usage: {{name}} use <profile> [export flags]" >&2
+                return 1
+            end
+            set -l profile $argv[2]
+            set -l lines (env AWS_VAULT= aws-vault export --format=env $argv[3..-1] $profile)
+            or return
+            {{name}} off
+            for line in $lines
+                set -l kv (string split -m 1 = -- $line)
+                set -gx $kv[1] $kv[2]
+            end
+            set -gx AWS_VAULT $profile
+            if set -q AWS_CREDENTIAL_EXPIRATION
+                set -g _avs_expires (date -u -d $AWS_CREDENTIAL_EXPIRATION +%s 2>/dev/null; or date -u -j -f '%Y-%m-%dT%H:%M:%SZ' $AWS_CREDENTIAL_EXPIRATION +%s 2>/dev/null)
+            end
+        case off
+            for var in ` + shellInitVars + ` _avs_expires
+                set -e $var
+            end
+        case '*'
+            command aws-vault $argv
+    end
+end
+
+# prints the active profile and the minutes until its credentials expire, for fish_prompt
+function {{name}}_prompt
+    set -q AWS_VAULT; or return 0
+    if not set -q _avs_expires
+        printf '%s' $AWS_VAULT
+        return 0
+    end
+    set -l left (math --scale=0 "($_avs_expires - "(date +%s)") / 60")
+    if test $left -gt 0
+        printf '%s (%dm)' $AWS_VAULT $left
+    else
+        printf '%s (expired)' $AWS_VAULT
+    end
+end
+`
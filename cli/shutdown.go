@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// exitInterrupted is the exit status when aws-vault is stopped by SIGINT or SIGTERM, as shells use for SIGINT
+const exitInterrupted = 130
+
+// shutdownTimeout is how long credential servers have to finish the requests in flight when they're stopped
+const shutdownTimeout = 5 * time.Second
+
+// rootCtx is the context of everything aws-vault does. It's cancelled when aws-vault is interrupted,
+// or when it exits, which cancels requests for credentials in flight and stops the credential servers
+var rootCtx, cancelRootCtx = context.WithCancel(context.Background())
+
+var (
+	interruptSignals = make(chan os.Signal, 1)
+
+	// handlesInterrupt is set by commands that stop gracefully when interrupted, see interrupted
+	handlesInterrupt atomic.Bool
+)
+
+// handleInterrupts cancels rootCtx on SIGINT or SIGTERM, and exits. Commands that wait for interrupted
+// are given shutdownTimeout to stop by themselves first, or until a second signal. While a subprocess
+// runs, signals are passed on to it instead, see stopHandlingInterrupts
+func handleInterrupts() {
+	signal.Notify(interruptSignals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-interruptSignals
+		log.Printf("Received %s, shutting down", sig)
+		cancelRootCtx()
+
+		if handlesInterrupt.Load() {
+			select {
+			case <-interruptSignals:
+			case <-time.After(shutdownTimeout + time.Second):
+			}
+		}
+		exit(exitInterrupted)
+	}()
+}
+
+// stopHandlingInterrupts leaves signals to a subprocess, which decides whether to stop
+func stopHandlingInterrupts() {
+	signal.Stop(interruptSignals)
+}
+
+// interrupted returns a channel that's closed when aws-vault is interrupted, for commands that run until
+// they're stopped. The command then has shutdownTimeout to stop gracefully and return
+func interrupted() <-chan struct{} {
+	handlesInterrupt.Store(true)
+	return rootCtx.Done()
+}
+
+// shutdownServer stops a credential server gracefully, waiting up to shutdownTimeout for requests in flight
+func shutdownServer(name string, shutdown func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		log.Printf("Failed to shut down the %s server: %s", name, err.Error())
+	}
+}
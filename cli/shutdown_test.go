@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdownServer(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	var deadline time.Time
+	shutdownServer("ecs", func(ctx context.Context) error {
+		deadline, _ = ctx.Deadline()
+		return nil
+	})
+	if remaining := time.Until(deadline); remaining <= 0 || remaining > shutdownTimeout {
+		t.Errorf("Expected the server to be given %s to shut down, got %s", shutdownTimeout, remaining)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("Expected nothing to be logged, got %q", logs.String())
+	}
+
+	shutdownServer("ecs", func(ctx context.Context) error {
+		return errors.New("requests still in flight")
+	})
+	if !strings.Contains(logs.String(), "Failed to shut down the ecs server: requests still in flight") {
+		t.Errorf("Expected the failure to be logged, got %q", logs.String())
+	}
+}
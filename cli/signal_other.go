@@ -0,0 +1,100 @@
+//go:build !windows
+// +build !windows
+
+package cli
+
+import (
+	"errors"
+	"log"
+	"os"
+	osexec "os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// setProcessGroup runs the command in its own process group, so signals reach the whole pipeline or
+// build it starts. When attached to a terminal, the group is put in the foreground, so that it reads
+// from the terminal and receives Ctrl-C, Ctrl-Z and window size changes directly
+func setProcessGroup(cmd *osexec.Cmd) {
+	if cmd.SysProcAttr != nil {
+		// the command is already set up, e.g. in its own namespace
+		return
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = int(os.Stdin.Fd())
+	}
+}
+
+// forwardSignal passes a signal received by aws-vault on to the process group of the subprocess
+func forwardSignal(p *os.Process, sig os.Signal) {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return
+	}
+	switch s {
+	case syscall.SIGCHLD, syscall.SIGURG, syscall.SIGTTIN, syscall.SIGTTOU:
+		// these are about aws-vault itself, SIGURG is used by the Go runtime
+		return
+	}
+	if err := syscall.Kill(-p.Pid, s); err != nil {
+		_ = p.Signal(sig)
+	}
+}
+
+// setForeground makes the process group the foreground group of the terminal, if there is one
+func setForeground(pgid int) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		_ = unix.IoctlSetPointerInt(int(os.Stdin.Fd()), unix.TIOCSPGRP, pgid)
+	}
+}
+
+// waitForCmd waits for the subprocess to exit, returning its exit code. When it's stopped, such as with
+// Ctrl-Z, aws-vault stops too so the shell sees the job as stopped, and resumes it when it's continued
+func waitForCmd(cmd *osexec.Cmd) (int, error) {
+	// aws-vault is in the background while the subprocess runs, and has to be able to take the terminal back
+	signal.Ignore(syscall.SIGTTOU)
+	foreground := cmd.SysProcAttr != nil && cmd.SysProcAttr.Foreground
+	pgrp, _ := unix.Getpgid(0)
+
+	for {
+		var status syscall.WaitStatus
+		_, err := syscall.Wait4(cmd.Process.Pid, &status, syscall.WUNTRACED, nil)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if status.Stopped() {
+			log.Printf("Subprocess stopped by %s", status.StopSignal())
+			if foreground {
+				setForeground(pgrp)
+			}
+			_ = syscall.Kill(syscall.Getpid(), syscall.SIGSTOP)
+
+			// continued, e.g. with fg
+			if foreground {
+				setForeground(cmd.Process.Pid)
+			}
+			if err = syscall.Kill(-cmd.Process.Pid, syscall.SIGCONT); err != nil {
+				_ = cmd.Process.Signal(syscall.SIGCONT)
+			}
+			continue
+		}
+
+		if foreground {
+			setForeground(pgrp)
+		}
+		// like shells, 128 plus the signal number if it was killed by a signal
+		if status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return status.ExitStatus(), nil
+	}
+}
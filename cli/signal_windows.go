@@ -0,0 +1,31 @@
+//go:build windows
+// +build windows
+
+package cli
+
+import (
+	"errors"
+	"log"
+	"os"
+	osexec "os/exec"
+)
+
+// setProcessGroup isn't needed on Windows, where the subprocess runs in a Job Object
+func setProcessGroup(cmd *osexec.Cmd) {}
+
+// forwardSignal passes a signal received by aws-vault on to the subprocess. On Windows, CTRL_C, CTRL_BREAK
+// and console close events are delivered to every process attached to the console, so the subprocess
+// has already received them. aws-vault keeps running so that it can exit with the subprocess's exit code
+func forwardSignal(p *os.Process, sig os.Signal) {
+	log.Printf("Received %s, waiting for the subprocess to exit", sig)
+}
+
+// waitForCmd waits for the subprocess to exit, returning its exit code
+func waitForCmd(cmd *osexec.Cmd) (int, error) {
+	// a non-zero exit isn't a failure of aws-vault, so the exit code is passed on
+	var exitErr *osexec.ExitError
+	if err := cmd.Wait(); err != nil && !errors.As(err, &exitErr) {
+		return 0, err
+	}
+	return cmd.ProcessState.ExitCode(), nil
+}
@@ -0,0 +1,211 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	osexec "os/exec"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/server"
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	"github.com/alecthomas/kingpin"
+)
+
+type SSHForwardCommandInput struct {
+	ProfileName     string
+	Host            string
+	Command         string
+	Args            []string
+	RemotePort      int
+	SSHPath         string
+	SSHOptions      []string
+	Lazy            bool
+	Config          vault.Config
+	SessionDuration time.Duration
+	NoSession       bool
+}
+
+func ConfigureSSHForwardCommand(app *kingpin.Application, a *AwsVault) {
+	input := SSHForwardCommandInput{}
+
+	cmd := app.Command("ssh-forward", "Connect to a host with ssh, serving credentials to it from an ECS credential server forwarded over the connection.")
+
+	cmd.Flag("duration", "Duration of the temporary or assume-role session. Defaults to 1h").
+		Short('d').
+		SetValue(newDurationValue(&input.SessionDuration))
+
+	cmd.Flag("no-session", "Skip creating STS session with GetSessionToken").
+		Short('n').
+		BoolVar(&input.NoSession)
+
+	cmd.Flag("region", "The AWS region").
+		HintOptions(awsRegions...).
+		StringVar(&input.Config.Region)
+
+	cmd.Flag("mfa-token", "The MFA token to use").
+		Short('t').
+		StringVar(&input.Config.MfaToken)
+
+	cmd.Flag("remote-port", "The port on the loopback interface of the host to serve credentials on. Defaults to the port of the local server").
+		IntVar(&input.RemotePort)
+
+	cmd.Flag("ssh", "Path to the ssh executable").
+		Default("ssh").
+		Envar("AWS_VAULT_SSH").
+		StringVar(&input.SSHPath)
+
+	cmd.Flag("ssh-option", "An option to pass to ssh with -o, e.g. User=ec2-user. Can be repeated").
+		StringsVar(&input.SSHOptions)
+
+	cmd.Flag("lazy", "Fetch credentials when the host first asks for them, rather than before connecting").
+		BoolVar(&input.Lazy)
+
+	cmd.Arg("profile", "Name of the profile").
+		Required().
+		HintAction(a.MustGetProfileNames).
+		StringVar(&input.ProfileName)
+
+	cmd.Arg("host", "The host to connect to, as given to ssh").
+		Required().
+		StringVar(&input.Host)
+
+	cmd.Arg(commandArgName, "Command to run on the host, defaults to a login shell").
+		StringVar(&input.Command)
+
+	cmd.Arg("args", "Command arguments").
+		StringsVar(&input.Args)
+
+	cmd.Action(func(c *kingpin.ParseContext) (err error) {
+		input.Config.MfaPromptMethod = a.PromptDriver(true)
+		input.Config.NonChainedGetSessionTokenDuration = input.SessionDuration
+		input.Config.AssumeRoleDuration = input.SessionDuration
+
+		input.Config = a.globalConfig(input.Config)
+
+		f, err := a.AwsConfigFile()
+		if err != nil {
+			return err
+		}
+		keyring, err := a.Keyring()
+		if err != nil {
+			return err
+		}
+
+		err = SSHForwardCommand(input, f, keyring)
+		fatalIfError(app, err, "ssh-forward")
+		return nil
+	})
+}
+
+// SSHForwardCommand starts an ECS credential server on localhost, and connects to the host with its port
+// forwarded to the loopback interface of the host. The command on the host is given the URL and auth
+// token of the server, so the credentials stay on this machine and the host only gets sessions
+func SSHForwardCommand(input SSHForwardCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
+	if input.Config.MfaPromptMethod == "terminal" {
+		return fmt.Errorf("Can't use --prompt=terminal with ssh-forward, as ssh uses the terminal. Specify a different prompt driver")
+	}
+
+	sshPath, err := osexec.LookPath(input.SSHPath)
+	if err != nil {
+		return fmt.Errorf("Can't find %s: %w", input.SSHPath, err)
+	}
+
+	input.ProfileName, err = resolveProfileName(input.ProfileName, f, keyring, input.Config)
+	if err != nil {
+		return err
+	}
+
+	input.Config.NoSession = input.NoSession
+
+	configLoader := vault.ConfigLoader{
+		File:          f,
+		BaseConfig:    input.Config,
+		ActiveProfile: input.ProfileName,
+	}
+	config, err := configLoader.LoadFromProfile(input.ProfileName)
+	if err != nil {
+		return fmt.Errorf("Error loading config: %w", err)
+	}
+
+	ckr := &vault.CredentialKeyring{Keyring: keyring}
+	credsProvider, err := vault.NewTempCredentialsProvider(config, ckr)
+	if err != nil {
+		return fmt.Errorf("Error getting temporary credentials: %w", err)
+	}
+
+	ecsServer, err := server.NewEcsServer(rootCtx, credsProvider, config, "", 0, input.Lazy)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := ecsServer.Serve()
+		if err != http.ErrServerClosed { // ErrServerClosed is a graceful close
+			log.Fatalf("ecs server: %s", err.Error())
+		}
+	}()
+	onExit(func() { shutdownServer("ecs", ecsServer.Shutdown) })
+
+	remotePort := input.RemotePort
+	if remotePort == 0 {
+		remotePort = ecsServer.Port()
+	}
+	infof("Forwarding credentials for %s to 127.0.0.1:%d on %s", input.ProfileName, remotePort, input.Host)
+
+	// the token is passed in the environment of ssh, which only the user can read, rather than its command line
+	env := environ(os.Environ())
+	env.Set(sshForwardTokenVar, ecsServer.AuthToken())
+
+	return doRunCmd(sshPath, input.sshArgs(ecsServer.Port(), remotePort, config.Region), env, cmdOptions{})
+}
+
+// sshForwardTokenVar is sent to the host by ssh with SendEnv, which the sshd of the host must accept
+const sshForwardTokenVar = "AWS_CONTAINER_AUTHORIZATION_TOKEN"
+
+// sshForwardTokenCheck stops the remote command when the sshd of the host didn't accept the token
+const sshForwardTokenCheck = `[ -n "$AWS_CONTAINER_AUTHORIZATION_TOKEN" ] || ` +
+	`{ echo "aws-vault: the host didn't accept AWS_CONTAINER_AUTHORIZATION_TOKEN, add it to AcceptEnv in its sshd_config" >&2; exit 1; }`
+
+// sshArgs are the arguments of ssh, forwarding the remote port to the local server and running the command
+// with the variables the AWS SDKs use to get credentials from an ECS credential server. The auth token isn't
+// in the arguments, ssh sends it from its environment
+func (input SSHForwardCommandInput) sshArgs(localPort, remotePort int, region string) []string {
+	args := []string{
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "SendEnv=" + sshForwardTokenVar,
+		"-R", fmt.Sprintf("127.0.0.1:%d:127.0.0.1:%d", remotePort, localPort),
+	}
+	if input.Command == "" {
+		args = append(args, "-t")
+	}
+	for _, option := range input.SSHOptions {
+		args = append(args, "-o", option)
+	}
+	args = append(args, input.Host, "--")
+
+	vars := []string{
+		"AWS_VAULT=" + input.ProfileName,
+		fmt.Sprintf("AWS_CONTAINER_CREDENTIALS_FULL_URI=http://127.0.0.1:%d", remotePort),
+	}
+	if region != "" {
+		vars = append(vars, "AWS_REGION="+region, "AWS_DEFAULT_REGION="+region)
+	}
+
+	remote := []string{"exec", "env"}
+	for _, v := range vars {
+		remote = append(remote, shellQuote(v))
+	}
+	if input.Command == "" {
+		remote = append(remote, "sh", "-c", shellQuote(sshForwardTokenCheck+`; exec "${SHELL:-/bin/sh}" -l`))
+	} else {
+		remote = append(remote, "sh", "-c", shellQuote(sshForwardTokenCheck+`; exec "$@"`), "sh")
+		for _, arg := range append([]string{input.Command}, input.Args...) {
+			remote = append(remote, shellQuote(arg))
+		}
+	}
+
+	return append(args, strings.Join(remote, " "))
+}
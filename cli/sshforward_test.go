@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSSHForwardArgs(t *testing.T) {
+	input := SSHForwardCommandInput{
+		ProfileName: "dev",
+		Host:        "devbox",
+		SSHOptions:  []string{"User=ec2-user"},
+	}
+
+	args := input.sshArgs(41000, 9911, "eu-west-1")
+	expected := []string{
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "SendEnv=AWS_CONTAINER_AUTHORIZATION_TOKEN",
+		"-R", "127.0.0.1:9911:127.0.0.1:41000",
+		"-t",
+		"-o", "User=ec2-user",
+		"devbox", "--",
+		`exec env 'AWS_VAULT=dev' 'AWS_CONTAINER_CREDENTIALS_FULL_URI=http://127.0.0.1:9911' ` +
+			`'AWS_REGION=eu-west-1' 'AWS_DEFAULT_REGION=eu-west-1' sh -c ` + shellQuote(sshForwardTokenCheck+`; exec "${SHELL:-/bin/sh}" -l`),
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %q, got %q", expected, args)
+	}
+
+	input.Command = "aws"
+	input.Args = []string{"s3", "ls", "s3://it's"}
+	args = input.sshArgs(41000, 9911, "")
+	remote := `exec env 'AWS_VAULT=dev' 'AWS_CONTAINER_CREDENTIALS_FULL_URI=http://127.0.0.1:9911' sh -c ` +
+		shellQuote(sshForwardTokenCheck+`; exec "$@"`) + ` sh 'aws' 's3' 'ls' 's3://it'\''s'`
+	if args[len(args)-1] != remote || args[6] == "-t" {
+		t.Errorf("Expected the command without a terminal, got %q", args)
+	}
+}
+
+func TestSSHForwardArgsLeaveOutToken(t *testing.T) {
+	input := SSHForwardCommandInput{ProfileName: "dev", Host: "devbox", Command: "env"}
+	for _, arg := range input.sshArgs(41000, 9911, "eu-west-1") {
+		if strings.Contains(arg, "AWS_CONTAINER_AUTHORIZATION_TOKEN=") {
+			t.Errorf("Expected the auth token not to be in the ssh command line, got %q", arg)
+		}
+	}
+}
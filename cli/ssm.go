@@ -0,0 +1,237 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	osexec "os/exec"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	"github.com/alecthomas/kingpin"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+type SsmCommandInput struct {
+	ProfileName     string
+	InstanceID      string
+	DocumentName    string
+	Parameters      map[string]string
+	PluginPath      string
+	Config          vault.Config
+	SessionDuration time.Duration
+	NoSession       bool
+}
+
+func ConfigureSsmCommand(app *kingpin.Application, a *AwsVault) {
+	input := SsmCommandInput{}
+
+	cmd := app.Command("ssm", "Start an SSM Session Manager session on an instance with session-manager-plugin.")
+
+	cmd.Flag("duration", "Duration of the temporary or assume-role session. Defaults to 1h").
+		Short('d').
+		SetValue(newDurationValue(&input.SessionDuration))
+
+	cmd.Flag("no-session", "Skip creating STS session with GetSessionToken").
+		Short('n').
+		BoolVar(&input.NoSession)
+
+	cmd.Flag("region", "The AWS region").
+		HintOptions(awsRegions...).
+		StringVar(&input.Config.Region)
+
+	cmd.Flag("mfa-token", "The MFA token to use").
+		Short('t').
+		StringVar(&input.Config.MfaToken)
+
+	cmd.Flag("document-name", "The SSM document to start the session with, e.g. AWS-StartPortForwardingSession").
+		StringVar(&input.DocumentName)
+
+	cmd.Flag("parameter", "A parameter of the SSM document as key=value, e.g. portNumber=22. Can be repeated").
+		Short('p').
+		StringMapVar(&input.Parameters)
+
+	cmd.Flag("plugin-path", "Path to the session-manager-plugin executable").
+		Default("session-manager-plugin").
+		Envar("AWS_VAULT_SSM_PLUGIN").
+		StringVar(&input.PluginPath)
+
+	cmd.Arg("profile", "Name of the profile").
+		Required().
+		HintAction(a.MustGetProfileNames).
+		StringVar(&input.ProfileName)
+
+	cmd.Arg("instance-id", "The instance to connect to, e.g. i-0123456789abcdef0").
+		Required().
+		StringVar(&input.InstanceID)
+
+	cmd.Action(func(c *kingpin.ParseContext) (err error) {
+		input.Config.MfaPromptMethod = a.PromptDriver(false)
+		input.Config.NonChainedGetSessionTokenDuration = input.SessionDuration
+		input.Config.AssumeRoleDuration = input.SessionDuration
+
+		input.Config = a.globalConfig(input.Config)
+
+		f, err := a.AwsConfigFile()
+		if err != nil {
+			return err
+		}
+		keyring, err := a.Keyring()
+		if err != nil {
+			return err
+		}
+
+		err = SsmCommand(input, f, keyring)
+		fatalIfError(app, err, "ssm")
+		return nil
+	})
+}
+
+// ssmStartSessionRequest is the request of the SSM StartSession API, and is passed on to session-manager-plugin
+type ssmStartSessionRequest struct {
+	Target       string              `json:"Target"`
+	DocumentName string              `json:"DocumentName,omitempty"`
+	Parameters   map[string][]string `json:"Parameters,omitempty"`
+}
+
+func SsmCommand(input SsmCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
+	pluginPath, err := osexec.LookPath(input.PluginPath)
+	if err != nil {
+		return fmt.Errorf("Can't find %s, install it from https://docs.aws.amazon.com/systems-manager/latest/userguide/session-manager-working-with-install-plugin.html", input.PluginPath)
+	}
+
+	input.ProfileName, err = resolveProfileName(input.ProfileName, f, keyring, input.Config)
+	if err != nil {
+		return err
+	}
+
+	input.Config.NoSession = input.NoSession
+
+	configLoader := vault.ConfigLoader{
+		File:          f,
+		BaseConfig:    input.Config,
+		ActiveProfile: input.ProfileName,
+	}
+	config, err := configLoader.LoadFromProfile(input.ProfileName)
+	if err != nil {
+		return fmt.Errorf("Error loading config: %w", err)
+	}
+	if config.Region == "" {
+		return fmt.Errorf("No region set for profile %s, use --region or set region in your AWS config", input.ProfileName)
+	}
+
+	ckr := &vault.CredentialKeyring{Keyring: keyring}
+	credsProvider, err := vault.NewTempCredentialsProvider(config, ckr)
+	if err != nil {
+		return fmt.Errorf("Error getting temporary credentials: %w", err)
+	}
+
+	creds, err := credsProvider.Retrieve(rootCtx)
+	if err != nil {
+		return fmt.Errorf("Failed to get credentials for %s: %w", input.ProfileName, err)
+	}
+
+	request := ssmStartSessionRequest{
+		Target:       input.InstanceID,
+		DocumentName: input.DocumentName,
+	}
+	for k, v := range input.Parameters {
+		if request.Parameters == nil {
+			request.Parameters = map[string][]string{}
+		}
+		request.Parameters[k] = []string{v}
+	}
+
+	endpoint := ssmEndpoint(config.Region)
+	session, err := startSSMSession(rootCtx, vault.HTTPClient(config), creds, config.Region, endpoint, request)
+	if err != nil {
+		return err
+	}
+
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	// the plugin takes the StartSession response and request, and only uses the credentials to
+	// terminate the session, which it does with the credentials in its environment
+	env := environ(os.Environ())
+	env = updateEnvForAwsVault(rootCtx, env, input.ProfileName, config.Region, defaultUnsetEnv)
+	env.Set("AWS_ACCESS_KEY_ID", creds.AccessKeyID)
+	env.Set("AWS_SECRET_ACCESS_KEY", creds.SecretAccessKey)
+	if creds.SessionToken != "" {
+		env.Set("AWS_SESSION_TOKEN", creds.SessionToken)
+	}
+
+	args := []string{string(session), config.Region, "StartSession", "", string(requestJSON), endpoint}
+	log.Printf("Starting subprocess: %s for session to %s", pluginPath, input.InstanceID)
+
+	cmd := osexec.Command(pluginPath, args...)
+	cmd.Env = env
+
+	return runCmd(cmd, nil)
+}
+
+// ssmEndpoint is the regional endpoint of SSM
+func ssmEndpoint(region string) string {
+	if strings.HasPrefix(region, "cn-") {
+		return fmt.Sprintf("https://ssm.%s.amazonaws.com.cn", region)
+	}
+	return fmt.Sprintf("https://ssm.%s.amazonaws.com", region)
+}
+
+// startSSMSession calls the SSM StartSession API and returns its response as is, as session-manager-plugin expects it
+func startSSMSession(ctx context.Context, client aws.HTTPClient, creds aws.Credentials, region, endpoint string, request ssmStartSessionRequest) ([]byte, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonSSM.StartSession")
+
+	payloadHash := sha256.Sum256(body)
+	err = v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]), "ssm", region, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to sign StartSession request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Type != "" {
+			errType := apiErr.Type[strings.LastIndex(apiErr.Type, "#")+1:]
+			return nil, fmt.Errorf("Failed to start session: %s: %s", errType, apiErr.Message)
+		}
+		return nil, fmt.Errorf("Failed to start session: %s", resp.Status)
+	}
+
+	return respBody, nil
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestStartSSMSession(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if target := r.Header.Get("X-Amz-Target"); target != "AmazonSSM.StartSession" {
+			t.Errorf("Expected target AmazonSSM.StartSession, got %s", target)
+		}
+		if auth := r.Header.Get("Authorization"); !strings.Contains(auth, "Credential=AKIAEXAMPLE/") || !strings.Contains(auth, "/us-east-1/ssm/aws4_request") {
+			t.Errorf("Unexpected Authorization header %s", auth)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var request ssmStartSessionRequest
+		if err := json.Unmarshal(body, &request); err != nil || request.Target != "i-0123456789abcdef0" {
+			t.Errorf("Unexpected request %s", body)
+		}
+		if r.Header.Get("X-Amz-Security-Token") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"com.amazonaws.ssm#InvalidTarget","message":"no token"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"SessionId":"s-1","StreamUrl":"wss://example","TokenValue":"t"}`))
+	}))
+	defer ts.Close()
+
+	request := ssmStartSessionRequest{Target: "i-0123456789abcdef0"}
+	creds := aws.Credentials{AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"}
+
+	session, err := startSSMSession(context.Background(), http.DefaultClient, creds, "us-east-1", ts.URL, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(session), `"SessionId":"s-1"`) {
+		t.Fatalf("Expected the response to be returned as is, got %s", session)
+	}
+
+	creds.SessionToken = ""
+	_, err = startSSMSession(context.Background(), http.DefaultClient, creds, "us-east-1", ts.URL, request)
+	if err == nil || !strings.Contains(err.Error(), "InvalidTarget: no token") {
+		t.Fatalf("Expected an InvalidTarget error, got %v", err)
+	}
+}
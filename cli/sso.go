@@ -0,0 +1,353 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	"github.com/alecthomas/kingpin"
+)
+
+// SSOSessionInput is the SSO start URL to sign in to, from an [sso-session] section or the flags
+type SSOSessionInput struct {
+	SSOSession string
+	StartURL   string
+	SSORegion  string
+	UseStdout  bool
+	Browser    string
+	Config     vault.Config
+}
+
+type SSOPopulateCommandInput struct {
+	SSOSessionInput
+	Region       string
+	NameTemplate string
+	DryRun       bool
+}
+
+type SSOLoginCommandInput struct {
+	SSOSessionInput
+}
+
+type SSOLogoutCommandInput struct {
+	SSOSessionInput
+}
+
+// defaultSSOProfileNameTemplate names profiles after the account and role, e.g. production-AdministratorAccess
+const defaultSSOProfileNameTemplate = "{{.AccountName}}-{{.RoleName}}"
+
+func ConfigureSSOCommand(app *kingpin.Application, a *AwsVault) {
+	cmd := app.Command("sso", "Manage AWS IAM Identity Center (SSO) profiles.")
+
+	configureSSOPopulateCommand(app, cmd, a)
+	configureSSOLoginCommand(app, cmd, a)
+	configureSSOLogoutCommand(app, cmd, a)
+}
+
+func (s *SSOSessionInput) configureFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("sso-session", "Name of the [sso-session] section to sign in with").
+		StringVar(&s.SSOSession)
+
+	cmd.Flag("start-url", "The SSO start URL to sign in with, when not using --sso-session").
+		StringVar(&s.StartURL)
+
+	cmd.Flag("sso-region", "The region of the SSO start URL, when not using --sso-session").
+		HintOptions(awsRegions...).
+		StringVar(&s.SSORegion)
+
+	cmd.Flag("stdout", "Print the SSO link to the terminal without automatically opening the browser").
+		BoolVar(&s.UseStdout)
+
+	cmd.Flag("browser", "Command to open the SSO link with, rather than the default browser. Overrides sso_browser_command in the sso-session").
+		StringVar(&s.Browser)
+}
+
+func configureSSOPopulateCommand(app *kingpin.Application, parent *kingpin.CmdClause, a *AwsVault) {
+	input := SSOPopulateCommandInput{}
+
+	cmd := parent.Command("populate", "Sign in to SSO and add a profile to the AWS config for every role in every account you can access.")
+
+	input.SSOSessionInput.configureFlags(cmd)
+
+	cmd.Flag("region", "The region to set in the profiles").
+		HintOptions(awsRegions...).
+		StringVar(&input.Region)
+
+	cmd.Flag("name-template", "Go template for the profile names, with .AccountName, .AccountID and .RoleName. Characters other than letters, digits, '.', '_' and '-' are replaced with '-'").
+		Default(defaultSSOProfileNameTemplate).
+		StringVar(&input.NameTemplate)
+
+	cmd.Flag("dry-run", "Print the profiles instead of writing them to the AWS config").
+		BoolVar(&input.DryRun)
+
+	cmd.Action(func(c *kingpin.ParseContext) (err error) {
+		input.Config = a.globalConfig(input.Config)
+
+		f, err := a.AwsConfigFile()
+		if err != nil {
+			return err
+		}
+		keyring, err := a.Keyring()
+		if err != nil {
+			return err
+		}
+
+		err = SSOPopulateCommand(input, f, keyring)
+		fatalIfError(app, err, "sso populate")
+		return nil
+	})
+}
+
+func SSOPopulateCommand(input SSOPopulateCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
+	config, err := input.ssoConfig(f)
+	if err != nil {
+		return err
+	}
+
+	nameTemplate, err := template.New("name").Option("missingkey=error").Parse(input.NameTemplate)
+	if err != nil {
+		return fmt.Errorf("Invalid --name-template: %w", err)
+	}
+
+	roles, err := vault.ListSSOAccountRoles(rootCtx, keyring, config)
+	if err != nil {
+		return fmt.Errorf("Failed to list SSO accounts and roles: %w", err)
+	}
+	if len(roles) == 0 {
+		return fmt.Errorf("No accounts and roles can be accessed with %s", config.SSOStartURL)
+	}
+
+	profiles, err := ssoProfiles(roles, nameTemplate, input, config)
+	if err != nil {
+		return err
+	}
+
+	for _, profile := range profiles {
+		if input.DryRun {
+			fmt.Print(formatProfileSection(profile))
+			continue
+		}
+
+		if existing, ok := f.ProfileSection(profile.Name); ok {
+			if existing.SSOAccountID != profile.SSOAccountID || existing.SSORoleName != profile.SSORoleName {
+				fmt.Fprintf(os.Stderr, "Skipping %s: a profile with that name already exists for another account or role\n", profile.Name)
+			}
+			continue
+		}
+		if err := f.Add(profile); err != nil {
+			return err
+		}
+		fmt.Printf("Added profile %s for %s in %s\n", profile.Name, profile.SSORoleName, profile.SSOAccountID)
+	}
+
+	return nil
+}
+
+func configureSSOLoginCommand(app *kingpin.Application, parent *kingpin.CmdClause, a *AwsVault) {
+	input := SSOLoginCommandInput{}
+
+	cmd := parent.Command("login", "Sign in to SSO and cache the token in the keyring, so that profiles using it don't need to.")
+
+	input.SSOSessionInput.configureFlags(cmd)
+
+	cmd.Action(func(c *kingpin.ParseContext) (err error) {
+		input.Config = a.globalConfig(input.Config)
+
+		f, err := a.AwsConfigFile()
+		if err != nil {
+			return err
+		}
+		keyring, err := a.Keyring()
+		if err != nil {
+			return err
+		}
+
+		err = SSOLoginCommand(input, f, keyring)
+		fatalIfError(app, err, "sso login")
+		return nil
+	})
+}
+
+func SSOLoginCommand(input SSOLoginCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
+	config, err := input.ssoConfig(f)
+	if err != nil {
+		return err
+	}
+
+	expiration, err := vault.SSOLogin(rootCtx, keyring, config)
+	if err != nil {
+		return err
+	}
+
+	infof("Signed in to %s, the token expires in %s", config.SSOStartURL, time.Until(expiration).Round(time.Minute))
+	return nil
+}
+
+func configureSSOLogoutCommand(app *kingpin.Application, parent *kingpin.CmdClause, a *AwsVault) {
+	input := SSOLogoutCommandInput{}
+
+	cmd := parent.Command("logout", "Sign out of SSO, removing its tokens from the keyring and the AWS CLI cache, and the sessions of the profiles using it.")
+
+	input.SSOSessionInput.configureFlags(cmd)
+
+	cmd.Action(func(c *kingpin.ParseContext) (err error) {
+		input.Config = a.globalConfig(input.Config)
+
+		f, err := a.AwsConfigFile()
+		if err != nil {
+			return err
+		}
+		keyring, err := a.Keyring()
+		if err != nil {
+			return err
+		}
+
+		err = SSOLogoutCommand(input, f, keyring)
+		fatalIfError(app, err, "sso logout")
+		return nil
+	})
+}
+
+func SSOLogoutCommand(input SSOLogoutCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
+	config, err := input.ssoConfig(f)
+	if err != nil {
+		return err
+	}
+
+	numTokensRemoved, err := vault.SSOLogout(rootCtx, keyring, config)
+	if err != nil {
+		return err
+	}
+
+	// the credentials of the roles stay valid until they expire, so they're removed too
+	sessions := &vault.SessionKeyring{Keyring: keyring, Hooks: f.HooksSection()}
+	numSessionsRemoved := 0
+	for _, profileName := range profilesUsingSSOStartURL(f, config.SSOStartURL) {
+		n, err := sessions.RemoveForProfile(profileName)
+		if err != nil {
+			return err
+		}
+		numSessionsRemoved += n
+	}
+
+	infof("Signed out of %s, removed %d tokens and %d sessions", config.SSOStartURL, numTokensRemoved, numSessionsRemoved)
+	return nil
+}
+
+// profileSSOStartURL is the SSO start URL of the profile, set in it or in its sso-session
+func profileSSOStartURL(f *vault.ConfigFile, profileSection vault.ProfileSection) string {
+	if profileSection.SSOSession != "" {
+		if ssoSession, ok := f.SSOSessionSection(profileSection.SSOSession); ok {
+			return ssoSession.SSOStartURL
+		}
+	}
+	return profileSection.SSOStartURL
+}
+
+// profilesUsingSSOStartURL are the names of the profiles that get credentials with the SSO start URL
+func profilesUsingSSOStartURL(f *vault.ConfigFile, startURL string) []string {
+	names := []string{}
+	for _, profileSection := range f.ProfileSections() {
+		if profileSection.SSOAccountID != "" && profileSSOStartURL(f, profileSection) == startURL {
+			names = append(names, profileSection.Name)
+		}
+	}
+	return names
+}
+
+// ssoConfig is the config to sign in to SSO with, from an [sso-session] section or the flags
+func (input SSOSessionInput) ssoConfig(f *vault.ConfigFile) (*vault.Config, error) {
+	config := input.Config
+	config.SSOUseStdout = input.UseStdout
+	config.SSOBrowserCommand = input.Browser
+
+	if input.SSOSession != "" {
+		if input.StartURL != "" || input.SSORegion != "" {
+			return nil, fmt.Errorf("Can't use --sso-session with --start-url or --sso-region")
+		}
+		section, ok := f.SSOSessionSection(input.SSOSession)
+		if !ok {
+			return nil, fmt.Errorf("No [sso-session %s] section in the AWS config", input.SSOSession)
+		}
+		config.SSOSession = section.Name
+		config.SSOStartURL = section.SSOStartURL
+		config.SSORegion = section.SSORegion
+		config.SSORegistrationScopes = section.SSORegistrationScopes
+		if config.SSOBrowserCommand == "" {
+			config.SSOBrowserCommand = section.SSOBrowserCommand
+		}
+	} else {
+		config.SSOStartURL = input.StartURL
+		config.SSORegion = input.SSORegion
+	}
+
+	if config.SSOStartURL == "" || config.SSORegion == "" {
+		return nil, fmt.Errorf("Set the SSO start URL and region with --sso-session, or with --start-url and --sso-region")
+	}
+	return &config, nil
+}
+
+var invalidProfileNameCharsRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ssoProfiles are the profile sections for the roles, named with the template
+func ssoProfiles(roles []vault.SSOAccountRole, nameTemplate *template.Template, input SSOPopulateCommandInput, config *vault.Config) ([]vault.ProfileSection, error) {
+	profiles := []vault.ProfileSection{}
+	names := map[string]vault.SSOAccountRole{}
+
+	for _, role := range roles {
+		var b strings.Builder
+		if err := nameTemplate.Execute(&b, role); err != nil {
+			return nil, fmt.Errorf("Invalid --name-template: %w", err)
+		}
+		name := strings.Trim(invalidProfileNameCharsRegexp.ReplaceAllString(b.String(), "-"), "-")
+		if name == "" {
+			return nil, fmt.Errorf("--name-template gives an empty name for %s in %s", role.RoleName, role.AccountID)
+		}
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("--name-template gives the same name %s for %s in %s and %s in %s, use .AccountID to tell them apart",
+				name, other.RoleName, other.AccountID, role.RoleName, role.AccountID)
+		}
+		names[name] = role
+
+		profile := vault.ProfileSection{
+			Name:         name,
+			Region:       input.Region,
+			SSOAccountID: role.AccountID,
+			SSORoleName:  role.RoleName,
+		}
+		if config.SSOSession != "" {
+			profile.SSOSession = config.SSOSession
+		} else {
+			profile.SSOStartURL = config.SSOStartURL
+			profile.SSORegion = config.SSORegion
+		}
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+// formatProfileSection prints the SSO settings of the profile as it's written to the config
+func formatProfileSection(profile vault.ProfileSection) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[profile %s]\n", profile.Name)
+	for _, kv := range [][2]string{
+		{"sso_session", profile.SSOSession},
+		{"sso_start_url", profile.SSOStartURL},
+		{"sso_region", profile.SSORegion},
+		{"sso_account_id", profile.SSOAccountID},
+		{"sso_role_name", profile.SSORoleName},
+		{"region", profile.Region},
+	} {
+		if kv[1] != "" {
+			fmt.Fprintf(&b, "%s = %s\n", kv[0], kv[1])
+		}
+	}
+	b.WriteString("\n")
+	return b.String()
+}
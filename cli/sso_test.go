@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"text/template"
+
+	"github.com/99designs/aws-vault/v7/vault"
+)
+
+func TestSSOProfiles(t *testing.T) {
+	roles := []vault.SSOAccountRole{
+		{AccountID: "111111111111", AccountName: "Production Web", RoleName: "AdministratorAccess"},
+		{AccountID: "222222222222", AccountName: "staging", RoleName: "ReadOnly"},
+	}
+	config := &vault.Config{SSOSession: "acme", SSOStartURL: "https://acme.awsapps.com/start", SSORegion: "us-east-1"}
+
+	profiles, err := ssoProfiles(roles, template.Must(template.New("name").Parse(defaultSSOProfileNameTemplate)), SSOPopulateCommandInput{Region: "eu-west-1"}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := vault.ProfileSection{
+		Name:         "Production-Web-AdministratorAccess",
+		Region:       "eu-west-1",
+		SSOSession:   "acme",
+		SSOAccountID: "111111111111",
+		SSORoleName:  "AdministratorAccess",
+	}
+	if profiles[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, profiles[0])
+	}
+
+	_, err = ssoProfiles(roles, template.Must(template.New("name").Parse("{{.RoleName}}-x")), SSOPopulateCommandInput{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles = append(roles, vault.SSOAccountRole{AccountID: "333333333333", AccountName: "dev", RoleName: "ReadOnly"})
+	if _, err = ssoProfiles(roles, template.Must(template.New("name").Parse("{{.RoleName}}")), SSOPopulateCommandInput{}, config); err == nil {
+		t.Error("Expected an error for profiles with the same name")
+	}
+}
+
+func TestProfilesUsingSSOStartURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(path, []byte(`[sso-session acme]
+sso_start_url = https://acme.awsapps.com/start
+sso_region = us-east-1
+
+[profile prod]
+sso_session = acme
+sso_account_id = 111111111111
+sso_role_name = AdministratorAccess
+
+[profile legacy]
+sso_start_url = https://acme.awsapps.com/start
+sso_region = us-east-1
+sso_account_id = 222222222222
+sso_role_name = ReadOnly
+
+[profile other]
+sso_start_url = https://other.awsapps.com/start
+sso_region = us-east-1
+sso_account_id = 333333333333
+sso_role_name = ReadOnly
+
+[profile user]
+region = us-east-1
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := vault.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := profilesUsingSSOStartURL(f, "https://acme.awsapps.com/start")
+	if !reflect.DeepEqual(names, []string{"prod", "legacy"}) {
+		t.Errorf("Expected the profiles using the start URL, got %v", names)
+	}
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+)
+
+var statsStart time.Time
+
+func enableStats() {
+	statsStart = time.Now()
+	vault.StatsRecorder = &vault.Stats{}
+}
+
+// printStats prints the timings recorded with --stats to stderr. It only prints once
+func printStats() {
+	if vault.StatsRecorder == nil {
+		return
+	}
+	timings := vault.StatsRecorder.Timings()
+	vault.StatsRecorder = nil
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Operation\tCalls\tTime\t")
+	for _, t := range timings {
+		fmt.Fprintf(w, "%s\t%d\t%s\t\n", t.Name, t.Count, t.Total.Round(time.Millisecond))
+	}
+	fmt.Fprintf(w, "total\t\t%s\t\n", time.Since(statsStart).Round(time.Millisecond))
+	_ = w.Flush()
+}
+
+// timedKeyring records the time spent accessing the keyring
+type timedKeyring struct {
+	keyring.Keyring
+}
+
+func (k *timedKeyring) Get(key string) (keyring.Item, error) {
+	defer vault.RecordTiming("keyring.Get", time.Now())
+	return k.Keyring.Get(key)
+}
+
+func (k *timedKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	defer vault.RecordTiming("keyring.GetMetadata", time.Now())
+	return k.Keyring.GetMetadata(key)
+}
+
+func (k *timedKeyring) Set(item keyring.Item) error {
+	defer vault.RecordTiming("keyring.Set", time.Now())
+	return k.Keyring.Set(item)
+}
+
+func (k *timedKeyring) Remove(key string) error {
+	defer vault.RecordTiming("keyring.Remove", time.Now())
+	return k.Keyring.Remove(key)
+}
+
+func (k *timedKeyring) Keys() ([]string, error) {
+	defer vault.RecordTiming("keyring.Keys", time.Now())
+	return k.Keyring.Keys()
+}
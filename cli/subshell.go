@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/99designs/aws-vault/v7/vault"
+)
+
+// withSubshell sets the command to the default shell when exec is given no command and the shell needs
+// setting up, as a login shell with --login-shell, or to source the shell_rc of the profile. The files
+// that source shell_rc are removed when aws-vault exits, so it needs to wait for the shell
+func (input ExecCommandInput) withSubshell(config *vault.Config, env *environ) (ExecCommandInput, bool, error) {
+	if input.Command != "" || (!input.LoginShell && config.ShellRC == "") {
+		return input, false, nil
+	}
+
+	shell := getDefaultShell()
+	command, args, err := subshellCommand(shell, input.LoginShell, config.ShellRC, env)
+	if err != nil {
+		return input, false, err
+	}
+
+	kind := "subshell"
+	if input.LoginShell {
+		kind = "login subshell"
+	}
+	infof("Starting a %s %s, use `exit` to exit the subshell", kind, shell)
+
+	input.Command = command
+	input.Args = args
+	return input, config.ShellRC != "", nil
+}
+
+// subshellCommand is the command that starts shell, and sources rcFile after the shell's own startup files.
+// Shells have no common way of doing this, so bash is given an --rcfile, zsh a ZDOTDIR and fish an
+// --init-command, and other shells ENV, which POSIX shells source when interactive
+func subshellCommand(shell string, login bool, rcFile string, env *environ) (string, []string, error) {
+	name := strings.TrimSuffix(filepath.Base(shell), ".exe")
+	switch strings.ToLower(name) {
+	case "cmd", "powershell", "pwsh":
+		return "", nil, fmt.Errorf("--login-shell and shell_rc aren't supported with %s", name)
+	}
+
+	args := []string{}
+	if login {
+		args = append(args, "-l")
+	}
+	if rcFile == "" {
+		return shell, args, nil
+	}
+
+	rcFile, err := expandHomeDir(rcFile)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := os.Stat(rcFile); err != nil {
+		return "", nil, fmt.Errorf("Can't read shell_rc: %w", err)
+	}
+
+	switch name {
+	case "fish":
+		return shell, append(args, "--init-command", "source "+shellQuote(rcFile)), nil
+	case "bash":
+		// bash ignores --rcfile in login shells, so the rc file sources the login files itself
+		startup := `[ -f ~/.bashrc ] && . ~/.bashrc`
+		if login {
+			startup = `[ -f /etc/profile ] && . /etc/profile
+for _avs_f in ~/.bash_profile ~/.bash_login ~/.profile; do
+  if [ -f "$_avs_f" ]; then . "$_avs_f"; break; fi
+done
+unset _avs_f`
+		}
+		dir, err := writeSubshellFiles(map[string]string{
+			"bashrc": startup + "\n. " + shellQuote(rcFile) + "\n",
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		return shell, []string{"--rcfile", filepath.Join(dir, "bashrc"), "-i"}, nil
+	case "zsh":
+		dir, err := writeZshStartupFiles(rcFile, env)
+		if err != nil {
+			return "", nil, err
+		}
+		env.Set("ZDOTDIR", dir)
+		return shell, args, nil
+	}
+
+	dir, err := writeSubshellFiles(map[string]string{
+		"env": `[ -n "$_AVS_ENV" ] && . "$_AVS_ENV"` + "\nunset _AVS_ENV\n. " + shellQuote(rcFile) + "\n",
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if v, ok := env.Get("ENV"); ok {
+		env.Set("_AVS_ENV", v)
+	}
+	env.Set("ENV", filepath.Join(dir, "env"))
+	return shell, args, nil
+}
+
+// writeZshStartupFiles writes startup files for a ZDOTDIR that source those of the user, keeping any
+// ZDOTDIR they set, and then rcFile once the last file for the kind of shell has been read
+func writeZshStartupFiles(rcFile string, env *environ) (string, error) {
+	zdotdir, ok := env.Get("ZDOTDIR")
+	if !ok || zdotdir == "" {
+		zdotdir = os.Getenv("HOME")
+	}
+	env.Set("_AVS_ZDOTDIR", zdotdir)
+
+	source := func(file string) string {
+		return fmt.Sprintf(`_avs_dir="$ZDOTDIR"
+ZDOTDIR="$_AVS_ZDOTDIR"
+[ -f "$ZDOTDIR/%s" ] && . "$ZDOTDIR/%s"
+_AVS_ZDOTDIR="$ZDOTDIR"
+ZDOTDIR="$_avs_dir"
+unset _avs_dir
+`, file, file)
+	}
+	finish := `ZDOTDIR="$_AVS_ZDOTDIR"
+unset _AVS_ZDOTDIR
+. ` + shellQuote(rcFile) + "\n"
+
+	return writeSubshellFiles(map[string]string{
+		".zshenv":   source(".zshenv"),
+		".zprofile": source(".zprofile"),
+		".zshrc":    source(".zshrc") + "[[ -o login ]] || {\n" + finish + "}\n",
+		".zlogin":   source(".zlogin") + finish,
+	})
+}
+
+// writeSubshellFiles writes the files to a temporary directory that is removed when aws-vault exits
+func writeSubshellFiles(files map[string]string) (string, error) {
+	dir, err := os.MkdirTemp("", "aws-vault-shell")
+	if err != nil {
+		return "", err
+	}
+	onExit(func() {
+		os.RemoveAll(dir)
+	})
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			return "", err
+		}
+	}
+	log.Printf("Wrote subshell startup files to %s", dir)
+
+	return dir, nil
+}
+
+// expandHomeDir expands a leading ~/ in path to the home directory
+func expandHomeDir(path string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[2:]), nil
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSubshellCommand(t *testing.T) {
+	rcFile := filepath.Join(t.TempDir(), "rc.sh")
+	if err := os.WriteFile(rcFile, []byte("export PS1='prod> '\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, args, err := subshellCommand("/bin/zsh", true, "", &environ{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(args, " ") != "-l" {
+		t.Errorf("Expected a login shell, got %v", args)
+	}
+
+	_, args, err = subshellCommand("/bin/bash", true, rcFile, &environ{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 3 || args[0] != "--rcfile" {
+		t.Fatalf("Expected bash to be given an --rcfile, got %v", args)
+	}
+	b, err := os.ReadFile(args[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "~/.bash_profile") || !strings.HasSuffix(string(b), ". "+shellQuote(rcFile)+"\n") {
+		t.Errorf("Unexpected rc file:\n%s", b)
+	}
+
+	env := environ{"ENV=/home/user/.shrc"}
+	_, _, err = subshellCommand("/bin/dash", false, rcFile, &env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := env.Get("_AVS_ENV"); v != "/home/user/.shrc" {
+		t.Errorf("Expected the ENV of the user to be kept, got %q", v)
+	}
+	if v, _ := env.Get("ENV"); !strings.HasPrefix(v, os.TempDir()) {
+		t.Errorf("Expected ENV to be a temporary file, got %q", v)
+	}
+
+	if _, _, err = subshellCommand("/bin/bash", false, filepath.Join(t.TempDir(), "missing"), &environ{}); err == nil {
+		t.Error("Expected an error for a missing shell_rc")
+	}
+	Flush()
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	"github.com/alecthomas/kingpin"
+)
+
+type TreeCommandInput struct {
+	ProfileName string
+}
+
+func ConfigureTreeCommand(app *kingpin.Application, a *AwsVault) {
+	input := TreeCommandInput{}
+
+	cmd := app.Command("tree", "Show the chain of credentials used for a profile, or for all profiles.")
+
+	cmd.Arg("profile", "Name of the profile").
+		HintAction(a.MustGetProfileNames).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		keyring, err := a.Keyring()
+		if err != nil {
+			return err
+		}
+		awsConfigFile, err := a.AwsConfigFile()
+		if err != nil {
+			return err
+		}
+		err = TreeCommand(input, awsConfigFile, keyring)
+		fatalIfError(app, err, "tree")
+		return nil
+	})
+}
+
+func TreeCommand(input TreeCommandInput, awsConfigFile *vault.ConfigFile, keyring keyring.Keyring) error {
+	ckr := &vault.CredentialKeyring{Keyring: keyring}
+
+	profileNames := awsConfigFile.ProfileNames()
+	if input.ProfileName != "" {
+		profileName, err := resolveProfileName(input.ProfileName, awsConfigFile, keyring, vault.Config{})
+		if err != nil {
+			return err
+		}
+		profileNames = []string{profileName}
+	}
+
+	for i, profileName := range profileNames {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := printProfileTree(os.Stdout, profileName, awsConfigFile, ckr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// chainLinkLabel describes a step in a credentials chain for display
+func chainLinkLabel(l vault.ChainLink) string {
+	label := l.Type
+	if l.Detail != "" {
+		label += " " + l.Detail
+	}
+	if l.MfaChained {
+		label += " (chained MFA)"
+	} else if l.MfaSerial != "" {
+		label += fmt.Sprintf(" (MFA %s)", l.MfaSerial)
+	}
+	if l.Missing {
+		label += " [MISSING]"
+	}
+	return label
+}
+
+// printProfileTree prints the chain for a profile as a tree, starting with the profile itself and
+// ending with the source credentials. Problems loading the profile, such as loops, are printed in
+// the tree rather than returned
+func printProfileTree(w io.Writer, profileName string, awsConfigFile *vault.ConfigFile, ckr *vault.CredentialKeyring) error {
+	fmt.Fprintln(w, profileName)
+
+	configLoader := vault.ConfigLoader{
+		File:          awsConfigFile,
+		ActiveProfile: profileName,
+	}
+	config, err := configLoader.LoadFromProfile(profileName)
+	if err != nil {
+		fmt.Fprintf(w, "└── ERROR: %s\n", err.Error())
+		return nil
+	}
+
+	links, err := vault.DescribeChain(config, ckr)
+	if err != nil {
+		return err
+	}
+
+	printChainLinks(w, profileName, links)
+	return nil
+}
+
+// printChainLinks prints the links of a chain as the branches of a tree, last link first
+func printChainLinks(w io.Writer, profileName string, links []vault.ChainLink) {
+	for i := len(links) - 1; i >= 0; i-- {
+		indent := strings.Repeat("    ", len(links)-1-i)
+		label := chainLinkLabel(links[i])
+		if links[i].ProfileName != profileName {
+			label = fmt.Sprintf("[%s] %s", links[i].ProfileName, label)
+		}
+		fmt.Fprintf(w, "%s└── %s\n", indent, label)
+	}
+}
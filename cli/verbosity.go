@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// Verbosity levels, set with -q and -v. -vv is the same as --debug
+const (
+	verbosityQuiet   = -1
+	verbosityDefault = 0
+	verbosityVerbose = 1
+	verbosityDebug   = 2
+)
+
+// verbosity is how much aws-vault tells you about what it's doing on stderr
+var verbosity = verbosityDefault
+
+// debugToStderr is whether the debugging output already goes to stderr, so verbose messages aren't repeated
+var debugToStderr = false
+
+// infof prints an informational message to stderr, such as that a subshell is starting, unless -q is set
+func infof(format string, args ...interface{}) {
+	log.Printf(format, args...)
+	if verbosity >= verbosityDefault && !debugToStderr {
+		fmt.Fprintf(os.Stderr, "aws-vault: "+format+"\n", args...)
+	}
+}
+
+// warningWriter is where warnings, such as about requests refused by the credential servers, are written
+// to as well as the debugging output. They're written even with -q, unless the debugging output is already
+// on stderr
+func warningWriter(stderr io.Writer) io.Writer {
+	if debugToStderr {
+		return nil
+	}
+	return stderr
+}
+
+// verbosef prints a message about the details of what aws-vault is doing to stderr with -v, such as the
+// variables set in the environment of the command, and otherwise only to the debugging output
+func verbosef(format string, args ...interface{}) {
+	log.Printf(format, args...)
+	if verbosity >= verbosityVerbose && !debugToStderr {
+		fmt.Fprintf(os.Stderr, "aws-vault: "+format+"\n", args...)
+	}
+}
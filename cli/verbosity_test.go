@@ -0,0 +1,33 @@
+package cli
+
+import "testing"
+
+func TestConfigureVerbosity(t *testing.T) {
+	defer func() { verbosity, debugToStderr = verbosityDefault, false }()
+
+	cases := []struct {
+		a         AwsVault
+		verbosity int
+		debug     bool
+	}{
+		{AwsVault{}, verbosityDefault, false},
+		{AwsVault{Quiet: true}, verbosityQuiet, false},
+		{AwsVault{Verbose: 1}, verbosityVerbose, false},
+		{AwsVault{Verbose: 2}, verbosityDebug, true},
+		{AwsVault{Verbose: 3}, verbosityDebug, true},
+	}
+	for _, c := range cases {
+		a := c.a
+		if err := a.configureVerbosity(); err != nil {
+			t.Fatal(err)
+		}
+		if verbosity != c.verbosity || a.Debug != c.debug {
+			t.Errorf("Expected %+v to give verbosity %d and debug %v, got %d and %v", c.a, c.verbosity, c.debug, verbosity, a.Debug)
+		}
+	}
+
+	a := AwsVault{Quiet: true, Verbose: 1}
+	if err := a.configureVerbosity(); err == nil {
+		t.Error("Expected an error for --quiet with --verbose")
+	}
+}
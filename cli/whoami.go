@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	"github.com/alecthomas/kingpin"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+type WhoamiCommandInput struct {
+	ProfileName     string
+	Config          vault.Config
+	SessionDuration time.Duration
+	NoSession       bool
+}
+
+func ConfigureWhoamiCommand(app *kingpin.Application, a *AwsVault) {
+	input := WhoamiCommandInput{}
+
+	cmd := app.Command("whoami", "Show the identity and credential chain used for a profile.")
+
+	cmd.Flag("duration", "Duration of the temporary or assume-role session. Defaults to 1h").
+		Short('d').
+		SetValue(newDurationValue(&input.SessionDuration))
+
+	cmd.Flag("no-session", "Skip creating STS session with GetSessionToken").
+		Short('n').
+		BoolVar(&input.NoSession)
+
+	cmd.Flag("region", "The AWS region").
+		HintOptions(awsRegions...).
+		StringVar(&input.Config.Region)
+
+	cmd.Flag("mfa-token", "The MFA token to use").
+		Short('t').
+		StringVar(&input.Config.MfaToken)
+
+	cmd.Arg("profile", "Name of the profile").
+		Required().
+		HintAction(a.MustGetProfileNames).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) (err error) {
+		input.Config.MfaPromptMethod = a.PromptDriver(false)
+		input.Config.NonChainedGetSessionTokenDuration = input.SessionDuration
+		input.Config.AssumeRoleDuration = input.SessionDuration
+
+		input.Config = a.globalConfig(input.Config)
+
+		f, err := a.AwsConfigFile()
+		if err != nil {
+			return err
+		}
+		keyring, err := a.Keyring()
+		if err != nil {
+			return err
+		}
+
+		err = WhoamiCommand(input, f, keyring)
+		fatalIfError(app, err, "whoami")
+		return nil
+	})
+}
+
+func WhoamiCommand(input WhoamiCommandInput, f *vault.ConfigFile, keyring keyring.Keyring) error {
+	var err error
+	input.ProfileName, err = resolveProfileName(input.ProfileName, f, keyring, input.Config)
+	if err != nil {
+		return err
+	}
+
+	input.Config.NoSession = input.NoSession
+
+	configLoader := vault.ConfigLoader{
+		File:          f,
+		BaseConfig:    input.Config,
+		ActiveProfile: input.ProfileName,
+	}
+	config, err := configLoader.LoadFromProfile(input.ProfileName)
+	if err != nil {
+		return fmt.Errorf("Error loading config: %w", err)
+	}
+
+	ckr := &vault.CredentialKeyring{Keyring: keyring}
+
+	// the chain is described before the providers are created, as creating them updates the config for chained MFA
+	links, err := vault.DescribeChain(config, ckr)
+	if err != nil {
+		return err
+	}
+
+	credsProvider, err := vault.NewTempCredentialsProvider(config, ckr)
+	if err != nil {
+		return fmt.Errorf("Error getting temporary credentials: %w", err)
+	}
+
+	creds, err := credsProvider.Retrieve(rootCtx)
+	if err != nil {
+		return fmt.Errorf("Failed to get credentials for %s: %w", input.ProfileName, err)
+	}
+
+	cfg := vault.NewAwsConfigWithCredsProvider(credentials.StaticCredentialsProvider{Value: creds}, config.Region, config.STSRegionalEndpoints)
+	vault.AddProfileProxy(&cfg, config)
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(rootCtx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("Failed to get caller identity: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Account:\t%s\n", aws.ToString(identity.Account))
+	fmt.Fprintf(w, "Arn:\t%s\n", aws.ToString(identity.Arn))
+	fmt.Fprintf(w, "UserId:\t%s\n", aws.ToString(identity.UserId))
+	if creds.CanExpire {
+		fmt.Fprintf(w, "Expires:\t%s (in %s)\n", creds.Expires.Local().Format(time.RFC3339), time.Until(creds.Expires).Truncate(time.Second))
+	} else {
+		fmt.Fprintf(w, "Expires:\tnever\n")
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(input.ProfileName)
+	printChainLinks(os.Stdout, input.ProfileName, links)
+
+	return nil
+}
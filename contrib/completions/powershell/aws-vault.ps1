@@ -0,0 +1,16 @@
+Register-ArgumentCompleter -Native -CommandName aws-vault, aws-vault.exe -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($words -contains '--') {
+        return
+    }
+    # aws-vault completes the word being typed, which is the last one before the cursor
+    if ($wordToComplete -ne '' -and $words.Count -gt 0) {
+        $words = @($words | Select-Object -SkipLast 1)
+    }
+
+    & $commandAst.CommandElements[0].ToString() --completion-bash @words $wordToComplete |
+        Where-Object { $_ -like "$wordToComplete*" } |
+        ForEach-Object { [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_) }
+}
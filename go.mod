@@ -12,9 +12,14 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/sso v1.12.2
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.14.2
 	github.com/aws/aws-sdk-go-v2/service/sts v1.18.3
+	github.com/aws/smithy-go v1.13.5
+	github.com/dvsekhvalnov/jose2go v1.5.0
 	github.com/google/go-cmp v0.5.9
 	github.com/mattn/go-isatty v0.0.17
+	github.com/mtibben/percent v0.2.1
 	github.com/skratchdot/open-golang v0.0.0-20200116055534-eef842397966
+	golang.org/x/crypto v0.6.0
+	golang.org/x/sys v0.5.0
 	golang.org/x/term v0.5.0
 	gopkg.in/ini.v1 v1.67.0
 )
@@ -28,11 +33,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.4.22 // indirect
 	github.com/aws/aws-sdk-go-v2/internal/ini v1.3.29 // indirect
 	github.com/aws/aws-sdk-go-v2/service/internal/presigned-url v1.9.22 // indirect
-	github.com/aws/smithy-go v1.13.5 // indirect
 	github.com/danieljoos/wincred v1.1.2 // indirect
-	github.com/dvsekhvalnov/jose2go v1.5.0 // indirect
 	github.com/godbus/dbus v0.0.0-20190726142602-4481cbc300e2 // indirect
 	github.com/gsterjov/go-libsecret v0.0.0-20161001094733-a6f4afe4910c // indirect
-	github.com/mtibben/percent v0.2.1 // indirect
-	golang.org/x/sys v0.5.0 // indirect
 )
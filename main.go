@@ -15,6 +15,7 @@ func main() {
 	app.Version(Version)
 
 	a := cli.ConfigureGlobals(app)
+	cli.ConfigureSetupCommand(app, a)
 	cli.ConfigureAddCommand(app, a)
 	cli.ConfigureRemoveCommand(app, a)
 	cli.ConfigureListCommand(app, a)
@@ -24,6 +25,22 @@ func main() {
 	cli.ConfigureClearCommand(app, a)
 	cli.ConfigureLoginCommand(app, a)
 	cli.ConfigureProxyCommand(app, a)
+	cli.ConfigureIsolatedExecCommand(app, a)
+	cli.ConfigureKeyringBridgeCommand(app, a)
+	cli.ConfigureTreeCommand(app, a)
+	cli.ConfigureWhoamiCommand(app, a)
+	cli.ConfigureSsmCommand(app, a)
+	cli.ConfigureSSHForwardCommand(app, a)
+	cli.ConfigureDoctorCommand(app, a)
+	cli.ConfigureBackendsCommand(app, a)
+	cli.ConfigureInfoCommand(app, a)
+	cli.ConfigureShellInitCommand(app, a)
+	cli.ConfigureCompletionCommand(app, a)
+	cli.ConfigureConfigureCliCommand(app, a)
+	cli.ConfigureComposeEnvCommand(app, a)
+	cli.ConfigureServeCommand(app, a)
+	cli.ConfigureSSOCommand(app, a)
 
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	cli.MustParse(app, cli.SeparateCommandArgs(app, os.Args[1:]))
+	cli.Flush()
 }
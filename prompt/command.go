@@ -0,0 +1,73 @@
+package prompt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// The environment variables describing the prompt to a prompt command
+const (
+	promptTypeEnv      = "AWS_VAULT_PROMPT_TYPE"
+	promptMessageEnv   = "AWS_VAULT_PROMPT_MESSAGE"
+	promptMfaSerialEnv = "AWS_VAULT_MFA_SERIAL"
+)
+
+// runPromptCommand runs a prompt command, set with prompt_command, and returns the first line it prints.
+// The kind of prompt and its message are in the environment, and the choices, if any, are written to
+// its stdin one per line, so that menus such as dmenu and rofi work as prompt commands
+func runPromptCommand(command, kind, message string, env []string, choices []string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd.exe", "/C", command)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), promptTypeEnv+"="+kind, promptMessageEnv+"="+message)
+	cmd.Env = append(cmd.Env, env...)
+	cmd.Stderr = os.Stderr
+	if len(choices) > 0 {
+		cmd.Stdin = strings.NewReader(strings.Join(choices, "\n") + "\n")
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("prompt_command: %w", err)
+	}
+
+	line, _ := bufio.NewReader(bytes.NewReader(out)).ReadString('\n')
+	return strings.TrimSpace(line), nil
+}
+
+// Command returns a Func that asks for MFA codes with the prompt command
+func Command(command string) Func {
+	return func(mfaSerial string) (string, error) {
+		message := strings.TrimSuffix(mfaPromptMessage(mfaSerial), ": ")
+		if Disabled {
+			return "", InteractionRequired(InteractionMFA, message)
+		}
+		return runPromptCommand(command, InteractionMFA, message, []string{promptMfaSerialEnv + "=" + mfaSerial}, nil)
+	}
+}
+
+// CommandConfirm asks a yes/no question with the prompt command, which is given the choices yes and no
+func CommandConfirm(command, message string) (bool, error) {
+	if Disabled {
+		return false, InteractionRequired(InteractionConfirm, message)
+	}
+	answer, err := runPromptCommand(command, InteractionConfirm, message, nil, []string{"yes", "no"})
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "yes" || answer == "y", nil
+}
+
+// CommandApprovalPrompt asks the user to approve issuing credentials for a profile with the prompt command
+func CommandApprovalPrompt(command, profileName string) (bool, error) {
+	return CommandConfirm(command, approvalPromptMessage(profileName))
+}
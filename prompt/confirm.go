@@ -0,0 +1,30 @@
+package prompt
+
+import "fmt"
+
+// ConfirmFunc asks the user a yes/no question, returning true if they said yes
+type ConfirmFunc func(message string) (bool, error)
+
+// ConfirmMethods are the prompt methods that can ask a yes/no question
+var ConfirmMethods = map[string]ConfirmFunc{}
+
+// Confirm asks a yes/no question with the prompt method, falling back to the terminal
+// for methods that can only ask for a code
+func Confirm(method, message string) (bool, error) {
+	if Disabled {
+		return false, InteractionRequired(InteractionConfirm, message)
+	}
+	if f, ok := ConfirmMethods[method]; ok {
+		return f(message)
+	}
+	return TerminalConfirm(message)
+}
+
+func approvalPromptMessage(profileName string) string {
+	return fmt.Sprintf("Issue credentials for profile %s?", profileName)
+}
+
+// ApprovalPrompt asks the user to approve issuing credentials for a profile
+func ApprovalPrompt(method, profileName string) (bool, error) {
+	return Confirm(method, approvalPromptMessage(profileName))
+}
@@ -1,6 +1,7 @@
 package prompt
 
 import (
+	"errors"
 	"os/exec"
 	"strings"
 )
@@ -16,8 +17,21 @@ func KDialogMfaPrompt(mfaSerial string) (string, error) {
 	return strings.TrimSpace(string(out)), nil
 }
 
+// KDialogConfirm asks a yes/no question. kdialog exits with status 1 when the answer is no
+func KDialogConfirm(message string) (bool, error) {
+	err := exec.Command("kdialog", "--yesno", message, "--title", "aws-vault").Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
 func init() {
 	if _, err := exec.LookPath("kdialog"); err == nil {
 		Methods["kdialog"] = KDialogMfaPrompt
+		ConfirmMethods["kdialog"] = KDialogConfirm
 	}
 }
@@ -0,0 +1,40 @@
+package prompt
+
+import (
+	"errors"
+)
+
+// Disabled makes every prompt fail with ErrInteractionRequired rather than wait for an answer, for
+// scripts that can't answer them. It's set with --no-prompt
+var Disabled = false
+
+// ErrInteractionRequired is returned by prompts, and anything else that needs the user, when they're disabled
+var ErrInteractionRequired = errors.New("interaction is required, but prompts are disabled by --no-prompt")
+
+// Kinds of interaction, so that callers can tell what was needed
+const (
+	InteractionMFA        = "mfa"
+	InteractionSSO        = "sso"
+	InteractionPassphrase = "passphrase"
+	InteractionConfirm    = "confirm"
+	InteractionInput      = "input"
+)
+
+// InteractionRequiredError is the error for doing something that needs the user while prompts are disabled
+type InteractionRequiredError struct {
+	Kind string
+	What string
+}
+
+func (e *InteractionRequiredError) Error() string {
+	return e.What + ": " + ErrInteractionRequired.Error()
+}
+
+func (e *InteractionRequiredError) Is(target error) bool {
+	return target == ErrInteractionRequired
+}
+
+// InteractionRequired is the error for doing something of the kind that needs the user while prompts are disabled
+func InteractionRequired(kind, what string) error {
+	return &InteractionRequiredError{Kind: kind, What: what}
+}
@@ -21,8 +21,24 @@ func OSAScriptMfaPrompt(mfaSerial string) (string, error) {
 	return strings.TrimSpace(string(out)), nil
 }
 
+func OSAScriptConfirm(message string) (bool, error) {
+	cmd := exec.Command("osascript", "-e", fmt.Sprintf(`
+		display dialog %q buttons {"Deny", "Approve"} default button "Deny" with icon caution
+        button returned of the result
+        return result`,
+		message))
+
+	out, err := cmd.Output()
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(string(out)) == "Approve", nil
+}
+
 func init() {
 	if _, err := exec.LookPath("osascript"); err == nil {
 		Methods["osascript"] = OSAScriptMfaPrompt
+		ConfirmMethods["osascript"] = OSAScriptConfirm
 	}
 }
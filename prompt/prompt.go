@@ -23,6 +23,11 @@ func Method(s string) Func {
 	if !ok {
 		panic(fmt.Sprintf("Prompt method %q doesn't exist", s))
 	}
+	if Disabled {
+		return func(mfaSerial string) (string, error) {
+			return "", InteractionRequired(InteractionMFA, "Entering an MFA code for "+mfaSerial)
+		}
+	}
 	return m
 }
 
@@ -10,6 +10,9 @@ import (
 )
 
 func TerminalPrompt(message string) (string, error) {
+	if Disabled {
+		return "", InteractionRequired(InteractionInput, strings.TrimSpace(message))
+	}
 	fmt.Fprint(os.Stderr, message)
 
 	reader := bufio.NewReader(os.Stdin)
@@ -22,6 +25,9 @@ func TerminalPrompt(message string) (string, error) {
 }
 
 func TerminalSecretPrompt(message string) (string, error) {
+	if Disabled {
+		return "", InteractionRequired(InteractionInput, strings.TrimSpace(message))
+	}
 	fmt.Fprint(os.Stderr, message)
 
 	text, err := term.ReadPassword(int(os.Stdin.Fd()))
@@ -38,6 +44,26 @@ func TerminalMfaPrompt(mfaSerial string) (string, error) {
 	return TerminalPrompt(mfaPromptMessage(mfaSerial))
 }
 
+// TerminalConfirm asks a yes/no question on the controlling terminal, so that it works even
+// when stdin and stdout are used by another process, as with credential_process
+func TerminalConfirm(message string) (bool, error) {
+	in, out := os.Stdin, os.Stderr
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		defer tty.Close()
+		in, out = tty, tty
+	}
+
+	fmt.Fprintf(out, "%s [y/N]: ", message)
+	text, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(text))
+	return answer == "y" || answer == "yes", nil
+}
+
 func init() {
 	Methods["terminal"] = TerminalMfaPrompt
+	ConfirmMethods["terminal"] = TerminalConfirm
 }
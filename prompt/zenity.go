@@ -1,6 +1,7 @@
 package prompt
 
 import (
+	"errors"
 	"os/exec"
 	"strings"
 )
@@ -16,8 +17,21 @@ func ZenityMfaPrompt(mfaSerial string) (string, error) {
 	return strings.TrimSpace(string(out)), nil
 }
 
+// ZenityConfirm asks a yes/no question. zenity exits with status 1 when the answer is no
+func ZenityConfirm(message string) (bool, error) {
+	err := exec.Command("zenity", "--question", "--title", "aws-vault", "--text", message).Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
 func init() {
 	if _, err := exec.LookPath("zenity"); err == nil {
 		Methods["zenity"] = ZenityMfaPrompt
+		ConfirmMethods["zenity"] = ZenityConfirm
 	}
 }
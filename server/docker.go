@@ -0,0 +1,50 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// dockerInspectFormat prints a line for each container with its name, docker-compose service and IP addresses
+const dockerInspectFormat = `{{.Name}} {{index .Config.Labels "com.docker.compose.service"}}{{range .NetworkSettings.Networks}} {{.IPAddress}}{{end}}`
+
+// listDockerContainers returns the names of the running containers, and their docker-compose services, by IP address
+func listDockerContainers() (map[string][]string, error) {
+	ids, err := exec.Command("docker", "ps", "-q").Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list docker containers: %w", err)
+	}
+	args := append([]string{"inspect", "--format", dockerInspectFormat}, strings.Fields(string(ids))...)
+	if len(args) == 3 {
+		return map[string][]string{}, nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to inspect docker containers: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	byIP := map[string][]string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		// the service is empty for containers not started by docker-compose, leaving two spaces
+		fields := strings.Split(strings.TrimSpace(line), " ")
+		if len(fields) < 2 {
+			continue
+		}
+		names := []string{strings.TrimPrefix(fields[0], "/")}
+		if fields[1] != "" {
+			names = append(names, fields[1])
+		}
+		for _, ip := range fields[2:] {
+			if ip != "" {
+				byIP[ip] = names
+			}
+		}
+	}
+	return byIP, nil
+}
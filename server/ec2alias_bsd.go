@@ -1,5 +1,5 @@
-//go:build darwin || freebsd || openbsd
-// +build darwin freebsd openbsd
+//go:build darwin || freebsd || openbsd || netbsd || dragonfly
+// +build darwin freebsd openbsd netbsd dragonfly
 
 package server
 
@@ -12,3 +12,11 @@ func installEc2EndpointNetworkAlias() ([]byte, error) {
 func removeEc2EndpointNetworkAlias() ([]byte, error) {
 	return exec.Command("ifconfig", "lo0", "-alias", "169.254.169.254").CombinedOutput()
 }
+
+func installEc2EndpointIPv6NetworkAlias() ([]byte, error) {
+	return exec.Command("ifconfig", "lo0", "inet6", "alias", "fd00:ec2::254", "prefixlen", "128").CombinedOutput()
+}
+
+func removeEc2EndpointIPv6NetworkAlias() ([]byte, error) {
+	return exec.Command("ifconfig", "lo0", "inet6", "-alias", "fd00:ec2::254").CombinedOutput()
+}
@@ -12,3 +12,11 @@ func installEc2EndpointNetworkAlias() ([]byte, error) {
 func removeEc2EndpointNetworkAlias() ([]byte, error) {
 	return exec.Command("ip", "addr", "del", "169.254.169.254/24", "dev", "lo", "label", "lo:0").CombinedOutput()
 }
+
+func installEc2EndpointIPv6NetworkAlias() ([]byte, error) {
+	return exec.Command("ip", "-6", "addr", "add", "fd00:ec2::254/128", "dev", "lo", "nodad").CombinedOutput()
+}
+
+func removeEc2EndpointIPv6NetworkAlias() ([]byte, error) {
+	return exec.Command("ip", "-6", "addr", "del", "fd00:ec2::254/128", "dev", "lo").CombinedOutput()
+}
@@ -0,0 +1,22 @@
+//go:build solaris
+// +build solaris
+
+package server
+
+import "os/exec"
+
+func installEc2EndpointNetworkAlias() ([]byte, error) {
+	return exec.Command("ifconfig", "lo0", "addif", "169.254.169.254/32", "up").CombinedOutput()
+}
+
+func removeEc2EndpointNetworkAlias() ([]byte, error) {
+	return exec.Command("ifconfig", "lo0", "removeif", "169.254.169.254").CombinedOutput()
+}
+
+func installEc2EndpointIPv6NetworkAlias() ([]byte, error) {
+	return exec.Command("ifconfig", "lo0", "inet6", "addif", "fd00:ec2::254/128", "up").CombinedOutput()
+}
+
+func removeEc2EndpointIPv6NetworkAlias() ([]byte, error) {
+	return exec.Command("ifconfig", "lo0", "inet6", "removeif", "fd00:ec2::254").CombinedOutput()
+}
@@ -35,7 +35,7 @@ func msgFound(localised []string, toTest string) bool {
 func runAndWrapAdminErrors(name string, arg ...string) ([]byte, error) {
 	out, err := exec.Command(name, arg...).CombinedOutput()
 	if msgFound(runAsAdministratorLocalised, string(out)) {
-		err = fmt.Errorf("Creation of network alias for server mode requires elevated permissions, run as administrator", err)
+		err = fmt.Errorf("Creation of network alias for server mode requires elevated permissions, run as administrator: %w", err)
 	}
 
 	return out, err
@@ -53,3 +53,16 @@ func installEc2EndpointNetworkAlias() ([]byte, error) {
 func removeEc2EndpointNetworkAlias() ([]byte, error) {
 	return runAndWrapAdminErrors("netsh", "interface", "ipv4", "delete", "address", "Loopback Pseudo-Interface 1", "169.254.169.254", "255.255.0.0")
 }
+
+func installEc2EndpointIPv6NetworkAlias() ([]byte, error) {
+	out, err := runAndWrapAdminErrors("netsh", "interface", "ipv6", "add", "address", "Loopback Pseudo-Interface 1", "fd00:ec2::254")
+	if msgFound(alreadyRegisteredLocalised, string(out)) {
+		return []byte{}, nil
+	}
+
+	return out, err
+}
+
+func removeEc2EndpointIPv6NetworkAlias() ([]byte, error) {
+	return runAndWrapAdminErrors("netsh", "interface", "ipv6", "delete", "address", "Loopback Pseudo-Interface 1", "fd00:ec2::254")
+}
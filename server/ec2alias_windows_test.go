@@ -0,0 +1,22 @@
+//go:build windows
+// +build windows
+
+package server
+
+import "testing"
+
+func TestMsgFound(t *testing.T) {
+	cases := []struct {
+		output string
+		found  bool
+	}{
+		{"The object already exists.", true},
+		{"Das Objekt ist bereits vorhanden.", true},
+		{"Ok.", false},
+	}
+	for _, c := range cases {
+		if found := msgFound(alreadyRegisteredLocalised, c.output); found != c.found {
+			t.Errorf("Expected %q to be found %v, got %v", c.output, c.found, found)
+		}
+	}
+}
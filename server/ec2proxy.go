@@ -15,11 +15,20 @@ import (
 const (
 	ec2MetadataEndpointIP   = "169.254.169.254"
 	ec2MetadataEndpointAddr = "169.254.169.254:80"
+
+	ec2MetadataEndpointIPv6Host = "[fd00:ec2::254]"
+	ec2MetadataEndpointIPv6Addr = "[fd00:ec2::254]:80"
 )
 
-// StartProxy starts a http proxy server that listens on the standard EC2 Instance Metadata endpoint http://169.254.169.254:80/
-// and forwards requests through to the running `aws-vault exec` command
-func StartProxy() error {
+// Ec2MetadataEndpointIPv6URL is the IPv6 EC2 Instance Metadata endpoint, used by SDKs in IPv6 endpoint mode
+const Ec2MetadataEndpointIPv6URL = "http://" + ec2MetadataEndpointIPv6Host
+
+// ipv6AliasInstalled is whether the proxy added the IPv6 endpoint to the loopback interface, so it's removed on shutdown
+var ipv6AliasInstalled bool
+
+// StartProxy starts a http proxy server that listens on the standard EC2 Instance Metadata endpoint http://169.254.169.254:80/,
+// and with ipv6 also http://[fd00:ec2::254]:80/, and forwards requests through to the running `aws-vault exec` command
+func StartProxy(ipv6 bool) error {
 	var localServerURL, err = url.Parse(fmt.Sprintf("http://%s/", ec2CredentialsServerAddr))
 	if err != nil {
 		return err
@@ -34,6 +43,17 @@ func StartProxy() error {
 		return err
 	}
 
+	var l6 net.Listener
+	if ipv6 {
+		if output, err := installEc2EndpointIPv6NetworkAlias(); err != nil {
+			return fmt.Errorf("%s: %s", strings.TrimSpace(string(output)), err.Error())
+		}
+		ipv6AliasInstalled = true
+		if l6, err = net.Listen("tcp", ec2MetadataEndpointIPv6Addr); err != nil {
+			return err
+		}
+	}
+
 	handler := http.NewServeMux()
 	handler.HandleFunc("/stop", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -41,16 +61,28 @@ func StartProxy() error {
 	})
 	handler.Handle("/", httputil.NewSingleHostReverseProxy(localServerURL))
 
+	if l6 != nil {
+		log.Printf("EC2 Instance Metadata endpoint proxy server running on %s", l6.Addr())
+		go func() {
+			log.Fatalln(http.Serve(l6, handler))
+		}()
+	}
 	log.Printf("EC2 Instance Metadata endpoint proxy server running on %s", l.Addr())
 	return http.Serve(l, handler)
 }
 
-func isProxyRunning() bool {
-	_, err := net.DialTimeout("tcp", ec2MetadataEndpointAddr, time.Millisecond*10)
+// isProxyRunning checks whether the proxy is listening on the endpoint address
+func isProxyRunning(addr string) bool {
+	_, err := net.DialTimeout("tcp", addr, time.Millisecond*10)
 	return err == nil
 }
 
 func Shutdown() {
+	if ipv6AliasInstalled {
+		if _, err := removeEc2EndpointIPv6NetworkAlias(); err != nil {
+			log.Println(err)
+		}
+	}
 	_, err := removeEc2EndpointNetworkAlias()
 	if err != nil {
 		log.Fatalln(err)
@@ -63,6 +95,14 @@ func StopProxy() {
 	_, _ = http.Get(fmt.Sprintf("http://%s/stop", ec2MetadataEndpointAddr)) //nolint
 }
 
+// proxyArgs are the arguments of the `aws-vault proxy` process
+func proxyArgs(ipv6 bool) []string {
+	if ipv6 {
+		return []string{"proxy", "--ipv6"}
+	}
+	return []string{"proxy"}
+}
+
 func awsVaultExecutable() string {
 	awsVaultPath, err := os.Executable()
 	if err != nil {
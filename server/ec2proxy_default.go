@@ -1,5 +1,5 @@
-//go:build !darwin && !freebsd && !openbsd && !linux
-// +build !darwin,!freebsd,!openbsd,!linux
+//go:build !darwin && !freebsd && !openbsd && !netbsd && !dragonfly && !linux
+// +build !darwin,!freebsd,!openbsd,!netbsd,!dragonfly,!linux
 
 package server
 
@@ -11,10 +11,10 @@ import (
 	"time"
 )
 
-// StartEc2EndpointProxyServerProcess starts a `aws-vault proxy` process
-func StartEc2EndpointProxyServerProcess() error {
+// StartEc2EndpointProxyServerProcess starts a `aws-vault proxy` process, also listening on the IPv6 endpoint with ipv6
+func StartEc2EndpointProxyServerProcess(ipv6 bool) error {
 	log.Println("Starting `aws-vault proxy`")
-	cmd := exec.Command(awsVaultExecutable(), "proxy")
+	cmd := exec.Command(awsVaultExecutable(), proxyArgs(ipv6)...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -22,7 +22,7 @@ func StartEc2EndpointProxyServerProcess() error {
 		return err
 	}
 	time.Sleep(time.Second * 1)
-	if !isProxyRunning() {
+	if !isProxyRunning(ec2MetadataEndpointAddr) || (ipv6 && !isProxyRunning(ec2MetadataEndpointIPv6Addr)) {
 		return errors.New("The EC2 Instance Metadata endpoint proxy server isn't running. Run `aws-vault proxy` as Administrator or root in the background and then try this command again")
 	}
 	return nil
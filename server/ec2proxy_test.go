@@ -0,0 +1,21 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProxyArgs(t *testing.T) {
+	cases := []struct {
+		ipv6     bool
+		expected []string
+	}{
+		{false, []string{"proxy"}},
+		{true, []string{"proxy", "--ipv6"}},
+	}
+	for _, c := range cases {
+		if args := proxyArgs(c.ipv6); !reflect.DeepEqual(args, c.expected) {
+			t.Errorf("Expected the args with ipv6 %v to be %v, got %v", c.ipv6, c.expected, args)
+		}
+	}
+}
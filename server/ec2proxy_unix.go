@@ -1,5 +1,5 @@
-//go:build darwin || freebsd || openbsd || linux
-// +build darwin freebsd openbsd linux
+//go:build darwin || freebsd || openbsd || netbsd || dragonfly || linux
+// +build darwin freebsd openbsd netbsd dragonfly linux
 
 package server
 
@@ -9,10 +9,10 @@ import (
 	"os/exec"
 )
 
-// StartEc2EndpointProxyServerProcess starts a `aws-vault proxy` process
-func StartEc2EndpointProxyServerProcess() error {
+// StartEc2EndpointProxyServerProcess starts a `aws-vault proxy` process, also listening on the IPv6 endpoint with ipv6
+func StartEc2EndpointProxyServerProcess(ipv6 bool) error {
 	log.Println("Starting `aws-vault proxy` as root in the background")
-	cmd := exec.Command("sudo", "-b", awsVaultExecutable(), "proxy")
+	cmd := exec.Command("sudo", append([]string{"-b", awsVaultExecutable()}, proxyArgs(ipv6)...)...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -3,10 +3,12 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/99designs/aws-vault/v7/iso8601"
@@ -15,12 +17,41 @@ import (
 
 const ec2CredentialsServerAddr = "127.0.0.1:9099"
 
-// StartEc2CredentialsServer starts a EC2 Instance Metadata server and endpoint proxy
-func StartEc2CredentialsServer(ctx context.Context, credsProvider aws.CredentialsProvider, region string) error {
-	if !isProxyRunning() {
-		if err := StartEc2EndpointProxyServerProcess(); err != nil {
+// DefaultEc2AllowedPaths are the metadata paths the EC2 server responds to by default, which are only those needed for credentials
+var DefaultEc2AllowedPaths = []string{"/latest/meta-data/iam/"}
+
+// ec2BlockedPaths are never served, even when covered by an allowed path
+var ec2BlockedPaths = []string{"/latest/user-data"}
+
+// isAllowedPath checks the path is under one of the allowed path prefixes, and isn't blocked
+func isAllowedPath(path string, allowedPaths []string) bool {
+	for _, p := range ec2BlockedPaths {
+		if strings.HasPrefix(path, p) {
+			return false
+		}
+	}
+	for _, p := range allowedPaths {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// StartEc2CredentialsServer starts a EC2 Instance Metadata server and endpoint proxy, which also listens
+// on the IPv6 endpoint with ipv6. The server only responds to requests for the allowed paths, or
+// DefaultEc2AllowedPaths if none are given. It stops when ctx is done
+func StartEc2CredentialsServer(ctx context.Context, credsProvider aws.CredentialsProvider, region string, allowedPaths []string, ipv6 bool) error {
+	if len(allowedPaths) == 0 {
+		allowedPaths = DefaultEc2AllowedPaths
+	}
+
+	if !isProxyRunning(ec2MetadataEndpointAddr) {
+		if err := StartEc2EndpointProxyServerProcess(ipv6); err != nil {
 			return err
 		}
+	} else if ipv6 && !isProxyRunning(ec2MetadataEndpointIPv6Addr) {
+		return errors.New("The EC2 Instance Metadata endpoint proxy is running without IPv6. Stop it with `aws-vault proxy --stop` and try again")
 	}
 
 	credsCache := aws.NewCredentialsCache(credsProvider)
@@ -29,13 +60,83 @@ func StartEc2CredentialsServer(ctx context.Context, credsProvider aws.Credential
 	// SDKs seem to very aggressively timeout
 	_, _ = credsCache.Retrieve(ctx)
 
-	go startEc2CredentialsServer(credsCache, region)
+	go startEc2CredentialsServer(ctx, credsCache, region, allowedPaths)
 
 	return nil
 }
 
-func startEc2CredentialsServer(credsProvider aws.CredentialsProvider, region string) {
+// Ec2Server is an EC2 Instance Metadata server on a local port, which SDKs are pointed at with
+// AWS_EC2_METADATA_SERVICE_ENDPOINT, so it needs neither the 169.254.169.254 alias nor root
+type Ec2Server struct {
+	listener net.Listener
+	server   http.Server
+}
+
+// NewEc2Server creates an EC2 Instance Metadata server listening on addr, a loopback address such as
+// 127.0.0.1:0. The server only responds to requests for the allowed paths, or DefaultEc2AllowedPaths
+// if none are given. Requests are made in ctx, so cancelling it cancels those in flight
+func NewEc2Server(ctx context.Context, credsProvider aws.CredentialsProvider, region string, allowedPaths []string, addr string) (*Ec2Server, error) {
+	if len(allowedPaths) == 0 {
+		allowedPaths = DefaultEc2AllowedPaths
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	credsCache := aws.NewCredentialsCache(credsProvider)
+
+	// pre-fetch credentials so that we can respond quickly to the first request
+	_, _ = credsCache.Retrieve(ctx)
+
+	e := &Ec2Server{listener: listener}
+	listenAddr := listener.Addr().String()
+	isHost := func(host string) bool {
+		return host == listenAddr
+	}
+	e.server.Handler = withLogging("ec2", withSecurityChecks(withProcessTreeCheck(processTreeFilterFromContext(ctx), withRequestGuard(requestGuardFromContext(ctx), ec2Router(credsCache, region))), allowedPaths, isHost))
+	e.server.BaseContext = func(net.Listener) context.Context { return ctx }
+	e.server.ConnContext = withConnPeer
+
+	return e, nil
+}
+
+// BaseURL is the endpoint of the server, for AWS_EC2_METADATA_SERVICE_ENDPOINT
+func (e *Ec2Server) BaseURL() string {
+	return fmt.Sprintf("http://%s", e.listener.Addr().String())
+}
+
+func (e *Ec2Server) Serve() error {
+	return e.server.Serve(e.listener)
+}
+
+// Shutdown stops the server gracefully, waiting for requests in flight until ctx is done
+func (e *Ec2Server) Shutdown(ctx context.Context) error {
+	return e.server.Shutdown(ctx)
+}
+
+func startEc2CredentialsServer(ctx context.Context, credsProvider aws.CredentialsProvider, region string, allowedPaths []string) {
 	log.Printf("Starting EC2 Instance Metadata server on %s", ec2CredentialsServerAddr)
+	srv := &http.Server{
+		Addr:        ec2CredentialsServerAddr,
+		Handler:     withLogging("ec2", withSecurityChecks(withProcessTreeCheck(processTreeFilterFromContext(ctx), withRequestGuard(requestGuardFromContext(ctx), ec2Router(credsProvider, region))), allowedPaths, isEc2MetadataEndpointHost)),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+		ConnContext: withConnPeer,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed { // ErrServerClosed is a graceful close
+		log.Fatalln(err)
+	}
+}
+
+// ec2Router serves the metadata SDKs need to get credentials
+func ec2Router(credsProvider aws.CredentialsProvider, region string) *http.ServeMux {
 	router := http.NewServeMux()
 
 	router.HandleFunc("/latest/meta-data/iam/security-credentials/", func(w http.ResponseWriter, r *http.Request) {
@@ -59,11 +160,12 @@ func startEc2CredentialsServer(credsProvider aws.CredentialsProvider, region str
 
 	router.HandleFunc("/latest/meta-data/iam/security-credentials/local-credentials", credsHandler(credsProvider))
 
-	log.Fatalln(http.ListenAndServe(ec2CredentialsServerAddr, withLogging(withSecurityChecks(router))))
+	return router
 }
 
-// withSecurityChecks is middleware to protect the server from attack vectors
-func withSecurityChecks(next *http.ServeMux) http.HandlerFunc {
+// withSecurityChecks is middleware to protect the server from attack vectors. isHost checks the Host
+// of requests is the address the server is reached at
+func withSecurityChecks(next http.Handler, allowedPaths []string, isHost func(string) bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Check the remote ip is from the loopback, otherwise clients on the same network segment could
 		// potentially route traffic via 169.254.169.254:80
@@ -78,18 +180,34 @@ func withSecurityChecks(next *http.ServeMux) http.HandlerFunc {
 			return
 		}
 
-		// Check that the request is to 169.254.169.254
+		// Check that the request is to 169.254.169.254, or the address of the server
 		// Without this it's possible for an attacker to mount a DNS rebinding attack
 		// See https://github.com/99designs/aws-vault/issues/578
-		if r.Host != ec2MetadataEndpointIP && r.Host != ec2MetadataEndpointAddr {
+		if !isHost(r.Host) {
 			http.Error(w, fmt.Sprintf("Access denied for host '%s'", r.Host), http.StatusUnauthorized)
 			return
 		}
 
+		// Only serve the metadata that's needed, so other local processes can't use the server for more
+		if !isAllowedPath(r.URL.Path, allowedPaths) {
+			warnf(r.Context(), "Blocked request for metadata path %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	}
 }
 
+// isEc2MetadataEndpointHost checks the Host of a request is one of the EC2 Instance Metadata endpoints
+func isEc2MetadataEndpointHost(host string) bool {
+	switch host {
+	case ec2MetadataEndpointIP, ec2MetadataEndpointAddr, ec2MetadataEndpointIPv6Host, ec2MetadataEndpointIPv6Addr:
+		return true
+	}
+	return false
+}
+
 func credsHandler(credsProvider aws.CredentialsProvider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		creds, err := credsProvider.Retrieve(r.Context())
@@ -116,5 +234,6 @@ func credsHandler(credsProvider aws.CredentialsProvider) http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		recordServedCredentials(w, creds)
 	}
 }
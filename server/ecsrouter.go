@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Ways an EcsRouter chooses the route of a request
+const (
+	// RouteByToken routes requests by their Authorization header, as each route has its own token
+	RouteByToken = "token"
+
+	// RouteByContainer routes requests by the Docker container they come from, matching the name of the
+	// route to the docker-compose service or name of the container. All routes share a token
+	RouteByContainer = "container"
+)
+
+// EcsRoute serves the credentials of a profile to the clients routed to it
+type EcsRoute struct {
+	// Name is the name of the route, such as a docker-compose service
+	Name string
+
+	// Token is the Authorization token of the route, set by NewEcsRouter
+	Token string
+
+	CredsProvider aws.CredentialsProvider
+	Config        *vault.Config
+}
+
+// EcsRouter is an ECS credential server that serves the credentials of several profiles on one
+// endpoint, choosing the profile for each request by its token or the container it comes from
+type EcsRouter struct {
+	listener net.Listener
+	server   http.Server
+	routeBy  string
+	token    string
+	routes   []EcsRoute
+
+	// ContainerNames returns the names a container is known by from its IP address, for RouteByContainer
+	ContainerNames func(ip string) ([]string, error)
+}
+
+// NewEcsRouter creates a router listening on addr. With RouteByToken, each route is given a token of its
+// own, otherwise they share one. Credentials are retrieved for every route unless lazyLoadBaseCreds is set.
+// Requests are made in ctx, so cancelling it cancels those in flight
+func NewEcsRouter(ctx context.Context, addr string, routeBy string, routes []EcsRoute, lazyLoadBaseCreds bool) (*EcsRouter, error) {
+	if routeBy != RouteByToken && routeBy != RouteByContainer {
+		return nil, fmt.Errorf("Unknown way to route requests %q", routeBy)
+	}
+
+	e := &EcsRouter{
+		routeBy:        routeBy,
+		token:          generateRandomString(),
+		ContainerNames: dockerContainerNames(),
+	}
+	for _, route := range routes {
+		credsCache := aws.NewCredentialsCache(route.CredsProvider, withExpiryWindow(route.Config))
+		if !lazyLoadBaseCreds {
+			if _, err := credsCache.Retrieve(ctx); err != nil {
+				return nil, fmt.Errorf("Retrieving creds for %s: %w", route.Name, err)
+			}
+		}
+		route.CredsProvider = credsCache
+		route.Token = e.token
+		if routeBy == RouteByToken {
+			route.Token = generateRandomString()
+		}
+		e.routes = append(e.routes, route)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	e.listener = listener
+	e.server.Handler = withLogging("proxy", withRequestGuard(requestGuardFromContext(ctx), http.HandlerFunc(e.serveCredentials)))
+	e.server.BaseContext = func(net.Listener) context.Context { return ctx }
+	e.server.ConnContext = withConnPeer
+
+	return e, nil
+}
+
+// Routes are the routes of the router, with their tokens
+func (e *EcsRouter) Routes() []EcsRoute {
+	return e.routes
+}
+
+// Port is the port the router listens on
+func (e *EcsRouter) Port() int {
+	return e.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (e *EcsRouter) Serve() error {
+	return e.server.Serve(e.listener)
+}
+
+// Shutdown stops the router gracefully, waiting for requests in flight until ctx is done
+func (e *EcsRouter) Shutdown(ctx context.Context) error {
+	return e.server.Shutdown(ctx)
+}
+
+func (e *EcsRouter) serveCredentials(w http.ResponseWriter, r *http.Request) {
+	route, code, msg := e.route(r)
+	if route == nil {
+		writeErrorMessage(w, msg, code)
+		return
+	}
+
+	creds, err := route.CredsProvider.Retrieve(r.Context())
+	if err != nil {
+		writeErrorMessage(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeCredsToResponse(creds, w)
+}
+
+// route returns the route for the request, or the status and message to refuse it with
+func (e *EcsRouter) route(r *http.Request) (*EcsRoute, int, string) {
+	token := r.Header.Get("Authorization")
+
+	if e.routeBy == RouteByToken {
+		for i := range e.routes {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(e.routes[i].Token)) == 1 {
+				return &e.routes[i], 0, ""
+			}
+		}
+		return nil, http.StatusForbidden, "invalid Authorization token"
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(e.token)) != 1 {
+		return nil, http.StatusForbidden, "invalid Authorization token"
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	names, err := e.ContainerNames(ip)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	for i := range e.routes {
+		for _, name := range names {
+			if e.routes[i].Name == name {
+				return &e.routes[i], 0, ""
+			}
+		}
+	}
+	return nil, http.StatusForbidden, fmt.Sprintf("no route for the container at %s", ip)
+}
+
+// dockerContainerRefreshInterval limits how often containers are listed when a request comes from an
+// unknown address, such as a container started after the last listing
+const dockerContainerRefreshInterval = 2 * time.Second
+
+// dockerContainerNames returns a lookup of the names of running containers by their IP addresses. The
+// containers are listed again when an address isn't known
+func dockerContainerNames() func(ip string) ([]string, error) {
+	var mu sync.Mutex
+	var byIP map[string][]string
+	var listed time.Time
+
+	return func(ip string) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if names, ok := byIP[ip]; ok {
+			return names, nil
+		}
+		if time.Since(listed) < dockerContainerRefreshInterval {
+			return nil, nil
+		}
+
+		var err error
+		byIP, err = listDockerContainers()
+		listed = time.Now()
+		if err != nil {
+			return nil, err
+		}
+		return byIP[ip], nil
+	}
+}
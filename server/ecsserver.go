@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -26,9 +27,9 @@ func writeErrorMessage(w http.ResponseWriter, msg string, statusCode int) {
 	}
 }
 
-func withAuthorizationCheck(authToken string, next http.HandlerFunc) http.HandlerFunc {
+func withAuthorizationCheck(isAuthorized func(string) bool, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("Authorization") != authToken {
+		if !isAuthorized(r.Header.Get("Authorization")) {
 			writeErrorMessage(w, "invalid Authorization token", http.StatusForbidden)
 			return
 		}
@@ -47,6 +48,7 @@ func writeCredsToResponse(creds aws.Credentials, w http.ResponseWriter) {
 		writeErrorMessage(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	recordServedCredentials(w, creds)
 }
 
 func generateRandomString() string {
@@ -59,15 +61,35 @@ func generateRandomString() string {
 
 type EcsServer struct {
 	listener          net.Listener
+	authTokenMu       sync.RWMutex
 	authToken         string
+	previousAuthToken string
 	server            http.Server
 	cache             sync.Map
 	baseCredsProvider aws.CredentialsProvider
 	config            *vault.Config
 }
 
+// withExpiryWindow renews credentials served to clients within the same window as cached sessions,
+// so clients aren't handed credentials that are about to expire. The window is widened when the local
+// clock is behind AWS, which decides when credentials expire
+func withExpiryWindow(config *vault.Config) func(*aws.CredentialsCacheOptions) {
+	return func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = config.ExpiryWindow()
+		if skew := vault.ClockSkew(); skew > 0 {
+			o.ExpiryWindow += skew
+		}
+	}
+}
+
 func NewEcsServer(ctx context.Context, baseCredsProvider aws.CredentialsProvider, config *vault.Config, authToken string, port int, lazyLoadBaseCreds bool) (*EcsServer, error) {
-	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	return NewEcsServerOnAddr(ctx, baseCredsProvider, config, authToken, fmt.Sprintf("127.0.0.1:%d", port), lazyLoadBaseCreds)
+}
+
+// NewEcsServerOnAddr creates an ECS server listening on addr, such as an address containers can reach,
+// or a vsock address for VMs. Requests are made in ctx, so cancelling it cancels those in flight
+func NewEcsServerOnAddr(ctx context.Context, baseCredsProvider aws.CredentialsProvider, config *vault.Config, authToken string, addr string, lazyLoadBaseCreds bool) (*EcsServer, error) {
+	listener, err := Listen(addr)
 	if err != nil {
 		return nil, err
 	}
@@ -75,7 +97,7 @@ func NewEcsServer(ctx context.Context, baseCredsProvider aws.CredentialsProvider
 		authToken = generateRandomString()
 	}
 
-	credsCache := aws.NewCredentialsCache(baseCredsProvider)
+	credsCache := aws.NewCredentialsCache(baseCredsProvider, withExpiryWindow(config))
 	if !lazyLoadBaseCreds {
 		_, err := credsCache.Retrieve(ctx)
 		if err != nil {
@@ -93,7 +115,9 @@ func NewEcsServer(ctx context.Context, baseCredsProvider aws.CredentialsProvider
 	router := http.NewServeMux()
 	router.HandleFunc("/", e.DefaultRoute)
 	router.HandleFunc("/role-arn/", e.AssumeRoleArnRoute)
-	e.server.Handler = withLogging(withAuthorizationCheck(e.authToken, router.ServeHTTP))
+	e.server.Handler = withLogging("ecs", withAuthorizationCheck(e.isAuthorized, withProcessTreeCheck(processTreeFilterFromContext(ctx), withRequestGuard(requestGuardFromContext(ctx), router)).ServeHTTP))
+	e.server.BaseContext = func(net.Listener) context.Context { return ctx }
+	e.server.ConnContext = withConnPeer
 
 	return e, nil
 }
@@ -101,7 +125,34 @@ func NewEcsServer(ctx context.Context, baseCredsProvider aws.CredentialsProvider
 func (e *EcsServer) BaseURL() string {
 	return fmt.Sprintf("http://%s", e.listener.Addr().String())
 }
+
+// Port is the TCP or vsock port the server listens on
+func (e *EcsServer) Port() int {
+	return listenerPort(e.listener)
+}
+
 func (e *EcsServer) AuthToken() string {
+	e.authTokenMu.RLock()
+	defer e.authTokenMu.RUnlock()
+	return e.authToken
+}
+
+func (e *EcsServer) isAuthorized(token string) bool {
+	e.authTokenMu.RLock()
+	defer e.authTokenMu.RUnlock()
+	if subtle.ConstantTimeCompare([]byte(token), []byte(e.authToken)) == 1 {
+		return true
+	}
+	return e.previousAuthToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(e.previousAuthToken)) == 1
+}
+
+// RotateAuthToken replaces the auth token with a new one, which is returned. The previous token
+// stays valid until the next rotation, so clients that read it just before the rotation still work
+func (e *EcsServer) RotateAuthToken() string {
+	e.authTokenMu.Lock()
+	defer e.authTokenMu.Unlock()
+	e.previousAuthToken = e.authToken
+	e.authToken = generateRandomString()
 	return e.authToken
 }
 
@@ -109,6 +160,17 @@ func (e *EcsServer) Serve() error {
 	return e.server.Serve(e.listener)
 }
 
+// Shutdown stops the server gracefully, waiting for requests in flight until ctx is done
+func (e *EcsServer) Shutdown(ctx context.Context) error {
+	return e.server.Shutdown(ctx)
+}
+
+// ServeTLS serves HTTPS with the certificate and key in the PEM files, for clients that aren't on the
+// loopback interface, which the AWS SDKs only allow to use HTTP
+func (e *EcsServer) ServeTLS(certFile, keyFile string) error {
+	return e.server.ServeTLS(e.listener, certFile, keyFile)
+}
+
 func (e *EcsServer) DefaultRoute(w http.ResponseWriter, r *http.Request) {
 	creds, err := e.baseCredsProvider.Retrieve(r.Context())
 	if err != nil {
@@ -126,12 +188,14 @@ func (e *EcsServer) getRoleProvider(roleArn string) aws.CredentialsProvider {
 		roleProviderCache = v.(*aws.CredentialsCache)
 	} else {
 		cfg := vault.NewAwsConfigWithCredsProvider(e.baseCredsProvider, e.config.Region, e.config.STSRegionalEndpoints)
+		vault.AddProfileProxy(&cfg, e.config)
+		vault.AddCredentialsIssuedHooks(&cfg, e.config)
 		roleProvider := &vault.AssumeRoleProvider{
 			StsClient: sts.NewFromConfig(cfg),
 			RoleARN:   roleArn,
 			Duration:  e.config.AssumeRoleDuration,
 		}
-		roleProviderCache = aws.NewCredentialsCache(roleProvider)
+		roleProviderCache = aws.NewCredentialsCache(roleProvider, withExpiryWindow(e.config))
 		e.cache.Store(roleArn, roleProviderCache)
 	}
 	return roleProviderCache
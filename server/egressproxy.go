@@ -0,0 +1,113 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultEgressAllowedHosts are the host name suffixes the egress proxy connects to, which cover the AWS endpoints
+var DefaultEgressAllowedHosts = []string{".amazonaws.com", ".amazonaws.com.cn", ".api.aws", ".aws.amazon.com"}
+
+// isAllowedHost checks the host is one of the allowed suffixes, or a subdomain of one
+func isAllowedHost(host string, allowedHosts []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, suffix := range allowedHosts {
+		// only whole labels match, so that "amazonaws.com" doesn't allow "evilamazonaws.com"
+		domain := strings.ToLower(strings.TrimPrefix(suffix, "."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// pipe copies between the connections until either side closes, then closes both
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+	a.Close()
+	b.Close()
+}
+
+// EgressProxyHandler is a HTTP proxy that only tunnels HTTPS connections, with CONNECT, to the allowed hosts
+func EgressProxyHandler(allowedHosts []string) http.Handler {
+	return egressProxyHandler(allowedHosts, func(address string) (net.Conn, error) {
+		return net.DialTimeout("tcp", address, 10*time.Second)
+	})
+}
+
+func egressProxyHandler(allowedHosts []string, dial func(address string) (net.Conn, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "Only CONNECT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		host, port, err := net.SplitHostPort(r.Host)
+		if err != nil || port != "443" || !isAllowedHost(host, allowedHosts) {
+			log.Printf("egress proxy: refused connection to %s", r.Host)
+			http.Error(w, "Host not allowed", http.StatusForbidden)
+			return
+		}
+
+		upstream, err := dial(r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			upstream.Close()
+			http.Error(w, "Hijacking not supported", http.StatusInternalServerError)
+			return
+		}
+		conn, buf, err := hijacker.Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		if _, err = buf.WriteString("HTTP/1.1 200 Connection established\r\n\r\n"); err == nil {
+			err = buf.Flush()
+		}
+		if err != nil {
+			conn.Close()
+			upstream.Close()
+			return
+		}
+
+		log.Printf("egress proxy: connected to %s", r.Host)
+		pipe(conn, upstream)
+	})
+}
+
+// ServeForward accepts connections on the listener and forwards each of them to the address
+func ServeForward(l net.Listener, network, address string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			upstream, err := net.Dial(network, address)
+			if err != nil {
+				log.Printf("forward: %s", err.Error())
+				conn.Close()
+				return
+			}
+			pipe(conn, upstream)
+		}()
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsAllowedHost(t *testing.T) {
+	cases := []struct {
+		host    string
+		allowed bool
+	}{
+		{"sts.amazonaws.com", true},
+		{"sts.us-east-1.amazonaws.com", true},
+		{"amazonaws.com", true},
+		{"STS.AmazonAWS.com", true},
+		{"sts.amazonaws.com.", true},
+		{"sts.amazonaws.com.cn", true},
+		{"portal.sso.us-east-1.amazonaws.com", true},
+		{"sts.api.aws", true},
+		{"evilamazonaws.com", false},
+		{"amazonaws.com.evil.com", false},
+		{"sts.amazonaws.com..", false},
+		{"example.com", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if allowed := isAllowedHost(c.host, DefaultEgressAllowedHosts); allowed != c.allowed {
+			t.Errorf("Expected %q to be allowed %v, got %v", c.host, c.allowed, allowed)
+		}
+	}
+
+	if isAllowedHost("evilexample.com", []string{"example.com"}) {
+		t.Error("Expected a suffix without a leading dot to only match whole labels")
+	}
+}
+
+// connect sends a CONNECT request for the address through the proxy, returning the connection and its response
+func connect(t *testing.T, proxy, method, address string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "%s %s HTTP/1.1\r\nHost: %s\r\n\r\n", method, address, address)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, br, resp
+}
+
+func TestEgressProxyHandler(t *testing.T) {
+	// an echo server stands in for AWS, reached whatever the host
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	var dialed []string
+	ts := httptest.NewServer(egressProxyHandler(DefaultEgressAllowedHosts, func(address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return net.Dial("tcp", echo.Addr().String())
+	}))
+	defer ts.Close()
+	proxy := ts.Listener.Addr().String()
+
+	conn, br, resp := connect(t, proxy, http.MethodConnect, "sts.amazonaws.com:443")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the connection to be allowed, got %s", resp.Status)
+	}
+	if _, err = conn.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := br.ReadString('\n'); err != nil || line != "ping\n" {
+		t.Fatalf("Expected the connection to be tunnelled, got %q %v", line, err)
+	}
+
+	for _, c := range []struct {
+		method, address string
+		status          int
+	}{
+		{http.MethodConnect, "evilamazonaws.com:443", http.StatusForbidden},
+		{http.MethodConnect, "sts.amazonaws.com:80", http.StatusForbidden},
+		{http.MethodConnect, "example.com:443", http.StatusForbidden},
+		{http.MethodGet, "sts.amazonaws.com:443", http.StatusMethodNotAllowed},
+	} {
+		if _, _, resp := connect(t, proxy, c.method, c.address); resp.StatusCode != c.status {
+			t.Errorf("Expected %s %s to get %d, got %s", c.method, c.address, c.status, resp.Status)
+		}
+	}
+
+	if len(dialed) != 1 || dialed[0] != "sts.amazonaws.com:443" {
+		t.Errorf("Expected only the allowed host to be dialed, got %v", dialed)
+	}
+}
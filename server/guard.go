@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RequestGuard watches the requests made to a credential server for signs that something other than
+// the intended subprocess is using it: a surge of requests, or more distinct clients than expected
+type RequestGuard struct {
+	// RequestsPerMinute is the sustained request rate allowed, 0 for no limit
+	RequestsPerMinute int
+
+	// Burst is the number of requests allowed at once above the sustained rate
+	Burst int
+
+	// MaxClients is the number of distinct clients allowed, 0 for no limit
+	MaxClients int
+
+	// Enforce refuses requests over the limits. Otherwise they are only logged
+	Enforce bool
+
+	mu      sync.Mutex
+	tokens  float64
+	last    time.Time
+	clients map[string]bool
+}
+
+type requestGuardContextKey struct{}
+
+// ContextWithRequestGuard returns a context that makes the EC2 and ECS servers created with it apply the
+// guard to their requests. No limits are applied to servers created without one
+func ContextWithRequestGuard(ctx context.Context, g *RequestGuard) context.Context {
+	return context.WithValue(ctx, requestGuardContextKey{}, g)
+}
+
+// requestGuardFromContext returns the guard added with ContextWithRequestGuard, or nil
+func requestGuardFromContext(ctx context.Context) *RequestGuard {
+	g, _ := ctx.Value(requestGuardContextKey{}).(*RequestGuard)
+	return g
+}
+
+// clientID identifies the client making a request. All requests come from the loopback address,
+// so the executable of the requesting process is used to tell clients apart, falling back to the
+// User-Agent where the process can't be found. The User-Agent is set by the client, so where processes
+// can't be found, a client can pose as one already seen, and MaxClients is only a hint
+func clientID(r *http.Request) string {
+	if peer, err := requestPeer(r); err == nil && peer.Exe != "" {
+		return peer.Exe
+	}
+	return r.UserAgent()
+}
+
+// allowRequest takes a token from the bucket, refilled at RequestsPerMinute
+func (g *RequestGuard) allowRequest(now time.Time) bool {
+	if g.RequestsPerMinute <= 0 {
+		return true
+	}
+	capacity := float64(g.RequestsPerMinute + g.Burst)
+	if g.last.IsZero() {
+		g.tokens = capacity
+	} else {
+		g.tokens += now.Sub(g.last).Minutes() * float64(g.RequestsPerMinute)
+		if g.tokens > capacity {
+			g.tokens = capacity
+		}
+	}
+	g.last = now
+
+	if g.tokens < 1 {
+		return false
+	}
+	g.tokens--
+	return true
+}
+
+// allowClient records the client, and checks the number of distinct clients is within MaxClients
+func (g *RequestGuard) allowClient(id string) bool {
+	if g.clients == nil {
+		g.clients = map[string]bool{}
+	}
+	if g.clients[id] {
+		return true
+	}
+	if g.MaxClients > 0 && len(g.clients) >= g.MaxClients {
+		return false
+	}
+	g.clients[id] = true
+	return true
+}
+
+// check returns an HTTP status code and message if the request should be refused, or 0 if it can be served
+func (g *RequestGuard) check(r *http.Request) (int, string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.allowRequest(time.Now()) {
+		warnf(r.Context(), "Request guard: more than %d requests per minute, from %q", g.RequestsPerMinute, clientID(r))
+		if g.Enforce {
+			return http.StatusTooManyRequests, "Too many requests"
+		}
+	}
+
+	if id := clientID(r); !g.allowClient(id) {
+		warnf(r.Context(), "Request guard: unexpected client %q, already seen %d distinct clients", id, len(g.clients))
+		if g.Enforce {
+			return http.StatusForbidden, "Too many distinct clients"
+		}
+	}
+
+	return 0, ""
+}
+
+func withRequestGuard(guard *RequestGuard, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if guard != nil {
+			if code, msg := guard.check(r); code != 0 {
+				http.Error(w, msg, code)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
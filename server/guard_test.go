@@ -0,0 +1,46 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestGuardWarnsWithoutEnforcing(t *testing.T) {
+	var warnings bytes.Buffer
+	guard := &RequestGuard{MaxClients: 1}
+	handler := withRequestGuard(guard, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, userAgent := range []string{"first", "second"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r = r.WithContext(ContextWithWarnings(r.Context(), &warnings))
+		r.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected the request of %s to be served, got %d", userAgent, w.Code)
+		}
+	}
+
+	if !strings.Contains(warnings.String(), `unexpected client "second"`) {
+		t.Errorf("Expected a warning about the second client, got %q", warnings.String())
+	}
+}
+
+func TestRequestGuardEnforcesLimits(t *testing.T) {
+	guard := &RequestGuard{RequestsPerMinute: 1, Enforce: true}
+	handler := withRequestGuard(guard, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	codes := []int{}
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		codes = append(codes, w.Code)
+	}
+
+	if codes[0] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("Expected the requests over the limit to be refused, got %v", codes)
+	}
+}
@@ -1,14 +1,25 @@
 package server
 
 import (
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/aws/aws-sdk-go-v2/aws"
 )
 
+// ClientLog, when set, is given a line for every request to the EC2 and ECS servers, naming the client.
+// Requests are otherwise only logged with --debug
+var ClientLog *log.Logger
+
 type loggingMiddlewareResponseWriter struct {
 	http.ResponseWriter
-	Code int
+	Code  int
+	Creds *aws.Credentials
 }
 
 func (w *loggingMiddlewareResponseWriter) WriteHeader(statusCode int) {
@@ -16,11 +27,53 @@ func (w *loggingMiddlewareResponseWriter) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
-func withLogging(handler http.Handler) http.Handler {
+func (w *loggingMiddlewareResponseWriter) recordCredentials(creds aws.Credentials) {
+	w.Creds = &creds
+}
+
+// withLogging logs requests to the server, which is named in the RequestLog
+func withLogging(serverName string, handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		requestStart := time.Now()
-		w2 := &loggingMiddlewareResponseWriter{w, http.StatusOK}
-		handler.ServeHTTP(w2, r)
-		log.Printf("http: %s: %d %s %s (%s)", r.RemoteAddr, w2.Code, r.Method, r.URL, time.Since(requestStart))
+		ctx, span := vault.StartSpan(r.Context(), fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+
+		// the peer is only looked up when it's logged or traced, before serving the request while its
+		// connection is certainly still open
+		client := r.RemoteAddr
+		var peerProcess *PeerProcess
+		if span != nil || ClientLog != nil || RequestLog != nil || log.Writer() != io.Discard {
+			if peer, err := requestPeer(r); err == nil {
+				peerProcess = &peer
+				client = fmt.Sprintf("%s (%s)", r.RemoteAddr, peer)
+				span.SetAttribute("process.pid", strconv.Itoa(peer.PID))
+				span.SetAttribute("process.executable.path", peer.Exe)
+			}
+		}
+
+		w2 := &loggingMiddlewareResponseWriter{ResponseWriter: w, Code: http.StatusOK}
+		handler.ServeHTTP(w2, r.WithContext(ctx))
+		span.SetAttribute("http.status_code", strconv.Itoa(w2.Code))
+		span.End(nil)
+		log.Printf("http: %s: %d %s %s (%s)", client, w2.Code, r.Method, r.URL, time.Since(requestStart))
+		if ClientLog != nil {
+			ClientLog.Printf("%s: %d %s %s", client, w2.Code, r.Method, r.URL.Path)
+		}
+		if RequestLog != nil {
+			entry := RequestLogEntry{
+				Time:    requestStart,
+				Server:  serverName,
+				Method:  r.Method,
+				Path:    r.URL.Path,
+				Status:  w2.Code,
+				Client:  r.RemoteAddr,
+				Peer:    peerProcess,
+				Latency: time.Since(requestStart),
+			}
+			if w2.Creds != nil {
+				entry.AccessKeyID = redactAccessKeyID(w2.Creds.AccessKeyID)
+				entry.Expires = w2.Creds.Expires
+			}
+			RequestLog.Log(entry)
+		}
 	})
 }
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// PeerProcess is the local process on the other end of a connection
+type PeerProcess struct {
+	PID int
+	Exe string
+}
+
+func (p PeerProcess) String() string {
+	return fmt.Sprintf("pid=%d exe=%s", p.PID, p.Exe)
+}
+
+type connPeerKey struct{}
+
+// connPeer finds the peer of a connection the first time it's needed, as finding it can mean scanning
+// every process. Requests on the same connection share the result
+type connPeer struct {
+	once       sync.Once
+	remoteAddr string
+	peer       PeerProcess
+	err        error
+}
+
+func (c *connPeer) get() (PeerProcess, error) {
+	c.once.Do(func() {
+		c.peer, c.err = lookupPeerProcess(c.remoteAddr)
+	})
+	return c.peer, c.err
+}
+
+// withConnPeer is the ConnContext of the servers, so that the peer of a connection is looked up at most once
+func withConnPeer(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connPeerKey{}, &connPeer{remoteAddr: c.RemoteAddr().String()})
+}
+
+// requestPeer finds the local process that made the request, which is logged so users can see which
+// processes used the credential servers
+func requestPeer(r *http.Request) (PeerProcess, error) {
+	if c, ok := r.Context().Value(connPeerKey{}).(*connPeer); ok {
+		return c.get()
+	}
+	return lookupPeerProcess(r.RemoteAddr)
+}
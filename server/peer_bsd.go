@@ -0,0 +1,57 @@
+//go:build darwin || freebsd || openbsd
+// +build darwin freebsd openbsd
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// lookupPeerProcess uses lsof to find the process with a TCP socket bound to the remote address
+func lookupPeerProcess(remoteAddr string) (PeerProcess, error) {
+	host, port, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return PeerProcess{}, err
+	}
+
+	out, err := exec.Command("lsof", "-nP", "-a", fmt.Sprintf("-iTCP@%s:%s", host, port), "-sTCP:ESTABLISHED", "-Fpn").Output()
+	if err != nil {
+		return PeerProcess{}, fmt.Errorf("lsof: %w", err)
+	}
+
+	// lsof lists both ends of the connection, so find the process whose local address is the remote address
+	peer := PeerProcess{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "p"):
+			peer.PID, _ = strconv.Atoi(line[1:])
+		case strings.HasPrefix(line, "n") && strings.HasPrefix(line[1:], net.JoinHostPort(host, port)+"->"):
+			exe, _ := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(peer.PID)).Output()
+			peer.Exe = strings.TrimSpace(string(exe))
+			return peer, nil
+		}
+	}
+
+	return PeerProcess{}, fmt.Errorf("no process found for %s", remoteAddr)
+}
+
+func parentPID(pid int) (int, error) {
+	out, err := exec.Command("ps", "-o", "ppid=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ps: %w", err)
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+// SupportsProcessTree reports whether requests can be restricted to a process tree on this platform
+func SupportsProcessTree() bool {
+	return true
+}
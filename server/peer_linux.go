@@ -0,0 +1,97 @@
+//go:build linux
+// +build linux
+
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procNetAddr formats an address the way it appears in /proc/net/tcp and /proc/net/tcp6, where the
+// IP is written as 32-bit words in host byte order
+func procNetAddr(ip net.IP, port int) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	var sb strings.Builder
+	for i := 0; i < len(ip); i += 4 {
+		fmt.Fprintf(&sb, "%02X%02X%02X%02X", ip[i+3], ip[i+2], ip[i+1], ip[i])
+	}
+	fmt.Fprintf(&sb, ":%04X", port)
+	return sb.String()
+}
+
+// socketInode finds the inode of the socket with the given local address
+func socketInode(addr string) (string, error) {
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(table)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) > 9 && fields[1] == addr {
+				f.Close()
+				return fields[9], nil
+			}
+		}
+		f.Close()
+	}
+	return "", fmt.Errorf("no socket found for %s", addr)
+}
+
+func lookupPeerProcess(remoteAddr string) (PeerProcess, error) {
+	host, portStr, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return PeerProcess{}, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return PeerProcess{}, err
+	}
+
+	inode, err := socketInode(procNetAddr(net.ParseIP(host), port))
+	if err != nil {
+		return PeerProcess{}, err
+	}
+	target := "socket:[" + inode + "]"
+
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		if link, err := os.Readlink(fd); err == nil && link == target {
+			procDir := filepath.Dir(filepath.Dir(fd))
+			pid, _ := strconv.Atoi(filepath.Base(procDir))
+			exe, _ := os.Readlink(filepath.Join(procDir, "exe"))
+			return PeerProcess{PID: pid, Exe: exe}, nil
+		}
+	}
+
+	return PeerProcess{}, fmt.Errorf("no process found for socket %s", inode)
+}
+
+// parentPID reads the parent of the process from /proc/<pid>/stat
+func parentPID(pid int) (int, error) {
+	b, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, err
+	}
+	// the command name may contain spaces, so the fields are read from after it
+	stat := string(b)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+	return strconv.Atoi(fields[1])
+}
+
+// SupportsProcessTree reports whether requests can be restricted to a process tree on this platform
+func SupportsProcessTree() bool {
+	return true
+}
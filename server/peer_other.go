@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !freebsd && !openbsd
+// +build !linux,!darwin,!freebsd,!openbsd
+
+package server
+
+import "errors"
+
+func lookupPeerProcess(remoteAddr string) (PeerProcess, error) {
+	return PeerProcess{}, errors.New("finding the peer process isn't supported on this platform")
+}
+
+func parentPID(pid int) (int, error) {
+	return 0, errors.New("finding the parent process isn't supported on this platform")
+}
+
+// SupportsProcessTree reports whether requests can be restricted to a process tree on this platform
+func SupportsProcessTree() bool {
+	return false
+}
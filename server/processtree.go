@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// ProcessTreeFilter only allows requests from a process and its descendants, so that other local
+// processes can't use the servers while a command runs. Requests are refused until the root is set
+type ProcessTreeFilter struct {
+	mu   sync.RWMutex
+	root int
+}
+
+type processTreeContextKey struct{}
+
+// ContextWithProcessTreeFilter returns a context that makes the EC2 and ECS servers created with it only
+// allow requests from the filter's process tree. All processes are allowed by servers created without one
+func ContextWithProcessTreeFilter(ctx context.Context, f *ProcessTreeFilter) context.Context {
+	return context.WithValue(ctx, processTreeContextKey{}, f)
+}
+
+// processTreeFilterFromContext returns the filter added with ContextWithProcessTreeFilter, or nil
+func processTreeFilterFromContext(ctx context.Context) *ProcessTreeFilter {
+	f, _ := ctx.Value(processTreeContextKey{}).(*ProcessTreeFilter)
+	return f
+}
+
+// SetRoot sets the process whose descendants are allowed. It's safe to call on a nil filter
+func (f *ProcessTreeFilter) SetRoot(pid int) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.root = pid
+}
+
+// isDescendant walks up the parents of pid looking for root
+func isDescendant(pid, root int) bool {
+	for i := 0; i < 256 && pid > 1; i++ {
+		if pid == root {
+			return true
+		}
+		ppid, err := parentPID(pid)
+		if err != nil {
+			return false
+		}
+		pid = ppid
+	}
+	return false
+}
+
+// allows checks the request comes from the process tree. Requests from aws-vault itself, such as
+// those forwarded into an isolated network namespace, are also allowed
+func (f *ProcessTreeFilter) allows(r *http.Request) bool {
+	f.mu.RLock()
+	root := f.root
+	f.mu.RUnlock()
+
+	if root == 0 {
+		return false
+	}
+	peer, err := requestPeer(r)
+	if err != nil {
+		log.Printf("Process tree: can't find the process for %s: %s", r.RemoteAddr, err.Error())
+		return false
+	}
+	return peer.PID == os.Getpid() || isDescendant(peer.PID, root)
+}
+
+func withProcessTreeCheck(filter *ProcessTreeFilter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if filter != nil && !filter.allows(r) {
+			warnf(r.Context(), "Process tree: refused request from %s, which isn't run by the command", r.RemoteAddr)
+			http.Error(w, "Request not from the command's process tree", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
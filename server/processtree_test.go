@@ -0,0 +1,33 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestEc2ServerRefusesRequestsOutsideProcessTree(t *testing.T) {
+	creds := aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "ABC", SecretAccessKey: "XYZ"}, nil
+	})
+
+	// no root has been set, so no process is in the tree yet
+	ctx := ContextWithProcessTreeFilter(context.Background(), &ProcessTreeFilter{})
+	e, err := NewEc2Server(ctx, creds, "us-east-1", nil, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = e.Serve() }()
+	defer func() { _ = e.Shutdown(context.Background()) }()
+
+	resp, err := http.Get(e.BaseURL() + "/latest/meta-data/iam/security-credentials/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the request to be refused, got %s", resp.Status)
+	}
+}
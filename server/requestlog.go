@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/iso8601"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Formats of the request log
+const (
+	RequestLogFormatText = "text"
+	RequestLogFormatJSON = "json"
+)
+
+// RequestLog, when set, is given an entry for every request to the credential servers, so what they
+// handed out can be audited
+var RequestLog *RequestLogger
+
+// RequestLogEntry is a request to a credential server
+type RequestLogEntry struct {
+	Time    time.Time
+	Server  string
+	Method  string
+	Path    string
+	Status  int
+	Client  string
+	Peer    *PeerProcess
+	Latency time.Duration
+
+	// AccessKeyID and Expires describe the credentials served, if any. Only the end of the key is kept
+	AccessKeyID string
+	Expires     time.Time
+}
+
+// RequestLogger writes request log entries as lines of text or JSON
+type RequestLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+}
+
+// NewRequestLogger creates a logger writing to w in the format, RequestLogFormatText or RequestLogFormatJSON
+func NewRequestLogger(w io.Writer, format string) (*RequestLogger, error) {
+	if format != RequestLogFormatText && format != RequestLogFormatJSON {
+		return nil, fmt.Errorf("Unknown request log format %q", format)
+	}
+	return &RequestLogger{w: w, format: format}, nil
+}
+
+type requestLogJSON struct {
+	Time               string `json:"time"`
+	Server             string `json:"server"`
+	Method             string `json:"method"`
+	Path               string `json:"path"`
+	Status             int    `json:"status"`
+	Client             string `json:"client"`
+	PID                int    `json:"pid,omitempty"`
+	Exe                string `json:"exe,omitempty"`
+	LatencyMs          int64  `json:"latency_ms"`
+	AccessKeyID        string `json:"access_key_id,omitempty"`
+	CredentialsExpires string `json:"credentials_expire,omitempty"`
+}
+
+// Log writes the entry
+func (l *RequestLogger) Log(e RequestLogEntry) {
+	var line []byte
+	if l.format == RequestLogFormatJSON {
+		j := requestLogJSON{
+			Time:        iso8601.Format(e.Time),
+			Server:      e.Server,
+			Method:      e.Method,
+			Path:        e.Path,
+			Status:      e.Status,
+			Client:      e.Client,
+			LatencyMs:   e.Latency.Milliseconds(),
+			AccessKeyID: e.AccessKeyID,
+		}
+		if e.Peer != nil {
+			j.PID, j.Exe = e.Peer.PID, e.Peer.Exe
+		}
+		if !e.Expires.IsZero() {
+			j.CredentialsExpires = iso8601.Format(e.Expires)
+		}
+		line, _ = json.Marshal(j)
+	} else {
+		s := fmt.Sprintf("%s %s %d %s %s client=%s", iso8601.Format(e.Time), e.Server, e.Status, e.Method, e.Path, e.Client)
+		if e.Peer != nil {
+			s += fmt.Sprintf(" pid=%d exe=%s", e.Peer.PID, e.Peer.Exe)
+		}
+		s += fmt.Sprintf(" latency=%s", e.Latency.Round(time.Microsecond))
+		if e.AccessKeyID != "" {
+			s += fmt.Sprintf(" access_key_id=%s expires=%s", e.AccessKeyID, iso8601.Format(e.Expires))
+		}
+		line = []byte(s)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(append(line, '\n'))
+}
+
+// credentialsRecorder is implemented by the response writer of withLogging, so handlers can record the
+// credentials they serve in the request log
+type credentialsRecorder interface {
+	recordCredentials(creds aws.Credentials)
+}
+
+// recordServedCredentials records the credentials served in the response, if it's logged
+func recordServedCredentials(w http.ResponseWriter, creds aws.Credentials) {
+	if r, ok := w.(credentialsRecorder); ok {
+		r.recordCredentials(creds)
+	}
+}
+
+// redactAccessKeyID keeps the last 4 characters of an access key ID, enough to tell keys apart
+func redactAccessKeyID(id string) string {
+	if len(id) <= 4 {
+		return id
+	}
+	return "****" + id[len(id)-4:]
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// vsockHostCID is the context ID of the host, which VMs connect to
+const vsockHostCID = 2
+
+// VsockAddr is the address of a vsock socket, which VMs use to talk to their host without networking
+type VsockAddr struct {
+	CID  uint32
+	Port uint32
+}
+
+func (a *VsockAddr) Network() string {
+	return "vsock"
+}
+
+func (a *VsockAddr) String() string {
+	return fmt.Sprintf("vsock:%d:%d", a.CID, a.Port)
+}
+
+// IsVsockAddr reports whether addr is a vsock address, rather than a TCP address
+func IsVsockAddr(addr string) bool {
+	return strings.HasPrefix(addr, "vsock:")
+}
+
+// parseVsockAddr parses vsock:PORT, for a vsock socket, or vsock:PATH:PORT for the Unix socket at PATH_PORT
+// that Firecracker and cloud-hypervisor connect guests to, as they emulate vsock over Unix sockets
+func parseVsockAddr(addr string) (path string, port uint32, err error) {
+	rest := strings.TrimPrefix(addr, "vsock:")
+	if i := strings.LastIndex(rest, ":"); i >= 0 {
+		path, rest = rest[:i], rest[i+1:]
+		if path == "" {
+			return "", 0, fmt.Errorf("Invalid vsock address %q, the path of the Unix socket is empty", addr)
+		}
+	}
+	p, err := strconv.ParseUint(rest, 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("Invalid vsock address %q, use vsock:PORT or vsock:PATH:PORT", addr)
+	}
+	return path, uint32(p), nil
+}
+
+// Listen listens on a TCP address, or a vsock address such as vsock:9911 or vsock:/run/vm/v.sock:9911
+func Listen(addr string) (net.Listener, error) {
+	if !IsVsockAddr(addr) {
+		return net.Listen("tcp", addr)
+	}
+	path, port, err := parseVsockAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return listenVsock(port)
+	}
+	listener, err := net.Listen("unix", fmt.Sprintf("%s_%d", path, port))
+	if err != nil {
+		return nil, err
+	}
+	return &hybridVsockListener{Listener: listener, addr: &VsockAddr{CID: vsockHostCID, Port: port}}, nil
+}
+
+// hybridVsockListener listens on the Unix socket a VMM connects guests to, for the port of the host they connect to
+type hybridVsockListener struct {
+	net.Listener
+	addr *VsockAddr
+}
+
+func (l *hybridVsockListener) Addr() net.Addr {
+	return l.addr
+}
+
+// listenerPort is the port of a TCP or vsock listener
+func listenerPort(l net.Listener) int {
+	switch addr := l.Addr().(type) {
+	case *net.TCPAddr:
+		return addr.Port
+	case *VsockAddr:
+		return int(addr.Port)
+	}
+	return 0
+}
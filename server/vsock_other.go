@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+func listenVsock(port uint32) (net.Listener, error) {
+	return nil, errors.New("vsock sockets are only supported on Linux, use vsock:PATH:PORT for a VMM that connects guests to a Unix socket")
+}
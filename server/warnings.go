@@ -0,0 +1,25 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+)
+
+type warningsContextKey struct{}
+
+// ContextWithWarnings returns a context that makes the servers created with it write warnings about the
+// requests they refuse, or that go over the limits of a RequestGuard, to w as well as the debug log
+func ContextWithWarnings(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, warningsContextKey{}, w)
+}
+
+// warnf logs a warning about a request, also writing it to the writer added to the request's context
+// with ContextWithWarnings
+func warnf(ctx context.Context, format string, args ...interface{}) {
+	log.Printf(format, args...)
+	if w, _ := ctx.Value(warningsContextKey{}).(io.Writer); w != nil {
+		fmt.Fprintf(w, "aws-vault: "+format+"\n", args...)
+	}
+}
@@ -0,0 +1,69 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/99designs/aws-vault/v7/prompt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// ApprovalProvider asks the user to approve issuing credentials before retrieving them, including
+// when they come from a cached session. Once approved, credentials can be retrieved again without asking
+type ApprovalProvider struct {
+	aws.CredentialsProvider
+	ProfileName  string
+	PromptMethod string
+	// PromptCommand asks for approval instead of the PromptMethod, when it's set
+	PromptCommand string
+	// NoPrompt fails rather than asking for approval
+	NoPrompt bool
+
+	mu       sync.Mutex
+	approved bool
+}
+
+// Retrieve asks for approval, then returns the credentials
+func (p *ApprovalProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	p.mu.Lock()
+	if !p.approved {
+		approved, err := p.prompt()
+		if err != nil {
+			p.mu.Unlock()
+			return aws.Credentials{}, fmt.Errorf("profile %s: approval prompt failed: %w", p.ProfileName, err)
+		}
+		if !approved {
+			p.mu.Unlock()
+			return aws.Credentials{}, fmt.Errorf("profile %s: issuing credentials was not approved", p.ProfileName)
+		}
+		p.approved = true
+	}
+	p.mu.Unlock()
+
+	return p.CredentialsProvider.Retrieve(ctx)
+}
+
+func (p *ApprovalProvider) prompt() (bool, error) {
+	if p.NoPrompt {
+		return false, prompt.InteractionRequired(prompt.InteractionConfirm, fmt.Sprintf("Approving credentials for %s", p.ProfileName))
+	}
+	if p.PromptCommand != "" {
+		return prompt.CommandApprovalPrompt(p.PromptCommand, p.ProfileName)
+	}
+	return prompt.ApprovalPrompt(p.PromptMethod, p.ProfileName)
+}
+
+// withApproval wraps the provider in an ApprovalProvider if the profile requires approval
+func withApproval(credsProvider aws.CredentialsProvider, config *Config) aws.CredentialsProvider {
+	if !config.RequireApproval {
+		return credsProvider
+	}
+	return &ApprovalProvider{
+		CredentialsProvider: credsProvider,
+		ProfileName:         config.ProfileName,
+		PromptMethod:        config.MfaPromptMethod,
+		PromptCommand:       config.PromptCommand,
+		NoPrompt:            config.NoPrompt,
+	}
+}
@@ -3,7 +3,6 @@ package vault
 import (
 	"context"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -21,6 +20,8 @@ type AssumeRoleProvider struct {
 	Tags              map[string]string
 	TransitiveTagKeys []string
 	SourceIdentity    string
+	Policy            string
+	PolicyARNs        []string
 	*Mfa
 }
 
@@ -89,12 +90,29 @@ func (p *AssumeRoleProvider) assumeRole(ctx context.Context) (*ststypes.Credenti
 		input.SourceIdentity = aws.String(p.SourceIdentity)
 	}
 
+	if p.Policy != "" {
+		input.Policy = aws.String(p.Policy)
+	}
+
+	if len(p.PolicyARNs) > 0 {
+		input.PolicyArns = policyDescriptors(p.PolicyARNs)
+	}
+
 	resp, err := p.StsClient.AssumeRole(ctx, input)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("Generated credentials %s using AssumeRole, expires in %s", FormatKeyForDisplay(*resp.Credentials.AccessKeyId), time.Until(*resp.Credentials.Expiration).String())
+	expiresIn := time.Until(*resp.Credentials.Expiration)
+	logf(LogFields{Provider: "assume_role", Duration: expiresIn}, "Generated credentials %s using AssumeRole, expires in %s", FormatKeyForDisplay(*resp.Credentials.AccessKeyId), expiresIn.String())
 
 	return resp.Credentials, nil
 }
+
+func policyDescriptors(arns []string) []ststypes.PolicyDescriptorType {
+	descriptors := make([]ststypes.PolicyDescriptorType, 0, len(arns))
+	for _, arn := range arns {
+		descriptors = append(descriptors, ststypes.PolicyDescriptorType{Arn: aws.String(arn)})
+	}
+	return descriptors
+}
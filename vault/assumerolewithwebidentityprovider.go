@@ -3,7 +3,6 @@ package vault
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
 	"time"
 
@@ -66,7 +65,8 @@ func (p *AssumeRoleWithWebIdentityProvider) assumeRole(ctx context.Context) (*st
 		return nil, err
 	}
 
-	log.Printf("Generated credentials %s using AssumeRoleWithWebIdentity, expires in %s", FormatKeyForDisplay(*resp.Credentials.AccessKeyId), time.Until(*resp.Credentials.Expiration).String())
+	expiresIn := time.Until(*resp.Credentials.Expiration)
+	logf(LogFields{Provider: "web_identity", Duration: expiresIn}, "Generated credentials %s using AssumeRoleWithWebIdentity, expires in %s", FormatKeyForDisplay(*resp.Credentials.AccessKeyId), expiresIn.String())
 
 	return resp.Credentials, nil
 }
@@ -83,5 +83,6 @@ func (p *AssumeRoleWithWebIdentityProvider) webIdentityToken() (string, error) {
 	}
 
 	// Exec WebIdentityTokenProcess to retrieve OpenID Connect token
-	return executeProcess(p.WebIdentityTokenProcess)
+	b, err := executeProcess(p.WebIdentityTokenProcess)
+	return string(b), err
 }
@@ -0,0 +1,117 @@
+package vault
+
+import (
+	"crypto/sha1" //nolint:gosec
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+)
+
+// awsCLITokenExpiryWindow is how long a token cached by the AWS CLI needs to be valid for to be used
+const awsCLITokenExpiryWindow = 5 * time.Minute
+
+// awsCLISSOToken is a token cached by the AWS CLI in ~/.aws/sso/cache
+type awsCLISSOToken struct {
+	StartURL    string `json:"startUrl"`
+	Region      string `json:"region"`
+	AccessToken string `json:"accessToken"`
+	ExpiresAt   string `json:"expiresAt"`
+}
+
+// awsCLISSOCacheFile is the file the AWS CLI caches the token in, named after the SHA-1 of the
+// sso-session name, or of the start URL for profiles without an sso-session
+func awsCLISSOCacheFile(ssoSession, startURL string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	key := startURL
+	if ssoSession != "" {
+		key = ssoSession
+	}
+	sum := sha1.Sum([]byte(key)) //nolint:gosec
+
+	return filepath.Join(home, ".aws", "sso", "cache", hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// readAWSCLISSOToken returns the token the AWS CLI cached when signing in with `aws sso login`, or
+// nil if there's none for the start URL that's valid. It's only read, the AWS CLI refreshes it
+func readAWSCLISSOToken(ssoSession, startURL string) *ssooidc.CreateTokenOutput {
+	path, err := awsCLISSOCacheFile(ssoSession, startURL)
+	if err != nil {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var cached awsCLISSOToken
+	if err = json.Unmarshal(b, &cached); err != nil {
+		log.Printf("Invalid SSO token cached by the AWS CLI in %s: %s", path, err)
+		return nil
+	}
+	if cached.StartURL != startURL || cached.AccessToken == "" {
+		return nil
+	}
+
+	expiresAt, err := parseAWSCLIExpiry(cached.ExpiresAt)
+	if err != nil {
+		log.Printf("Invalid expiry of SSO token cached by the AWS CLI in %s: %s", path, err)
+		return nil
+	}
+	if time.Until(expiresAt) < awsCLITokenExpiryWindow {
+		return nil
+	}
+
+	log.Printf("Using the SSO token cached by the AWS CLI for %s (expires in: %s)", startURL, time.Until(expiresAt).Round(time.Second))
+	return &ssooidc.CreateTokenOutput{
+		AccessToken: aws.String(cached.AccessToken),
+		TokenType:   aws.String("Bearer"),
+		ExpiresIn:   int32(time.Until(expiresAt) / time.Second),
+	}
+}
+
+// parseAWSCLIExpiry parses expiresAt, which older versions of the AWS CLI wrote with a UTC suffix
+func parseAWSCLIExpiry(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02T15:04:05UTC", s)
+}
+
+// removeAWSCLISSOToken removes the token the AWS CLI cached for the start URL, returning its access
+// token while it's still valid so that it can be signed out. A file for another start URL is left alone
+func removeAWSCLISSOToken(ssoSession, startURL string) (accessToken string, removed bool, err error) {
+	path, err := awsCLISSOCacheFile(ssoSession, startURL)
+	if err != nil {
+		return "", false, err
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	var cached awsCLISSOToken
+	if err = json.Unmarshal(b, &cached); err != nil || cached.StartURL != startURL {
+		return "", false, nil
+	}
+	if err = os.Remove(path); err != nil {
+		return "", false, err
+	}
+
+	if expiresAt, err := parseAWSCLIExpiry(cached.ExpiresAt); err == nil && time.Now().Before(expiresAt) {
+		accessToken = cached.AccessToken
+	}
+	return accessToken, true, nil
+}
@@ -0,0 +1,84 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestReadAWSCLISSOToken(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	write := func(ssoSession, startURL, expiresAt string) {
+		path, err := awsCLISSOCacheFile(ssoSession, startURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		content := fmt.Sprintf(`{"startUrl": %q, "region": "us-east-1", "accessToken": "token-for-%s", "expiresAt": %q}`, startURL, startURL, expiresAt)
+		if err = os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	valid := time.Now().Add(time.Hour).UTC()
+	write("acme", "https://acme.awsapps.com/start", valid.Format(time.RFC3339))
+	write("", "https://legacy.awsapps.com/start", valid.Format("2006-01-02T15:04:05UTC"))
+	write("", "https://expired.awsapps.com/start", time.Now().Add(time.Minute).UTC().Format(time.RFC3339))
+
+	token := readAWSCLISSOToken("acme", "https://acme.awsapps.com/start")
+	if token == nil || aws.ToString(token.AccessToken) != "token-for-https://acme.awsapps.com/start" {
+		t.Fatalf("Expected the token of the sso-session, got %v", token)
+	}
+	if token.ExpiresIn < 3500 {
+		t.Errorf("Expected the token to expire in an hour, got %ds", token.ExpiresIn)
+	}
+	if token = readAWSCLISSOToken("", "https://legacy.awsapps.com/start"); token == nil {
+		t.Error("Expected the token of the start URL with an expiry in the old format")
+	}
+	if token = readAWSCLISSOToken("other", "https://acme.awsapps.com/start"); token != nil {
+		t.Error("Expected no token for another sso-session")
+	}
+	if token = readAWSCLISSOToken("", "https://expired.awsapps.com/start"); token != nil {
+		t.Error("Expected a token that's about to expire not to be used")
+	}
+}
+
+func TestRemoveAWSCLISSOToken(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	path, err := awsCLISSOCacheFile("acme", "https://acme.awsapps.com/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	content := fmt.Sprintf(`{"startUrl": "https://acme.awsapps.com/start", "accessToken": "token", "expiresAt": %q}`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	if err = os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, removed, err := removeAWSCLISSOToken("acme", "https://other.awsapps.com/start"); err != nil || removed {
+		t.Fatalf("Expected the token of another start URL to be left alone, got %v %v", removed, err)
+	}
+	accessToken, removed, err := removeAWSCLISSOToken("acme", "https://acme.awsapps.com/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !removed || accessToken != "token" {
+		t.Errorf("Expected the valid token to be removed, got %q %v", accessToken, removed)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the cache file to be removed, got %v", err)
+	}
+	if _, removed, _ = removeAWSCLISSOToken("acme", "https://acme.awsapps.com/start"); removed {
+		t.Error("Expected nothing to remove")
+	}
+}
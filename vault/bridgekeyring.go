@@ -0,0 +1,197 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/99designs/keyring"
+)
+
+// keyringBridgeRequest is a keyring operation sent to a keyring bridge, as a line of JSON
+type keyringBridgeRequest struct {
+	Op   string        `json:"op"`
+	Key  string        `json:"key,omitempty"`
+	Item *keyring.Item `json:"item,omitempty"`
+}
+
+// keyringBridgeResponse is the result of a keyring operation, as a line of JSON
+type keyringBridgeResponse struct {
+	Item     *keyring.Item     `json:"item,omitempty"`
+	Metadata *keyring.Metadata `json:"metadata,omitempty"`
+	Keys     []string          `json:"keys,omitempty"`
+	NotFound bool              `json:"not_found,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// ServeKeyringBridge serves the operations of a BridgeKeyring from r, using k, until r is closed
+func ServeKeyringBridge(k keyring.Keyring, r io.Reader, w io.Writer) error {
+	dec := json.NewDecoder(r)
+	enc := json.NewEncoder(w)
+	for {
+		var req keyringBridgeRequest
+		if err := dec.Decode(&req); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var resp keyringBridgeResponse
+		var err error
+		switch req.Op {
+		case "get":
+			var item keyring.Item
+			item, err = k.Get(req.Key)
+			resp.Item = &item
+		case "metadata":
+			var md keyring.Metadata
+			md, err = k.GetMetadata(req.Key)
+			resp.Metadata = &md
+		case "set":
+			if req.Item == nil {
+				err = errors.New("no item to set")
+			} else {
+				err = k.Set(*req.Item)
+			}
+		case "remove":
+			err = k.Remove(req.Key)
+		case "keys":
+			resp.Keys, err = k.Keys()
+		default:
+			err = fmt.Errorf("unknown operation %q", req.Op)
+		}
+		if err == keyring.ErrKeyNotFound {
+			resp = keyringBridgeResponse{NotFound: true}
+		} else if err != nil {
+			resp = keyringBridgeResponse{Error: err.Error()}
+		}
+
+		if err = enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// BridgeKeyring is a keyring that's served by another process, such as aws-vault on the Windows
+// host of WSL, so that both share the same credentials and sessions. The process is started on
+// first use and talked to over its stdin and stdout, and it exits when they're closed
+type BridgeKeyring struct {
+	Command string
+	Args    []string
+
+	mu    sync.Mutex
+	enc   *json.Encoder
+	dec   *json.Decoder
+	stdin io.Closer
+	cmd   *exec.Cmd
+}
+
+// NewKeyringHelper returns a keyring that's served by a keyring helper, a command run with the shell that
+// serves the operations of a BridgeKeyring, so that secret stores aws-vault doesn't support can be used
+func NewKeyringHelper(command string) *BridgeKeyring {
+	cmd := shellCommand(command)
+	return &BridgeKeyring{Command: cmd.Path, Args: cmd.Args[1:]}
+}
+
+func (k *BridgeKeyring) start() error {
+	if k.enc != nil {
+		return nil
+	}
+
+	log.Printf("Starting keyring bridge %s %s", k.Command, strings.Join(k.Args, " "))
+	cmd := exec.Command(k.Command, k.Args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("Failed to start the keyring bridge %s: %w", k.Command, err)
+	}
+
+	k.enc = json.NewEncoder(stdin)
+	k.dec = json.NewDecoder(stdout)
+	k.stdin = stdin
+	k.cmd = cmd
+	return nil
+}
+
+// stop closes the stdin of the bridge and waits for it to exit, after it failed or a response couldn't be
+// read, so the next call starts it again rather than using a broken pipe or reading the rest of a response
+func (k *BridgeKeyring) stop() {
+	if k.stdin != nil {
+		k.stdin.Close()
+	}
+	if k.cmd != nil {
+		if err := k.cmd.Wait(); err != nil {
+			log.Printf("Keyring bridge %s exited: %s", k.Command, err.Error())
+		}
+	}
+	k.enc, k.dec, k.stdin, k.cmd = nil, nil, nil, nil
+}
+
+func (k *BridgeKeyring) call(req keyringBridgeRequest) (keyringBridgeResponse, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var resp keyringBridgeResponse
+	if err := k.start(); err != nil {
+		return resp, err
+	}
+	if err := k.enc.Encode(req); err != nil {
+		k.stop()
+		return resp, fmt.Errorf("keyring bridge: %w", err)
+	}
+	if err := k.dec.Decode(&resp); err != nil {
+		k.stop()
+		return resp, fmt.Errorf("keyring bridge: %w", err)
+	}
+	if resp.NotFound {
+		return resp, keyring.ErrKeyNotFound
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+func (k *BridgeKeyring) Get(key string) (keyring.Item, error) {
+	resp, err := k.call(keyringBridgeRequest{Op: "get", Key: key})
+	if err != nil || resp.Item == nil {
+		return keyring.Item{}, err
+	}
+	return *resp.Item, nil
+}
+
+func (k *BridgeKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	resp, err := k.call(keyringBridgeRequest{Op: "metadata", Key: key})
+	if err != nil || resp.Metadata == nil {
+		return keyring.Metadata{}, err
+	}
+	return *resp.Metadata, nil
+}
+
+func (k *BridgeKeyring) Set(item keyring.Item) error {
+	_, err := k.call(keyringBridgeRequest{Op: "set", Item: &item})
+	return err
+}
+
+func (k *BridgeKeyring) Remove(key string) error {
+	_, err := k.call(keyringBridgeRequest{Op: "remove", Key: key})
+	return err
+}
+
+func (k *BridgeKeyring) Keys() ([]string, error) {
+	resp, err := k.call(keyringBridgeRequest{Op: "keys"})
+	return resp.Keys, err
+}
@@ -0,0 +1,74 @@
+package vault
+
+import (
+	"encoding/json"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/99designs/keyring"
+)
+
+func TestBridgeKeyring(t *testing.T) {
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	defer reqW.Close()
+
+	served := keyring.NewArrayKeyring(nil)
+	go func() {
+		_ = ServeKeyringBridge(served, reqR, respW)
+	}()
+
+	k := &BridgeKeyring{enc: json.NewEncoder(reqW), dec: json.NewDecoder(respR)}
+
+	if err := k.Set(keyring.Item{Key: "foo", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	item, err := served.Get("foo")
+	if err != nil || string(item.Data) != "secret" {
+		t.Fatalf("Expected the item to be set in the served keyring, got %v, %v", item, err)
+	}
+
+	item, err = k.Get("foo")
+	if err != nil || string(item.Data) != "secret" {
+		t.Fatalf("Expected the item to be read through the bridge, got %v, %v", item, err)
+	}
+	if keys, err := k.Keys(); err != nil || len(keys) != 1 || keys[0] != "foo" {
+		t.Fatalf("Unexpected keys %v, %v", keys, err)
+	}
+	if err = k.Remove("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Get("foo"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestKeyringHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the helper is a shell script")
+	}
+
+	k := NewKeyringHelper(`while read -r req; do echo '{"not_found":true}'; done`)
+	if _, err := k.Get("foo"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound from the helper, got %v", err)
+	}
+}
+
+func TestKeyringHelperRestartsAfterExiting(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the helper is a shell script")
+	}
+
+	// the helper answers a single request, then exits
+	k := NewKeyringHelper(`read -r req; echo '{"not_found":true}'`)
+	if _, err := k.Get("foo"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound from the helper, got %v", err)
+	}
+	if _, err := k.Get("foo"); err == nil || err == keyring.ErrKeyNotFound {
+		t.Fatalf("Expected an error from the helper that exited, got %v", err)
+	}
+	if _, err := k.Get("foo"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected the helper to be started again, got %v", err)
+	}
+}
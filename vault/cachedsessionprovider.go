@@ -16,26 +16,57 @@ type CachedSessionProvider struct {
 	CredentialsFunc func(context.Context) (*ststypes.Credentials, error)
 	Keyring         *SessionKeyring
 	ExpiryWindow    time.Duration
+	// Refresh ignores the cached session, creating a new one that replaces it in the cache
+	Refresh bool
+
+	prefetched prefetchedSession
+	// dependency is prefetched along with the session, such as the SSO token used to create it
+	dependency prefetcher
+}
+
+func (p *CachedSessionProvider) getCached() (*ststypes.Credentials, error) {
+	if p.Refresh {
+		log.Printf("Ignoring cached %s session for %s", p.SessionKey.Type, p.SessionKey.ProfileName)
+		return nil, ErrNotFound
+	}
+	return p.Keyring.Get(p.SessionKey)
+}
+
+// prefetch starts reading the cached session in the background
+func (p *CachedSessionProvider) prefetch() {
+	p.prefetched.start(p.getCached)
+	if p.dependency != nil {
+		p.dependency.prefetch()
+	}
 }
 
 // Retrieve returns cached credentials from the keyring, or if no credentials are cached
 // generates a new set of temporary credentials using the CredentialsFunc
 func (p *CachedSessionProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
-	creds, err := p.Keyring.Get(p.SessionKey)
+	ctx, span := StartSpan(ctx, "cached session "+p.SessionKey.Type)
+	span.SetAttribute("aws_vault.profile", p.SessionKey.ProfileName)
+
+	creds, err := p.prefetched.get(p.getCached)
 
-	if err != nil || time.Until(*creds.Expiration) < p.ExpiryWindow {
+	if err != nil || timeUntil(*creds.Expiration) < p.ExpiryWindow {
 		// lookup missed, we need to create a new one.
+		span.SetAttribute("aws_vault.cache_hit", "false")
 		creds, err = p.CredentialsFunc(ctx)
 		if err != nil {
+			span.End(err)
 			return aws.Credentials{}, err
 		}
 		err = p.Keyring.Set(p.SessionKey, creds)
 		if err != nil {
+			span.End(err)
 			return aws.Credentials{}, err
 		}
 	} else {
-		log.Printf("Re-using cached credentials %s from %s, expires in %s", FormatKeyForDisplay(*creds.AccessKeyId), p.SessionKey.Type, time.Until(*creds.Expiration).String())
+		span.SetAttribute("aws_vault.cache_hit", "true")
+		expiresIn := timeUntil(*creds.Expiration)
+		logf(LogFields{Profile: p.SessionKey.ProfileName, Duration: expiresIn}, "Re-using cached credentials %s from %s, expires in %s", FormatKeyForDisplay(*creds.AccessKeyId), p.SessionKey.Type, expiresIn.String())
 	}
+	span.End(nil)
 
 	return aws.Credentials{
 		AccessKeyID:     aws.ToString(creds.AccessKeyId),
@@ -0,0 +1,159 @@
+package vault
+
+import (
+	"fmt"
+	"time"
+)
+
+// ChainLink describes one of the steps taken to get credentials for a profile
+type ChainLink struct {
+	// ProfileName is the profile the step belongs to
+	ProfileName string
+
+	// Type is the kind of step, e.g. "sts.AssumeRole" or "stored credentials"
+	Type string
+
+	// Detail is extra information for the step, such as the role ARN
+	Detail string
+
+	// MfaSerial is the MFA device required by the step, if any
+	MfaSerial string
+
+	// MfaChained is set when the MFA of an earlier GetSessionToken step is reused
+	MfaChained bool
+
+	// Missing is set when the step can't be taken, e.g. when stored credentials are missing
+	Missing bool
+
+	// Duration is the duration of the session requested by the step, if it requests one
+	Duration time.Duration
+
+	// DurationError is set when the duration is outside the range AWS allows for the step
+	DurationError error
+
+	// SessionKey is the key the session of the step is cached under, or nil when it isn't cached
+	SessionKey *SessionMetadata
+}
+
+// DescribeChain returns the steps used to get credentials for the profile, starting with the
+// source credentials. It follows the same logic as NewTempCredentialsProvider without creating
+// any providers or making any requests
+func DescribeChain(config *Config, k *CredentialKeyring) ([]ChainLink, error) {
+	d := chainDescriber{keyring: k}
+	return d.describe(config)
+}
+
+type chainDescriber struct {
+	keyring    *CredentialKeyring
+	chainedMfa string
+}
+
+func (d *chainDescriber) describe(config *Config) ([]ChainLink, error) {
+	if config.HasFakeCredentials() {
+		return []ChainLink{{
+			ProfileName: config.ProfileName,
+			Type:        "fake credentials",
+		}}, nil
+	}
+
+	if config.HasSSOStartURL() || config.HasSSOSession() {
+		return []ChainLink{{
+			ProfileName: config.ProfileName,
+			Type:        "sso.GetRoleCredentials",
+			Detail:      fmt.Sprintf("%s/%s", config.SSOAccountID, config.SSORoleName),
+			SessionKey:  cachedSessionKey(config, ssoRoleSessionKey(config)),
+		}}, nil
+	}
+
+	if config.HasWebIdentity() {
+		return []ChainLink{{
+			ProfileName:   config.ProfileName,
+			Type:          "sts.AssumeRoleWithWebIdentity",
+			Detail:        config.RoleARN,
+			Duration:      config.AssumeRoleDuration,
+			DurationError: checkSessionDuration(config, "AssumeRoleWithWebIdentity", config.AssumeRoleDuration, MaxAssumeRoleDuration),
+			SessionKey:    cachedSessionKey(config, webIdentitySessionKey(config)),
+		}}, nil
+	}
+
+	if config.HasCredentialProcess() {
+		return []ChainLink{{
+			ProfileName: config.ProfileName,
+			Type:        "credential_process",
+			Detail:      config.CredentialProcess,
+			SessionKey:  cachedSessionKey(config, credentialProcessSessionKey(config)),
+		}}, nil
+	}
+
+	if config.HasCredentialPlugin() {
+		return []ChainLink{{
+			ProfileName: config.ProfileName,
+			Type:        "credential_plugin",
+			Detail:      config.CredentialPlugin,
+			SessionKey:  cachedSessionKey(config, credentialPluginSessionKey(config)),
+		}}, nil
+	}
+
+	var links []ChainLink
+	if config.HasSourceProfile() {
+		sourceLinks, err := d.describe(config.SourceProfile)
+		if err != nil {
+			return nil, err
+		}
+		links = sourceLinks
+	} else {
+		hasStoredCredentials, err := d.keyring.Has(config.ProfileName)
+		if err != nil {
+			return nil, err
+		}
+		links = []ChainLink{{
+			ProfileName: config.ProfileName,
+			Type:        "stored credentials",
+			Missing:     !hasStoredCredentials,
+		}}
+	}
+
+	if config.HasRole() {
+		isMfaChained := config.MfaSerial != "" && config.MfaSerial == d.chainedMfa
+		link := ChainLink{
+			ProfileName: config.ProfileName,
+			Type:        "sts.AssumeRole",
+			Detail:      config.RoleARN,
+			MfaSerial:   config.MfaSerial,
+			MfaChained:  isMfaChained,
+			Duration:    config.AssumeRoleDuration,
+		}
+		if config.isRoleChained() {
+			link.DurationError = checkSessionDuration(config, "assuming a role with the credentials of another role", config.AssumeRoleDuration, roleChainingMaximumDuration)
+		} else {
+			link.DurationError = checkSessionDuration(config, "AssumeRole", config.AssumeRoleDuration, MaxAssumeRoleDuration)
+		}
+		// as with NewAssumeRoleProvider, only roles assumed with an MFA of their own are cached
+		if config.MfaSerial != "" && !isMfaChained {
+			link.SessionKey = cachedSessionKey(config, assumeRoleSessionKey(config))
+		}
+		return append(links, link), nil
+	}
+
+	if canUseGetSessionToken, _ := config.CanUseGetSessionToken(); canUseGetSessionToken {
+		d.chainedMfa = config.MfaSerial
+		return append(links, ChainLink{
+			ProfileName:   config.ProfileName,
+			Type:          "sts.GetSessionToken",
+			MfaSerial:     config.MfaSerial,
+			Duration:      config.GetSessionTokenDuration(),
+			DurationError: checkSessionDuration(config, "GetSessionToken", config.GetSessionTokenDuration(), MaxSessionTokenDuration),
+			SessionKey:    cachedSessionKey(config, sessionTokenSessionKey(config)),
+		}), nil
+	}
+
+	return links, nil
+}
+
+// cachedSessionKey is the key when sessions are cached, or nil when they're not
+func cachedSessionKey(config *Config, key SessionMetadata) *SessionMetadata {
+	if !config.useSessionCache() {
+		return nil
+	}
+	return &key
+}
@@ -0,0 +1,78 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// clockSkewThreshold is the smallest difference from the AWS clock that's treated as skew, as the Date header
+// only has a resolution of a second and is delayed by the network
+const clockSkewThreshold = 30 * time.Second
+
+// clockSkew is the difference of the AWS clock from the local clock, in nanoseconds
+var clockSkew int64
+
+// ClockSkew returns how far ahead of the local clock AWS was in the last response, or 0 if the
+// clocks are in sync or no response has been received yet
+func ClockSkew() time.Duration {
+	return time.Duration(atomic.LoadInt64(&clockSkew))
+}
+
+// now returns the current time according to AWS
+func now() time.Time {
+	return time.Now().Add(ClockSkew())
+}
+
+// timeUntil returns the duration until t according to AWS, so that expiration times are compared with the
+// clock that decides when credentials expire
+func timeUntil(t time.Time) time.Duration {
+	return t.Sub(now())
+}
+
+func recordClockSkew(resp *smithyhttp.Response, receivedAt time.Time) {
+	serverTime, err := smithyhttp.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	skew := serverTime.Sub(receivedAt)
+	if skew > -clockSkewThreshold && skew < clockSkewThreshold {
+		skew = 0
+	}
+	atomic.StoreInt64(&clockSkew, int64(skew))
+}
+
+// describeClockSkew describes the skew for error messages, e.g. "3m0s behind AWS"
+func describeClockSkew(skew time.Duration) string {
+	if skew > 0 {
+		return fmt.Sprintf("%s behind AWS", skew.Truncate(time.Second))
+	}
+	return fmt.Sprintf("%s ahead of AWS", (-skew).Truncate(time.Second))
+}
+
+// detectClockSkew is an SDK API option that records the skew of the local clock from the Date header of
+// responses, and explains errors that are likely caused by it, such as rejected signatures and MFA codes
+func detectClockSkew(stack *middleware.Stack) error {
+	err := stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc("AwsVaultRecordClockSkew", func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+		out, md, err := next.HandleDeserialize(ctx, in)
+		if resp, ok := out.RawResponse.(*smithyhttp.Response); ok {
+			recordClockSkew(resp, time.Now())
+		}
+		return out, md, err
+	}), middleware.After)
+	if err != nil {
+		return err
+	}
+
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("AwsVaultExplainClockSkew", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		out, md, err := next.HandleInitialize(ctx, in)
+		if skew := ClockSkew(); err != nil && skew != 0 {
+			err = fmt.Errorf("%w. The local clock is %s, which can cause signatures and MFA codes to be rejected. Synchronise your clock, e.g. by enabling NTP", err, describeClockSkew(skew))
+		}
+		return out, md, err
+	}), middleware.Before)
+}
@@ -0,0 +1,40 @@
+package vault
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func TestRecordClockSkew(t *testing.T) {
+	defer func() { clockSkew = 0 }()
+
+	receivedAt := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		serverTime time.Time
+		expected   time.Duration
+	}{
+		{receivedAt.Add(10 * time.Second), 0},
+		{receivedAt.Add(7 * time.Minute), 7 * time.Minute},
+		{receivedAt.Add(-2 * time.Minute), -2 * time.Minute},
+	} {
+		resp := &smithyhttp.Response{Response: &http.Response{Header: http.Header{}}}
+		resp.Header.Set("Date", tc.serverTime.Format(http.TimeFormat))
+
+		recordClockSkew(resp, receivedAt)
+		if ClockSkew() != tc.expected {
+			t.Errorf("Expected a skew of %s for a server time of %s, got %s", tc.expected, tc.serverTime, ClockSkew())
+		}
+	}
+}
+
+func TestDescribeClockSkew(t *testing.T) {
+	if s := describeClockSkew(7 * time.Minute); s != "7m0s behind AWS" {
+		t.Errorf("Unexpected description %q", s)
+	}
+	if s := describeClockSkew(-90 * time.Second); s != "1m30s ahead of AWS" {
+		t.Errorf("Unexpected description %q", s)
+	}
+}
@@ -1,13 +1,16 @@
 package vault
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode"
 
 	ini "gopkg.in/ini.v1"
 )
@@ -23,40 +26,59 @@ const (
 	roleChainingMaximumDuration = 1 * time.Hour
 )
 
-// UseSession will disable the use of GetSessionToken when set to false
-var UseSession = true
-
 func init() {
 	ini.PrettyFormat = false
 }
 
-// ConfigFile is an abstraction over what is in ~/.aws/config
+var iniLoadOptions = ini.LoadOptions{
+	AllowNestedValues:   true,
+	InsensitiveSections: false,
+	InsensitiveKeys:     true,
+}
+
+// ConfigFile is an abstraction over what is in ~/.aws/config. To keep startup fast with large
+// config files, only the section headers are read up front, and sections are parsed when first used
 type ConfigFile struct {
-	Path    string
+	// Path is the file that changes are written to, the last of Paths
+	Path string
+	// Paths are the files that are merged, in order of precedence, with settings in later files
+	// overriding those in earlier ones
+	Paths   []string
 	iniFile *ini.File
+
+	// sectionNames are in the order they first appear
+	sectionNames []string
+	// sections holds the text of each section, including its header. A section that appears
+	// more than once has the text of each occurrence, as the ini parser merges them
+	sections map[string][]byte
+
+	profileSections    map[string]*ProfileSection
+	ssoSessionSections map[string]*SSOSessionSection
+	hooksSection       *HooksSection
 }
 
-// configPath returns either $AWS_CONFIG_FILE or ~/.aws/config
-func configPath() (string, error) {
-	file := os.Getenv("AWS_CONFIG_FILE")
-	if file == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", err
+// configPaths returns either the files listed in $AWS_CONFIG_FILE, separated like PATH, or ~/.aws/config
+func configPaths() ([]string, error) {
+	paths := []string{}
+	for _, file := range filepath.SplitList(os.Getenv("AWS_CONFIG_FILE")) {
+		if file != "" {
+			paths = append(paths, file)
 		}
-		file = filepath.Join(home, "/.aws/config")
-	} else {
-		log.Printf("Using AWS_CONFIG_FILE value: %s", file)
 	}
-	return file, nil
-}
+	if len(paths) > 0 {
+		log.Printf("Using AWS_CONFIG_FILE value: %s", strings.Join(paths, string(os.PathListSeparator)))
+		return paths, nil
+	}
 
-// createConfigFilesIfMissing will create the config directory and file if they do not exist
-func createConfigFilesIfMissing() error {
-	file, err := configPath()
+	home, err := os.UserHomeDir()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return []string{filepath.Join(home, "/.aws/config")}, nil
+}
+
+// createConfigFilesIfMissing will create the config directory and file if they do not exist
+func createConfigFilesIfMissing(file string) error {
 	dir := filepath.Dir(file)
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		err = os.Mkdir(dir, 0700)
@@ -79,76 +101,278 @@ func createConfigFilesIfMissing() error {
 
 // LoadConfig loads and parses a config file. No error is returned if the file doesn't exist
 func LoadConfig(path string) (*ConfigFile, error) {
+	return LoadConfigFiles([]string{path})
+}
+
+// LoadConfigFiles loads and merges the config files, with settings in later files overriding those in
+// earlier ones. The last file is the one changes are written to, and is created if it doesn't exist.
+// Earlier files that don't exist are skipped
+func LoadConfigFiles(paths []string) (*ConfigFile, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("No config files to load")
+	}
 	config := &ConfigFile{
-		Path: path,
+		Path: paths[len(paths)-1],
 	}
-	if _, err := os.Stat(path); err == nil {
-		if parseErr := config.parseFile(); parseErr != nil {
-			return nil, parseErr
+	for _, path := range paths[:len(paths)-1] {
+		if _, err := os.Stat(path); err != nil {
+			log.Printf("Skipping config file %s: %s", path, err)
+			continue
 		}
-	} else {
-		log.Printf("Config file %s doesn't exist so lets create it", path)
-		err := createConfigFilesIfMissing()
-		if err != nil {
+		config.Paths = append(config.Paths, path)
+	}
+	config.Paths = append(config.Paths, config.Path)
+
+	if _, err := os.Stat(config.Path); err != nil {
+		log.Printf("Config file %s doesn't exist so lets create it", config.Path)
+		if err := createConfigFilesIfMissing(config.Path); err != nil {
 			return nil, err
 		}
-		if parseErr := config.parseFile(); parseErr != nil {
-			return nil, parseErr
-		}
+	}
+	if err := config.parseFile(); err != nil {
+		return nil, err
 	}
 	return config, nil
 }
 
-// LoadConfigFromEnv finds the config file from the environment
+// LoadConfigFromEnv finds the config files from the environment
 func LoadConfigFromEnv() (*ConfigFile, error) {
-	file, err := configPath()
+	paths, err := configPaths()
 	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("Loading config file %s", file)
-	return LoadConfig(file)
+	log.Printf("Loading config files %s", strings.Join(paths, ", "))
+	return LoadConfigFiles(paths)
 }
 
+// utf8BOM is the byte order mark some editors, such as Notepad, start files with
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// iniLineScanner finds the section headers of an ini file a line at a time, as the ini parser does. It
+// tracks values that span lines, so that a line of a multi-line value isn't taken for a section header
+type iniLineScanner struct {
+	// multilineQuote is the quote that ends the multi-line value being read, """ or `
+	multilineQuote string
+	// continuation is set when the value continues on the next line, as it ended with a backslash
+	continuation bool
+	// nestedValues is set when the last key had no value, so indented lines are nested values
+	nestedValues bool
+}
+
+// sectionHeader returns the name of the section if the line is a section header
+func (s *iniLineScanner) sectionHeader(line []byte) (string, bool) {
+	if s.multilineQuote != "" {
+		if bytes.Contains(line, []byte(s.multilineQuote)) {
+			s.multilineQuote = ""
+		}
+		return "", false
+	}
+	if s.continuation {
+		next := bytes.TrimSpace(line)
+		s.continuation = len(next) > 0 && next[len(next)-1] == '\\'
+		return "", false
+	}
+	if s.nestedValues && len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+		return "", false
+	}
+
+	line = bytes.TrimLeftFunc(line, unicode.IsSpace)
+	if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+		return "", false
+	}
+	if line[0] == '[' {
+		end := bytes.LastIndexByte(line, ']')
+		if end < 0 {
+			return "", false
+		}
+		s.nestedValues = false
+		return string(line[1:end]), true
+	}
+
+	s.scanValue(line)
+	return "", false
+}
+
+// scanValue looks at the value of a key for the start of a value spanning lines
+func (s *iniLineScanner) scanValue(line []byte) {
+	delim := bytes.IndexAny(line, "=:")
+	if line[0] == '"' || line[0] == '`' {
+		// the key is quoted, so the delimiter is after the closing quote
+		quote := line[:1]
+		if bytes.HasPrefix(line, []byte(`"""`)) {
+			quote = line[:3]
+		}
+		if end := bytes.Index(line[len(quote):], quote); end >= 0 {
+			if i := bytes.IndexAny(line[len(quote)+end+len(quote):], "=:"); i >= 0 {
+				delim = len(quote) + end + len(quote) + i
+			}
+		}
+	}
+	if delim < 0 {
+		return
+	}
+
+	value := bytes.TrimLeftFunc(line[delim+1:], unicode.IsSpace)
+	s.nestedValues = len(value) == 0
+	switch {
+	case len(value) > 3 && bytes.HasPrefix(value, []byte(`"""`)):
+		if !bytes.Contains(value[3:], []byte(`"""`)) {
+			s.multilineQuote = `"""`
+		}
+	case len(value) > 0 && value[0] == '`':
+		if !bytes.Contains(value[1:], []byte("`")) {
+			s.multilineQuote = "`"
+		}
+	default:
+		value = bytes.TrimSpace(value)
+		s.continuation = len(value) > 0 && value[len(value)-1] == '\\'
+	}
+}
+
+// parseFile reads the files and splits them into sections, without parsing them. Sections in more than
+// one file have the text of each, in the order of the files, so later settings override earlier ones
 func (c *ConfigFile) parseFile() error {
-	log.Printf("Parsing config file %s", c.Path)
+	c.iniFile = nil
+	c.sectionNames = []string{}
+	c.sections = map[string][]byte{}
+	c.profileSections = map[string]*ProfileSection{}
+	c.ssoSessionSections = map[string]*SSOSessionSection{}
+	c.hooksSection = nil
 
-	f, err := ini.LoadSources(ini.LoadOptions{
-		AllowNestedValues:   true,
-		InsensitiveSections: false,
-		InsensitiveKeys:     true,
-	}, c.Path)
-	if err != nil {
-		return fmt.Errorf("Error parsing config file %s: %w", c.Path, err)
+	for _, path := range c.paths() {
+		log.Printf("Reading config file %s", path)
+
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Error reading config file %s: %w", path, err)
+		}
+		contents = bytes.TrimPrefix(contents, utf8BOM)
+
+		scanner := iniLineScanner{}
+		current := ""
+		for len(contents) > 0 {
+			line := contents
+			if i := bytes.IndexByte(contents, '\n'); i >= 0 {
+				line = contents[:i+1]
+			}
+			contents = contents[len(line):]
+			if line[len(line)-1] != '\n' {
+				// the section may continue in the next file
+				line = append(line[:len(line):len(line)], '\n')
+			}
+
+			if name, ok := scanner.sectionHeader(line); ok {
+				current = name
+				if _, seen := c.sections[name]; !seen {
+					c.sectionNames = append(c.sectionNames, name)
+				}
+			}
+			// lines before the first section aren't part of any profile
+			if current != "" {
+				c.sections[current] = append(c.sections[current], line...)
+			}
+		}
 	}
-	c.iniFile = f
+
 	return nil
 }
 
+// paths are the files of the config, which is only Path when it wasn't loaded with LoadConfigFiles
+func (c *ConfigFile) paths() []string {
+	if len(c.Paths) == 0 {
+		return []string{c.Path}
+	}
+	return c.Paths
+}
+
+// parseSection parses the named section and maps it to v
+func (c *ConfigFile) parseSection(name string, v interface{}) (bool, error) {
+	text, ok := c.sections[name]
+	if !ok {
+		return false, nil
+	}
+
+	f, err := ini.LoadSources(iniLoadOptions, text)
+	if err != nil {
+		return false, fmt.Errorf("Error parsing section [%s] of config file %s: %w", name, strings.Join(c.paths(), ", "), err)
+	}
+	section, err := f.GetSection(name)
+	if err != nil {
+		return false, nil
+	}
+	if err = section.MapTo(v); err != nil {
+		return false, fmt.Errorf("Error parsing section [%s] of config file %s: %w", name, strings.Join(c.paths(), ", "), err)
+	}
+	return true, nil
+}
+
+// ini parses the whole file, which is only needed to change it
+func (c *ConfigFile) ini() (*ini.File, error) {
+	if c.iniFile == nil {
+		log.Printf("Parsing config file %s", c.Path)
+		f, err := ini.LoadSources(iniLoadOptions, c.Path)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing config file %s: %w", c.Path, err)
+		}
+		c.iniFile = f
+	}
+	return c.iniFile, nil
+}
+
+// WriteMerged writes the settings of all the files merged into one, for programs that only read one config file
+func (c *ConfigFile) WriteMerged(w io.Writer) error {
+	paths := c.paths()
+	others := []interface{}{}
+	for _, path := range paths[1:] {
+		others = append(others, path)
+	}
+	f, err := ini.LoadSources(iniLoadOptions, paths[0], others...)
+	if err != nil {
+		return fmt.Errorf("Error parsing config files %s: %w", strings.Join(paths, ", "), err)
+	}
+	_, err = f.WriteTo(w)
+	return err
+}
+
 // ProfileSection is a profile section of the config file
 type ProfileSection struct {
-	Name                    string `ini:"-"`
-	MfaSerial               string `ini:"mfa_serial,omitempty"`
-	RoleARN                 string `ini:"role_arn,omitempty"`
-	ExternalID              string `ini:"external_id,omitempty"`
-	Region                  string `ini:"region,omitempty"`
-	RoleSessionName         string `ini:"role_session_name,omitempty"`
-	DurationSeconds         uint   `ini:"duration_seconds,omitempty"`
-	SourceProfile           string `ini:"source_profile,omitempty"`
-	IncludeProfile          string `ini:"include_profile,omitempty"`
-	SSOSession              string `ini:"sso_session,omitempty"`
-	SSOStartURL             string `ini:"sso_start_url,omitempty"`
-	SSORegion               string `ini:"sso_region,omitempty"`
-	SSOAccountID            string `ini:"sso_account_id,omitempty"`
-	SSORoleName             string `ini:"sso_role_name,omitempty"`
-	WebIdentityTokenFile    string `ini:"web_identity_token_file,omitempty"`
-	WebIdentityTokenProcess string `ini:"web_identity_token_process,omitempty"`
-	STSRegionalEndpoints    string `ini:"sts_regional_endpoints,omitempty"`
-	SessionTags             string `ini:"session_tags,omitempty"`
-	TransitiveSessionTags   string `ini:"transitive_session_tags,omitempty"`
-	SourceIdentity          string `ini:"source_identity,omitempty"`
-	CredentialProcess       string `ini:"credential_process,omitempty"`
-	MfaProcess              string `ini:"mfa_process,omitempty"`
+	Name                     string `ini:"-"`
+	MfaSerial                string `ini:"mfa_serial,omitempty"`
+	RoleARN                  string `ini:"role_arn,omitempty"`
+	ExternalID               string `ini:"external_id,omitempty"`
+	Region                   string `ini:"region,omitempty"`
+	RoleSessionName          string `ini:"role_session_name,omitempty"`
+	DurationSeconds          uint   `ini:"duration_seconds,omitempty"`
+	SourceProfile            string `ini:"source_profile,omitempty"`
+	IncludeProfile           string `ini:"include_profile,omitempty"`
+	SSOSession               string `ini:"sso_session,omitempty"`
+	SSOStartURL              string `ini:"sso_start_url,omitempty"`
+	SSORegion                string `ini:"sso_region,omitempty"`
+	SSOAccountID             string `ini:"sso_account_id,omitempty"`
+	SSORoleName              string `ini:"sso_role_name,omitempty"`
+	WebIdentityTokenFile     string `ini:"web_identity_token_file,omitempty"`
+	WebIdentityTokenProcess  string `ini:"web_identity_token_process,omitempty"`
+	STSRegionalEndpoints     string `ini:"sts_regional_endpoints,omitempty"`
+	SessionTags              string `ini:"session_tags,omitempty"`
+	TransitiveSessionTags    string `ini:"transitive_session_tags,omitempty"`
+	SourceIdentity           string `ini:"source_identity,omitempty"`
+	CredentialProcess        string `ini:"credential_process,omitempty"`
+	CredentialPlugin         string `ini:"credential_plugin,omitempty"`
+	MfaProcess               string `ini:"mfa_process,omitempty"`
+	PromptCommand            string `ini:"prompt_command,omitempty"`
+	SessionPolicy            string `ini:"session_policy,omitempty"`
+	SessionPolicyARNs        string `ini:"session_policy_arns,omitempty"`
+	FederationEndpoint       string `ini:"federation_endpoint,omitempty"`
+	RequireApproval          bool   `ini:"require_approval,omitempty"`
+	CredentialsIssuedWebhook string `ini:"credentials_issued_webhook,omitempty"`
+	CredentialsIssuedCommand string `ini:"credentials_issued_command,omitempty"`
+	RenewBefore              string `ini:"renew_before,omitempty"`
+	ShellRC                  string `ini:"shell_rc,omitempty"`
+	SSOBrowserCommand        string `ini:"sso_browser_command,omitempty"`
+	HTTPSProxy               string `ini:"https_proxy,omitempty"`
+	NoProxy                  string `ini:"no_proxy,omitempty"`
+	CredentialType           string `ini:"credential_type,omitempty"`
 }
 
 // SSOSessionSection is a [sso-session] section of the config file
@@ -157,6 +381,7 @@ type SSOSessionSection struct {
 	SSOStartURL           string `ini:"sso_start_url,omitempty"`
 	SSORegion             string `ini:"sso_region,omitempty"`
 	SSORegistrationScopes string `ini:"sso_registration_scopes,omitempty"`
+	SSOBrowserCommand     string `ini:"sso_browser_command,omitempty"`
 }
 
 func (s ProfileSection) IsEmpty() bool {
@@ -168,10 +393,7 @@ func (s ProfileSection) IsEmpty() bool {
 func (c *ConfigFile) ProfileSections() []ProfileSection {
 	result := []ProfileSection{}
 
-	if c.iniFile == nil {
-		return result
-	}
-	for _, section := range c.iniFile.SectionStrings() {
+	for _, section := range c.sectionNames {
 		if section == defaultSectionName || strings.HasPrefix(section, "profile ") {
 			profile, _ := c.ProfileSection(strings.TrimPrefix(section, "profile "))
 
@@ -181,7 +403,7 @@ func (c *ConfigFile) ProfileSections() []ProfileSection {
 			}
 
 			result = append(result, profile)
-		} else if strings.HasPrefix(section, "sso-session ") {
+		} else if strings.HasPrefix(section, "sso-session ") || section == hooksSectionName {
 			// Not a profile
 			continue
 		} else {
@@ -196,62 +418,95 @@ func (c *ConfigFile) ProfileSections() []ProfileSection {
 // ProfileSection returns the profile section with the matching name. If there isn't any,
 // an empty profile with the provided name is returned, along with false.
 func (c *ConfigFile) ProfileSection(name string) (ProfileSection, bool) {
+	profile, ok, err := c.loadProfileSection(name)
+	if err != nil {
+		log.Println(err.Error())
+	}
+	return profile, ok
+}
+
+// loadProfileSection parses the profile section the first time it's used, and caches it
+func (c *ConfigFile) loadProfileSection(name string) (ProfileSection, bool, error) {
+	if cached, ok := c.profileSections[name]; ok {
+		if cached == nil {
+			return ProfileSection{Name: name}, false, nil
+		}
+		return *cached, true, nil
+	}
+
 	profile := ProfileSection{
 		Name: name,
 	}
-	if c.iniFile == nil {
-		return profile, false
+	if c.sections == nil {
+		return profile, false, nil
 	}
 	// default profile name has a slightly different section format
 	sectionName := "profile " + name
 	if name == defaultSectionName {
 		sectionName = defaultSectionName
 	}
-	section, err := c.iniFile.GetSection(sectionName)
+	ok, err := c.parseSection(sectionName, &profile)
 	if err != nil {
-		return profile, false
+		return ProfileSection{Name: name}, false, err
 	}
-	if err = section.MapTo(&profile); err != nil {
-		panic(err)
+	if !ok {
+		c.profileSections[name] = nil
+		return profile, false, nil
 	}
-	return profile, true
+	c.profileSections[name] = &profile
+	return profile, true, nil
 }
 
 // SSOSessionSection returns the [sso-session] section with the matching name. If there isn't any,
 // an empty sso-session with the provided name is returned, along with false.
 func (c *ConfigFile) SSOSessionSection(name string) (SSOSessionSection, bool) {
+	if cached, ok := c.ssoSessionSections[name]; ok {
+		if cached == nil {
+			return SSOSessionSection{Name: name}, false
+		}
+		return *cached, true
+	}
+
 	ssoSession := SSOSessionSection{
 		Name: name,
 	}
-	if c.iniFile == nil {
+	if c.sections == nil {
 		return ssoSession, false
 	}
-	sectionName := "sso-session " + name
-	section, err := c.iniFile.GetSection(sectionName)
+	ok, err := c.parseSection("sso-session "+name, &ssoSession)
 	if err != nil {
+		log.Println(err.Error())
 		return ssoSession, false
 	}
-	if err = section.MapTo(&ssoSession); err != nil {
-		panic(err)
+	if !ok {
+		c.ssoSessionSections[name] = nil
+		return ssoSession, false
 	}
+	c.ssoSessionSections[name] = &ssoSession
 	return ssoSession, true
 }
 
 func (c *ConfigFile) Save() error {
-	return c.iniFile.SaveTo(c.Path)
+	f, err := c.ini()
+	if err != nil {
+		return err
+	}
+	if err = f.SaveTo(c.Path); err != nil {
+		return err
+	}
+	return c.parseFile()
 }
 
 // Add the profile to the configuration file
 func (c *ConfigFile) Add(profile ProfileSection) error {
-	if c.iniFile == nil {
+	if c.sections == nil {
 		return errors.New("No iniFile to add to")
 	}
-	// default profile name has a slightly different section format
-	sectionName := "profile " + profile.Name
-	if profile.Name == defaultSectionName {
-		sectionName = defaultSectionName
+	iniFile, err := c.ini()
+	if err != nil {
+		return err
 	}
-	section, err := c.iniFile.NewSection(sectionName)
+	section, err := iniFile.NewSection(profileSectionName(profile.Name))
 	if err != nil {
 		return fmt.Errorf("Error creating section %q: %v", profile.Name, err)
 	}
@@ -261,6 +516,61 @@ func (c *ConfigFile) Add(profile ProfileSection) error {
 	return c.Save()
 }
 
+// profileSectionName is the name of the section of a profile, the default profile has a slightly different format
+func profileSectionName(name string) string {
+	if name == defaultSectionName {
+		return defaultSectionName
+	}
+	return "profile " + name
+}
+
+// ManagedProfileMarker is the comment on profile sections written by aws-vault configure-cli
+const ManagedProfileMarker = "; managed by aws-vault configure-cli, changes will be overwritten"
+
+// IsManagedProfile is whether the profile section was written by aws-vault configure-cli
+func (c *ConfigFile) IsManagedProfile(name string) (bool, error) {
+	iniFile, err := c.ini()
+	if err != nil {
+		return false, err
+	}
+	section, err := iniFile.GetSection(profileSectionName(name))
+	if err != nil {
+		return false, nil
+	}
+	return strings.Contains(section.Comment, ManagedProfileMarker), nil
+}
+
+// SetManagedProfile creates or replaces a profile section written by aws-vault configure-cli. A section
+// that exists without the marker belongs to the user, and is left alone with an error. Use Save to write the file
+func (c *ConfigFile) SetManagedProfile(profile ProfileSection) error {
+	if c.sections == nil {
+		return errors.New("No iniFile to add to")
+	}
+	iniFile, err := c.ini()
+	if err != nil {
+		return err
+	}
+
+	sectionName := profileSectionName(profile.Name)
+	section, err := iniFile.GetSection(sectionName)
+	if err == nil {
+		if !strings.Contains(section.Comment, ManagedProfileMarker) {
+			return fmt.Errorf("Profile %s already exists and wasn't created by configure-cli", profile.Name)
+		}
+		for _, key := range section.KeyStrings() {
+			section.DeleteKey(key)
+		}
+	} else if section, err = iniFile.NewSection(sectionName); err != nil {
+		return fmt.Errorf("Error creating section %q: %v", profile.Name, err)
+	}
+
+	section.Comment = ManagedProfileMarker
+	if err = section.ReflectFrom(&profile); err != nil {
+		return fmt.Errorf("Error mapping profile to ini file: %v", err)
+	}
+	return nil
+}
+
 // ProfileNames returns a slice of profile names from the AWS config
 func (c *ConfigFile) ProfileNames() []string {
 	profileNames := []string{}
@@ -312,7 +622,10 @@ func (cl *ConfigLoader) populateFromConfigFile(config *Config, profileName strin
 		return fmt.Errorf("Loop detected in config file for profile '%s'", profileName)
 	}
 
-	psection, ok := cl.File.ProfileSection(profileName)
+	psection, ok, err := cl.File.loadProfileSection(profileName)
+	if err != nil {
+		return err
+	}
 	if !ok {
 		// ignore missing profiles
 		log.Printf("Profile '%s' missing in config file", profileName)
@@ -336,9 +649,16 @@ func (cl *ConfigLoader) populateFromConfigFile(config *Config, profileName strin
 	if config.AssumeRoleDuration == 0 {
 		config.AssumeRoleDuration = time.Duration(psection.DurationSeconds) * time.Second
 	}
+	if config.NonChainedGetSessionTokenDuration == 0 && psection.RoleARN == "" {
+		// profiles without a role use duration_seconds for their GetSessionToken session
+		config.NonChainedGetSessionTokenDuration = time.Duration(psection.DurationSeconds) * time.Second
+	}
 	if config.SourceProfileName == "" {
 		config.SourceProfileName = psection.SourceProfile
 	}
+	if config.SSOBrowserCommand == "" {
+		config.SSOBrowserCommand = psection.SSOBrowserCommand
+	}
 	if config.SSOSession == "" {
 		config.SSOSession = psection.SSOSession
 		if psection.SSOSession != "" {
@@ -348,6 +668,9 @@ func (cl *ConfigLoader) populateFromConfigFile(config *Config, profileName strin
 				config.SSOStartURL = ssoSection.SSOStartURL
 				config.SSORegion = ssoSection.SSORegion
 				config.SSORegistrationScopes = ssoSection.SSORegistrationScopes
+				if config.SSOBrowserCommand == "" {
+					config.SSOBrowserCommand = ssoSection.SSOBrowserCommand
+				}
 			} else {
 				// ignore missing profiles
 				log.Printf("[sso-session] '%s' missing in config file", psection.SSOSession)
@@ -381,9 +704,21 @@ func (cl *ConfigLoader) populateFromConfigFile(config *Config, profileName strin
 	if config.CredentialProcess == "" {
 		config.CredentialProcess = psection.CredentialProcess
 	}
+	if config.CredentialPlugin == "" {
+		config.CredentialPlugin = psection.CredentialPlugin
+	}
 	if config.MfaProcess == "" {
 		config.MfaProcess = psection.MfaProcess
 	}
+	if config.PromptCommand == "" {
+		config.PromptCommand = psection.PromptCommand
+	}
+	if config.CredentialType == "" {
+		if psection.CredentialType != "" && psection.CredentialType != CredentialTypeFake {
+			return fmt.Errorf("Invalid credential_type %q in profile '%s', the only type is %s", psection.CredentialType, profileName, CredentialTypeFake)
+		}
+		config.CredentialType = psection.CredentialType
+	}
 	if sessionTags := psection.SessionTags; sessionTags != "" && config.SessionTags == nil {
 		err := config.SetSessionTags(sessionTags)
 		if err != nil {
@@ -393,6 +728,40 @@ func (cl *ConfigLoader) populateFromConfigFile(config *Config, profileName strin
 	if transitiveSessionTags := psection.TransitiveSessionTags; transitiveSessionTags != "" && config.TransitiveSessionTags == nil {
 		config.SetTransitiveSessionTags(transitiveSessionTags)
 	}
+	if config.SessionPolicy == "" {
+		config.SessionPolicy = psection.SessionPolicy
+	}
+	if sessionPolicyARNs := psection.SessionPolicyARNs; sessionPolicyARNs != "" && config.SessionPolicyARNs == nil {
+		config.SetSessionPolicyARNs(sessionPolicyARNs)
+	}
+	if config.FederationEndpoint == "" {
+		config.FederationEndpoint = psection.FederationEndpoint
+	}
+	if !config.RequireApproval {
+		config.RequireApproval = psection.RequireApproval
+	}
+	if config.CredentialsIssuedWebhook == "" {
+		config.CredentialsIssuedWebhook = psection.CredentialsIssuedWebhook
+	}
+	if config.CredentialsIssuedCommand == "" {
+		config.CredentialsIssuedCommand = psection.CredentialsIssuedCommand
+	}
+	if renewBefore := psection.RenewBefore; renewBefore != "" && config.RenewBefore == 0 {
+		d, err := ParseDuration(renewBefore)
+		if err != nil {
+			return fmt.Errorf("Failed to parse renew_before profile setting: %s", err)
+		}
+		config.RenewBefore = d
+	}
+	if config.ShellRC == "" {
+		config.ShellRC = psection.ShellRC
+	}
+	if config.HTTPSProxy == "" {
+		config.HTTPSProxy = psection.HTTPSProxy
+	}
+	if config.NoProxy == "" {
+		config.NoProxy = psection.NoProxy
+	}
 
 	if psection.IncludeProfile != "" {
 		err := cl.populateFromConfigFile(config, psection.IncludeProfile)
@@ -437,28 +806,28 @@ func (cl *ConfigLoader) populateFromEnv(profile *Config) {
 
 	var err error
 	if assumeRoleTTL := os.Getenv("AWS_ASSUME_ROLE_TTL"); assumeRoleTTL != "" && profile.AssumeRoleDuration == 0 {
-		profile.AssumeRoleDuration, err = time.ParseDuration(assumeRoleTTL)
+		profile.AssumeRoleDuration, err = ParseDuration(assumeRoleTTL)
 		if err == nil {
 			log.Printf("Using duration_seconds %q from AWS_ASSUME_ROLE_TTL", profile.AssumeRoleDuration)
 		}
 	}
 
 	if sessionTTL := os.Getenv("AWS_SESSION_TOKEN_TTL"); sessionTTL != "" && profile.NonChainedGetSessionTokenDuration == 0 {
-		profile.NonChainedGetSessionTokenDuration, err = time.ParseDuration(sessionTTL)
+		profile.NonChainedGetSessionTokenDuration, err = ParseDuration(sessionTTL)
 		if err == nil {
 			log.Printf("Using a session duration of %q from AWS_SESSION_TOKEN_TTL", profile.NonChainedGetSessionTokenDuration)
 		}
 	}
 
 	if sessionTTL := os.Getenv("AWS_CHAINED_SESSION_TOKEN_TTL"); sessionTTL != "" && profile.ChainedGetSessionTokenDuration == 0 {
-		profile.ChainedGetSessionTokenDuration, err = time.ParseDuration(sessionTTL)
+		profile.ChainedGetSessionTokenDuration, err = ParseDuration(sessionTTL)
 		if err == nil {
 			log.Printf("Using a cached MFA session duration of %q from AWS_CACHED_SESSION_TOKEN_TTL", profile.ChainedGetSessionTokenDuration)
 		}
 	}
 
 	if federationTokenTTL := os.Getenv("AWS_FEDERATION_TOKEN_TTL"); federationTokenTTL != "" && profile.GetFederationTokenDuration == 0 {
-		profile.GetFederationTokenDuration, err = time.ParseDuration(federationTokenTTL)
+		profile.GetFederationTokenDuration, err = ParseDuration(federationTokenTTL)
 		if err == nil {
 			log.Printf("Using a session duration of %q from AWS_FEDERATION_TOKEN_TTL", profile.GetFederationTokenDuration)
 		}
@@ -521,6 +890,7 @@ func (cl *ConfigLoader) LoadFromProfile(profileName string) (*Config, error) {
 	}
 
 	cl.populateFromDefaults(&config)
+	config.Hooks = cl.File.HooksSection()
 
 	err = cl.hydrateSourceConfig(&config)
 	if err != nil {
@@ -558,6 +928,9 @@ type Config struct {
 	// MfaProcess specifies external command to run to get an MFA token
 	MfaProcess string
 
+	// PromptCommand specifies external command to prompt for MFA codes and approval with, rather than the prompt driver
+	PromptCommand string
+
 	// AssumeRole config
 	RoleARN         string
 	RoleSessionName string
@@ -600,6 +973,9 @@ type Config struct {
 	// SSOUseStdout specifies that the system browser should not be automatically opened
 	SSOUseStdout bool
 
+	// SSOBrowserCommand specifies a command to open the SSO authorization page with, rather than the system browser
+	SSOBrowserCommand string
+
 	// SessionTags specifies assumed role Session Tags
 	SessionTags map[string]string
 
@@ -611,6 +987,67 @@ type Config struct {
 
 	// CredentialProcess specifies external command to run to get an AWS credential
 	CredentialProcess string
+
+	// CredentialPlugin specifies a command speaking the credential plugin protocol to get an AWS credential
+	CredentialPlugin string
+
+	// SessionPolicy specifies an inline IAM policy document used to scope down AssumeRole and GetFederationToken sessions
+	SessionPolicy string
+
+	// SessionPolicyARNs specifies managed IAM policy ARNs used to scope down AssumeRole and GetFederationToken sessions
+	SessionPolicyARNs []string
+
+	// FederationEndpoint overrides the AWS sign-in federation endpoint used to log in to the console
+	FederationEndpoint string
+
+	// RequireApproval asks the user to approve issuing credentials for the profile
+	RequireApproval bool
+
+	// RenewBefore treats cached sessions expiring within this duration as stale
+	RenewBefore time.Duration
+
+	// CredentialsIssuedWebhook is a URL that an event is posted to when credentials are issued
+	CredentialsIssuedWebhook string
+
+	// CredentialsIssuedCommand is a command run with an event on stdin when credentials are issued
+	CredentialsIssuedCommand string
+
+	// Hooks are the commands run for events such as credentials being issued, from the [hooks] section
+	Hooks HooksSection
+
+	// ShellRC is a file sourced by the subshell that exec starts when given no command
+	ShellRC string
+
+	// HTTPSProxy is the proxy for calls to AWS made for the profile, rather than HTTPS_PROXY
+	HTTPSProxy string
+
+	// NoProxy are the hosts that are called without HTTPSProxy, rather than NO_PROXY
+	NoProxy string
+
+	// CredentialType is set to "fake" to give the profile fake credentials, without any requests to AWS
+	CredentialType string
+
+	// NoSession disables GetSessionToken for profiles without a role, set with --no-session
+	NoSession bool
+
+	// NoSessionCache neither reads nor stores sessions and SSO tokens in the keyring
+	NoSessionCache bool
+
+	// RefreshSessions ignores cached sessions, creating new ones that replace them in the cache, set with --no-cache
+	RefreshSessions bool
+
+	// RefreshSSOTokens ignores cached SSO tokens, signing in to SSO again, set with --no-cache-sso
+	RefreshSSOTokens bool
+
+	// SSOFlow is the OAuth flow used to sign in to SSO, SSOFlowDeviceCode when it's empty, set with --sso-flow
+	SSOFlow string
+
+	// SSOEvents receives the progress of signing in to SSO as lines of JSON, set with --sso-json
+	SSOEvents io.Writer
+
+	// NoPrompt makes prompts for MFA codes, approval and signing in to SSO fail with
+	// prompt.ErrInteractionRequired rather than wait for an answer, set with --no-prompt
+	NoPrompt bool
 }
 
 // SetSessionTags parses a comma separated key=vaue string and sets Config.SessionTags map
@@ -636,6 +1073,15 @@ func (c *Config) SetTransitiveSessionTags(s string) {
 	}
 }
 
+// SetSessionPolicyARNs parses a comma separated string and sets Config.SessionPolicyARNs
+func (c *Config) SetSessionPolicyARNs(s string) {
+	for _, arn := range strings.Split(s, ",") {
+		if arn = strings.TrimSpace(arn); arn != "" {
+			c.SessionPolicyARNs = append(c.SessionPolicyARNs, arn)
+		}
+	}
+}
+
 func (c *Config) IsChained() bool {
 	return c.ChainedFromProfile != nil
 }
@@ -664,13 +1110,26 @@ func (c *Config) HasWebIdentity() bool {
 	return c.WebIdentityTokenFile != "" || c.WebIdentityTokenProcess != ""
 }
 
+// useSessionCache is whether sessions and SSO tokens for the profile are cached in the keyring
+func (c *Config) useSessionCache() bool {
+	return !c.NoSessionCache
+}
+
 func (c *Config) HasCredentialProcess() bool {
 	return c.CredentialProcess != ""
 }
 
+func (c *Config) HasCredentialPlugin() bool {
+	return c.CredentialPlugin != ""
+}
+
+func (c *Config) HasSessionPolicy() bool {
+	return c.SessionPolicy != "" || len(c.SessionPolicyARNs) > 0
+}
+
 // CanUseGetSessionToken determines if GetSessionToken should be used, and if not returns a reason
 func (c *Config) CanUseGetSessionToken() (bool, string) {
-	if !UseSession {
+	if c.NoSession {
 		return false, "sessions are disabled"
 	}
 
@@ -695,6 +1154,14 @@ func (c *Config) CanUseGetSessionToken() (bool, string) {
 	return true, ""
 }
 
+// ExpiryWindow is how long before they expire cached sessions are renewed
+func (c *Config) ExpiryWindow() time.Duration {
+	if c.RenewBefore > 0 {
+		return c.RenewBefore
+	}
+	return defaultExpirationWindow
+}
+
 func (c *Config) GetSessionTokenDuration() time.Duration {
 	if c.IsChained() {
 		return c.ChainedGetSessionTokenDuration
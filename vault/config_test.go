@@ -6,8 +6,10 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -616,3 +618,490 @@ source_profile = interim
 		t.Fatalf("Expected transitive_session_tags to be empty, got %+v", baseConfig.TransitiveSessionTags)
 	}
 }
+
+func TestSessionPolicyFromIni(t *testing.T) {
+	f := newConfigFile(t, []byte(`
+[profile readonly]
+session_policy = {"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}
+session_policy_arns = arn:aws:iam::aws:policy/ReadOnlyAccess , arn:aws:iam::aws:policy/job-function/ViewOnlyAccess
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile, ActiveProfile: "readonly"}
+	config, err := configLoader.LoadFromProfile("readonly")
+	if err != nil {
+		t.Fatalf("Should have found a profile: %v", err)
+	}
+
+	expectedSessionPolicy := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}`
+	if config.SessionPolicy != expectedSessionPolicy {
+		t.Fatalf("Expected session_policy: %q, got %q", expectedSessionPolicy, config.SessionPolicy)
+	}
+
+	expectedSessionPolicyARNs := []string{"arn:aws:iam::aws:policy/ReadOnlyAccess", "arn:aws:iam::aws:policy/job-function/ViewOnlyAccess"}
+	if !reflect.DeepEqual(expectedSessionPolicyARNs, config.SessionPolicyARNs) {
+		t.Fatalf("Expected session_policy_arns: %+v, got %+v", expectedSessionPolicyARNs, config.SessionPolicyARNs)
+	}
+}
+
+func TestProfileSectionMergesRepeatedSections(t *testing.T) {
+	f := newConfigFile(t, []byte(`
+[profile foo]
+region = us-east-1
+mfa_serial = arn:aws:iam::123456789:mfa/old
+
+[profile bar]
+region = eu-west-1
+
+[profile foo]
+mfa_serial = arn:aws:iam::123456789:mfa/new
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := vault.ProfileSection{Name: "foo", Region: "us-east-1", MfaSerial: "arn:aws:iam::123456789:mfa/new"}
+	actual, ok := configFile.ProfileSection("foo")
+	if !ok {
+		t.Fatal("Should have found a profile")
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("ProfileSection() mismatch (-expected +actual):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"foo", "bar"}, configFile.ProfileNames()); diff != "" {
+		t.Errorf("ProfileNames() mismatch (-expected +actual):\n%s", diff)
+	}
+}
+
+// The config file is split into sections without parsing it, which has to agree with the ini parser on
+// where each section starts
+func TestConfigSectionsMatchIniParser(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   string
+		expected []string
+		region   string
+	}{
+		{
+			name:     "byte order mark",
+			config:   "\xef\xbb\xbf[profile foo]\nregion = us-east-1\n\n[profile bar]\nregion = eu-west-1\n",
+			expected: []string{"foo", "bar"},
+			region:   "us-east-1",
+		},
+		{
+			name:     "continuation lines",
+			config:   "[profile foo]\nregion = us-east-1\nsession_policy = a \\\n[profile evil]\nregion = eu-west-1\n",
+			expected: []string{"foo"},
+			region:   "eu-west-1",
+		},
+		{
+			name:     "triple quoted values",
+			config:   "[profile foo]\nregion = us-east-1\nsession_policy = \"\"\"{\n[profile evil]\n}\"\"\"\n\n[profile bar]\nregion = eu-west-1\n",
+			expected: []string{"foo", "bar"},
+			region:   "us-east-1",
+		},
+		{
+			name:     "backquoted values",
+			config:   "[profile foo]\nregion = us-east-1\nsession_policy = `{\n[profile evil]\n}`\n",
+			expected: []string{"foo"},
+			region:   "us-east-1",
+		},
+		{
+			name:     "nested values",
+			config:   "[profile foo]\nregion = us-east-1\ns3 =\n  [profile evil]\n  max_concurrent_requests = 20\n\n[profile bar]\n",
+			expected: []string{"foo", "bar"},
+			region:   "us-east-1",
+		},
+		{
+			name:     "headers with comments and indentation",
+			config:   "  [profile foo] ; comment\r\nregion = us-east-1\r\n# [profile evil]\r\n[profile bar]\r\n",
+			expected: []string{"foo", "bar"},
+			region:   "us-east-1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newConfigFile(t, []byte(tc.config))
+			defer os.Remove(f)
+
+			configFile, err := vault.LoadConfig(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, configFile.ProfileNames()); diff != "" {
+				t.Errorf("ProfileNames() mismatch (-expected +actual):\n%s", diff)
+			}
+			profile, ok := configFile.ProfileSection("foo")
+			if !ok || profile.Region != tc.region {
+				t.Errorf("Expected profile foo with region %s, got %+v", tc.region, profile)
+			}
+
+			// the ini parser reading the whole file finds the same profiles
+			var merged bytes.Buffer
+			if err := configFile.WriteMerged(&merged); err != nil {
+				t.Fatal(err)
+			}
+			reparsed := newConfigFile(t, merged.Bytes())
+			defer os.Remove(reparsed)
+			reparsedFile, err := vault.LoadConfig(reparsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, reparsedFile.ProfileNames()); diff != "" {
+				t.Errorf("ProfileNames() of the ini parser's output mismatch (-expected +actual):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFilesMergesFiles(t *testing.T) {
+	base := newConfigFile(t, []byte(`[profile foo]
+region = us-east-1
+mfa_serial = arn:aws:iam::123456789:mfa/base
+
+[profile bar]
+region = eu-west-1`))
+	defer os.Remove(base)
+	override := newConfigFile(t, []byte(`[profile foo]
+region = ap-southeast-2
+
+[profile baz]
+region = us-west-2
+`))
+	defer os.Remove(override)
+
+	configFile, err := vault.LoadConfigFiles([]string{base, "/does/not/exist", override})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configFile.Path != override {
+		t.Errorf("Expected changes to be written to %s, got %s", override, configFile.Path)
+	}
+
+	expected := vault.ProfileSection{Name: "foo", Region: "ap-southeast-2", MfaSerial: "arn:aws:iam::123456789:mfa/base"}
+	actual, _ := configFile.ProfileSection("foo")
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("ProfileSection() mismatch (-expected +actual):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"foo", "bar", "baz"}, configFile.ProfileNames()); diff != "" {
+		t.Errorf("ProfileNames() mismatch (-expected +actual):\n%s", diff)
+	}
+
+	var b bytes.Buffer
+	if err = configFile.WriteMerged(&b); err != nil {
+		t.Fatal(err)
+	}
+	merged := newConfigFile(t, b.Bytes())
+	defer os.Remove(merged)
+	mergedFile, err := vault.LoadConfig(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, _ = mergedFile.ProfileSection("foo")
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("WriteMerged() mismatch (-expected +actual):\n%s", diff)
+	}
+}
+
+func TestLoadConfigFromEnvSplitsPaths(t *testing.T) {
+	base := newConfigFile(t, []byte("[profile foo]\nregion = us-east-1\n"))
+	defer os.Remove(base)
+	override := newConfigFile(t, []byte("[profile bar]\nregion = us-west-2\n"))
+	defer os.Remove(override)
+
+	t.Setenv("AWS_CONFIG_FILE", base+string(os.PathListSeparator)+override)
+	configFile, err := vault.LoadConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{base, override}, configFile.Paths); diff != "" {
+		t.Errorf("Paths mismatch (-expected +actual):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"foo", "bar"}, configFile.ProfileNames()); diff != "" {
+		t.Errorf("ProfileNames() mismatch (-expected +actual):\n%s", diff)
+	}
+}
+
+func TestDurationSecondsOfProfileWithoutRole(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile user]
+duration_seconds = 43200
+
+[profile role]
+source_profile = user
+role_arn = arn:aws:iam::111111111111:role/admin
+duration_seconds = 7200
+`))
+	defer os.Remove(f)
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile}
+
+	config, err := configLoader.LoadFromProfile("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.NonChainedGetSessionTokenDuration != 12*time.Hour {
+		t.Errorf("Expected the GetSessionToken duration of user to be 12h, got %s", config.NonChainedGetSessionTokenDuration)
+	}
+
+	config, err = configLoader.LoadFromProfile("role")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.AssumeRoleDuration != 2*time.Hour || config.NonChainedGetSessionTokenDuration != vault.DefaultSessionDuration {
+		t.Errorf("Expected duration_seconds of role to only set the AssumeRole duration, got %s and %s", config.AssumeRoleDuration, config.NonChainedGetSessionTokenDuration)
+	}
+}
+
+func TestRequireApprovalFromIni(t *testing.T) {
+	f := newConfigFile(t, []byte(`
+[profile prod]
+require_approval = true
+
+[profile prod-admin]
+include_profile = prod
+role_arn = arn:aws:iam::123456789:role/admin
+
+[profile dev]
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile}
+
+	for profile, expected := range map[string]bool{"prod": true, "prod-admin": true, "dev": false} {
+		config, err := configLoader.LoadFromProfile(profile)
+		if err != nil {
+			t.Fatalf("Should have found a profile: %v", err)
+		}
+		if config.RequireApproval != expected {
+			t.Errorf("Expected require_approval for %s to be %v, got %v", profile, expected, config.RequireApproval)
+		}
+	}
+}
+
+func TestRenewBeforeFromIni(t *testing.T) {
+	f := newConfigFile(t, []byte(`
+[default]
+renew_before = 15m
+
+[profile dev]
+
+[profile ci]
+renew_before = 30m
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile}
+
+	for profile, expected := range map[string]time.Duration{"dev": 15 * time.Minute, "ci": 30 * time.Minute} {
+		config, err := configLoader.LoadFromProfile(profile)
+		if err != nil {
+			t.Fatalf("Should have found a profile: %v", err)
+		}
+		if config.ExpiryWindow() != expected {
+			t.Errorf("Expected the expiry window for %s to be %s, got %s", profile, expected, config.ExpiryWindow())
+		}
+	}
+
+	configLoader.BaseConfig = vault.Config{RenewBefore: time.Hour}
+	config, err := configLoader.LoadFromProfile("ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ExpiryWindow() != time.Hour {
+		t.Errorf("Expected --renew-before to take precedence, got %s", config.ExpiryWindow())
+	}
+}
+
+func TestSSOBrowserCommandFromIni(t *testing.T) {
+	f := newConfigFile(t, []byte(`
+[sso-session acme]
+sso_start_url = https://acme.awsapps.com/start
+sso_region = us-east-1
+sso_browser_command = firefox --private-window
+
+[profile prod]
+sso_session = acme
+sso_account_id = 111111111111
+sso_role_name = AdministratorAccess
+
+[profile dev]
+sso_session = acme
+sso_account_id = 222222222222
+sso_role_name = ReadOnly
+sso_browser_command = chromium --profile-directory=Work
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile}
+
+	for profile, expected := range map[string]string{"prod": "firefox --private-window", "dev": "chromium --profile-directory=Work"} {
+		config, err := configLoader.LoadFromProfile(profile)
+		if err != nil {
+			t.Fatalf("Should have found a profile: %v", err)
+		}
+		if config.SSOBrowserCommand != expected {
+			t.Errorf("Expected sso_browser_command for %s to be %q, got %q", profile, expected, config.SSOBrowserCommand)
+		}
+	}
+
+	configLoader.BaseConfig = vault.Config{SSOBrowserCommand: "open -a Safari"}
+	config, err := configLoader.LoadFromProfile("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.SSOBrowserCommand != "open -a Safari" {
+		t.Errorf("Expected --browser to take precedence, got %q", config.SSOBrowserCommand)
+	}
+}
+
+func TestPromptCommandFromIni(t *testing.T) {
+	f := newConfigFile(t, []byte(`
+[default]
+prompt_command = echo 123456
+
+[profile dev]
+mfa_serial = arn:aws:iam::111111111111:mfa/user
+
+[profile ci]
+prompt_command = rofi -dmenu
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile}
+
+	config, err := configLoader.LoadFromProfile("ci")
+	if err != nil {
+		t.Fatalf("Should have found a profile: %v", err)
+	}
+	if config.PromptCommand != "rofi -dmenu" {
+		t.Errorf("Expected prompt_command %q, got %q", "rofi -dmenu", config.PromptCommand)
+	}
+
+	config, err = configLoader.LoadFromProfile("dev")
+	if err != nil {
+		t.Fatalf("Should have found a profile: %v", err)
+	}
+	token, err := vault.NewMfa(config).GetMfaToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *token != "123456" {
+		t.Errorf("Expected the MFA code from prompt_command, got %q", *token)
+	}
+}
+
+func TestDescribeChain(t *testing.T) {
+	f := newConfigFile(t, []byte(`
+[profile base]
+mfa_serial = arn:aws:iam::111111111111:mfa/user
+
+[profile admin]
+source_profile = base
+role_arn = arn:aws:iam::222222222222:role/admin
+mfa_serial = arn:aws:iam::111111111111:mfa/user
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile, ActiveProfile: "admin"}
+	config, err := configLoader.LoadFromProfile("admin")
+	if err != nil {
+		t.Fatalf("Should have found a profile: %v", err)
+	}
+
+	ckr := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring([]keyring.Item{})}
+	links, err := vault.DescribeChain(config, ckr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the role uses the chained MFA, so its session isn't cached
+	expected := []vault.ChainLink{
+		{ProfileName: "base", Type: "stored credentials", Missing: true},
+		{ProfileName: "base", Type: "sts.GetSessionToken", MfaSerial: "arn:aws:iam::111111111111:mfa/user", Duration: vault.DefaultChainedSessionDuration, SessionKey: &vault.SessionMetadata{}},
+		{ProfileName: "admin", Type: "sts.AssumeRole", Detail: "arn:aws:iam::222222222222:role/admin", MfaSerial: "arn:aws:iam::111111111111:mfa/user", MfaChained: true, Duration: vault.DefaultSessionDuration},
+	}
+	hasSameSessionKey := cmp.Comparer(func(a, b *vault.SessionMetadata) bool { return (a == nil) == (b == nil) })
+	if diff := cmp.Diff(expected, links, hasSameSessionKey); diff != "" {
+		t.Errorf("DescribeChain() mismatch (-expected +got):\n%s", diff)
+	}
+	if key := links[1].SessionKey; key.Type != "sts.GetSessionToken" || key.ProfileName != "base" {
+		t.Errorf("Expected the session key of GetSessionToken for base, got %+v", key)
+	}
+}
+
+func TestSetManagedProfile(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile work]
+region=us-east-1
+
+[profile work-vault]
+region=us-west-2
+`))
+	defer os.Remove(f)
+
+	cfg, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cfg.SetManagedProfile(vault.ProfileSection{Name: "work-vault", CredentialProcess: "aws-vault export --format=json work"}); err == nil {
+		t.Fatal("Expected an error replacing a profile that wasn't created by configure-cli")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err = cfg.SetManagedProfile(vault.ProfileSection{Name: "work-cli", Region: "us-east-1", CredentialProcess: "aws-vault export --format=json work"}); err != nil {
+			t.Fatal(err)
+		}
+		if err = cfg.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if managed, _ := cfg.IsManagedProfile("work-cli"); !managed {
+		t.Fatal("Expected work-cli to be managed")
+	}
+	if managed, _ := cfg.IsManagedProfile("work"); managed {
+		t.Fatal("Expected work not to be managed")
+	}
+
+	profile, ok := cfg.ProfileSection("work-cli")
+	if !ok || profile.CredentialProcess != "aws-vault export --format=json work" || profile.Region != "us-east-1" {
+		t.Fatalf("Unexpected profile %#v", profile)
+	}
+
+	b, _ := os.ReadFile(f)
+	if n := bytes.Count(b, []byte("[profile work-cli]")); n != 1 {
+		t.Fatalf("Expected the profile to be written once, got %d in:\n%s", n, b)
+	}
+}
@@ -2,7 +2,9 @@ package vault
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/99designs/keyring"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -18,7 +20,7 @@ func (ck *CredentialKeyring) Keys() (credentialsNames []string, err error) {
 		return credentialsNames, err
 	}
 	for _, keyName := range allKeys {
-		if !IsSessionKey(keyName) && !IsOIDCTokenKey(keyName) {
+		if !IsSessionKey(keyName) && !IsOIDCTokenKey(keyName) && !IsOIDCClientKey(keyName) && !IsSessionCacheKey(keyName) && !IsCredentialPluginStateKey(keyName) {
 			credentialsNames = append(credentialsNames, keyName)
 		}
 	}
@@ -43,7 +45,10 @@ func (ck *CredentialKeyring) Get(credentialsName string) (creds aws.Credentials,
 	if err != nil {
 		return creds, err
 	}
-	if err = json.Unmarshal(item.Data, &creds); err != nil {
+	err = withLockedSecret(item.Data, ownsItemData(ck.Keyring), func(b []byte) error {
+		return json.Unmarshal(b, &creds)
+	})
+	if err != nil {
 		return creds, fmt.Errorf("Invalid data in keyring: %v", err)
 	}
 	return creds, err
@@ -55,16 +60,31 @@ func (ck *CredentialKeyring) Set(credentialsName string, creds aws.Credentials)
 		return err
 	}
 
-	return ck.Keyring.Set(keyring.Item{
-		Key:   credentialsName,
-		Label: fmt.Sprintf("aws-vault (%s)", credentialsName),
-		Data:  bytes,
+	return withLockedSecret(bytes, ownsItemData(ck.Keyring), func(b []byte) error {
+		return ck.Keyring.Set(keyring.Item{
+			Key:   credentialsName,
+			Label: fmt.Sprintf("aws-vault (%s)", credentialsName),
+			Data:  b,
 
-		// specific Keychain settings
-		KeychainNotTrustApplication: true,
+			// specific Keychain settings
+			KeychainNotTrustApplication: true,
+		})
 	})
 }
 
+// LastModified returns when the credentials were last stored, without reading the secret itself.
+// A zero time is returned if the keyring backend doesn't keep track of it
+func (ck *CredentialKeyring) LastModified(credentialsName string) (time.Time, error) {
+	md, err := ck.Keyring.GetMetadata(credentialsName)
+	if errors.Is(err, keyring.ErrMetadataNeedsCredentials) || errors.Is(err, keyring.ErrMetadataNotSupported) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return md.ModificationTime, nil
+}
+
 func (ck *CredentialKeyring) Remove(credentialsName string) error {
 	return ck.Keyring.Remove(credentialsName)
 }
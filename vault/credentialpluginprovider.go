@@ -0,0 +1,214 @@
+package vault
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// CredentialPluginProtocolVersion is the version of the protocol aws-vault speaks to credential plugins
+const CredentialPluginProtocolVersion = 1
+
+// The types of the messages exchanged with a credential plugin
+const (
+	// CredentialPluginGetCredentials is the request aws-vault starts the plugin with
+	CredentialPluginGetCredentials = "GetCredentials"
+	// CredentialPluginPromptMFA asks aws-vault to prompt for an MFA code, which is sent back in a CredentialPluginMFAToken
+	CredentialPluginPromptMFA = "PromptMFA"
+	CredentialPluginMFAToken  = "MFAToken"
+	// CredentialPluginCredentials is the plugin's last message, with the credentials
+	CredentialPluginCredentials = "Credentials"
+	// CredentialPluginError is the plugin's last message when it can't get credentials
+	CredentialPluginError = "Error"
+)
+
+// CredentialPluginMessage is a line of JSON exchanged with a credential plugin over its stdin and stdout.
+// aws-vault sends a GetCredentials request, and the plugin replies with any number of PromptMFA messages,
+// each answered with an MFAToken, followed by either Credentials or an Error
+type CredentialPluginMessage struct {
+	Type string
+
+	// Set in GetCredentials
+	Version     int    `json:",omitempty"`
+	ProfileName string `json:",omitempty"`
+	Region      string `json:",omitempty"`
+	MfaSerial   string `json:",omitempty"`
+	// Refresh asks the plugin not to reuse credentials it has cached itself
+	Refresh bool `json:",omitempty"`
+
+	// State is given to the plugin in GetCredentials as it was last returned with Credentials for the
+	// profile, such as a refresh token. It's stored in the keyring, and an empty State removes it
+	State string `json:",omitempty"`
+
+	// Prompt is the text of a PromptMFA, and Token the code in the MFAToken replying to it
+	Prompt string `json:",omitempty"`
+	Token  string `json:",omitempty"`
+
+	// Set in Credentials
+	AccessKeyID     string     `json:"AccessKeyId,omitempty"`
+	SecretAccessKey string     `json:",omitempty"`
+	SessionToken    string     `json:",omitempty"`
+	Expiration      *time.Time `json:",omitempty"`
+
+	// Message is the text of an Error
+	Message string `json:",omitempty"`
+}
+
+// CredentialPluginProvider gets credentials from a credential plugin, a command that speaks the protocol of
+// CredentialPluginMessage. Unlike credential_process, the plugin can ask aws-vault to prompt for MFA, and
+// keep state in the keyring to refresh credentials without signing in again
+type CredentialPluginProvider struct {
+	Command     string
+	ProfileName string
+	Region      string
+	Mfa         *Mfa
+	Refresh     bool
+	// StateKeyring stores the plugin's state, or is nil when it isn't kept
+	StateKeyring *CredentialPluginStateKeyring
+}
+
+// Retrieve runs the plugin to get credentials
+func (p *CredentialPluginProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	creds, err := p.callPlugin(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	return aws.Credentials{
+		AccessKeyID:     aws.ToString(creds.AccessKeyId),
+		SecretAccessKey: aws.ToString(creds.SecretAccessKey),
+		SessionToken:    aws.ToString(creds.SessionToken),
+		CanExpire:       true,
+		Expires:         aws.ToTime(creds.Expiration),
+	}, nil
+}
+
+func (p *CredentialPluginProvider) callPlugin(ctx context.Context) (*ststypes.Credentials, error) {
+	request := CredentialPluginMessage{
+		Type:        CredentialPluginGetCredentials,
+		Version:     CredentialPluginProtocolVersion,
+		ProfileName: p.ProfileName,
+		Region:      p.Region,
+		MfaSerial:   p.Mfa.GetMfaSerial(),
+		Refresh:     p.Refresh,
+	}
+	if p.StateKeyring != nil {
+		state, err := p.StateKeyring.Get(p.ProfileName)
+		if err != nil {
+			return nil, err
+		}
+		request.State = state
+	}
+
+	cmd := shellCommand(p.Command)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Running credential plugin %q", p.Command)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("running credential plugin %q: %w", p.Command, err)
+	}
+
+	// the plugin is killed if the context is cancelled, such as while it waits for a sign in
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = cmd.Process.Kill()
+		case <-done:
+		}
+	}()
+
+	creds, state, err := p.converse(stdin, stdout, request)
+	stdin.Close()
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("credential plugin %q: %w", p.Command, err)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("credential plugin %q: %w", p.Command, err)
+	}
+
+	if p.StateKeyring != nil {
+		if err := p.StateKeyring.Set(p.ProfileName, state); err != nil {
+			return nil, err
+		}
+	}
+
+	return creds, nil
+}
+
+// converse sends the request to the plugin and answers its prompts until it replies with credentials
+func (p *CredentialPluginProvider) converse(w io.Writer, r io.Reader, request CredentialPluginMessage) (*ststypes.Credentials, string, error) {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(request); err != nil {
+		return nil, "", err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg CredentialPluginMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return nil, "", fmt.Errorf("invalid JSON message: %w", err)
+		}
+
+		switch msg.Type {
+		case CredentialPluginPromptMFA:
+			mfa := &Mfa{mfaSerial: msg.Prompt, mfaPromptFunc: p.Mfa.mfaPromptFunc}
+			if mfa.mfaSerial == "" {
+				mfa.mfaSerial = p.Mfa.GetMfaSerial()
+			}
+			token, err := mfa.GetMfaToken()
+			if err != nil {
+				return nil, "", err
+			}
+			if err := enc.Encode(CredentialPluginMessage{Type: CredentialPluginMFAToken, Token: aws.ToString(token)}); err != nil {
+				return nil, "", err
+			}
+
+		case CredentialPluginCredentials:
+			if msg.AccessKeyID == "" || msg.SecretAccessKey == "" || msg.Expiration == nil {
+				return nil, "", errors.New("credentials are missing AccessKeyId, SecretAccessKey or Expiration")
+			}
+			return &ststypes.Credentials{
+				AccessKeyId:     aws.String(msg.AccessKeyID),
+				SecretAccessKey: aws.String(msg.SecretAccessKey),
+				SessionToken:    aws.String(msg.SessionToken),
+				Expiration:      msg.Expiration,
+			}, msg.State, nil
+
+		case CredentialPluginError:
+			return nil, "", errors.New(msg.Message)
+
+		default:
+			return nil, "", fmt.Errorf("unknown message type %q", msg.Type)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+	return nil, "", errors.New("exited without sending credentials")
+}
@@ -0,0 +1,125 @@
+package vault
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// fakeCredentialPlugin answers a request with the messages, reading a reply after each PromptMFA
+func fakeCredentialPlugin(messages ...CredentialPluginMessage) (io.Writer, io.Reader, chan []CredentialPluginMessage) {
+	toPlugin, pluginIn := io.Pipe()
+	fromPlugin, pluginOut := io.Pipe()
+	received := make(chan []CredentialPluginMessage, 1)
+
+	go func() {
+		defer pluginOut.Close()
+		var got []CredentialPluginMessage
+		scanner := bufio.NewScanner(toPlugin)
+		read := func() {
+			var msg CredentialPluginMessage
+			if scanner.Scan() {
+				_ = json.Unmarshal(scanner.Bytes(), &msg)
+			}
+			got = append(got, msg)
+		}
+
+		read()
+		for _, m := range messages {
+			b, _ := json.Marshal(m)
+			_, _ = pluginOut.Write(append(b, '\n'))
+			if m.Type == CredentialPluginPromptMFA {
+				read()
+			}
+		}
+		received <- got
+	}()
+
+	return pluginIn, fromPlugin, received
+}
+
+func TestCredentialPluginConverse(t *testing.T) {
+	expiration := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	w, r, received := fakeCredentialPlugin(
+		CredentialPluginMessage{Type: CredentialPluginPromptMFA, Prompt: "Okta Verify"},
+		CredentialPluginMessage{Type: CredentialPluginCredentials, AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token", Expiration: &expiration, State: "refresh-token"},
+	)
+
+	var prompted string
+	p := &CredentialPluginProvider{
+		Command:     "plugin",
+		ProfileName: "okta",
+		Mfa: &Mfa{mfaPromptFunc: func(prompt string) (string, error) {
+			prompted = prompt
+			return "123456", nil
+		}},
+	}
+	creds, state, err := p.converse(w, r, CredentialPluginMessage{Type: CredentialPluginGetCredentials, Version: CredentialPluginProtocolVersion, ProfileName: "okta", State: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if aws.ToString(creds.AccessKeyId) != "ASIAEXAMPLE" || !aws.ToTime(creds.Expiration).Equal(expiration) {
+		t.Errorf("Unexpected credentials %#v", creds)
+	}
+	if state != "refresh-token" {
+		t.Errorf("Expected the state refresh-token, got %q", state)
+	}
+	if prompted != "Okta Verify" {
+		t.Errorf("Expected a prompt for Okta Verify, got %q", prompted)
+	}
+
+	got := <-received
+	if len(got) != 2 || got[0].Type != CredentialPluginGetCredentials || got[0].State != "old" || got[1].Type != CredentialPluginMFAToken || got[1].Token != "123456" {
+		t.Errorf("Unexpected messages to the plugin %#v", got)
+	}
+}
+
+func TestCredentialPluginConverseError(t *testing.T) {
+	w, r, _ := fakeCredentialPlugin(CredentialPluginMessage{Type: CredentialPluginError, Message: "user is locked out"})
+
+	p := &CredentialPluginProvider{Command: "plugin", Mfa: &Mfa{}}
+	_, _, err := p.converse(w, r, CredentialPluginMessage{Type: CredentialPluginGetCredentials})
+	if err == nil || !strings.Contains(err.Error(), "user is locked out") {
+		t.Errorf("Expected the plugin's error, got %v", err)
+	}
+}
+
+func TestCredentialPluginConverseMissingCredentials(t *testing.T) {
+	w, r, _ := fakeCredentialPlugin(CredentialPluginMessage{Type: CredentialPluginCredentials, AccessKeyID: "ASIAEXAMPLE"})
+
+	p := &CredentialPluginProvider{Command: "plugin", Mfa: &Mfa{}}
+	if _, _, err := p.converse(w, r, CredentialPluginMessage{Type: CredentialPluginGetCredentials}); err == nil {
+		t.Error("Expected an error for credentials without a secret or expiration")
+	}
+}
+
+func TestCredentialPluginStateKeyring(t *testing.T) {
+	kr := keyring.NewArrayKeyring(nil)
+	s := &CredentialPluginStateKeyring{Keyring: kr}
+
+	if err := s.Set("okta", "refresh-token"); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := s.Get("okta"); err != nil || state != "refresh-token" {
+		t.Fatalf("Expected the stored state, got %q, %v", state, err)
+	}
+
+	keys, _ := (&CredentialKeyring{Keyring: kr}).Keys()
+	if len(keys) != 0 {
+		t.Errorf("Expected the state not to be listed as credentials, got %v", keys)
+	}
+
+	if err := s.Set("okta", ""); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := s.Get("okta"); err != nil || state != "" {
+		t.Errorf("Expected the state to be removed, got %q, %v", state, err)
+	}
+}
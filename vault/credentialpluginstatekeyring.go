@@ -0,0 +1,56 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/99designs/keyring"
+)
+
+// CredentialPluginStateKeyring stores the state credential plugins return for each profile, such as a
+// refresh token, so the plugin can get new credentials next time without signing in again
+type CredentialPluginStateKeyring struct {
+	Keyring keyring.Keyring
+}
+
+const credentialPluginStateKeyPrefix = "plugin-state:"
+
+func (s *CredentialPluginStateKeyring) fmtKey(profileName string) string {
+	return credentialPluginStateKeyPrefix + profileName
+}
+
+func IsCredentialPluginStateKey(k string) bool {
+	return strings.HasPrefix(k, credentialPluginStateKeyPrefix)
+}
+
+// Get returns the state stored for the profile, or an empty string when there's none
+func (s *CredentialPluginStateKeyring) Get(profileName string) (string, error) {
+	item, err := s.Keyring.Get(s.fmtKey(profileName))
+	if err == keyring.ErrKeyNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(item.Data), nil
+}
+
+// Set stores the state for the profile, removing it when it's empty
+func (s *CredentialPluginStateKeyring) Set(profileName, state string) error {
+	if state == "" {
+		err := s.Keyring.Remove(s.fmtKey(profileName))
+		if err == keyring.ErrKeyNotFound {
+			return nil
+		}
+		return err
+	}
+
+	return withLockedSecret([]byte(state), ownsItemData(s.Keyring), func(b []byte) error {
+		return s.Keyring.Set(keyring.Item{
+			Key:         s.fmtKey(profileName),
+			Data:        b,
+			Label:       fmt.Sprintf("aws-vault credential plugin state for %s", profileName),
+			Description: "aws-vault credential plugin state",
+		})
+	})
+}
@@ -40,7 +40,7 @@ func (p *CredentialProcessProvider) Retrieve(ctx context.Context) (aws.Credentia
 	return p.retrieveWith(ctx, executeProcess)
 }
 
-func (p *CredentialProcessProvider) retrieveWith(ctx context.Context, fn func(string) (string, error)) (aws.Credentials, error) {
+func (p *CredentialProcessProvider) retrieveWith(ctx context.Context, fn func(string) ([]byte, error)) (aws.Credentials, error) {
 	creds, err := p.callCredentialProcessWith(ctx, fn)
 	if err != nil {
 		return aws.Credentials{}, err
@@ -59,7 +59,7 @@ func (p *CredentialProcessProvider) callCredentialProcess(ctx context.Context) (
 	return p.callCredentialProcessWith(ctx, executeProcess)
 }
 
-func (p *CredentialProcessProvider) callCredentialProcessWith(_ context.Context, fn func(string) (string, error)) (*ststypes.Credentials, error) {
+func (p *CredentialProcessProvider) callCredentialProcessWith(_ context.Context, fn func(string) ([]byte, error)) (*ststypes.Credentials, error) {
 	// Exec CredentialProcess to retrieve AWS creds in JSON format as described in
 	// https://docs.aws.amazon.com/cli/latest/topic/config-vars.html#sourcing-credentials-from-external-processes
 	output, err := fn(p.CredentialProcess)
@@ -70,7 +70,10 @@ func (p *CredentialProcessProvider) callCredentialProcessWith(_ context.Context,
 
 	// Unmarshal the JSON into a ststypes.Credentials object
 	var value ststypes.Credentials
-	if err := json.Unmarshal([]byte(output), &value); err != nil {
+	err = withLockedSecret(output, true, func(b []byte) error {
+		return json.Unmarshal(b, &value)
+	})
+	if err != nil {
 		return &ststypes.Credentials{}, fmt.Errorf("invalid JSON format from command %q: %v", p.CredentialProcess, err)
 	}
 
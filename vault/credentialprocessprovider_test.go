@@ -13,22 +13,22 @@ import (
 	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
 )
 
-func executeFail(process string) (string, error) {
-	return "", errors.New("executing process failed")
+func executeFail(process string) ([]byte, error) {
+	return nil, errors.New("executing process failed")
 }
 
-func executeGetBadJSON(process string) (string, error) {
-	return "Junk", nil
+func executeGetBadJSON(process string) ([]byte, error) {
+	return []byte("Junk"), nil
 }
 
-func executeGetCredential(accessKeyID *string, expiration *time.Time, secretAccesKey *string, sessionToken *string) (string, error) {
+func executeGetCredential(accessKeyID *string, expiration *time.Time, secretAccesKey *string, sessionToken *string) ([]byte, error) {
 	v, err := json.Marshal(ststypes.Credentials{
 		AccessKeyId:     accessKeyID,
 		Expiration:      expiration,
 		SecretAccessKey: secretAccesKey,
 		SessionToken:    sessionToken,
 	})
-	return string(v), err
+	return v, err
 }
 
 func TestCredentialProcessProvider_Retrieve(t *testing.T) {
@@ -47,7 +47,7 @@ func TestCredentialProcessProvider_Retrieve(t *testing.T) {
 
 	tests := []struct {
 		name                string
-		execFunc            func(string) (string, error)
+		execFunc            func(string) ([]byte, error)
 		wantErr             bool
 		expectMissingFields bool
 	}{
@@ -65,7 +65,7 @@ func TestCredentialProcessProvider_Retrieve(t *testing.T) {
 		},
 		{
 			name: "successful execution, good cred",
-			execFunc: func(string) (string, error) {
+			execFunc: func(string) ([]byte, error) {
 				return executeGetCredential(&accessKeyID, &expiration, &secretAccessKey, &sessionToken)
 			},
 			wantErr:             false,
@@ -73,7 +73,7 @@ func TestCredentialProcessProvider_Retrieve(t *testing.T) {
 		},
 		{
 			name: "fields missing",
-			execFunc: func(string) (string, error) {
+			execFunc: func(string) ([]byte, error) {
 				return executeGetCredential(nil, nil, nil, nil)
 			},
 			wantErr:             true,
@@ -107,3 +107,22 @@ func TestCredentialProcessProvider_Retrieve(t *testing.T) {
 		})
 	}
 }
+
+func TestCredentialProcessProviderWipesOutput(t *testing.T) {
+	accessKeyID, secretAccessKey, sessionToken := "abcd", "0123", "4567"
+	expiration := time.Now().Add(time.Hour)
+	output, err := executeGetCredential(&accessKeyID, &expiration, &secretAccessKey, &sessionToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := CredentialProcessProvider{}
+	if _, err = provider.retrieveWith(context.Background(), func(string) ([]byte, error) { return output, nil }); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range output {
+		if b != 0 {
+			t.Fatalf("Expected the output of the process to be wiped, got %q", output)
+		}
+	}
+}
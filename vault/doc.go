@@ -0,0 +1,15 @@
+// Package vault issues AWS credentials for the profiles in the AWS config file, from master credentials
+// stored in a keyring, as the aws-vault command does.
+//
+// Programs embedding aws-vault should use NewSession, which is configured only by its SessionOptions:
+//
+//	s, err := vault.NewSession(ctx, "work", vault.SessionOptions{Keyring: kr})
+//	if err != nil {
+//		return err
+//	}
+//	cfg := s.AwsConfig()
+//
+// The settings of the aws-vault command's flags, such as NoSession and RefreshSessions, are fields of
+// the Config in the SessionOptions, and traces are recorded by a Tracer in the context, added with
+// ContextWithTracer.
+package vault
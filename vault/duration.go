@@ -0,0 +1,81 @@
+package vault
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The range of session durations that AWS allows. Roles can have a lower maximum than
+// MaxAssumeRoleDuration, which is only known when assuming them
+const (
+	MinSessionDuration         = 15 * time.Minute
+	MaxSessionTokenDuration    = 36 * time.Hour
+	MaxFederationTokenDuration = 36 * time.Hour
+	MaxAssumeRoleDuration      = 12 * time.Hour
+)
+
+var daysRegexp = regexp.MustCompile(`^(\d+)d(.*)$`)
+
+// ParseDuration parses a duration such as 90m, 1h30m or 12h like time.ParseDuration, and also accepts
+// days, as in 1d or 1d12h. A number without a unit is seconds, as with duration_seconds
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if seconds, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	d := time.Duration(0)
+	rest := s
+	if m := daysRegexp.FindStringSubmatch(s); m != nil {
+		days, err := strconv.Atoi(m[1])
+		if err != nil {
+			return 0, invalidDurationError(s)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+		rest = m[2]
+	}
+	if rest != "" || d == 0 {
+		r, err := time.ParseDuration(rest)
+		if err != nil || r < 0 {
+			return 0, invalidDurationError(s)
+		}
+		d += r
+	}
+	return d, nil
+}
+
+func invalidDurationError(s string) error {
+	return fmt.Errorf("Invalid duration %q, use a number of seconds or a duration such as 90m, 1h30m, 12h or 1d", s)
+}
+
+// FormatDuration formats the duration without the zero units that time.Duration has, as in 12h rather than 12h0m0s
+func FormatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// checkSessionDuration returns an error naming the allowed range when the duration of the session is
+// outside it, so that it fails before asking for an MFA code rather than with an error from STS
+func checkSessionDuration(config *Config, operation string, d, max time.Duration) error {
+	if d == 0 || (d >= MinSessionDuration && d <= max) {
+		return nil
+	}
+	return fmt.Errorf("profile %s: the duration %s is outside the range of %s to %s that %s allows",
+		config.ProfileName, FormatDuration(d), FormatDuration(MinSessionDuration), FormatDuration(max), operation)
+}
+
+// isRoleChained is whether the role of the profile is assumed with the credentials of another role,
+// which AWS limits to sessions of an hour
+func (c *Config) isRoleChained() bool {
+	return c.HasSourceProfile() && (c.SourceProfile.HasRole() || c.SourceProfile.HasWebIdentity() ||
+		c.SourceProfile.HasSSOStartURL() || c.SourceProfile.HasSSOSession())
+}
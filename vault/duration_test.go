@@ -0,0 +1,79 @@
+package vault
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"90m":     90 * time.Minute,
+		"1h30m":   90 * time.Minute,
+		"12h":     12 * time.Hour,
+		"1d":      24 * time.Hour,
+		"1d12h":   36 * time.Hour,
+		"3600":    time.Hour,
+		" 15m ":   15 * time.Minute,
+		"0":       0,
+		"1.5h":    90 * time.Minute,
+		"2d30m":   48*time.Hour + 30*time.Minute,
+		"36h0m0s": 36 * time.Hour,
+	}
+	for s, expected := range cases {
+		d, err := ParseDuration(s)
+		if err != nil {
+			t.Errorf("ParseDuration(%q): %v", s, err)
+		} else if d != expected {
+			t.Errorf("ParseDuration(%q) = %s, expected %s", s, d, expected)
+		}
+	}
+
+	for _, s := range []string{"", "d", "1x", "-1h", "-1d", "1d-1h", "1w"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("Expected ParseDuration(%q) to fail", s)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		12 * time.Hour:   "12h",
+		15 * time.Minute: "15m",
+		90 * time.Minute: "1h30m",
+		90 * time.Second: "1m30s",
+	}
+	for d, expected := range cases {
+		if s := FormatDuration(d); s != expected {
+			t.Errorf("FormatDuration(%s) = %s, expected %s", d, s, expected)
+		}
+	}
+}
+
+func TestCheckSessionDuration(t *testing.T) {
+	source := &Config{ProfileName: "source", RoleARN: "arn:aws:iam::111111111111:role/source"}
+	role := func(d time.Duration, source *Config) *Config {
+		return &Config{ProfileName: "role", RoleARN: "arn:aws:iam::111111111111:role/a", AssumeRoleDuration: d, SourceProfile: source, MfaPromptMethod: "terminal"}
+	}
+	cases := []struct {
+		config *Config
+		ok     bool
+	}{
+		{role(12*time.Hour, nil), true},
+		{role(13*time.Hour, nil), false},
+		{role(10*time.Minute, nil), false},
+		{role(time.Hour, source), true},
+		{role(2*time.Hour, source), false},
+	}
+	for _, c := range cases {
+		_, err := NewAssumeRoleProvider(nil, nil, c.config)
+		if ok := err == nil; ok != c.ok {
+			t.Errorf("Expected a duration of %s with source profile %v to be allowed: %v, got %v", c.config.AssumeRoleDuration, c.config.SourceProfile != nil, c.ok, err)
+		}
+	}
+
+	_, err := NewSessionTokenProvider(nil, nil, &Config{ProfileName: "user", NonChainedGetSessionTokenDuration: 37 * time.Hour})
+	expected := "profile user: the duration 37h is outside the range of 15m to 36h that GetSessionToken allows"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected %q, got %v", expected, err)
+	}
+}
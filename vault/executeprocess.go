@@ -7,22 +7,25 @@ import (
 	"runtime"
 )
 
-func executeProcess(process string) (string, error) {
-	var cmdArgs []string
+// shellCommand returns a command that runs the process with the platform's shell
+func shellCommand(process string) *exec.Cmd {
 	if runtime.GOOS == "windows" {
-		cmdArgs = []string{"cmd.exe", "/C", process}
-	} else {
-		cmdArgs = []string{"/bin/sh", "-c", process}
+		return exec.Command("cmd.exe", "/C", process)
 	}
+	return exec.Command("/bin/sh", "-c", process)
+}
 
-	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+// executeProcess runs the process and returns its output. It's returned as the buffer it was read into, so
+// that secrets in it can be wiped
+func executeProcess(process string) ([]byte, error) {
+	cmd := shellCommand(process)
 	cmd.Env = os.Environ()
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = os.Stderr
 
 	output, err := cmd.Output()
 	if err != nil {
-		return "", fmt.Errorf("running command %q: %v", process, err)
+		return nil, fmt.Errorf("running command %q: %v", process, err)
 	}
-	return string(output), nil
+	return output, nil
 }
@@ -0,0 +1,100 @@
+package vault_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+)
+
+var fakeCredentialsConfig = []byte(`[profile fixture]
+credential_type = fake
+
+[profile fixture-role]
+source_profile = fixture
+role_arn = arn:aws:iam::111111111111:role/admin
+duration_seconds = 900
+
+[profile real]
+region = us-east-1
+`)
+
+func TestFakeCredentials(t *testing.T) {
+	f := newConfigFile(t, fakeCredentialsConfig)
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile}
+	ckr := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+
+	config, err := configLoader.LoadFromProfile("fixture-role")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.HasFakeCredentials() {
+		t.Fatalf("Expected fixture-role to have fake credentials from its source profile")
+	}
+
+	p, err := vault.NewTempCredentialsProvider(config, ckr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(creds.AccessKeyID, "ASIA") || len(creds.AccessKeyID) != 20 {
+		t.Errorf("Expected an STS style access key, got %q", creds.AccessKeyID)
+	}
+	if creds.SecretAccessKey == "" || creds.SessionToken == "" {
+		t.Errorf("Expected a secret key and session token, got %#v", creds)
+	}
+	if remaining := time.Until(creds.Expires); remaining <= 14*time.Minute || remaining > 15*time.Minute {
+		t.Errorf("Expected the credentials to last 15m, got %s", remaining)
+	}
+
+	again, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.AccessKeyID != creds.AccessKeyID || again.SecretAccessKey != creds.SecretAccessKey || again.SessionToken != creds.SessionToken {
+		t.Errorf("Expected the same credentials every time")
+	}
+
+	other, err := vault.NewFakeCredentialsProvider(&vault.Config{ProfileName: "fixture"}).Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.AccessKeyID == creds.AccessKeyID {
+		t.Errorf("Expected each profile to have its own access key")
+	}
+
+	config, err = configLoader.LoadFromProfile("real")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.HasFakeCredentials() {
+		t.Errorf("Expected real not to have fake credentials")
+	}
+}
+
+func TestInvalidCredentialType(t *testing.T) {
+	f := newConfigFile(t, []byte("[profile bad]\ncredential_type = pretend\n"))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile}
+	if _, err := configLoader.LoadFromProfile("bad"); err == nil {
+		t.Fatalf("Expected an error for an invalid credential_type")
+	}
+}
@@ -2,7 +2,6 @@ package vault
 
 import (
 	"context"
-	"log"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -13,9 +12,11 @@ const allowAllIAMPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow
 
 // FederationTokenProvider retrieves temporary credentials from STS using GetFederationToken
 type FederationTokenProvider struct {
-	StsClient *sts.Client
-	Name      string
-	Duration  time.Duration
+	StsClient  *sts.Client
+	Name       string
+	Duration   time.Duration
+	Policy     string
+	PolicyARNs []string
 }
 
 func (f *FederationTokenProvider) name() string {
@@ -28,16 +29,31 @@ func (f *FederationTokenProvider) name() string {
 
 // Retrieve generates a new set of temporary credentials using STS GetFederationToken
 func (f *FederationTokenProvider) Retrieve(ctx context.Context) (creds aws.Credentials, err error) {
-	resp, err := f.StsClient.GetFederationToken(ctx, &sts.GetFederationTokenInput{
+	input := &sts.GetFederationTokenInput{
 		Name:            aws.String(f.name()),
 		DurationSeconds: aws.Int32(int32(f.Duration.Seconds())),
-		Policy:          aws.String(allowAllIAMPolicy),
-	})
+	}
+
+	// Without any session policy the federated user would have no permissions at all,
+	// so fall back to allowing everything the IAM user can do
+	switch {
+	case f.Policy != "":
+		input.Policy = aws.String(f.Policy)
+	case len(f.PolicyARNs) == 0:
+		input.Policy = aws.String(allowAllIAMPolicy)
+	}
+
+	if len(f.PolicyARNs) > 0 {
+		input.PolicyArns = policyDescriptors(f.PolicyARNs)
+	}
+
+	resp, err := f.StsClient.GetFederationToken(ctx, input)
 	if err != nil {
 		return creds, err
 	}
 
-	log.Printf("Generated credentials %s using GetFederationToken, expires in %s", FormatKeyForDisplay(*resp.Credentials.AccessKeyId), time.Until(*resp.Credentials.Expiration).String())
+	expiresIn := time.Until(*resp.Credentials.Expiration)
+	logf(LogFields{Provider: "federation_token", Duration: expiresIn}, "Generated credentials %s using GetFederationToken, expires in %s", FormatKeyForDisplay(*resp.Credentials.AccessKeyId), expiresIn.String())
 
 	return aws.Credentials{
 		AccessKeyID:     aws.ToString(resp.Credentials.AccessKeyId),
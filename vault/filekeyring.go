@@ -0,0 +1,441 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/keyring"
+	jose "github.com/dvsekhvalnov/jose2go"
+	"github.com/mtibben/percent"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	fileKeyringVersion = 1
+	fileKeyringKDF     = "argon2id"
+	fileKeyringKeySize = 32
+	fileKeyringSalt    = 16
+)
+
+// Argon2Params are the Argon2id parameters used to derive encryption keys from the file keyring passphrase
+type Argon2Params struct {
+	// Time is the number of passes over the memory
+	Time uint32
+
+	// Memory is the memory used in KiB
+	Memory uint32
+
+	// Threads is the degree of parallelism
+	Threads uint8
+}
+
+// DefaultArgon2Params are the recommended Argon2id parameters from RFC 9106 for memory constrained environments
+var DefaultArgon2Params = Argon2Params{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+func (p Argon2Params) String() string {
+	return fmt.Sprintf("t=%d,m=%d,p=%d", p.Time, p.Memory, p.Threads)
+}
+
+// weakerThan checks if any parameter is lower than in other
+func (p Argon2Params) weakerThan(other Argon2Params) bool {
+	return p.Time < other.Time || p.Memory < other.Memory || p.Threads < other.Threads
+}
+
+// ParseArgon2Params parses parameters in the form "t=3,m=65536,p=4". Parameters that aren't given keep their default values
+func ParseArgon2Params(s string) (Argon2Params, error) {
+	p := DefaultArgon2Params
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			return p, fmt.Errorf("invalid Argon2 parameter %q, expected key=value", kv)
+		}
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || n == 0 {
+			return p, fmt.Errorf("invalid value for Argon2 parameter %s: %q", k, v)
+		}
+		switch k {
+		case "t":
+			p.Time = uint32(n)
+		case "m":
+			p.Memory = uint32(n)
+		case "p":
+			if n > 255 {
+				return p, fmt.Errorf("invalid value for Argon2 parameter p: %q", v)
+			}
+			p.Threads = uint8(n)
+		default:
+			return p, fmt.Errorf("unknown Argon2 parameter %q, expected t, m or p", k)
+		}
+	}
+	return p, nil
+}
+
+// fileKeyringItem is how items are stored in the files
+type fileKeyringItem struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Time       uint32 `json:"t"`
+	Memory     uint32 `json:"m"`
+	Threads    uint8  `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// FileKeyring is an encrypted file keyring, compatible with the "file" backend of the keyring
+// library. Keys are derived from the passphrase with Argon2id, and files encrypted by the keyring
+// library, or with weaker parameters, are re-encrypted when they are read. Files and the directory
+// must only be accessible by the current user. With PassphraseCacheTTL, the passphrase is cached in
+// the kernel's session keyring for that long, so it isn't prompted for on every invocation
+type FileKeyring struct {
+	Dir                string
+	PasswordFunc       keyring.PromptFunc
+	Params             Argon2Params
+	PassphraseCacheTTL time.Duration
+
+	mu       sync.Mutex
+	password string
+	keys     map[string][]byte
+}
+
+// checkPrivate refuses to use a file or directory that other users can access
+func checkPrivate(path string, info os.FileInfo) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("%s has permissions %#o, which allow other users to access it. Run `chmod go-rwx %s` to fix this", path, perm, path)
+	}
+	return nil
+}
+
+func (k *FileKeyring) resolveDir() (string, error) {
+	if k.Dir == "" {
+		return "", errors.New("No directory provided for file keyring")
+	}
+
+	dir, err := keyring.ExpandTilde(k.Dir)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return dir, os.MkdirAll(dir, 0700)
+	} else if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is a file, not a directory", dir)
+	}
+
+	return dir, checkPrivate(dir, info)
+}
+
+func (k *FileKeyring) filename(key string) (string, error) {
+	dir, err := k.resolveDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, percent.Encode(key, "/")), nil
+}
+
+func (k *FileKeyring) unlock() error {
+	if k.password != "" {
+		return nil
+	}
+
+	dir, err := k.resolveDir()
+	if err != nil {
+		return err
+	}
+	if k.PassphraseCacheTTL > 0 {
+		if password, err := getCachedPassphrase(passphraseCacheName(dir)); err == nil {
+			log.Printf("Using the cached passphrase for %s", dir)
+			k.password = password
+			return nil
+		}
+	}
+
+	k.password, err = k.PasswordFunc(fmt.Sprintf("Enter passphrase to unlock %q", dir))
+	if err != nil {
+		return err
+	}
+
+	if k.PassphraseCacheTTL > 0 {
+		if err = cachePassphrase(passphraseCacheName(dir), k.password, k.PassphraseCacheTTL); err != nil {
+			log.Printf("Couldn't cache the passphrase: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+func passphraseCacheName(dir string) string {
+	return "aws-vault:file-passphrase:" + dir
+}
+
+// forgetPassphrase removes a passphrase that failed to decrypt a file from the cache
+func (k *FileKeyring) forgetPassphrase() {
+	if k.PassphraseCacheTTL == 0 {
+		return
+	}
+	if dir, err := k.resolveDir(); err == nil {
+		forgetCachedPassphrase(passphraseCacheName(dir))
+	}
+}
+
+// deriveKey derives the encryption key for the salt and parameters. Keys are cached, as deriving them is deliberately slow
+func (k *FileKeyring) deriveKey(salt []byte, p Argon2Params) []byte {
+	cacheKey := string(salt) + p.String()
+	if key, ok := k.keys[cacheKey]; ok {
+		return key
+	}
+	if k.keys == nil {
+		k.keys = map[string][]byte{}
+	}
+	key := argon2.IDKey([]byte(k.password), salt, p.Time, p.Memory, p.Threads, fileKeyringKeySize)
+	k.keys[cacheKey] = key
+	return key
+}
+
+func (k *FileKeyring) encrypt(key string, plaintext []byte) ([]byte, error) {
+	salt := make([]byte, fileKeyringSalt)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(k.deriveKey(salt, k.Params))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	// the key is authenticated, so a file can't be swapped for another one
+	return json.Marshal(fileKeyringItem{
+		Version:    fileKeyringVersion,
+		KDF:        fileKeyringKDF,
+		Time:       k.Params.Time,
+		Memory:     k.Params.Memory,
+		Threads:    k.Params.Threads,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, []byte(key)),
+	})
+}
+
+// decrypt decrypts the contents of a file, returning whether it should be re-encrypted
+// because it was encrypted by the keyring library or with weaker parameters
+func (k *FileKeyring) decrypt(key string, contents []byte) ([]byte, bool, error) {
+	var item fileKeyringItem
+	if err := json.Unmarshal(contents, &item); err != nil || item.KDF == "" {
+		payload, _, err := jose.Decode(string(contents), k.password)
+		if err != nil {
+			return nil, false, err
+		}
+		return []byte(payload), true, nil
+	}
+
+	if item.Version != fileKeyringVersion || item.KDF != fileKeyringKDF {
+		return nil, false, fmt.Errorf("unsupported file keyring format version %d with %s", item.Version, item.KDF)
+	}
+
+	params := Argon2Params{Time: item.Time, Memory: item.Memory, Threads: item.Threads}
+	block, err := aes.NewCipher(k.deriveKey(item.Salt, params))
+	if err != nil {
+		return nil, false, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, false, err
+	}
+	plaintext, err := gcm.Open(nil, item.Nonce, item.Ciphertext, []byte(key))
+	if err != nil {
+		return nil, false, errors.New("failed to decrypt, the passphrase may be incorrect")
+	}
+
+	return plaintext, params.weakerThan(k.Params), nil
+}
+
+func (k *FileKeyring) Get(key string) (keyring.Item, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	filename, err := k.filename(key)
+	if err != nil {
+		return keyring.Item{}, err
+	}
+
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return keyring.Item{}, keyring.ErrKeyNotFound
+	} else if err != nil {
+		return keyring.Item{}, err
+	}
+	if err = checkPrivate(filename, info); err != nil {
+		return keyring.Item{}, err
+	}
+
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return keyring.Item{}, err
+	}
+	if err = k.unlock(); err != nil {
+		return keyring.Item{}, err
+	}
+
+	plaintext, reencrypt, err := k.decrypt(key, contents)
+	if err != nil {
+		k.forgetPassphrase()
+		return keyring.Item{}, err
+	}
+	defer zeroBytes(plaintext)
+
+	var item keyring.Item
+	if err = json.Unmarshal(plaintext, &item); err != nil {
+		return keyring.Item{}, err
+	}
+
+	if reencrypt {
+		log.Printf("Re-encrypting %s with Argon2id %s", filename, k.Params)
+		if err = k.write(filename, key, plaintext); err != nil {
+			return keyring.Item{}, fmt.Errorf("Failed to re-encrypt %s: %w", filename, err)
+		}
+	}
+
+	return item, nil
+}
+
+func (k *FileKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	filename, err := k.filename(key)
+	if err != nil {
+		return keyring.Metadata{}, err
+	}
+
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return keyring.Metadata{}, keyring.ErrKeyNotFound
+	} else if err != nil {
+		return keyring.Metadata{}, err
+	}
+
+	// everything in the file is encrypted, so only the modification time is known
+	return keyring.Metadata{ModificationTime: info.ModTime()}, nil
+}
+
+func (k *FileKeyring) write(filename, key string, plaintext []byte) error {
+	contents, err := k.encrypt(key, plaintext)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filename, contents)
+}
+
+// tempFilePrefix starts the names of files being written. Keys always have % encoded, so it can't be the name of one
+const tempFilePrefix = "%tmp-"
+
+// writeFileAtomic replaces a file with one only readable by the current user, writing it to a temporary file
+// in the same directory first so that an interrupted write never leaves a partial item
+func writeFileAtomic(filename string, contents []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), tempFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err = f.Chmod(0600); err == nil {
+		if _, err = f.Write(contents); err == nil {
+			err = f.Sync()
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filename)
+}
+
+func (k *FileKeyring) Set(item keyring.Item) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	plaintext, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(plaintext)
+
+	if err = k.unlock(); err != nil {
+		return err
+	}
+
+	filename, err := k.filename(item.Key)
+	if err != nil {
+		return err
+	}
+	return k.write(filename, item.Key, plaintext)
+}
+
+func (k *FileKeyring) Remove(key string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	filename, err := k.filename(key)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(filename)
+}
+
+func (k *FileKeyring) Keys() ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	dir, err := k.resolveDir()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return keys, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), tempFilePrefix) {
+			continue
+		}
+		keys = append(keys, percent.Decode(f.Name()))
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,268 @@
+package vault_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	jose "github.com/dvsekhvalnov/jose2go"
+)
+
+var testArgon2Params = vault.Argon2Params{Time: 1, Memory: 1024, Threads: 1}
+
+func newTestFileKeyring(t *testing.T) *vault.FileKeyring {
+	return &vault.FileKeyring{
+		Dir:          filepath.Join(t.TempDir(), "keys"),
+		PasswordFunc: func(string) (string, error) { return "passphrase", nil },
+		Params:       testArgon2Params,
+	}
+}
+
+func TestFileKeyringRoundTrip(t *testing.T) {
+	k := newTestFileKeyring(t)
+
+	if err := k.Set(keyring.Item{Key: "foo/bar", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(k.Dir, "foo%2Fbar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), `"kdf":"argon2id"`) || strings.Contains(string(contents), "secret") {
+		t.Fatalf("Unexpected file contents %s", contents)
+	}
+
+	item, err := k.Get("foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Data) != "secret" {
+		t.Fatalf("Expected data %q, got %q", "secret", item.Data)
+	}
+
+	keys, err := k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "foo/bar" {
+		t.Fatalf("Unexpected keys %v", keys)
+	}
+}
+
+func TestFileKeyringMigratesLegacyFiles(t *testing.T) {
+	k := newTestFileKeyring(t)
+
+	token, err := jose.Encrypt(`{"Key":"foo","Data":"c2VjcmV0"}`, jose.PBES2_HS256_A128KW, jose.A256GCM, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Mkdir(k.Dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(k.Dir, "foo")
+	if err = os.WriteFile(filename, []byte(token), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := k.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Data) != "secret" {
+		t.Fatalf("Expected data %q, got %q", "secret", item.Data)
+	}
+
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), `"kdf":"argon2id"`) {
+		t.Fatalf("Expected the file to be re-encrypted, got %s", contents)
+	}
+}
+
+func TestFileKeyringRefusesReadableFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions aren't checked on Windows")
+	}
+	k := newTestFileKeyring(t)
+
+	if err := k.Set(keyring.Item{Key: "foo", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(k.Dir, "foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := k.Get("foo"); err == nil {
+		t.Fatal("Expected an error for a file readable by other users")
+	}
+}
+
+func TestFileKeyringReplacesFiles(t *testing.T) {
+	k := newTestFileKeyring(t)
+
+	for _, data := range []string{"first", "second"} {
+		if err := k.Set(keyring.Item{Key: "foo", Data: []byte(data)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a temporary file left by an interrupted write
+	if err := os.WriteFile(filepath.Join(k.Dir, "%tmp-123"), []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := k.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Data) != "second" {
+		t.Fatalf("Expected data %q, got %q", "second", item.Data)
+	}
+
+	files, err := os.ReadDir(k.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected only the item and the left over file, got %v", files)
+	}
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(filepath.Join(k.Dir, "foo")); err != nil || info.Mode().Perm() != 0600 {
+			t.Fatalf("Expected the file to only be readable by the user, got %v %v", info, err)
+		}
+	}
+
+	keys, err := k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "foo" {
+		t.Fatalf("Unexpected keys %v", keys)
+	}
+}
+
+func TestFileKeyringKeysReturnsReadErrors(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("the directory can't be made unreadable")
+	}
+	k := newTestFileKeyring(t)
+
+	if err := k.Set(keyring.Item{Key: "foo", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(k.Dir, 0300); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(k.Dir, 0700)
+
+	if keys, err := k.Keys(); err == nil {
+		t.Fatalf("Expected an error reading an unreadable directory, got keys %v", keys)
+	}
+}
+
+func TestFileKeyringConcurrentUse(t *testing.T) {
+	k := newTestFileKeyring(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if err := k.Set(keyring.Item{Key: key, Data: []byte("secret")}); err != nil {
+				t.Error(err)
+			}
+			if _, err := k.GetMetadata(key); err != nil {
+				t.Error(err)
+			}
+			if _, err := k.Keys(); err != nil {
+				t.Error(err)
+			}
+			if err := k.Remove(key); err != nil {
+				t.Error(err)
+			}
+		}(fmt.Sprintf("key%d", i))
+	}
+	wg.Wait()
+
+	if keys, err := k.Keys(); err != nil || len(keys) != 0 {
+		t.Fatalf("Expected no keys, got %v, %v", keys, err)
+	}
+}
+
+func TestFileKeyringCachesPassphrase(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the passphrase is only cached on Linux")
+	}
+
+	k := newTestFileKeyring(t)
+	k.PassphraseCacheTTL = time.Minute
+	if err := k.Set(keyring.Item{Key: "foo", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+
+	prompted := false
+	k2 := &vault.FileKeyring{
+		Dir:                k.Dir,
+		PasswordFunc:       func(string) (string, error) { prompted = true; return "passphrase", nil },
+		Params:             testArgon2Params,
+		PassphraseCacheTTL: time.Minute,
+	}
+	if _, err := k2.Get("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if prompted {
+		t.Skip("the kernel keyring isn't available")
+	}
+
+	// a wrong passphrase isn't kept in the cache
+	k3 := newTestFileKeyring(t)
+	k3.PassphraseCacheTTL = time.Minute
+	k3.PasswordFunc = func(string) (string, error) { return "wrong", nil }
+	if err := k.Set(keyring.Item{Key: "foo", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k3.Keys(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(k.Dir, "foo"), filepath.Join(k3.Dir, "foo")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k3.Get("foo"); err == nil {
+		t.Fatal("Expected an error decrypting with the wrong passphrase")
+	}
+
+	k4 := newTestFileKeyring(t)
+	k4.Dir = k3.Dir
+	k4.PassphraseCacheTTL = time.Minute
+	k4.PasswordFunc = func(string) (string, error) { prompted = true; return "passphrase", nil }
+	if _, err := k4.Get("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if !prompted {
+		t.Fatal("Expected the wrong passphrase to be removed from the cache")
+	}
+}
+
+func TestParseArgon2Params(t *testing.T) {
+	p, err := vault.ParseArgon2Params("t=4,m=131072")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := vault.Argon2Params{Time: 4, Memory: 131072, Threads: vault.DefaultArgon2Params.Threads}
+	if p != expected {
+		t.Fatalf("Expected %v, got %v", expected, p)
+	}
+
+	if _, err := vault.ParseArgon2Params("x=1"); err == nil {
+		t.Fatal("Expected an error for an unknown parameter")
+	}
+}
@@ -0,0 +1,96 @@
+package vault
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The events that hooks are run for
+const (
+	HookCredentialsIssued = "credentials-issued"
+	HookSessionExpired    = "session-expired"
+	HookSSOLoginRequired  = "sso-login-required"
+	HookRotationComplete  = "rotation-complete"
+)
+
+const hooksSectionName = "hooks"
+
+// HooksSection is the [hooks] section of the config file, with the command that's run for each event
+type HooksSection struct {
+	CredentialsIssued string `ini:"credentials-issued,omitempty"`
+	SessionExpired    string `ini:"session-expired,omitempty"`
+	SSOLoginRequired  string `ini:"sso-login-required,omitempty"`
+	RotationComplete  string `ini:"rotation-complete,omitempty"`
+}
+
+// HooksSection returns the [hooks] section of the config, which is empty if there isn't one
+func (c *ConfigFile) HooksSection() HooksSection {
+	if c.hooksSection != nil {
+		return *c.hooksSection
+	}
+
+	hooks := HooksSection{}
+	if c.sections == nil {
+		return hooks
+	}
+	if _, err := c.parseSection(hooksSectionName, &hooks); err != nil {
+		log.Println(err.Error())
+	}
+	c.hooksSection = &hooks
+	return hooks
+}
+
+func (h HooksSection) command(event string) string {
+	switch event {
+	case HookCredentialsIssued:
+		return h.CredentialsIssued
+	case HookSessionExpired:
+		return h.SessionExpired
+	case HookSSOLoginRequired:
+		return h.SSOLoginRequired
+	case HookRotationComplete:
+		return h.RotationComplete
+	}
+	return ""
+}
+
+// hookEnv is the environment of a hook, with the event and its metadata as AWS_VAULT_HOOK_ variables
+func hookEnv(event string, metadata map[string]string) []string {
+	env := []string{
+		"AWS_VAULT_HOOK_EVENT=" + event,
+		"AWS_VAULT_HOOK_TIME=" + time.Now().UTC().Format(time.RFC3339),
+	}
+
+	names := []string{}
+	for name := range metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if metadata[name] != "" {
+			env = append(env, "AWS_VAULT_HOOK_"+strings.ToUpper(name)+"="+metadata[name])
+		}
+	}
+	return env
+}
+
+// Run runs the command for the event, if there is one, with the event's metadata in its environment.
+// Failures are logged rather than returned, so a broken hook doesn't stop aws-vault from working
+func (h HooksSection) Run(event string, metadata map[string]string) {
+	command := h.command(event)
+	if command == "" {
+		return
+	}
+
+	log.Printf("Running %s hook", event)
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(), hookEnv(event, metadata)...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Printf("Failed to run %s hook: %s", event, err.Error())
+	}
+}
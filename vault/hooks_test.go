@@ -0,0 +1,99 @@
+package vault_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+)
+
+func TestHooksFromConfig(t *testing.T) {
+	f := newConfigFile(t, []byte(`
+[hooks]
+credentials-issued = notify-send issued
+rotation-complete = notify-send rotated
+
+[profile work]
+region = eu-west-1
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := (&vault.ConfigLoader{File: configFile}).LoadFromProfile("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := vault.HooksSection{CredentialsIssued: "notify-send issued", RotationComplete: "notify-send rotated"}
+	if config.Hooks != expected {
+		t.Errorf("Expected hooks %+v, got %+v", expected, config.Hooks)
+	}
+	if names := configFile.ProfileNames(); len(names) != 1 || names[0] != "work" {
+		t.Errorf("Expected [hooks] not to be a profile, got profiles %v", names)
+	}
+}
+
+func TestSessionExpiredHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook is a shell command")
+	}
+	out := filepath.Join(t.TempDir(), "hook")
+
+	kr := keyring.NewArrayKeyring(nil)
+	expired := vault.SessionMetadata{Type: "sts.GetSessionToken", ProfileName: "work", Expiration: time.Now().Add(-time.Minute)}
+	if err := kr.Set(keyring.Item{Key: expired.String(), Data: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	sk := &vault.SessionKeyring{Keyring: kr, Hooks: vault.HooksSection{SessionExpired: `echo "$AWS_VAULT_HOOK_EVENT $AWS_VAULT_HOOK_PROFILE $AWS_VAULT_HOOK_SESSION_TYPE" > ` + out}}
+	if n, err := sk.RemoveOldSessions(); err != nil || n != 1 {
+		t.Fatalf("Expected 1 session removed, got %d, %v", n, err)
+	}
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(b)); got != "session-expired work sts.GetSessionToken" {
+		t.Errorf("Unexpected hook output %q", got)
+	}
+}
+
+func TestSessionExpiredHookWhenProfileSessionsRemoved(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook is a shell command")
+	}
+	out := filepath.Join(t.TempDir(), "hook")
+
+	kr := keyring.NewArrayKeyring(nil)
+	for _, s := range []vault.SessionMetadata{
+		{Type: "sts.GetSessionToken", ProfileName: "work", Expiration: time.Now().Add(-time.Minute)},
+		{Type: "sts.AssumeRole", ProfileName: "work", Expiration: time.Now().Add(time.Hour)},
+	} {
+		if err := kr.Set(keyring.Item{Key: s.String(), Data: []byte(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sk := &vault.SessionKeyring{Keyring: kr, Hooks: vault.HooksSection{SessionExpired: `echo "$AWS_VAULT_HOOK_SESSION_TYPE" >> ` + out}}
+	if n, err := sk.RemoveForProfile("work"); err != nil || n != 2 {
+		t.Fatalf("Expected 2 sessions removed, got %d, %v", n, err)
+	}
+
+	// only the session that had expired is reported
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(b)); got != "sts.GetSessionToken" {
+		t.Errorf("Unexpected hook output %q", got)
+	}
+}
@@ -0,0 +1,152 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+)
+
+const credentialsIssuedWebhookTimeout = 5 * time.Second
+
+// CredentialsIssuedEvent describes temporary credentials that were issued. It's sent to
+// credentials_issued_webhook and credentials_issued_command, and never contains secrets
+type CredentialsIssuedEvent struct {
+	Time       time.Time `json:"time"`
+	Profile    string    `json:"profile"`
+	Operation  string    `json:"operation"`
+	RoleARN    string    `json:"role_arn,omitempty"`
+	AccountID  string    `json:"account_id,omitempty"`
+	RoleName   string    `json:"role_name,omitempty"`
+	Expiration time.Time `json:"expiration"`
+	Duration   string    `json:"duration"`
+	Hostname   string    `json:"hostname"`
+	User       string    `json:"user"`
+}
+
+// newCredentialsIssuedEvent creates an event from the output of an API call, or returns false if the call didn't issue credentials
+func newCredentialsIssuedEvent(config *Config, operation string, result interface{}) (CredentialsIssuedEvent, bool) {
+	e := CredentialsIssuedEvent{
+		Time:      time.Now().UTC(),
+		Profile:   config.ProfileName,
+		Operation: operation,
+	}
+
+	switch out := result.(type) {
+	case *sts.AssumeRoleOutput:
+		e.RoleARN = aws.ToString(out.AssumedRoleUser.Arn)
+		e.Expiration = aws.ToTime(out.Credentials.Expiration)
+	case *sts.AssumeRoleWithWebIdentityOutput:
+		e.RoleARN = aws.ToString(out.AssumedRoleUser.Arn)
+		e.Expiration = aws.ToTime(out.Credentials.Expiration)
+	case *sts.GetSessionTokenOutput:
+		e.Expiration = aws.ToTime(out.Credentials.Expiration)
+	case *sts.GetFederationTokenOutput:
+		e.RoleARN = aws.ToString(out.FederatedUser.Arn)
+		e.Expiration = aws.ToTime(out.Credentials.Expiration)
+	case *sso.GetRoleCredentialsOutput:
+		e.AccountID = config.SSOAccountID
+		e.RoleName = config.SSORoleName
+		e.Expiration = time.UnixMilli(out.RoleCredentials.Expiration).UTC()
+	default:
+		return e, false
+	}
+
+	e.Duration = e.Expiration.Sub(e.Time).Round(time.Second).String()
+	e.Hostname, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		e.User = u.Username
+	}
+
+	return e, true
+}
+
+func postCredentialsIssuedEvent(url string, body []byte) error {
+	client := http.Client{Timeout: credentialsIssuedWebhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func runCredentialsIssuedCommand(process string, body []byte) error {
+	cmd := shellCommand(process)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// hookMetadata is the metadata the credentials-issued hook is run with
+func (e CredentialsIssuedEvent) hookMetadata() map[string]string {
+	return map[string]string{
+		"profile":    e.Profile,
+		"operation":  e.Operation,
+		"role_arn":   e.RoleARN,
+		"account_id": e.AccountID,
+		"role_name":  e.RoleName,
+		"expiration": e.Expiration.Format(time.RFC3339),
+	}
+}
+
+// notifyCredentialsIssued sends the event to the hooks configured for the profile. Failures are
+// logged rather than returned, so they don't stop credentials being used
+func notifyCredentialsIssued(config *Config, e CredentialsIssuedEvent) {
+	config.Hooks.Run(HookCredentialsIssued, e.hookMetadata())
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Failed to encode credentials issued event: %s", err.Error())
+		return
+	}
+
+	if config.CredentialsIssuedWebhook != "" {
+		logf(LogFields{Profile: config.ProfileName}, "profile %s: sending credentials issued event to webhook", config.ProfileName)
+		if err := postCredentialsIssuedEvent(config.CredentialsIssuedWebhook, body); err != nil {
+			log.Printf("Failed to send credentials issued event: %s", err.Error())
+		}
+	}
+	if config.CredentialsIssuedCommand != "" {
+		logf(LogFields{Profile: config.ProfileName}, "profile %s: running credentials_issued_command", config.ProfileName)
+		if err := runCredentialsIssuedCommand(config.CredentialsIssuedCommand, body); err != nil {
+			log.Printf("Failed to run credentials_issued_command: %s", err.Error())
+		}
+	}
+}
+
+// AddCredentialsIssuedHooks adds an SDK API option to cfg that notifies the hooks configured for
+// the profile whenever an API call issues temporary credentials
+func AddCredentialsIssuedHooks(cfg *aws.Config, config *Config) {
+	if config.CredentialsIssuedWebhook == "" && config.CredentialsIssuedCommand == "" && config.Hooks.CredentialsIssued == "" {
+		return
+	}
+
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("AwsVaultCredentialsIssued", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			out, md, err := next.HandleInitialize(ctx, in)
+			if err == nil {
+				operation := fmt.Sprintf("%s.%s", awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx))
+				if e, ok := newCredentialsIssuedEvent(config, operation, out.Result); ok {
+					notifyCredentialsIssued(config, e)
+				}
+			}
+			return out, md, err
+		}), middleware.After)
+	})
+}
@@ -0,0 +1,47 @@
+package vault
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+func TestNewCredentialsIssuedEvent(t *testing.T) {
+	config := &Config{ProfileName: "prod"}
+	expiration := time.Now().Add(time.Hour)
+
+	e, ok := newCredentialsIssuedEvent(config, "STS.AssumeRole", &sts.AssumeRoleOutput{
+		AssumedRoleUser: &ststypes.AssumedRoleUser{Arn: aws.String("arn:aws:sts::123456789012:assumed-role/admin/session")},
+		Credentials: &ststypes.Credentials{
+			AccessKeyId:     aws.String("ASIAEXAMPLEKEYID1234"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(expiration),
+		},
+	})
+	if !ok {
+		t.Fatal("Expected an event for AssumeRole")
+	}
+	if e.Profile != "prod" || e.RoleARN != "arn:aws:sts::123456789012:assumed-role/admin/session" || !e.Expiration.Equal(expiration) {
+		t.Fatalf("Unexpected event %+v", e)
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"ASIAEXAMPLEKEYID1234", "secret", "token"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("Event contains %q: %s", secret, b)
+		}
+	}
+
+	if _, ok := newCredentialsIssuedEvent(config, "STS.GetCallerIdentity", &sts.GetCallerIdentityOutput{}); ok {
+		t.Fatal("Expected no event for GetCallerIdentity")
+	}
+}
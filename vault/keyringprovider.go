@@ -14,6 +14,12 @@ type KeyringProvider struct {
 }
 
 func (p *KeyringProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	_, span := StartSpan(ctx, "keyring credentials")
+	span.SetAttribute("aws_vault.profile", p.CredentialsName)
+
 	log.Printf("Looking up keyring for '%s'", p.CredentialsName)
-	return p.Keyring.Get(p.CredentialsName)
+	creds, err := p.Keyring.Get(p.CredentialsName)
+	span.End(err)
+
+	return creds, err
 }
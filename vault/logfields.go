@@ -0,0 +1,31 @@
+package vault
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// LogFields describe a log message, for log output that keeps them apart from the message such as JSON
+type LogFields struct {
+	Profile  string
+	Provider string
+	// Duration is how long the credentials in the message last
+	Duration time.Duration
+}
+
+// fieldLogWriter is a log output that records the fields of messages logged with logf
+type fieldLogWriter interface {
+	WriteFields(msg string, fields LogFields) error
+}
+
+// logf logs a message along with its fields. The fields are only passed on when the output of the
+// log package is a fieldLogWriter, otherwise only the message is logged
+func logf(fields LogFields, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	if w, ok := log.Writer().(fieldLogWriter); ok {
+		_ = w.WriteFields(msg, fields)
+		return
+	}
+	log.Print(msg)
+}
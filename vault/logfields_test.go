@@ -0,0 +1,41 @@
+package vault
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+type testFieldLogWriter struct {
+	msg    string
+	fields LogFields
+}
+
+func (w *testFieldLogWriter) Write(p []byte) (int, error) {
+	w.msg = string(p)
+	return len(p), nil
+}
+
+func (w *testFieldLogWriter) WriteFields(msg string, fields LogFields) error {
+	w.msg, w.fields = msg, fields
+	return nil
+}
+
+func TestLogfPassesFields(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+
+	w := &testFieldLogWriter{}
+	log.SetOutput(w)
+	logf(LogFields{Profile: "work", Provider: "assume_role"}, "profile %s: using AssumeRole", "work")
+	if w.msg != "profile work: using AssumeRole" || w.fields.Profile != "work" || w.fields.Provider != "assume_role" {
+		t.Errorf("Unexpected message %q with fields %+v", w.msg, w.fields)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	logf(LogFields{Profile: "work"}, "profile %s: using stored credentials", "work")
+	if !strings.HasSuffix(buf.String(), "profile work: using stored credentials\n") {
+		t.Errorf("Expected the message to be logged without fields, got %q", buf.String())
+	}
+}
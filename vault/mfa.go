@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/99designs/aws-vault/v7/prompt"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -21,6 +22,7 @@ type Mfa struct {
 // GetMfaToken returns the MFA token
 func (m *Mfa) GetMfaToken() (*string, error) {
 	if m.mfaPromptFunc != nil {
+		defer RecordTiming("mfa prompt", time.Now())
 		token, err := m.mfaPromptFunc(m.mfaSerial)
 		return aws.String(token), err
 	}
@@ -44,6 +46,12 @@ func NewMfa(config *Config) *Mfa {
 			log.Println("Executing mfa_process")
 			return ProcessMfaProvider(config.MfaProcess)
 		}
+	} else if config.NoPrompt {
+		m.mfaPromptFunc = func(mfaSerial string) (string, error) {
+			return "", prompt.InteractionRequired(prompt.InteractionMFA, "Entering an MFA code for "+mfaSerial)
+		}
+	} else if config.PromptCommand != "" {
+		m.mfaPromptFunc = prompt.Command(config.PromptCommand)
 	} else {
 		m.mfaPromptFunc = prompt.Method(config.MfaPromptMethod)
 	}
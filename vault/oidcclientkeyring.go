@@ -0,0 +1,96 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+)
+
+// oidcClientExpiryWindow is how long before it expires a client registration is replaced, so it
+// doesn't expire during a sign in
+const oidcClientExpiryWindow = time.Hour
+
+// OIDCClientKeyring stores the OIDC client registrations used to sign in to SSO, so that a client
+// is registered once for each start URL and set of scopes rather than on every sign in
+type OIDCClientKeyring struct {
+	Keyring keyring.Keyring
+}
+
+type OIDCClientData struct {
+	ClientID     string
+	ClientSecret string
+	Expiration   time.Time
+}
+
+const oidcClientKeyPrefix = "oidc-client:"
+
+func (o *OIDCClientKeyring) fmtKey(startURL string, scopes []string) string {
+	if len(scopes) == 0 {
+		return oidcClientKeyPrefix + startURL
+	}
+	return oidcClientKeyPrefix + startURL + " " + strings.Join(scopes, ",")
+}
+
+func IsOIDCClientKey(k string) bool {
+	return strings.HasPrefix(k, oidcClientKeyPrefix)
+}
+
+func (o *OIDCClientKeyring) Get(startURL string, scopes []string) (*ssooidc.RegisterClientOutput, error) {
+	item, err := o.Keyring.Get(o.fmtKey(startURL, scopes))
+	if err != nil {
+		return nil, err
+	}
+
+	val := OIDCClientData{}
+
+	err = withLockedSecret(item.Data, ownsItemData(o.Keyring), func(b []byte) error {
+		return json.Unmarshal(b, &val)
+	})
+	if err != nil {
+		log.Printf("Invalid data in keyring: %s", err.Error())
+		return nil, keyring.ErrKeyNotFound
+	}
+	if time.Until(val.Expiration) < oidcClientExpiryWindow {
+		log.Printf("OIDC client for '%s' expired, removing", startURL)
+		_ = o.Remove(startURL, scopes)
+		return nil, keyring.ErrKeyNotFound
+	}
+
+	return &ssooidc.RegisterClientOutput{
+		ClientId:              aws.String(val.ClientID),
+		ClientSecret:          aws.String(val.ClientSecret),
+		ClientSecretExpiresAt: val.Expiration.Unix(),
+	}, nil
+}
+
+func (o *OIDCClientKeyring) Set(startURL string, scopes []string, client *ssooidc.RegisterClientOutput) error {
+	val := OIDCClientData{
+		ClientID:     aws.ToString(client.ClientId),
+		ClientSecret: aws.ToString(client.ClientSecret),
+		Expiration:   time.Unix(client.ClientSecretExpiresAt, 0),
+	}
+
+	valJSON, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+
+	return withLockedSecret(valJSON, ownsItemData(o.Keyring), func(b []byte) error {
+		return o.Keyring.Set(keyring.Item{
+			Key:         o.fmtKey(startURL, scopes),
+			Data:        b,
+			Label:       fmt.Sprintf("aws-vault oidc client for %s (expires %s)", startURL, val.Expiration.Format(time.RFC3339)),
+			Description: "aws-vault oidc client",
+		})
+	})
+}
+
+func (o *OIDCClientKeyring) Remove(startURL string, scopes []string) error {
+	return o.Keyring.Remove(o.fmtKey(startURL, scopes))
+}
@@ -0,0 +1,50 @@
+package vault_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+)
+
+func TestOIDCClientKeyring(t *testing.T) {
+	k := &vault.OIDCClientKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+
+	err := k.Set("https://example.awsapps.com/start", nil, &ssooidc.RegisterClientOutput{
+		ClientId:              aws.String("client-id"),
+		ClientSecret:          aws.String("client-secret"),
+		ClientSecretExpiresAt: time.Now().Add(90 * 24 * time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = k.Set("https://expired.awsapps.com/start", nil, &ssooidc.RegisterClientOutput{
+		ClientId:              aws.String("client-id"),
+		ClientSecret:          aws.String("client-secret"),
+		ClientSecretExpiresAt: time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := k.Get("https://example.awsapps.com/start", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(client.ClientId) != "client-id" || aws.ToString(client.ClientSecret) != "client-secret" {
+		t.Fatalf("Unexpected client %v", client)
+	}
+
+	if _, err = k.Get("https://example.awsapps.com/start", []string{"sso:account:access"}); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected a client registered with other scopes not to be used, got %v", err)
+	}
+	if _, err = k.Get("https://expired.awsapps.com/start", nil); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected a client that's about to expire not to be used, got %v", err)
+	}
+	if keys, _ := k.Keyring.Keys(); len(keys) != 1 || !vault.IsOIDCClientKey(keys[0]) {
+		t.Fatalf("Expected the expired client to be removed, got %v", keys)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
 )
 
@@ -37,7 +38,7 @@ func (o OIDCTokenKeyring) Has(startURL string) (bool, error) {
 	}
 
 	for _, k := range kk {
-		if startURL == k {
+		if o.fmtKey(startURL) == k {
 			return true, nil
 		}
 	}
@@ -53,23 +54,81 @@ func (o OIDCTokenKeyring) Get(startURL string) (*ssooidc.CreateTokenOutput, erro
 
 	val := OIDCTokenData{}
 
-	if err = json.Unmarshal(item.Data, &val); err != nil {
+	err = withLockedSecret(item.Data, ownsItemData(o.Keyring), func(b []byte) error {
+		return json.Unmarshal(b, &val)
+	})
+	if err != nil {
 		log.Printf("Invalid data in keyring: %s", err.Error())
 		return nil, keyring.ErrKeyNotFound
 	}
-	if time.Now().After(val.Expiration) {
+	// expired tokens are kept while they have a refresh token, which outlives the access token
+	if time.Now().After(val.Expiration) && aws.ToString(val.Token.RefreshToken) == "" {
 		log.Printf("OIDC token for '%s' expired, removing", startURL)
 		_ = o.Remove(startURL)
 		return nil, keyring.ErrKeyNotFound
 	}
 
 	secondsLeft := time.Until(val.Expiration) / time.Second
+	if secondsLeft < 0 {
+		secondsLeft = 0
+	}
 
 	val.Token.ExpiresIn = int32(secondsLeft)
 
 	return &val.Token, err
 }
 
+// SSOTokenStatus is the state of the SSO token cached for a start URL
+type SSOTokenStatus struct {
+	StartURL        string
+	Cached          bool
+	Expiration      time.Time
+	HasRefreshToken bool
+	// FromAWSCLI is whether the token was cached by the AWS CLI, as none is in the keyring
+	FromAWSCLI bool
+}
+
+// NeedsSignIn is whether getting credentials will sign in to SSO in the browser, as there's no access token
+// that's valid or can be refreshed
+func (s SSOTokenStatus) NeedsSignIn() bool {
+	return !s.Cached || (time.Now().After(s.Expiration) && !s.HasRefreshToken)
+}
+
+// Status returns the state of the token cached for the start URL, without refreshing or removing it. When
+// there's none in the keyring that can be used, the token cached by the AWS CLI for the sso-session is checked
+func (o OIDCTokenKeyring) Status(ssoSession, startURL string) (SSOTokenStatus, error) {
+	status := SSOTokenStatus{StartURL: startURL}
+
+	item, err := o.Keyring.Get(o.fmtKey(startURL))
+	if err != nil && err != keyring.ErrKeyNotFound {
+		return status, err
+	}
+	if err == nil {
+		val := OIDCTokenData{}
+		err = withLockedSecret(item.Data, ownsItemData(o.Keyring), func(b []byte) error {
+			return json.Unmarshal(b, &val)
+		})
+		if err == nil {
+			status.Cached = true
+			status.Expiration = val.Expiration
+			status.HasRefreshToken = aws.ToString(val.Token.RefreshToken) != ""
+		}
+	}
+
+	if status.NeedsSignIn() {
+		if token := readAWSCLISSOToken(ssoSession, startURL); token != nil {
+			return SSOTokenStatus{
+				StartURL:   startURL,
+				Cached:     true,
+				Expiration: time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+				FromAWSCLI: true,
+			}, nil
+		}
+	}
+
+	return status, nil
+}
+
 func (o OIDCTokenKeyring) Set(startURL string, token *ssooidc.CreateTokenOutput) error {
 	val := OIDCTokenData{
 		Token:      *token,
@@ -81,11 +140,13 @@ func (o OIDCTokenKeyring) Set(startURL string, token *ssooidc.CreateTokenOutput)
 		return err
 	}
 
-	return o.Keyring.Set(keyring.Item{
-		Key:         o.fmtKey(startURL),
-		Data:        valJSON,
-		Label:       fmt.Sprintf("aws-vault oidc token for %s (expires %s)", startURL, val.Expiration.Format(time.RFC3339)),
-		Description: "aws-vault oidc token",
+	return withLockedSecret(valJSON, ownsItemData(o.Keyring), func(b []byte) error {
+		return o.Keyring.Set(keyring.Item{
+			Key:         o.fmtKey(startURL),
+			Data:        b,
+			Label:       fmt.Sprintf("aws-vault oidc token for %s (expires %s)", startURL, val.Expiration.Format(time.RFC3339)),
+			Description: "aws-vault oidc token",
+		})
 	})
 }
 
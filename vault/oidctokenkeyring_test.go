@@ -0,0 +1,47 @@
+package vault_test
+
+import (
+	"testing"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+)
+
+func TestOIDCTokenKeyringStatus(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	k := vault.OIDCTokenKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+
+	err := k.Set("https://example.awsapps.com/start", &ssooidc.CreateTokenOutput{
+		AccessToken:  aws.String("token"),
+		RefreshToken: aws.String("refresh"),
+		ExpiresIn:    -60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if has, _ := k.Has("https://example.awsapps.com/start"); !has {
+		t.Error("Expected the token to be found")
+	}
+	if has, _ := k.Has("https://other.awsapps.com/start"); has {
+		t.Error("Expected no token for another start URL")
+	}
+
+	status, err := k.Status("", "https://example.awsapps.com/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Cached || !status.HasRefreshToken || status.NeedsSignIn() {
+		t.Errorf("Expected an expired token that can be refreshed, got %+v", status)
+	}
+
+	status, err = k.Status("", "https://other.awsapps.com/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Cached || !status.NeedsSignIn() {
+		t.Errorf("Expected no token, got %+v", status)
+	}
+}
@@ -0,0 +1,51 @@
+//go:build linux
+// +build linux
+
+package vault
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// getCachedPassphrase reads a passphrase from the session keyring of the kernel
+func getCachedPassphrase(name string) (string, error) {
+	id, err := unix.KeyctlSearch(unix.KEY_SPEC_SESSION_KEYRING, "user", name, 0)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 4096)
+	defer zeroBytes(buf)
+	n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+	if err != nil {
+		return "", err
+	}
+	if n > len(buf) {
+		return "", unix.EMSGSIZE
+	}
+
+	return string(buf[:n]), nil
+}
+
+// cachePassphrase stores a passphrase in the session keyring of the kernel, which removes it after ttl
+func cachePassphrase(name, passphrase string, ttl time.Duration) error {
+	id, err := unix.AddKey("user", name, []byte(passphrase), unix.KEY_SPEC_SESSION_KEYRING)
+	if err != nil {
+		return err
+	}
+
+	seconds := int(ttl.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	_, err = unix.KeyctlInt(unix.KEYCTL_SET_TIMEOUT, id, seconds, 0, 0)
+	return err
+}
+
+func forgetCachedPassphrase(name string) {
+	if id, err := unix.KeyctlSearch(unix.KEY_SPEC_SESSION_KEYRING, "user", name, 0); err == nil {
+		_, _ = unix.KeyctlInt(unix.KEYCTL_INVALIDATE, id, 0, 0, 0)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package vault
+
+import (
+	"errors"
+	"time"
+)
+
+var errPassphraseCacheUnsupported = errors.New("caching the passphrase is only supported on Linux")
+
+func getCachedPassphrase(name string) (string, error) {
+	return "", errPassphraseCacheUnsupported
+}
+
+func cachePassphrase(name, passphrase string, ttl time.Duration) error {
+	return errPassphraseCacheUnsupported
+}
+
+func forgetCachedPassphrase(name string) {}
@@ -0,0 +1,108 @@
+package vault
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// prefetcher is implemented by providers that can start reading from the keyring before they're used
+type prefetcher interface {
+	prefetch()
+}
+
+// prefetchAll starts the cached session and SSO token reads of every step of a chain at once. Otherwise
+// each step only reads the keyring once the step before it has finished, which makes deep chains slow
+// to start. Master credentials aren't prefetched, so they're only read from the keyring when they're used
+func prefetchAll(prefetchers []prefetcher) {
+	if len(prefetchers) < 2 {
+		return
+	}
+	for _, p := range prefetchers {
+		p.prefetch()
+	}
+}
+
+type sessionFetch struct {
+	creds *ststypes.Credentials
+	err   error
+}
+
+// prefetchedSession reads a session from the keyring in the background. The result is only used once,
+// so later reads, such as those by the credential servers, see sessions stored since
+type prefetchedSession struct {
+	mu     sync.Mutex
+	result chan sessionFetch
+}
+
+func (f *prefetchedSession) start(read func() (*ststypes.Credentials, error)) {
+	ch := make(chan sessionFetch, 1)
+	f.mu.Lock()
+	f.result = ch
+	f.mu.Unlock()
+
+	go func() {
+		creds, err := read()
+		ch <- sessionFetch{creds, err}
+	}()
+}
+
+// get returns the prefetched result the first time it's called, if there is one, and otherwise reads the session
+func (f *prefetchedSession) get(read func() (*ststypes.Credentials, error)) (*ststypes.Credentials, error) {
+	f.mu.Lock()
+	ch := f.result
+	f.result = nil
+	f.mu.Unlock()
+
+	if ch == nil {
+		return read()
+	}
+	r := <-ch
+	return r.creds, r.err
+}
+
+type oidcTokenFetch struct {
+	token *ssooidc.CreateTokenOutput
+	err   error
+}
+
+// prefetchingOIDCTokenCache reads the SSO token for a start URL in the background, so it can be read
+// at the same time as the cached session
+type prefetchingOIDCTokenCache struct {
+	OIDCTokenCacher
+	StartURL string
+	// Refresh skips prefetching the token when it's to be ignored
+	Refresh bool
+
+	mu     sync.Mutex
+	result chan oidcTokenFetch
+}
+
+func (c *prefetchingOIDCTokenCache) prefetch() {
+	if ssoSignInFor(c.StartURL).refreshToken(c.Refresh) {
+		return
+	}
+	ch := make(chan oidcTokenFetch, 1)
+	c.mu.Lock()
+	c.result = ch
+	c.mu.Unlock()
+
+	go func() {
+		token, err := c.OIDCTokenCacher.Get(c.StartURL)
+		ch <- oidcTokenFetch{token, err}
+	}()
+}
+
+func (c *prefetchingOIDCTokenCache) Get(startURL string) (*ssooidc.CreateTokenOutput, error) {
+	c.mu.Lock()
+	ch := c.result
+	c.result = nil
+	c.mu.Unlock()
+
+	if ch == nil || startURL != c.StartURL {
+		return c.OIDCTokenCacher.Get(startURL)
+	}
+	r := <-ch
+	return r.token, r.err
+}
@@ -0,0 +1,37 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+func TestPrefetchedSessionIsOnlyUsedOnce(t *testing.T) {
+	reads := 0
+	read := func() (*ststypes.Credentials, error) {
+		reads++
+		return &ststypes.Credentials{AccessKeyId: aws.String("ASIAEXAMPLEKEYID1234")}, nil
+	}
+
+	var f prefetchedSession
+	f.start(read)
+
+	creds, err := f.get(read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(creds.AccessKeyId) != "ASIAEXAMPLEKEYID1234" {
+		t.Fatalf("Unexpected credentials %v", creds)
+	}
+	if reads != 1 {
+		t.Fatalf("Expected the prefetched session to be used, got %d reads", reads)
+	}
+
+	if _, err = f.get(read); err != nil {
+		t.Fatal(err)
+	}
+	if reads != 2 {
+		t.Fatalf("Expected the session to be read again, got %d reads", reads)
+	}
+}
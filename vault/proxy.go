@@ -0,0 +1,116 @@
+package vault
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// profileProxy is the proxy of a profile, set with https_proxy and no_proxy. Those that aren't
+// set in the profile come from the environment, as they do for profiles that set neither
+type profileProxy struct {
+	HTTPSProxy string
+	NoProxy    string
+}
+
+// proxyClients are the HTTP clients of each proxy, so that the steps of a chain using the same
+// proxy share connections like those using the shared httpClient
+var proxyClients = struct {
+	sync.Mutex
+	m map[profileProxy]*awshttp.BuildableClient
+}{m: map[profileProxy]*awshttp.BuildableClient{}}
+
+// HTTPClient returns the client for calls made for the profile, which uses the proxy of the profile
+func HTTPClient(config *Config) aws.HTTPClient {
+	if config == nil || (config.HTTPSProxy == "" && config.NoProxy == "") {
+		return httpClient
+	}
+
+	p := profileProxy{HTTPSProxy: config.HTTPSProxy, NoProxy: config.NoProxy}
+	if p.HTTPSProxy == "" {
+		p.HTTPSProxy = getEnv("HTTPS_PROXY", "https_proxy")
+	}
+	if p.NoProxy == "" {
+		p.NoProxy = getEnv("NO_PROXY", "no_proxy")
+	}
+
+	proxyClients.Lock()
+	defer proxyClients.Unlock()
+	client, ok := proxyClients.m[p]
+	if !ok {
+		logf(LogFields{Profile: config.ProfileName}, "profile %s: using proxy %q, except for %q", config.ProfileName, p.HTTPSProxy, p.NoProxy)
+		client = httpClient.WithTransportOptions(func(tr *http.Transport) {
+			tr.Proxy = p.proxyFunc
+		})
+		proxyClients.m[p] = client
+	}
+	return client
+}
+
+// AddProfileProxy makes the SDK clients of the config use the proxy of the profile
+func AddProfileProxy(cfg *aws.Config, config *Config) {
+	cfg.HTTPClient = HTTPClient(config)
+}
+
+func (p profileProxy) proxyFunc(req *http.Request) (*url.URL, error) {
+	if p.HTTPSProxy == "" || p.bypass(req.URL.Hostname()) {
+		return nil, nil
+	}
+
+	proxy := p.HTTPSProxy
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("Invalid https_proxy %q", p.HTTPSProxy)
+	}
+	return proxyURL, nil
+}
+
+// bypass is whether the host is in no_proxy, a comma separated list of hosts, domains that their
+// subdomains match too, IP addresses, CIDR ranges and `*` for all hosts
+func (p profileProxy) bypass(host string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+
+	for _, entry := range strings.Split(p.NoProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+func getEnv(keys ...string) string {
+	for _, key := range keys {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package vault
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProfileProxy(t *testing.T) {
+	p := profileProxy{HTTPSProxy: "proxy.corp.example:3128", NoProxy: "localhost, .internal.example,10.0.0.0/8,sts.us-east-1.amazonaws.com:443"}
+
+	cases := map[string]string{
+		"https://sts.eu-west-1.amazonaws.com/":       "http://proxy.corp.example:3128",
+		"https://sts.us-east-1.amazonaws.com/":       "",
+		"https://localhost:8443/":                    "",
+		"https://oidc.internal.example/":             "",
+		"https://internal.example/":                  "",
+		"https://notinternal.example/":               "http://proxy.corp.example:3128",
+		"https://10.1.2.3/":                          "",
+		"https://portal.sso.us-east-1.amazonaws.com": "http://proxy.corp.example:3128",
+	}
+	for u, expected := range cases {
+		req, _ := http.NewRequest(http.MethodGet, u, nil)
+		proxyURL, err := p.proxyFunc(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if proxyURL != nil {
+			got = proxyURL.String()
+		}
+		if got != expected {
+			t.Errorf("Expected the proxy for %s to be %q, got %q", u, expected, got)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://sts.amazonaws.com/", nil)
+	if proxyURL, _ := (profileProxy{HTTPSProxy: "http://proxy:3128", NoProxy: "*"}).proxyFunc(req); proxyURL != nil {
+		t.Errorf("Expected no_proxy = * to bypass the proxy, got %s", proxyURL)
+	}
+}
+
+func TestHTTPClientIsSharedWithoutProxy(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "")
+	if HTTPClient(&Config{}) != httpClient {
+		t.Error("Expected profiles without a proxy to use the shared client")
+	}
+	a := HTTPClient(&Config{HTTPSProxy: "http://proxy:3128"})
+	if a == httpClient || a != HTTPClient(&Config{ProfileName: "other", HTTPSProxy: "http://proxy:3128"}) {
+		t.Error("Expected profiles with the same proxy to share a client")
+	}
+}
@@ -0,0 +1,39 @@
+package vault
+
+import (
+	"log"
+
+	"github.com/99designs/keyring"
+)
+
+// zeroBytes overwrites a buffer that held a secret
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// ownsItemData reports whether aws-vault can zero the data of items passed to and returned from
+// the keyring once it's done with them. The ArrayKeyring keeps the data it's given, rather than a copy
+func ownsItemData(k keyring.Keyring) bool {
+	if c, ok := k.(*FileSessionCache); ok {
+		return ownsItemData(c.Keyring)
+	}
+	_, isArrayKeyring := k.(*keyring.ArrayKeyring)
+	return !isArrayKeyring
+}
+
+// withLockedSecret keeps b out of swap while fn uses it, and zeroes b afterwards if wipe is set
+func withLockedSecret(b []byte, wipe bool, fn func([]byte) error) error {
+	if len(b) > 0 {
+		if err := lockMemory(b); err != nil {
+			log.Printf("Couldn't lock memory holding secrets: %s", err.Error())
+		} else {
+			defer unlockMemory(b)
+		}
+	}
+	if wipe {
+		defer zeroBytes(b)
+	}
+	return fn(b)
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !windows
+// +build !linux,!darwin,!freebsd,!openbsd,!netbsd,!windows
+
+package vault
+
+func lockMemory(b []byte) error {
+	return nil
+}
+
+func unlockMemory(b []byte) {}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd
+// +build linux darwin freebsd openbsd netbsd
+
+package vault
+
+import "golang.org/x/sys/unix"
+
+func lockMemory(b []byte) error {
+	return unix.Mlock(b)
+}
+
+func unlockMemory(b []byte) {
+	_ = unix.Munlock(b)
+}
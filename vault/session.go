@@ -0,0 +1,89 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// SessionOptions configure a Session
+type SessionOptions struct {
+	// Keyring stores the master credentials, and caches sessions and SSO tokens. Any keyring.Keyring
+	// works, such as one from keyring.Open, or keyring.NewArrayKeyring in tests
+	Keyring keyring.Keyring
+
+	// ConfigFile is the AWS config file of the profile. When nil, the files named by AWS_CONFIG_FILE,
+	// or ~/.aws/config, are loaded
+	ConfigFile *ConfigFile
+
+	// Config is the base of the profile's config, with anything set here taking precedence over the
+	// config file. Settings such as NoSession, NoSessionCache, RefreshSessions and NoPrompt apply to
+	// every profile in a chain of source profiles
+	Config Config
+}
+
+// Session issues credentials for a profile as aws-vault does, so other Go programs can use aws-vault's
+// profiles and keyring without running it. Unlike the CLI, a Session is only configured by its
+// SessionOptions, so sessions with different options can be used at once
+type Session struct {
+	// Config is the loaded config of the profile
+	Config *Config
+
+	provider aws.CredentialsProvider
+}
+
+// NewSession loads the config of the profile and creates a Session for it. No credentials are
+// retrieved until they're asked for
+func NewSession(ctx context.Context, profileName string, opts SessionOptions) (s *Session, err error) {
+	_, span := StartSpan(ctx, "new session")
+	span.SetAttribute("aws_vault.profile", profileName)
+	defer func() { span.End(err) }()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if profileName == "" {
+		return nil, errors.New("No profile given")
+	}
+	if opts.Keyring == nil {
+		return nil, errors.New("No keyring given")
+	}
+
+	configFile := opts.ConfigFile
+	if configFile == nil {
+		if configFile, err = LoadConfigFromEnv(); err != nil {
+			return nil, err
+		}
+	}
+
+	configLoader := &ConfigLoader{
+		BaseConfig:    opts.Config,
+		File:          configFile,
+		ActiveProfile: profileName,
+	}
+	config, err := configLoader.LoadFromProfile(profileName)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading config: %w", err)
+	}
+
+	provider, err := NewTempCredentialsProvider(config, &CredentialKeyring{Keyring: opts.Keyring})
+	if err != nil {
+		return nil, fmt.Errorf("Error getting temporary credentials: %w", err)
+	}
+
+	return &Session{Config: config, provider: provider}, nil
+}
+
+// Retrieve returns credentials for the profile, from a cached session when there is one. It makes
+// Session an aws.CredentialsProvider
+func (s *Session) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	return s.provider.Retrieve(ctx)
+}
+
+// AwsConfig returns an AWS SDK config for the profile's region, with credentials from the session
+func (s *Session) AwsConfig() aws.Config {
+	return NewAwsConfigWithCredsProvider(aws.NewCredentialsCache(s), s.Config.Region, s.Config.STSRegionalEndpoints)
+}
@@ -0,0 +1,128 @@
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/99designs/keyring"
+)
+
+const sessionCacheKeyName = "aws-vault-session-cache-key"
+
+// sessionCacheArgon2Params are cheap, as the session cache key is random rather than a passphrase
+var sessionCacheArgon2Params = Argon2Params{Time: 1, Memory: 1024, Threads: 1}
+
+// IsSessionCacheKey checks if the key is the one holding the encryption key of the FileSessionCache
+func IsSessionCacheKey(k string) bool {
+	return k == sessionCacheKeyName
+}
+
+// isCachedKey checks if the key is for a session, SSO token, SSO client or credential plugin state, which the
+// FileSessionCache stores
+func isCachedKey(k string) bool {
+	return IsSessionKey(k) || IsOIDCTokenKey(k) || IsOIDCClientKey(k) || IsCredentialPluginStateKey(k)
+}
+
+// FileSessionCache is a keyring that stores sessions and SSO tokens in encrypted files instead of
+// the wrapped keyring, which can be slow or prompt on every write. The files are encrypted with a
+// random key kept in the wrapped keyring, so it's only read once for all the sessions used
+type FileSessionCache struct {
+	keyring.Keyring
+	cache *FileKeyring
+}
+
+// NewFileSessionCache returns a keyring that stores sessions in encrypted files in dir, and everything else in k
+func NewFileSessionCache(k keyring.Keyring, dir string) *FileSessionCache {
+	c := &FileSessionCache{Keyring: k}
+	c.cache = &FileKeyring{
+		Dir:          dir,
+		PasswordFunc: c.cacheKey,
+		Params:       sessionCacheArgon2Params,
+	}
+	return c
+}
+
+// cacheKey gets the encryption key for the cache from the wrapped keyring, creating it the first time
+func (c *FileSessionCache) cacheKey(string) (string, error) {
+	item, err := c.Keyring.Get(sessionCacheKeyName)
+	if err == nil {
+		return string(item.Data), nil
+	}
+	if !errors.Is(err, keyring.ErrKeyNotFound) {
+		return "", err
+	}
+
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", err
+	}
+	item = keyring.Item{
+		Key:   sessionCacheKeyName,
+		Label: "aws-vault (session cache key)",
+		Data:  []byte(hex.EncodeToString(b)),
+	}
+	if err = c.Keyring.Set(item); err != nil {
+		return "", err
+	}
+	return string(item.Data), nil
+}
+
+// Get reads sessions from the cache, falling back to the wrapped keyring for sessions stored
+// before the cache was used
+func (c *FileSessionCache) Get(key string) (keyring.Item, error) {
+	if isCachedKey(key) {
+		item, err := c.cache.Get(key)
+		if !errors.Is(err, keyring.ErrKeyNotFound) {
+			return item, err
+		}
+	}
+	return c.Keyring.Get(key)
+}
+
+func (c *FileSessionCache) GetMetadata(key string) (keyring.Metadata, error) {
+	if isCachedKey(key) {
+		md, err := c.cache.GetMetadata(key)
+		if !errors.Is(err, keyring.ErrKeyNotFound) {
+			return md, err
+		}
+	}
+	return c.Keyring.GetMetadata(key)
+}
+
+func (c *FileSessionCache) Set(item keyring.Item) error {
+	if isCachedKey(item.Key) {
+		return c.cache.Set(item)
+	}
+	return c.Keyring.Set(item)
+}
+
+func (c *FileSessionCache) Remove(key string) error {
+	if isCachedKey(key) {
+		err := c.cache.Remove(key)
+		if err == nil {
+			return nil
+		}
+	}
+	return c.Keyring.Remove(key)
+}
+
+// Keys returns the keys in both the cache and the wrapped keyring
+func (c *FileSessionCache) Keys() ([]string, error) {
+	keys, err := c.Keyring.Keys()
+	if err != nil {
+		return nil, err
+	}
+	cachedKeys, err := c.cache.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for _, k := range keys {
+		if !IsSessionCacheKey(k) {
+			result = append(result, k)
+		}
+	}
+	return append(result, cachedKeys...), nil
+}
@@ -0,0 +1,64 @@
+package vault_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+func TestFileSessionCache(t *testing.T) {
+	main := keyring.NewArrayKeyring([]keyring.Item{{Key: "foo", Data: []byte(`{}`)}})
+	cache := vault.NewFileSessionCache(main, filepath.Join(t.TempDir(), "sessions"))
+	sk := &vault.SessionKeyring{Keyring: cache}
+
+	key := vault.SessionMetadata{Type: "sts.GetSessionToken", ProfileName: "foo"}
+	err := sk.Set(key, &ststypes.Credentials{
+		AccessKeyId:     aws.String("ASIAEXAMPLE"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := sk.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(creds.AccessKeyId) != "ASIAEXAMPLE" {
+		t.Fatalf("Unexpected credentials %+v", creds)
+	}
+
+	mainKeys, err := main.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range mainKeys {
+		if vault.IsSessionKey(k) {
+			t.Fatalf("Session %q was stored in the keyring instead of the cache", k)
+		}
+	}
+
+	ck := &vault.CredentialKeyring{Keyring: cache}
+	names, err := ck.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "foo" {
+		t.Fatalf("Expected only the foo credentials, got %v", names)
+	}
+
+	sessions, err := sk.GetAllMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ProfileName != "foo" {
+		t.Fatalf("Expected the foo session, got %v", sessions)
+	}
+}
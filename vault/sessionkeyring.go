@@ -1,20 +1,20 @@
 package vault
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
 	"regexp"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/99designs/keyring"
 	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
 )
 
-var sessionKeyPattern = regexp.MustCompile(`^(?P<type>[^,]+),(?P<profile>[^,]+),(?P<mfaSerial>[^,]*),(?P<expiration>[0-9]{1,})$`)
+var sessionKeyPattern = regexp.MustCompile(`^(?P<type>[^,]+),(?P<profile>[^,]+),(?P<mfaSerial>[^,]*),(?:(?P<parameters>[A-Za-z0-9_-]+),)?(?P<expiration>[0-9]{1,})$`)
 
 var oldSessionKeyPatterns = []*regexp.Regexp{
 	regexp.MustCompile(`^session,(?P<profile>[^,]+),(?P<mfaSerial>[^,]*),(?P<expiration>[0-9]{2,})$`),
@@ -45,26 +45,118 @@ type SessionMetadata struct {
 	Type        string
 	ProfileName string
 	MfaSerial   string
-	Expiration  time.Time
+	// Parameters is a hash of the parameters the session was created with, such as its duration and
+	// session policy, so that a session isn't reused after they change
+	Parameters string
+	Expiration time.Time
+}
+
+// sessionParameters hashes the parameters a session is created with. They're formatted with Go syntax,
+// which can't fail and prints maps sorted by key, so the same parameters always give the same hash
+func sessionParameters(params map[string]interface{}) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%#v", params)))
+	return base64URLEncodingNoPadding.EncodeToString(sum[:9])
+}
+
+// The session keys below are shared by the providers and DescribeChain, so that a chain can be checked
+// for cached sessions without creating the providers
+
+func sessionTokenSessionKey(config *Config) SessionMetadata {
+	return SessionMetadata{
+		Type:        "sts.GetSessionToken",
+		ProfileName: config.ProfileName,
+		MfaSerial:   config.MfaSerial,
+		Parameters: sessionParameters(map[string]interface{}{
+			"duration": config.GetSessionTokenDuration(),
+		}),
+	}
+}
+
+func assumeRoleSessionKey(config *Config) SessionMetadata {
+	return SessionMetadata{
+		Type:        "sts.AssumeRole",
+		ProfileName: config.ProfileName,
+		MfaSerial:   config.MfaSerial,
+		Parameters: sessionParameters(map[string]interface{}{
+			"role_arn":            config.RoleARN,
+			"role_session_name":   config.RoleSessionName,
+			"external_id":         config.ExternalID,
+			"duration":            config.AssumeRoleDuration,
+			"tags":                config.SessionTags,
+			"transitive_tag_keys": config.TransitiveSessionTags,
+			"source_identity":     config.SourceIdentity,
+			"policy":              config.SessionPolicy,
+			"policy_arns":         config.SessionPolicyARNs,
+		}),
+	}
+}
+
+func webIdentitySessionKey(config *Config) SessionMetadata {
+	return SessionMetadata{
+		Type:        "sts.AssumeRoleWithWebIdentity",
+		ProfileName: config.ProfileName,
+		Parameters: sessionParameters(map[string]interface{}{
+			"role_arn":          config.RoleARN,
+			"role_session_name": config.RoleSessionName,
+			"duration":          config.AssumeRoleDuration,
+		}),
+	}
+}
+
+func ssoRoleSessionKey(config *Config) SessionMetadata {
+	return SessionMetadata{
+		Type:        "sso.GetRoleCredentials",
+		ProfileName: config.ProfileName,
+		MfaSerial:   config.SSOStartURL,
+		Parameters: sessionParameters(map[string]interface{}{
+			"account_id": config.SSOAccountID,
+			"role_name":  config.SSORoleName,
+		}),
+	}
+}
+
+func credentialProcessSessionKey(config *Config) SessionMetadata {
+	return SessionMetadata{
+		Type:        "credential_process",
+		ProfileName: config.ProfileName,
+		Parameters: sessionParameters(map[string]interface{}{
+			"command": config.CredentialProcess,
+		}),
+	}
+}
+
+func credentialPluginSessionKey(config *Config) SessionMetadata {
+	return SessionMetadata{
+		Type:        "credential_plugin",
+		ProfileName: config.ProfileName,
+		MfaSerial:   config.MfaSerial,
+		Parameters: sessionParameters(map[string]interface{}{
+			"command": config.CredentialPlugin,
+		}),
+	}
 }
 
 func (k *SessionMetadata) String() string {
+	parameters := ""
+	if k.Parameters != "" {
+		parameters = k.Parameters + ","
+	}
 	return fmt.Sprintf(
-		"%s,%s,%s,%d",
+		"%s,%s,%s,%s%d",
 		k.Type,
 		base64URLEncodingNoPadding.EncodeToString([]byte(k.ProfileName)),
 		base64URLEncodingNoPadding.EncodeToString([]byte(k.MfaSerial)),
+		parameters,
 		k.Expiration.Unix(),
 	)
 }
 
-func (k *SessionMetadata) StringForMatching() string {
-	return fmt.Sprintf(
-		"%s,%s,%s,",
-		k.Type,
-		base64URLEncodingNoPadding.EncodeToString([]byte(k.ProfileName)),
-		base64URLEncodingNoPadding.EncodeToString([]byte(k.MfaSerial)),
-	)
+// matches checks if other is a session for the same profile, created with the same parameters
+func (k *SessionMetadata) matches(other SessionMetadata) bool {
+	return k.Type == other.Type &&
+		k.ProfileName == other.ProfileName &&
+		k.MfaSerial == other.MfaSerial &&
+		k.Parameters == other.Parameters
 }
 
 func NewSessionKeyFromString(s string) (SessionMetadata, error) {
@@ -81,7 +173,7 @@ func NewSessionKeyFromString(s string) (SessionMetadata, error) {
 	if err != nil {
 		return SessionMetadata{}, err
 	}
-	expiryUnixtime, err := strconv.Atoi(matches[4])
+	expiryUnixtime, err := strconv.Atoi(matches[5])
 	if err != nil {
 		return SessionMetadata{}, err
 	}
@@ -90,12 +182,16 @@ func NewSessionKeyFromString(s string) (SessionMetadata, error) {
 		Type:        matches[1],
 		ProfileName: string(profileName),
 		MfaSerial:   string(mfaSerial),
+		Parameters:  matches[4],
 		Expiration:  time.Unix(int64(expiryUnixtime), 0),
 	}, nil
 }
 
 type SessionKeyring struct {
 	Keyring keyring.Keyring
+	// Hooks run the session-expired hook for each expired session that's removed, whether it's purged
+	// when the sessions are read or written, or removed with the rest of a profile's sessions
+	Hooks HooksSection
 }
 
 var ErrNotFound = keyring.ErrKeyNotFound
@@ -106,7 +202,7 @@ func (sk *SessionKeyring) lookupKeyName(key SessionMetadata) (string, error) {
 		return key.String(), err
 	}
 	for _, keyName := range allKeys {
-		if strings.HasPrefix(keyName, key.StringForMatching()) {
+		if k, err := NewSessionKeyFromString(keyName); err == nil && key.matches(k) {
 			return keyName, nil
 		}
 	}
@@ -136,7 +232,10 @@ func (sk *SessionKeyring) Get(key SessionMetadata) (creds *ststypes.Credentials,
 	if err != nil {
 		return creds, err
 	}
-	if err = json.Unmarshal(item.Data, &creds); err != nil {
+	err = withLockedSecret(item.Data, ownsItemData(sk.Keyring), func(b []byte) error {
+		return json.Unmarshal(b, &creds)
+	})
+	if err != nil {
 		log.Printf("SessionKeyring: Ignoring invalid data: %s", err.Error())
 		return creds, ErrNotFound
 	}
@@ -166,11 +265,13 @@ func (sk *SessionKeyring) Set(key SessionMetadata, creds *ststypes.Credentials)
 		}
 	}
 
-	return sk.Keyring.Set(keyring.Item{
-		Key:         key.String(),
-		Data:        valJSON,
-		Label:       fmt.Sprintf("aws-vault session for %s (expires %s)", key.ProfileName, creds.Expiration.Format(time.RFC3339)),
-		Description: "aws-vault session",
+	return withLockedSecret(valJSON, ownsItemData(sk.Keyring), func(b []byte) error {
+		return sk.Keyring.Set(keyring.Item{
+			Key:         key.String(),
+			Data:        b,
+			Label:       fmt.Sprintf("aws-vault session for %s (expires %s)", key.ProfileName, creds.Expiration.Format(time.RFC3339)),
+			Description: "aws-vault session",
+		})
 	})
 }
 
@@ -193,6 +294,7 @@ func (sk *SessionKeyring) RemoveAll() (n int, err error) {
 			return n, err
 		}
 		n++
+		sk.removed(key)
 	}
 	return n, nil
 }
@@ -254,6 +356,7 @@ func (sk *SessionKeyring) RemoveForProfile(profileName string) (n int, err error
 				return n, err
 			}
 			n++
+			sk.removed(s)
 		}
 	}
 
@@ -286,9 +389,26 @@ func (sk *SessionKeyring) RemoveOldSessions() (n int, err error) {
 					continue
 				}
 				n++
+				sk.removed(stsk)
 			}
 		}
 	}
 
 	return n, nil
 }
+
+// removed runs the session-expired hook if the session that's been removed had expired
+func (sk *SessionKeyring) removed(m SessionMetadata) {
+	if time.Now().After(m.Expiration) {
+		sk.Hooks.Run(HookSessionExpired, map[string]string{
+			"profile":      m.ProfileName,
+			"session_type": m.Type,
+			"expiration":   m.Expiration.UTC().Format(time.RFC3339),
+		})
+	}
+}
+
+// Lookup returns the metadata of the session stored for the key, with its expiration, or ErrNotFound
+func (sk *SessionKeyring) Lookup(key SessionMetadata) (SessionMetadata, error) {
+	return sk.realSessionKey(key)
+}
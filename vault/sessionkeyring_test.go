@@ -2,8 +2,12 @@ package vault_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/99designs/aws-vault/v7/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
 )
 
 func TestIsSessionKey(t *testing.T) {
@@ -16,6 +20,7 @@ func TestIsSessionKey(t *testing.T) {
 		{"blah-iam session (32383863333237616430)", true},
 		{"session,c2Vzc2lvbg,,1572281751", true},
 		{"session,c2Vzc2lvbg,YXJuOmF3czppYW06OjEyMzQ1Njc4OTA6bWZhL2pzdGV3bW9u,1572281751", true},
+		{"sts.AssumeRole,c2Vzc2lvbg,,Gx4MYyS9W0A3,1572281751", true},
 	}
 
 	for _, tc := range testCases {
@@ -26,3 +31,34 @@ func TestIsSessionKey(t *testing.T) {
 		}
 	}
 }
+
+func TestSessionKeyringMatchesParameters(t *testing.T) {
+	sk := &vault.SessionKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	readOnly := vault.SessionMetadata{Type: "sts.AssumeRole", ProfileName: "foo", Parameters: "cmVhZG9ubHk"}
+	admin := vault.SessionMetadata{Type: "sts.AssumeRole", ProfileName: "foo", Parameters: "YWRtaW4"}
+
+	err := sk.Set(readOnly, &ststypes.Credentials{
+		AccessKeyId:     aws.String("ASIAEXAMPLEKEYID1234"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = sk.Get(readOnly); err != nil {
+		t.Fatalf("Expected the session to be found: %v", err)
+	}
+	if _, err = sk.Get(admin); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected a session created with other parameters not to be found, got %v", err)
+	}
+
+	keys, err := sk.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Parameters != readOnly.Parameters {
+		t.Fatalf("Expected the parameters to be parsed from the key, got %v", keys)
+	}
+}
@@ -2,7 +2,6 @@ package vault
 
 import (
 	"context"
-	"log"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -54,7 +53,8 @@ func (p *SessionTokenProvider) GetSessionToken(ctx context.Context) (*ststypes.C
 		return nil, err
 	}
 
-	log.Printf("Generated credentials %s using GetSessionToken, expires in %s", FormatKeyForDisplay(*resp.Credentials.AccessKeyId), time.Until(*resp.Credentials.Expiration).String())
+	expiresIn := time.Until(*resp.Credentials.Expiration)
+	logf(LogFields{Provider: "session_token", Duration: expiresIn}, "Generated credentials %s using GetSessionToken, expires in %s", FormatKeyForDisplay(*resp.Credentials.AccessKeyId), expiresIn.String())
 
 	return resp.Credentials, nil
 }
@@ -0,0 +1,70 @@
+package vault
+
+import (
+	"context"
+	"sort"
+
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+)
+
+// SSOAccountRole is a role that can be used with SSO in an account
+type SSOAccountRole struct {
+	AccountID   string
+	AccountName string
+	RoleName    string
+}
+
+// ListSSOAccountRoles signs in to the SSO start URL of the config, or uses the token cached in the
+// keyring, and lists the roles that can be used in each account, sorted by account name
+func ListSSOAccountRoles(ctx context.Context, k keyring.Keyring, config *Config) ([]SSOAccountRole, error) {
+	p := newSSOTokenProvider(k, config)
+
+	token, _, err := p.getOIDCToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client := p.SSOClient
+	roles := []SSOAccountRole{}
+
+	accounts := sso.NewListAccountsPaginator(client, &sso.ListAccountsInput{
+		AccessToken: token.AccessToken,
+	})
+	for accounts.HasMorePages() {
+		page, err := accounts.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, account := range page.AccountList {
+			accountRoles := sso.NewListAccountRolesPaginator(client, &sso.ListAccountRolesInput{
+				AccessToken: token.AccessToken,
+				AccountId:   account.AccountId,
+			})
+			for accountRoles.HasMorePages() {
+				rolesPage, err := accountRoles.NextPage(ctx)
+				if err != nil {
+					return nil, err
+				}
+				for _, role := range rolesPage.RoleList {
+					roles = append(roles, SSOAccountRole{
+						AccountID:   aws.ToString(account.AccountId),
+						AccountName: aws.ToString(account.AccountName),
+						RoleName:    aws.ToString(role.RoleName),
+					})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(roles, func(i, j int) bool {
+		if roles[i].AccountName != roles[j].AccountName {
+			return roles[i].AccountName < roles[j].AccountName
+		}
+		return roles[i].RoleName < roles[j].RoleName
+	})
+
+	return roles, nil
+}
@@ -0,0 +1,295 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+)
+
+// Flows for signing in to SSO, set with --sso-flow. The authorization code flow with PKCE redirects
+// the browser back to a listener on localhost, so there's no code to confirm
+const (
+	SSOFlowDeviceCode = "device-code"
+	SSOFlowAuthCode   = "auth-code"
+)
+
+// ssoAuthCodeTimeout is how long to wait for the browser to be redirected back after signing in
+const ssoAuthCodeTimeout = 10 * time.Minute
+
+// ssoRedirectPath is the path of the listener that the browser is redirected to. Clients are registered
+// without a port, as any port of a loopback address is allowed
+const ssoRedirectPath = "/oauth/callback"
+
+// oidcEndpoint is the endpoint of the SSO OIDC API in the region
+func oidcEndpoint(region string) string {
+	if strings.HasPrefix(region, "cn-") {
+		return fmt.Sprintf("https://oidc.%s.amazonaws.com.cn", region)
+	}
+	return fmt.Sprintf("https://oidc.%s.amazonaws.com", region)
+}
+
+// clientCacheKey is the start URL that OIDC clients are cached under. Clients for the authorization
+// code flow are registered with other grant types and a redirect URI, so are cached separately
+func (p *SSORoleCredentialsProvider) clientCacheKey() string {
+	if p.Flow == SSOFlowAuthCode {
+		return p.StartURL + "#" + SSOFlowAuthCode
+	}
+	return p.StartURL
+}
+
+// oidcRequest calls an operation of the SSO OIDC API. The version of the SDK used doesn't have the
+// parameters of the authorization code flow, but the API is plain JSON without request signing
+func (p *SSORoleCredentialsProvider) oidcRequest(ctx context.Context, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, oidcEndpoint(p.SSORegion)+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := p.HTTPClient
+	if client == nil {
+		client = httpClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var oidcErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(b, &oidcErr) == nil && oidcErr.Error != "" {
+			return fmt.Errorf("SSO OIDC %s failed: %s %s", path, oidcErr.Error, oidcErr.Description)
+		}
+		return fmt.Errorf("SSO OIDC %s failed: %s", path, resp.Status)
+	}
+
+	return json.Unmarshal(b, out)
+}
+
+// registerAuthCodeClient returns the OIDC client registered for the authorization code flow, or registers a new one
+func (p *SSORoleCredentialsProvider) registerAuthCodeClient(ctx context.Context) (*ssooidc.RegisterClientOutput, error) {
+	if p.OIDCClientCache != nil {
+		client, err := p.OIDCClientCache.Get(p.clientCacheKey(), p.RegistrationScopes)
+		if err == nil {
+			log.Printf("Re-using OIDC client for %s (expires at: %s)", p.StartURL, time.Unix(client.ClientSecretExpiresAt, 0))
+			return client, nil
+		}
+		if err != keyring.ErrKeyNotFound {
+			return nil, err
+		}
+	}
+
+	var out struct {
+		ClientID              string `json:"clientId"`
+		ClientSecret          string `json:"clientSecret"`
+		ClientSecretExpiresAt int64  `json:"clientSecretExpiresAt"`
+	}
+	err := p.oidcRequest(ctx, "/client/register", map[string]interface{}{
+		"clientName":   "aws-vault",
+		"clientType":   "public",
+		"scopes":       p.RegistrationScopes,
+		"grantTypes":   []string{"authorization_code", "refresh_token"},
+		"redirectUris": []string{"http://127.0.0.1" + ssoRedirectPath},
+		"issuerUrl":    p.StartURL,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &ssooidc.RegisterClientOutput{
+		ClientId:              aws.String(out.ClientID),
+		ClientSecret:          aws.String(out.ClientSecret),
+		ClientSecretExpiresAt: out.ClientSecretExpiresAt,
+	}
+	log.Printf("Created new OIDC client for the authorization code flow (expires at: %s)", time.Unix(client.ClientSecretExpiresAt, 0))
+
+	if p.OIDCClientCache != nil {
+		if err = p.OIDCClientCache.Set(p.clientCacheKey(), p.RegistrationScopes, client); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// newOIDCTokenWithAuthCode signs in with the authorization code flow with PKCE. The browser is sent
+// to the authorization page, which redirects it back to a listener on localhost with the code
+func (p *SSORoleCredentialsProvider) newOIDCTokenWithAuthCode(ctx context.Context) (*ssooidc.CreateTokenOutput, error) {
+	defer RecordTiming("sso authorization code", time.Now())
+
+	client, err := p.registerAuthCodeClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen for the SSO redirect: %w", err)
+	}
+	defer listener.Close()
+	redirectURI := fmt.Sprintf("http://%s%s", listener.Addr().String(), ssoRedirectPath)
+
+	verifier, err := randomURLSafeString(64)
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomURLSafeString(32)
+	if err != nil {
+		return nil, err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", aws.ToString(client.ClientId))
+	q.Set("redirect_uri", redirectURI)
+	q.Set("state", state)
+	q.Set("code_challenge_method", "S256")
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if len(p.RegistrationScopes) > 0 {
+		q.Set("scopes", strings.Join(p.RegistrationScopes, ","))
+	}
+	authorizeURL := oidcEndpoint(p.SSORegion) + "/authorize?" + q.Encode()
+
+	if p.Events != nil {
+		writeSSOEvent(p.Events, SSOEvent{Event: SSOEventAuthorization, StartURL: p.StartURL, AuthorizationURL: authorizeURL, ExpiresIn: int32(ssoAuthCodeTimeout / time.Second)})
+	} else if p.UseStdout {
+		fmt.Fprintf(os.Stderr, "Open the SSO authorization page for %s in a browser on this machine (use Ctrl-C to abort)\n%s\n", p.StartURL, authorizeURL)
+	} else {
+		p.openSSOPage(authorizeURL, "")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ssoAuthCodeTimeout)
+	defer cancel()
+	code, err := waitForAuthCode(ctx, listener, state)
+	if err != nil {
+		writeSSOEvent(p.Events, SSOEvent{Event: SSOEventFailed, StartURL: p.StartURL, Error: err.Error()})
+		return nil, err
+	}
+
+	var out struct {
+		AccessToken  string `json:"accessToken"`
+		TokenType    string `json:"tokenType"`
+		ExpiresIn    int32  `json:"expiresIn"`
+		RefreshToken string `json:"refreshToken"`
+		IDToken      string `json:"idToken"`
+	}
+	err = p.oidcRequest(ctx, "/token", map[string]interface{}{
+		"clientId":     aws.ToString(client.ClientId),
+		"clientSecret": aws.ToString(client.ClientSecret),
+		"grantType":    "authorization_code",
+		"code":         code,
+		"redirectUri":  redirectURI,
+		"codeVerifier": verifier,
+	}, &out)
+	if err != nil {
+		writeSSOEvent(p.Events, SSOEvent{Event: SSOEventFailed, StartURL: p.StartURL, Error: err.Error()})
+		return nil, err
+	}
+	writeSSOEvent(p.Events, SSOEvent{Event: SSOEventAuthorized, StartURL: p.StartURL, ExpiresIn: out.ExpiresIn})
+
+	t := &ssooidc.CreateTokenOutput{
+		AccessToken: aws.String(out.AccessToken),
+		TokenType:   aws.String(out.TokenType),
+		ExpiresIn:   out.ExpiresIn,
+	}
+	if out.RefreshToken != "" {
+		t.RefreshToken = aws.String(out.RefreshToken)
+	}
+	if out.IDToken != "" {
+		t.IdToken = aws.String(out.IDToken)
+	}
+
+	log.Printf("Created new OIDC access token for %s (expires in: %ds)", p.StartURL, t.ExpiresIn)
+	return t, nil
+}
+
+// waitForAuthCode serves the redirect from the authorization page, and returns the code once
+// a redirect with the state is received
+func waitForAuthCode(ctx context.Context, listener net.Listener, state string) (string, error) {
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ssoRedirectPath, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("state") != state {
+			http.Error(w, "Invalid state, start signing in to SSO again", http.StatusBadRequest)
+			return
+		}
+
+		var res result
+		if e := q.Get("error"); e != "" {
+			res.err = fmt.Errorf("SSO authorization failed: %s %s", e, q.Get("error_description"))
+			http.Error(w, "Signing in to SSO failed, you can close this window", http.StatusForbidden)
+		} else if res.code = q.Get("code"); res.code == "" {
+			res.err = errors.New("SSO authorization returned no code")
+			http.Error(w, "Signing in to SSO failed, you can close this window", http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Signed in to SSO, you can close this window and return to aws-vault")
+		}
+
+		select {
+		case results <- res:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		// lets the page be sent to the browser before the listener is closed
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	select {
+	case res := <-results:
+		return res.code, res.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("Timed out waiting to be signed in to SSO: %w", ctx.Err())
+	}
+}
+
+func randomURLSafeString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
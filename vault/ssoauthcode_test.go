@@ -0,0 +1,48 @@
+package vault
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWaitForAuthCode(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		base := "http://" + listener.Addr().String() + ssoRedirectPath
+		resp, err := http.Get(base + "?state=wrong&code=stolen")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected a redirect with the wrong state to be refused, got %s", resp.Status)
+		}
+
+		resp, err = http.Get(base + "?state=expected&code=the-code")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+	}()
+
+	code, err := waitForAuthCode(ctx, listener, "expected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "the-code" {
+		t.Fatalf("Expected the code from the redirect with the state, got %q", code)
+	}
+}
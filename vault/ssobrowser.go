@@ -0,0 +1,83 @@
+package vault
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/skratchdot/open-golang/open"
+)
+
+// ssoBrowserCommandData are the placeholders of sso_browser_command
+type ssoBrowserCommandData struct {
+	URL      string
+	StartURL string
+	UserCode string
+}
+
+// ssoBrowserCommand is the sso_browser_command to run to open the url, with the placeholders replaced
+// by their values quoted for the shell. A command without placeholders is given the url as its last argument
+func ssoBrowserCommand(command string, data ssoBrowserCommandData) (string, error) {
+	if !strings.Contains(command, "{{") {
+		return command + " " + quoteShellArg(data.URL), nil
+	}
+
+	tmpl, err := template.New("sso_browser_command").Option("missingkey=error").Parse(command)
+	if err != nil {
+		return "", fmt.Errorf("Invalid sso_browser_command: %w", err)
+	}
+	data.URL = quoteShellArg(data.URL)
+	data.StartURL = quoteShellArg(data.StartURL)
+	data.UserCode = quoteShellArg(data.UserCode)
+
+	var b strings.Builder
+	if err = tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("Invalid sso_browser_command: %w", err)
+	}
+	return b.String(), nil
+}
+
+// quoteShellArg quotes s as a single argument for the shell that shellCommand runs
+func quoteShellArg(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// openSSOPage opens the SSO authorization page with the sso_browser_command, or the default browser.
+// The command isn't waited for, as a browser may keep running until it's closed
+func (p *SSORoleCredentialsProvider) openSSOPage(url, userCode string) {
+	if p.BrowserCommand == "" {
+		log.Println("Opening SSO authorization page in browser")
+		fmt.Fprintf(os.Stderr, "Opening the SSO authorization page for %s in your default browser (use Ctrl-C to abort)\n%s\n", p.StartURL, url)
+		if err := open.Run(url); err != nil {
+			log.Printf("Failed to open browser: %s", err)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Opening the SSO authorization page for %s with sso_browser_command (use Ctrl-C to abort)\n%s\n", p.StartURL, url)
+	process, err := ssoBrowserCommand(p.BrowserCommand, ssoBrowserCommandData{URL: url, StartURL: p.StartURL, UserCode: userCode})
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	log.Printf("Running sso_browser_command: %s", process)
+	cmd := shellCommand(process)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err = cmd.Start(); err != nil {
+		log.Printf("Failed to run sso_browser_command: %s", err)
+		return
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("sso_browser_command failed: %s", err)
+		}
+	}()
+}
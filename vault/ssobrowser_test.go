@@ -0,0 +1,37 @@
+//go:build !windows
+// +build !windows
+
+package vault
+
+import "testing"
+
+func TestSSOBrowserCommand(t *testing.T) {
+	data := ssoBrowserCommandData{
+		URL:      "https://device.sso.us-east-1.amazonaws.com/?user_code=ABCD-EFGH",
+		StartURL: "https://acme.awsapps.com/start",
+		UserCode: "ABCD-EFGH",
+	}
+
+	cases := map[string]string{
+		"firefox --private-window":                   "firefox --private-window 'https://device.sso.us-east-1.amazonaws.com/?user_code=ABCD-EFGH'",
+		"open -a Firefox {{.URL}}":                   "open -a Firefox 'https://device.sso.us-east-1.amazonaws.com/?user_code=ABCD-EFGH'",
+		"notify-send {{.StartURL}} {{.UserCode}}":    "notify-send 'https://acme.awsapps.com/start' 'ABCD-EFGH'",
+		"echo {{.URL}} | xclip -selection clipboard": "echo 'https://device.sso.us-east-1.amazonaws.com/?user_code=ABCD-EFGH' | xclip -selection clipboard",
+	}
+	for command, expected := range cases {
+		process, err := ssoBrowserCommand(command, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if process != expected {
+			t.Errorf("Expected %q to be %q, got %q", command, expected, process)
+		}
+	}
+
+	if process, _ := ssoBrowserCommand("open {{.URL}}", ssoBrowserCommandData{URL: "https://example.com/?q='x'"}); process != `open 'https://example.com/?q='\''x'\'''` {
+		t.Errorf("Expected quotes in the URL to be escaped, got %s", process)
+	}
+	if _, err := ssoBrowserCommand("open {{.Link}}", data); err == nil {
+		t.Error("Expected an error for an unknown placeholder")
+	}
+}
@@ -0,0 +1,57 @@
+package vault
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// ssoEventsMu serialises writing events, as profiles can sign in to SSO at once
+var ssoEventsMu sync.Mutex
+
+// Events written to Config.SSOEvents, which receives the progress of signing in to SSO as lines of JSON,
+// for wrappers that show the device code or authorization page in their own UI. The browser isn't
+// opened when it's set
+const (
+	SSOEventDeviceAuthorization = "device_authorization"
+	SSOEventAuthorization       = "authorization"
+	SSOEventPending             = "pending"
+	SSOEventSlowDown            = "slow_down"
+	SSOEventAuthorized          = "authorized"
+	SSOEventFailed              = "failed"
+)
+
+// SSOEvent is a step of signing in to SSO
+type SSOEvent struct {
+	Event                   string    `json:"event"`
+	Time                    time.Time `json:"time"`
+	StartURL                string    `json:"start_url"`
+	UserCode                string    `json:"user_code,omitempty"`
+	VerificationURI         string    `json:"verification_uri,omitempty"`
+	VerificationURIComplete string    `json:"verification_uri_complete,omitempty"`
+	AuthorizationURL        string    `json:"authorization_url,omitempty"`
+	ExpiresIn               int32     `json:"expires_in,omitempty"`
+	RetryIn                 int32     `json:"retry_in,omitempty"`
+	Error                   string    `json:"error,omitempty"`
+}
+
+func writeSSOEvent(w io.Writer, e SSOEvent) {
+	if w == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Failed to write SSO event: %s", err)
+		return
+	}
+
+	ssoEventsMu.Lock()
+	defer ssoEventsMu.Unlock()
+	if _, err = w.Write(append(b, '\n')); err != nil {
+		log.Printf("Failed to write SSO event: %s", err)
+	}
+}
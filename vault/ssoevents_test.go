@@ -0,0 +1,31 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteSSOEvent(t *testing.T) {
+	writeSSOEvent(nil, SSOEvent{Event: SSOEventPending})
+
+	var b bytes.Buffer
+	writeSSOEvent(&b, SSOEvent{Event: SSOEventDeviceAuthorization, StartURL: "https://example.awsapps.com/start", UserCode: "ABCD-EFGH", ExpiresIn: 600})
+	writeSSOEvent(&b, SSOEvent{Event: SSOEventPending, StartURL: "https://example.awsapps.com/start", RetryIn: 5})
+
+	lines := bytes.Split(bytes.TrimSpace(b.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("Expected an event on each line, got %q", b.String())
+	}
+
+	var e map[string]interface{}
+	if err := json.Unmarshal(lines[0], &e); err != nil {
+		t.Fatal(err)
+	}
+	if e["event"] != SSOEventDeviceAuthorization || e["user_code"] != "ABCD-EFGH" || e["expires_in"] != float64(600) || e["time"] == nil {
+		t.Errorf("Unexpected event %s", lines[0])
+	}
+	if _, ok := e["retry_in"]; ok {
+		t.Errorf("Expected fields that aren't set to be left out, got %s", lines[0])
+	}
+}
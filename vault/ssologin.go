@@ -0,0 +1,107 @@
+package vault
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+)
+
+// newSSOTokenProvider is a provider for getting the SSO token of the start URL of the config, rather
+// than the credentials of a role. Tokens and clients are cached in the keyring
+func newSSOTokenProvider(k keyring.Keyring, config *Config) *SSORoleCredentialsProvider {
+	cfg := NewAwsConfig(config.SSORegion, config.STSRegionalEndpoints)
+	AddProfileProxy(&cfg, config)
+
+	p := &SSORoleCredentialsProvider{
+		OIDCClient:         ssooidc.NewFromConfig(cfg),
+		RegistrationScopes: ssoRegistrationScopes(config),
+		StartURL:           config.SSOStartURL,
+		SSORegion:          config.SSORegion,
+		SSOSession:         config.SSOSession,
+		SSOClient:          sso.NewFromConfig(cfg),
+		UseStdout:          config.SSOUseStdout,
+		BrowserCommand:     config.SSOBrowserCommand,
+		HTTPClient:         cfg.HTTPClient,
+		Hooks:              config.Hooks,
+		Flow:               config.SSOFlow,
+		Events:             config.SSOEvents,
+		RefreshToken:       config.RefreshSSOTokens,
+		NoPrompt:           config.NoPrompt,
+	}
+	if config.useSessionCache() {
+		p.OIDCTokenCache = OIDCTokenKeyring{Keyring: k}
+		p.OIDCClientCache = &OIDCClientKeyring{Keyring: k}
+	}
+	return p
+}
+
+// SSOLogin signs in to the SSO start URL of the config, even if a token is cached, and caches the
+// new token in the keyring. It returns when the token expires
+func SSOLogin(ctx context.Context, k keyring.Keyring, config *Config) (time.Time, error) {
+	p := newSSOTokenProvider(k, config)
+
+	signIn := ssoSignInFor(p.StartURL)
+	signIn.mu.Lock()
+	defer signIn.mu.Unlock()
+
+	token, err := p.newOIDCToken(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	signIn.signedIn = true
+	if err = (OIDCTokenKeyring{Keyring: k}).Set(p.StartURL, token); err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Now().Add(time.Duration(token.ExpiresIn) * time.Second), nil
+}
+
+// SSOLogout signs out of the SSO start URL of the config, invalidating the token cached in the keyring
+// and that cached by the AWS CLI, and removes them. It returns how many tokens were removed
+func SSOLogout(ctx context.Context, k keyring.Keyring, config *Config) (int, error) {
+	p := newSSOTokenProvider(k, config)
+	tokens := OIDCTokenKeyring{Keyring: k}
+	n := 0
+
+	token, err := tokens.Get(p.StartURL)
+	if err != nil && err != keyring.ErrKeyNotFound {
+		return n, err
+	}
+	if token != nil {
+		if token.ExpiresIn > 0 {
+			p.logout(ctx, aws.ToString(token.AccessToken))
+		}
+		if err = tokens.Remove(p.StartURL); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	accessToken, removed, err := removeAWSCLISSOToken(p.SSOSession, p.StartURL)
+	if err != nil {
+		return n, err
+	}
+	if removed {
+		if accessToken != "" {
+			p.logout(ctx, accessToken)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// logout invalidates the access token. Failing to is only logged, as the token is removed anyway
+func (p *SSORoleCredentialsProvider) logout(ctx context.Context, accessToken string) {
+	_, err := p.SSOClient.Logout(ctx, &sso.LogoutInput{AccessToken: aws.String(accessToken)})
+	if err != nil {
+		log.Printf("Failed to sign out of %s: %s", p.StartURL, err)
+		return
+	}
+	log.Printf("Signed out of %s", p.StartURL)
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/99designs/aws-vault/v7/prompt"
 	"github.com/99designs/keyring"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
@@ -17,9 +19,12 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
 	ssooidctypes "github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
 	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
-	"github.com/skratchdot/open-golang/open"
 )
 
+// ssoTokenRefreshWindow is how long before it expires an SSO access token is refreshed, when it
+// has a refresh token, so that it doesn't expire while credentials are being served
+const ssoTokenRefreshWindow = time.Hour
+
 type OIDCTokenCacher interface {
 	Get(string) (*ssooidc.CreateTokenOutput, error)
 	Set(string, *ssooidc.CreateTokenOutput) error
@@ -28,13 +33,37 @@ type OIDCTokenCacher interface {
 
 // SSORoleCredentialsProvider creates temporary credentials for an SSO Role.
 type SSORoleCredentialsProvider struct {
-	OIDCClient     *ssooidc.Client
-	OIDCTokenCache OIDCTokenCacher
-	StartURL       string
-	SSOClient      *sso.Client
-	AccountID      string
-	RoleName       string
-	UseStdout      bool
+	OIDCClient      *ssooidc.Client
+	OIDCTokenCache  OIDCTokenCacher
+	OIDCClientCache *OIDCClientKeyring
+	// RegistrationScopes are the scopes the OIDC client is registered with. Tokens are only
+	// issued with a refresh token when the client is registered with scopes
+	RegistrationScopes []string
+	StartURL           string
+	SSORegion          string
+	// SSOSession is the name of the sso-session, which the AWS CLI caches its token under
+	SSOSession string
+	SSOClient  *sso.Client
+	AccountID  string
+	RoleName   string
+	UseStdout  bool
+	// BrowserCommand is the sso_browser_command that opens the SSO authorization page, rather than the default browser
+	BrowserCommand string
+	// HTTPClient makes the calls to the OIDC API that aren't made with OIDCClient
+	HTTPClient aws.HTTPClient
+	// Hooks run the sso-login-required hook before signing in
+	Hooks HooksSection
+	// Flow is the OAuth flow used to sign in, SSOFlowDeviceCode when it's empty
+	Flow string
+	// Events receives the progress of signing in as lines of JSON, rather than it being shown
+	Events io.Writer
+	// RefreshToken ignores the cached token, signing in again
+	RefreshToken bool
+	// NoPrompt fails rather than signing in
+	NoPrompt bool
+
+	usingAWSCLIToken  bool
+	ignoreAWSCLIToken bool
 }
 
 func millisecondsTimeValue(v int64) time.Time {
@@ -69,7 +98,7 @@ func (p *SSORoleCredentialsProvider) getRoleCredentials(ctx context.Context) (*s
 		RoleName:    aws.String(p.RoleName),
 	})
 	if err != nil {
-		if cached && p.OIDCTokenCache != nil {
+		if cached && (p.OIDCTokenCache != nil || p.usingAWSCLIToken) {
 			var rspError *awshttp.ResponseError
 			if !errors.As(err, &rspError) {
 				return nil, err
@@ -79,8 +108,10 @@ func (p *SSORoleCredentialsProvider) getRoleCredentials(ctx context.Context) (*s
 			// again. This is a recursive call but it should only happen once
 			// due to the cache being cleared before retrying.
 			if rspError.HTTPStatusCode() == http.StatusUnauthorized {
-				err = p.OIDCTokenCache.Remove(p.StartURL)
-				if err != nil {
+				if p.usingAWSCLIToken {
+					log.Printf("The SSO token cached by the AWS CLI for %s was rejected, signing in again", p.StartURL)
+					p.ignoreAWSCLIToken = true
+				} else if err = p.OIDCTokenCache.Remove(p.StartURL); err != nil {
 					return nil, err
 				}
 				return p.getRoleCredentials(ctx)
@@ -88,7 +119,8 @@ func (p *SSORoleCredentialsProvider) getRoleCredentials(ctx context.Context) (*s
 		}
 		return nil, err
 	}
-	log.Printf("Got credentials %s for SSO role %s (account: %s), expires in %s", FormatKeyForDisplay(*resp.RoleCredentials.AccessKeyId), p.RoleName, p.AccountID, time.Until(millisecondsTimeValue(resp.RoleCredentials.Expiration)).String())
+	expiresIn := time.Until(millisecondsTimeValue(resp.RoleCredentials.Expiration))
+	logf(LogFields{Provider: "sso", Duration: expiresIn}, "Got credentials %s for SSO role %s (account: %s), expires in %s", FormatKeyForDisplay(*resp.RoleCredentials.AccessKeyId), p.RoleName, p.AccountID, expiresIn.String())
 
 	return resp.RoleCredentials, nil
 }
@@ -109,19 +141,46 @@ func (p *SSORoleCredentialsProvider) getRoleCredentialsAsStsCredemtials(ctx cont
 }
 
 func (p *SSORoleCredentialsProvider) getOIDCToken(ctx context.Context) (token *ssooidc.CreateTokenOutput, cached bool, err error) {
-	if p.OIDCTokenCache != nil {
+	signIn := ssoSignInFor(p.StartURL)
+	signIn.mu.Lock()
+	defer signIn.mu.Unlock()
+
+	p.usingAWSCLIToken = false
+	if p.OIDCTokenCache != nil && !signIn.refreshToken(p.RefreshToken) {
 		token, err = p.OIDCTokenCache.Get(p.StartURL)
 		if err != nil && err != keyring.ErrKeyNotFound {
 			return nil, false, err
 		}
-		if token != nil {
+		if token != nil && token.ExpiresIn < int32(ssoTokenRefreshWindow/time.Second) && aws.ToString(token.RefreshToken) != "" {
+			refreshed, err := p.refreshOIDCToken(ctx, token)
+			if err == nil {
+				return refreshed, true, p.OIDCTokenCache.Set(p.StartURL, refreshed)
+			}
+			log.Printf("Failed to refresh the OIDC token for %s: %s", p.StartURL, err)
+		}
+		if token != nil && token.ExpiresIn > 0 {
 			return token, true, nil
 		}
 	}
+	// a token from signing in with `aws sso login` saves signing in again
+	if !signIn.refreshToken(p.RefreshToken) && !p.ignoreAWSCLIToken {
+		if token = readAWSCLISSOToken(p.SSOSession, p.StartURL); token != nil {
+			p.usingAWSCLIToken = true
+			return token, true, nil
+		}
+	}
+
+	p.Hooks.Run(HookSSOLoginRequired, map[string]string{
+		"sso_start_url": p.StartURL,
+		"sso_session":   p.SSOSession,
+		"account_id":    p.AccountID,
+		"role_name":     p.RoleName,
+	})
 	token, err = p.newOIDCToken(ctx)
 	if err != nil {
 		return nil, false, err
 	}
+	signIn.signedIn = true
 
 	if p.OIDCTokenCache != nil {
 		err = p.OIDCTokenCache.Set(p.StartURL, token)
@@ -132,34 +191,122 @@ func (p *SSORoleCredentialsProvider) getOIDCToken(ctx context.Context) (token *s
 	return token, false, err
 }
 
-func (p *SSORoleCredentialsProvider) newOIDCToken(ctx context.Context) (*ssooidc.CreateTokenOutput, error) {
-	clientCreds, err := p.OIDCClient.RegisterClient(ctx, &ssooidc.RegisterClientInput{
-		ClientName: aws.String("aws-vault"),
-		ClientType: aws.String("public"),
+// refreshOIDCToken gets a new access token with the refresh token, without signing in again
+func (p *SSORoleCredentialsProvider) refreshOIDCToken(ctx context.Context, token *ssooidc.CreateTokenOutput) (*ssooidc.CreateTokenOutput, error) {
+	if p.OIDCClientCache == nil {
+		return nil, errors.New("no OIDC client is cached")
+	}
+	client, err := p.OIDCClientCache.Get(p.clientCacheKey(), p.RegistrationScopes)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshed, err := p.OIDCClient.CreateToken(ctx, &ssooidc.CreateTokenInput{
+		ClientId:     client.ClientId,
+		ClientSecret: client.ClientSecret,
+		GrantType:    aws.String("refresh_token"),
+		RefreshToken: token.RefreshToken,
 	})
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("Created new OIDC client (expires at: %s)", time.Unix(clientCreds.ClientSecretExpiresAt, 0))
+	if refreshed.RefreshToken == nil {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+
+	log.Printf("Refreshed OIDC access token for %s (expires in: %ds)", p.StartURL, refreshed.ExpiresIn)
+	return refreshed, nil
+}
 
-	deviceCreds, err := p.OIDCClient.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
-		ClientId:     clientCreds.ClientId,
-		ClientSecret: clientCreds.ClientSecret,
-		StartUrl:     aws.String(p.StartURL),
+// registerClient returns the OIDC client registered for the start URL, or registers a new one
+func (p *SSORoleCredentialsProvider) registerClient(ctx context.Context) (client *ssooidc.RegisterClientOutput, cached bool, err error) {
+	if p.OIDCClientCache != nil {
+		client, err = p.OIDCClientCache.Get(p.StartURL, p.RegistrationScopes)
+		if err == nil {
+			log.Printf("Re-using OIDC client for %s (expires at: %s)", p.StartURL, time.Unix(client.ClientSecretExpiresAt, 0))
+			return client, true, nil
+		}
+		if err != keyring.ErrKeyNotFound {
+			return nil, false, err
+		}
+	}
+
+	client, err = p.OIDCClient.RegisterClient(ctx, &ssooidc.RegisterClientInput{
+		ClientName: aws.String("aws-vault"),
+		ClientType: aws.String("public"),
+		Scopes:     p.RegistrationScopes,
 	})
+	if err != nil {
+		return nil, false, err
+	}
+	log.Printf("Created new OIDC client (expires at: %s)", time.Unix(client.ClientSecretExpiresAt, 0))
+
+	if p.OIDCClientCache != nil {
+		if err = p.OIDCClientCache.Set(p.StartURL, p.RegistrationScopes, client); err != nil {
+			return nil, false, err
+		}
+	}
+	return client, false, nil
+}
+
+// startDeviceAuthorization starts the device authorization with the client for the start URL. A cached
+// client that's been rejected is replaced with a new one
+func (p *SSORoleCredentialsProvider) startDeviceAuthorization(ctx context.Context) (*ssooidc.RegisterClientOutput, *ssooidc.StartDeviceAuthorizationOutput, error) {
+	for {
+		client, cached, err := p.registerClient(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		deviceCreds, err := p.OIDCClient.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
+			ClientId:     client.ClientId,
+			ClientSecret: client.ClientSecret,
+			StartUrl:     aws.String(p.StartURL),
+		})
+		var ice *ssooidctypes.InvalidClientException
+		if cached && errors.As(err, &ice) {
+			log.Printf("OIDC client for %s was rejected, registering a new one", p.StartURL)
+			if err = p.OIDCClientCache.Remove(p.StartURL, p.RegistrationScopes); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return client, deviceCreds, nil
+	}
+}
+
+func (p *SSORoleCredentialsProvider) newOIDCToken(ctx context.Context) (*ssooidc.CreateTokenOutput, error) {
+	if p.NoPrompt {
+		return nil, prompt.InteractionRequired(prompt.InteractionSSO, "Signing in to SSO at "+p.StartURL)
+	}
+	if p.Flow == SSOFlowAuthCode {
+		return p.newOIDCTokenWithAuthCode(ctx)
+	}
+
+	defer RecordTiming("sso device authorization", time.Now())
+
+	clientCreds, deviceCreds, err := p.startDeviceAuthorization(ctx)
 	if err != nil {
 		return nil, err
 	}
 	log.Printf("Created OIDC device code for %s (expires in: %ds)", p.StartURL, deviceCreds.ExpiresIn)
 
-	if p.UseStdout {
-		fmt.Fprintf(os.Stderr, "Open the SSO authorization page in a browser (use Ctrl-C to abort)\n%s\n", aws.ToString(deviceCreds.VerificationUriComplete))
+	if p.Events != nil {
+		writeSSOEvent(p.Events, SSOEvent{
+			Event:                   SSOEventDeviceAuthorization,
+			StartURL:                p.StartURL,
+			UserCode:                aws.ToString(deviceCreds.UserCode),
+			VerificationURI:         aws.ToString(deviceCreds.VerificationUri),
+			VerificationURIComplete: aws.ToString(deviceCreds.VerificationUriComplete),
+			ExpiresIn:               deviceCreds.ExpiresIn,
+		})
+	} else if p.UseStdout {
+		fmt.Fprintf(os.Stderr, "Open the SSO authorization page for %s in a browser (use Ctrl-C to abort)\n%s\n", p.StartURL, aws.ToString(deviceCreds.VerificationUriComplete))
 	} else {
-		log.Println("Opening SSO authorization page in browser")
-		fmt.Fprintf(os.Stderr, "Opening the SSO authorization page in your default browser (use Ctrl-C to abort)\n%s\n", aws.ToString(deviceCreds.VerificationUriComplete))
-		if err := open.Run(aws.ToString(deviceCreds.VerificationUriComplete)); err != nil {
-			log.Printf("Failed to open browser: %s", err)
-		}
+		p.openSSOPage(aws.ToString(deviceCreds.VerificationUriComplete), aws.ToString(deviceCreds.UserCode))
 	}
 
 	// These are the default values defined in the following RFC:
@@ -182,16 +329,22 @@ func (p *SSORoleCredentialsProvider) newOIDCToken(ctx context.Context) (*ssooidc
 			var sde *ssooidctypes.SlowDownException
 			if errors.As(err, &sde) {
 				retryInterval += slowDownDelay
+				writeSSOEvent(p.Events, SSOEvent{Event: SSOEventSlowDown, StartURL: p.StartURL, RetryIn: int32(retryInterval / time.Second)})
+				time.Sleep(retryInterval)
+				continue
 			}
 
 			var ape *ssooidctypes.AuthorizationPendingException
 			if errors.As(err, &ape) {
+				writeSSOEvent(p.Events, SSOEvent{Event: SSOEventPending, StartURL: p.StartURL, RetryIn: int32(retryInterval / time.Second)})
 				time.Sleep(retryInterval)
 				continue
 			}
 
+			writeSSOEvent(p.Events, SSOEvent{Event: SSOEventFailed, StartURL: p.StartURL, Error: err.Error()})
 			return nil, err
 		}
+		writeSSOEvent(p.Events, SSOEvent{Event: SSOEventAuthorized, StartURL: p.StartURL, ExpiresIn: t.ExpiresIn})
 
 		log.Printf("Created new OIDC access token for %s (expires in: %ds)", p.StartURL, t.ExpiresIn)
 		return t, nil
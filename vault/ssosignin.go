@@ -0,0 +1,36 @@
+package vault
+
+import "sync"
+
+// ssoSignIn serialises getting the SSO token of a start URL. Profiles of the same organization used at
+// once, such as by the credential servers or the steps of a chain, wait for a single sign in, while
+// those of other organizations sign in to theirs without waiting
+type ssoSignIn struct {
+	mu sync.Mutex
+	// signedIn is whether this process has signed in to the start URL, after which RefreshSSOTokens
+	// no longer ignores the cached token, so it's only signed in to once
+	signedIn bool
+}
+
+var ssoSignIns = struct {
+	sync.Mutex
+	m map[string]*ssoSignIn
+}{m: map[string]*ssoSignIn{}}
+
+// ssoSignInFor returns the sign in of the start URL
+func ssoSignInFor(startURL string) *ssoSignIn {
+	ssoSignIns.Lock()
+	defer ssoSignIns.Unlock()
+
+	s, ok := ssoSignIns.m[startURL]
+	if !ok {
+		s = &ssoSignIn{}
+		ssoSignIns.m[startURL] = s
+	}
+	return s
+}
+
+// refreshToken is whether to ignore the cached token and sign in again, when tokens are refreshed
+func (s *ssoSignIn) refreshToken(refresh bool) bool {
+	return refresh && !s.signedIn
+}
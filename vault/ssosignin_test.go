@@ -0,0 +1,48 @@
+package vault
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+)
+
+type staticOIDCTokenCache struct {
+	token *ssooidc.CreateTokenOutput
+}
+
+func (c staticOIDCTokenCache) Get(string) (*ssooidc.CreateTokenOutput, error) { return c.token, nil }
+func (c staticOIDCTokenCache) Set(string, *ssooidc.CreateTokenOutput) error   { return nil }
+func (c staticOIDCTokenCache) Remove(string) error                            { return nil }
+
+func TestSSOSignInIsPerStartURL(t *testing.T) {
+	if ssoSignInFor("https://acme.awsapps.com/start") != ssoSignInFor("https://acme.awsapps.com/start") {
+		t.Error("Expected the same sign in for a start URL")
+	}
+	if ssoSignInFor("https://acme.awsapps.com/start") == ssoSignInFor("https://other.awsapps.com/start") {
+		t.Error("Expected another start URL to have its own sign in")
+	}
+}
+
+func TestRefreshSSOTokensSignsInOnce(t *testing.T) {
+	startURL := "https://refreshed.awsapps.com/start"
+	signIn := ssoSignInFor(startURL)
+	if !signIn.refreshToken(true) {
+		t.Fatal("Expected the cached token to be ignored before signing in")
+	}
+	signIn.signedIn = true
+
+	p := &SSORoleCredentialsProvider{
+		StartURL:       startURL,
+		RefreshToken:   true,
+		OIDCTokenCache: staticOIDCTokenCache{&ssooidc.CreateTokenOutput{AccessToken: aws.String("token"), ExpiresIn: 28800}},
+	}
+	token, cached, err := p.getOIDCToken(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached || aws.ToString(token.AccessToken) != "token" {
+		t.Errorf("Expected the token cached by the sign in to be used, got %v", token)
+	}
+}
@@ -0,0 +1,72 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Timing is the total time spent on an operation
+type Timing struct {
+	Name  string
+	Count int
+	Total time.Duration
+}
+
+// Stats records how long operations take, such as keyring access, MFA prompts and AWS API calls
+type Stats struct {
+	mu      sync.Mutex
+	timings []Timing
+}
+
+// StatsRecorder is where timings are recorded. Nothing is recorded when it's nil
+var StatsRecorder *Stats
+
+// Record adds the duration of an operation to the total for its name
+func (s *Stats) Record(name string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.timings {
+		if s.timings[i].Name == name {
+			s.timings[i].Count++
+			s.timings[i].Total += d
+			return
+		}
+	}
+	s.timings = append(s.timings, Timing{Name: name, Count: 1, Total: d})
+}
+
+// Timings returns the recorded timings in the order the operations were first seen
+func (s *Stats) Timings() []Timing {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Timing{}, s.timings...)
+}
+
+// RecordTiming records the time since start for the operation, if stats are enabled
+func RecordTiming(name string, start time.Time) {
+	if StatsRecorder != nil {
+		StatsRecorder.Record(name, time.Since(start))
+	}
+}
+
+// instrumentAPICalls is an SDK API option that records the time taken by each API call, and traces it
+func instrumentAPICalls(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("AwsVaultStats", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		name := fmt.Sprintf("%s.%s", awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx))
+		defer RecordTiming(name, time.Now())
+
+		ctx, span := StartSpan(ctx, name)
+		span.SetAttribute("rpc.system", "aws-api")
+		out, md, err := next.HandleInitialize(ctx, in)
+		span.End(err)
+
+		return out, md, err
+	}), middleware.After)
+}
@@ -0,0 +1,277 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span is a timed operation, exported as an OpenTelemetry span
+type Span struct {
+	tracer     *Tracer
+	traceID    string
+	spanID     string
+	parentID   string
+	name       string
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        error
+}
+
+// SetAttribute adds an attribute to the span. It's safe to call on a nil span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// End records the end of the span, along with an error if the operation failed. It's safe to call on a nil span
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.end = time.Now()
+	s.err = err
+}
+
+// Traceparent returns the W3C trace context header for the span, so that other processes can
+// continue the trace
+func (s *Span) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.traceID, s.spanID)
+}
+
+// Tracer records spans for a single trace and exports them via OTLP/HTTP
+type Tracer struct {
+	mu       sync.Mutex
+	endpoint string
+	headers  map[string]string
+	spans    []*Span
+	root     *Span
+}
+
+type spanContextKey struct{}
+
+type tracerContextKey struct{}
+
+// ContextWithTracer returns a context whose spans, and those of the contexts derived from it, are recorded
+// by t. Nothing is traced with a context without a tracer
+func ContextWithTracer(ctx context.Context, t *Tracer) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tracerContextKey{}, t)
+}
+
+// TracerFromContext returns the tracer recording the spans of ctx, or nil if there isn't one
+func TracerFromContext(ctx context.Context) *Tracer {
+	if s, ok := ctx.Value(spanContextKey{}).(*Span); ok {
+		return s.tracer
+	}
+	t, _ := ctx.Value(tracerContextKey{}).(*Tracer)
+	return t
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewTracerFromEnv returns a tracer configured with the standard OTEL_EXPORTER_OTLP_* environment
+// variables, or nil if no OTLP endpoint is configured. The trace continues from TRACEPARENT if it's set
+func NewTracerFromEnv(rootSpanName string) *Tracer {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil
+	}
+
+	t := &Tracer{
+		endpoint: endpoint,
+		headers:  parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+	}
+
+	traceID, parentID := randomHex(16), ""
+	if parts := strings.Split(os.Getenv("TRACEPARENT"), "-"); len(parts) == 4 && len(parts[1]) == 32 && len(parts[2]) == 16 {
+		traceID, parentID = parts[1], parts[2]
+	}
+	t.root = t.newSpan(rootSpanName, traceID, parentID)
+
+	return t
+}
+
+// parseOTLPHeaders parses the comma separated key=value pairs of OTEL_EXPORTER_OTLP_HEADERS, whose
+// values are percent-encoded as in the W3C Baggage format
+func parseOTLPHeaders(s string) map[string]string {
+	headers := map[string]string{}
+	for _, h := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(h, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(v))
+		if err != nil {
+			log.Printf("Ignoring OTLP header %s: %s", strings.TrimSpace(k), err.Error())
+			continue
+		}
+		headers[strings.TrimSpace(k)] = value
+	}
+	return headers
+}
+
+func (t *Tracer) newSpan(name, traceID, parentID string) *Span {
+	s := &Span{
+		tracer:     t,
+		traceID:    traceID,
+		spanID:     randomHex(8),
+		parentID:   parentID,
+		name:       name,
+		start:      time.Now(),
+		attributes: map[string]string{},
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = append(t.spans, s)
+	return s
+}
+
+// Root returns the span covering the whole aws-vault command
+func (t *Tracer) Root() *Span {
+	return t.root
+}
+
+// StartSpan starts a span as a child of the span in ctx, or of the root span if there isn't one.
+// A nil span is returned when ctx has no tracer
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	t := TracerFromContext(ctx)
+	if t == nil {
+		return ctx, nil
+	}
+	parent, ok := ctx.Value(spanContextKey{}).(*Span)
+	if !ok {
+		parent = t.root
+	}
+	s := t.newSpan(name, parent.traceID, parent.spanID)
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	result := []otlpAttribute{}
+	for k, v := range attributes {
+		a := otlpAttribute{Key: k}
+		a.Value.StringValue = v
+		result = append(result, a)
+	}
+	return result
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            otlpStatus      `json:"status"`
+}
+
+// Export ends the root span and sends all spans to the OTLP endpoint, using the OTLP/HTTP JSON encoding
+func (t *Tracer) Export(ctx context.Context) error {
+	t.root.End(nil)
+
+	t.mu.Lock()
+	spans := []otlpSpan{}
+	for _, s := range t.spans {
+		end := s.end
+		if end.IsZero() {
+			end = time.Now()
+		}
+		status := otlpStatus{Code: 1}
+		if s.err != nil {
+			status = otlpStatus{Code: 2, Message: s.err.Error()}
+		}
+		spans = append(spans, otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              1,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attributes),
+			Status:            status,
+		})
+	}
+	t.spans = nil
+	t.mu.Unlock()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]string{"service.name": "aws-vault"}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "github.com/99designs/aws-vault/v7"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("OTLP endpoint returned %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseOTLPHeaders(t *testing.T) {
+	cases := []struct {
+		headers  string
+		expected map[string]string
+	}{
+		{"", map[string]string{}},
+		{"api-key=secret", map[string]string{"api-key": "secret"}},
+		{" api-key = secret , x-team=a%2Cb", map[string]string{"api-key": "secret", "x-team": "a,b"}},
+		{"Authorization=Basic%20dXNlcjpwYXNz", map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}},
+		{"token=a=b", map[string]string{"token": "a=b"}},
+		{"invalid=%zz,valid=1,novalue,=empty", map[string]string{"valid": "1"}},
+	}
+	for _, c := range cases {
+		if headers := parseOTLPHeaders(c.headers); !reflect.DeepEqual(headers, c.expected) {
+			t.Errorf("Expected %q to be parsed as %v, got %v", c.headers, c.expected, headers)
+		}
+	}
+}
+
+func TestTracerExport(t *testing.T) {
+	var authorization string
+	var body struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", ts.URL+"/")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20token")
+	t.Setenv("TRACEPARENT", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	tracer := NewTracerFromEnv("aws-vault exec")
+	_, span := StartSpan(ContextWithTracer(context.Background(), tracer), "keyring.Get")
+	span.SetAttribute("profile", "llamas")
+	span.End(errors.New("not found"))
+
+	if err := tracer.Export(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if authorization != "Bearer token" {
+		t.Errorf("Expected the decoded header to be sent, got %q", authorization)
+	}
+	if len(body.ResourceSpans) != 1 || len(body.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("Unexpected body %+v", body)
+	}
+	spans := body.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("Expected the root span and one child, got %+v", spans)
+	}
+	root, child := spans[0], spans[1]
+	if root.TraceID != "0af7651916cd43dd8448eb211c80319c" || root.ParentSpanID != "b7ad6b7169203331" {
+		t.Errorf("Expected the trace in TRACEPARENT to be continued, got %+v", root)
+	}
+	if child.TraceID != root.TraceID || child.ParentSpanID != root.SpanID {
+		t.Errorf("Expected the child to be in the trace of the root span, got %+v", child)
+	}
+	if child.Status.Code != 2 || child.Status.Message != "not found" {
+		t.Errorf("Expected an error status, got %+v", child.Status)
+	}
+	if len(child.Attributes) != 1 || child.Attributes[0].Key != "profile" || child.Attributes[0].Value.StringValue != "llamas" {
+		t.Errorf("Unexpected attributes %+v", child.Attributes)
+	}
+}
+
+func TestNewTracerFromEnvWithoutEndpoint(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+
+	if tracer := NewTracerFromEnv("aws-vault exec"); tracer != nil {
+		t.Error("Expected no tracer without an OTLP endpoint")
+	}
+}
@@ -5,29 +5,37 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/99designs/keyring"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/sso"
 	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
 )
 
 var defaultExpirationWindow = 5 * time.Minute
 
 func init() {
-	if d, err := time.ParseDuration(os.Getenv("AWS_MIN_TTL")); err == nil {
+	if d, err := ParseDuration(os.Getenv("AWS_MIN_TTL")); err == nil {
 		defaultExpirationWindow = d
 	}
 }
 
-var UseSessionCache = true
+// httpClient is shared by all SDK clients, so that each step of a chained profile reuses the
+// connections made by the previous ones rather than making new TLS connections
+var httpClient = awshttp.NewBuildableClient()
 
 func NewAwsConfig(region, stsRegionalEndpoints string) aws.Config {
 	return aws.Config{
 		Region:                      region,
+		HTTPClient:                  httpClient,
 		EndpointResolverWithOptions: getSTSEndpointResolver(stsRegionalEndpoints),
+		APIOptions:                  []func(*middleware.Stack) error{instrumentAPICalls, detectClockSkew},
 	}
 }
 
@@ -35,7 +43,9 @@ func NewAwsConfigWithCredsProvider(credsProvider aws.CredentialsProvider, region
 	return aws.Config{
 		Region:                      region,
 		Credentials:                 credsProvider,
+		HTTPClient:                  httpClient,
 		EndpointResolverWithOptions: getSTSEndpointResolver(stsRegionalEndpoints),
+		APIOptions:                  []func(*middleware.Stack) error{instrumentAPICalls, detectClockSkew},
 	}
 }
 
@@ -49,7 +59,13 @@ func NewMasterCredentialsProvider(k *CredentialKeyring, credentialsName string)
 }
 
 func NewSessionTokenProvider(credsProvider aws.CredentialsProvider, k keyring.Keyring, config *Config) (aws.CredentialsProvider, error) {
+	if err := checkSessionDuration(config, "GetSessionToken", config.GetSessionTokenDuration(), MaxSessionTokenDuration); err != nil {
+		return nil, err
+	}
+
 	cfg := NewAwsConfigWithCredsProvider(credsProvider, config.Region, config.STSRegionalEndpoints)
+	AddProfileProxy(&cfg, config)
+	AddCredentialsIssuedHooks(&cfg, config)
 
 	sessionTokenProvider := &SessionTokenProvider{
 		StsClient: sts.NewFromConfig(cfg),
@@ -57,15 +73,12 @@ func NewSessionTokenProvider(credsProvider aws.CredentialsProvider, k keyring.Ke
 		Mfa:       NewMfa(config),
 	}
 
-	if UseSessionCache {
+	if config.useSessionCache() {
 		return &CachedSessionProvider{
-			SessionKey: SessionMetadata{
-				Type:        "sts.GetSessionToken",
-				ProfileName: config.ProfileName,
-				MfaSerial:   config.MfaSerial,
-			},
-			Keyring:         &SessionKeyring{Keyring: k},
-			ExpiryWindow:    defaultExpirationWindow,
+			SessionKey:      sessionTokenSessionKey(config),
+			Keyring:         &SessionKeyring{Keyring: k, Hooks: config.Hooks},
+			ExpiryWindow:    config.ExpiryWindow(),
+			Refresh:         config.RefreshSessions,
 			CredentialsFunc: sessionTokenProvider.GetSessionToken,
 		}, nil
 	}
@@ -75,7 +88,18 @@ func NewSessionTokenProvider(credsProvider aws.CredentialsProvider, k keyring.Ke
 
 // NewAssumeRoleProvider returns a provider that generates credentials using AssumeRole
 func NewAssumeRoleProvider(credsProvider aws.CredentialsProvider, k keyring.Keyring, config *Config) (aws.CredentialsProvider, error) {
+	if config.isRoleChained() {
+		err := checkSessionDuration(config, "assuming a role with the credentials of another role", config.AssumeRoleDuration, roleChainingMaximumDuration)
+		if err != nil {
+			return nil, err
+		}
+	} else if err := checkSessionDuration(config, "AssumeRole", config.AssumeRoleDuration, MaxAssumeRoleDuration); err != nil {
+		return nil, err
+	}
+
 	cfg := NewAwsConfigWithCredsProvider(credsProvider, config.Region, config.STSRegionalEndpoints)
+	AddProfileProxy(&cfg, config)
+	AddCredentialsIssuedHooks(&cfg, config)
 
 	p := &AssumeRoleProvider{
 		StsClient:         sts.NewFromConfig(cfg),
@@ -86,18 +110,17 @@ func NewAssumeRoleProvider(credsProvider aws.CredentialsProvider, k keyring.Keyr
 		Tags:              config.SessionTags,
 		TransitiveTagKeys: config.TransitiveSessionTags,
 		SourceIdentity:    config.SourceIdentity,
+		Policy:            config.SessionPolicy,
+		PolicyARNs:        config.SessionPolicyARNs,
 		Mfa:               NewMfa(config),
 	}
 
-	if UseSessionCache && config.MfaSerial != "" {
+	if config.useSessionCache() && config.MfaSerial != "" {
 		return &CachedSessionProvider{
-			SessionKey: SessionMetadata{
-				Type:        "sts.AssumeRole",
-				ProfileName: config.ProfileName,
-				MfaSerial:   config.MfaSerial,
-			},
-			Keyring:         &SessionKeyring{Keyring: k},
-			ExpiryWindow:    defaultExpirationWindow,
+			SessionKey:      assumeRoleSessionKey(config),
+			Keyring:         &SessionKeyring{Keyring: k, Hooks: config.Hooks},
+			ExpiryWindow:    config.ExpiryWindow(),
+			Refresh:         config.RefreshSessions,
 			CredentialsFunc: p.assumeRole,
 		}, nil
 	}
@@ -105,10 +128,46 @@ func NewAssumeRoleProvider(credsProvider aws.CredentialsProvider, k keyring.Keyr
 	return p, nil
 }
 
+// NewChainedAssumeRoleProvider returns a provider that assumes the role of the profile with the given
+// credentials, such as those of an outer aws-vault session, instead of its source profile. As the
+// credentials are not from the keyring, the session isn't cached
+func NewChainedAssumeRoleProvider(sourceCreds aws.Credentials, config *Config) (aws.CredentialsProvider, error) {
+	if !config.HasRole() {
+		return nil, fmt.Errorf("profile %s has no role_arn to assume with the credentials of the session", config.ProfileName)
+	}
+	if err := checkSessionDuration(config, "AssumeRole", config.AssumeRoleDuration, MaxAssumeRoleDuration); err != nil {
+		return nil, err
+	}
+
+	cfg := NewAwsConfigWithCredsProvider(credentials.StaticCredentialsProvider{Value: sourceCreds}, config.Region, config.STSRegionalEndpoints)
+	AddProfileProxy(&cfg, config)
+	AddCredentialsIssuedHooks(&cfg, config)
+
+	return &AssumeRoleProvider{
+		StsClient:         sts.NewFromConfig(cfg),
+		RoleARN:           config.RoleARN,
+		RoleSessionName:   config.RoleSessionName,
+		ExternalID:        config.ExternalID,
+		Duration:          config.AssumeRoleDuration,
+		Tags:              config.SessionTags,
+		TransitiveTagKeys: config.TransitiveSessionTags,
+		SourceIdentity:    config.SourceIdentity,
+		Policy:            config.SessionPolicy,
+		PolicyARNs:        config.SessionPolicyARNs,
+		Mfa:               NewMfa(config),
+	}, nil
+}
+
 // NewAssumeRoleWithWebIdentityProvider returns a provider that generates
 // credentials using AssumeRoleWithWebIdentity
 func NewAssumeRoleWithWebIdentityProvider(k keyring.Keyring, config *Config) (aws.CredentialsProvider, error) {
+	if err := checkSessionDuration(config, "AssumeRoleWithWebIdentity", config.AssumeRoleDuration, MaxAssumeRoleDuration); err != nil {
+		return nil, err
+	}
+
 	cfg := NewAwsConfig(config.Region, config.STSRegionalEndpoints)
+	AddProfileProxy(&cfg, config)
+	AddCredentialsIssuedHooks(&cfg, config)
 
 	p := &AssumeRoleWithWebIdentityProvider{
 		StsClient:               sts.NewFromConfig(cfg),
@@ -119,14 +178,12 @@ func NewAssumeRoleWithWebIdentityProvider(k keyring.Keyring, config *Config) (aw
 		Duration:                config.AssumeRoleDuration,
 	}
 
-	if UseSessionCache {
+	if config.useSessionCache() {
 		return &CachedSessionProvider{
-			SessionKey: SessionMetadata{
-				Type:        "sts.AssumeRoleWithWebIdentity",
-				ProfileName: config.ProfileName,
-			},
-			Keyring:         &SessionKeyring{Keyring: k},
-			ExpiryWindow:    defaultExpirationWindow,
+			SessionKey:      webIdentitySessionKey(config),
+			Keyring:         &SessionKeyring{Keyring: k, Hooks: config.Hooks},
+			ExpiryWindow:    config.ExpiryWindow(),
+			Refresh:         config.RefreshSessions,
 			CredentialsFunc: p.assumeRole,
 		}, nil
 	}
@@ -137,33 +194,68 @@ func NewAssumeRoleWithWebIdentityProvider(k keyring.Keyring, config *Config) (aw
 // NewSSORoleCredentialsProvider creates a provider for SSO credentials
 func NewSSORoleCredentialsProvider(k keyring.Keyring, config *Config) (aws.CredentialsProvider, error) {
 	cfg := NewAwsConfig(config.SSORegion, config.STSRegionalEndpoints)
+	AddProfileProxy(&cfg, config)
+	AddCredentialsIssuedHooks(&cfg, config)
 
 	ssoRoleCredentialsProvider := &SSORoleCredentialsProvider{
-		OIDCClient: ssooidc.NewFromConfig(cfg),
-		StartURL:   config.SSOStartURL,
-		SSOClient:  sso.NewFromConfig(cfg),
-		AccountID:  config.SSOAccountID,
-		RoleName:   config.SSORoleName,
-		UseStdout:  config.SSOUseStdout,
+		OIDCClient:         ssooidc.NewFromConfig(cfg),
+		RegistrationScopes: ssoRegistrationScopes(config),
+		StartURL:           config.SSOStartURL,
+		SSORegion:          config.SSORegion,
+		SSOSession:         config.SSOSession,
+		SSOClient:          sso.NewFromConfig(cfg),
+		AccountID:          config.SSOAccountID,
+		RoleName:           config.SSORoleName,
+		UseStdout:          config.SSOUseStdout,
+		BrowserCommand:     config.SSOBrowserCommand,
+		HTTPClient:         cfg.HTTPClient,
+		Hooks:              config.Hooks,
+		Flow:               config.SSOFlow,
+		Events:             config.SSOEvents,
+		RefreshToken:       config.RefreshSSOTokens,
+		NoPrompt:           config.NoPrompt,
 	}
 
-	if UseSessionCache {
-		ssoRoleCredentialsProvider.OIDCTokenCache = OIDCTokenKeyring{Keyring: k}
+	if config.useSessionCache() {
+		tokenCache := &prefetchingOIDCTokenCache{
+			OIDCTokenCacher: OIDCTokenKeyring{Keyring: k},
+			StartURL:        config.SSOStartURL,
+			Refresh:         config.RefreshSSOTokens,
+		}
+		ssoRoleCredentialsProvider.OIDCTokenCache = tokenCache
+		ssoRoleCredentialsProvider.OIDCClientCache = &OIDCClientKeyring{Keyring: k}
 		return &CachedSessionProvider{
-			SessionKey: SessionMetadata{
-				Type:        "sso.GetRoleCredentials",
-				ProfileName: config.ProfileName,
-				MfaSerial:   config.SSOStartURL,
-			},
-			Keyring:         &SessionKeyring{Keyring: k},
-			ExpiryWindow:    defaultExpirationWindow,
+			SessionKey:      ssoRoleSessionKey(config),
+			Keyring:         &SessionKeyring{Keyring: k, Hooks: config.Hooks},
+			ExpiryWindow:    config.ExpiryWindow(),
+			Refresh:         config.RefreshSessions,
 			CredentialsFunc: ssoRoleCredentialsProvider.getRoleCredentialsAsStsCredemtials,
+			dependency:      tokenCache,
 		}, nil
 	}
 
 	return ssoRoleCredentialsProvider, nil
 }
 
+// ssoRegistrationScopes are the scopes to register the OIDC client with, from sso_registration_scopes.
+// Like the AWS CLI, clients for an sso-session are otherwise registered with sso:account:access, so
+// that tokens can be refreshed
+func ssoRegistrationScopes(config *Config) []string {
+	scopes := []string{}
+	for _, scope := range strings.Split(config.SSORegistrationScopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) > 0 {
+		return scopes
+	}
+	if config.HasSSOSession() {
+		return []string{"sso:account:access"}
+	}
+	return nil
+}
+
 // NewCredentialProcessProvider creates a provider to retrieve credentials from an external
 // executable as described in https://docs.aws.amazon.com/cli/latest/topic/config-vars.html#sourcing-credentials-from-external-processes
 func NewCredentialProcessProvider(k keyring.Keyring, config *Config) (aws.CredentialsProvider, error) {
@@ -171,14 +263,12 @@ func NewCredentialProcessProvider(k keyring.Keyring, config *Config) (aws.Creden
 		CredentialProcess: config.CredentialProcess,
 	}
 
-	if UseSessionCache {
+	if config.useSessionCache() {
 		return &CachedSessionProvider{
-			SessionKey: SessionMetadata{
-				Type:        "credential_process",
-				ProfileName: config.ProfileName,
-			},
-			Keyring:         &SessionKeyring{Keyring: k},
-			ExpiryWindow:    defaultExpirationWindow,
+			SessionKey:      credentialProcessSessionKey(config),
+			Keyring:         &SessionKeyring{Keyring: k, Hooks: config.Hooks},
+			ExpiryWindow:    config.ExpiryWindow(),
+			Refresh:         config.RefreshSessions,
 			CredentialsFunc: credentialProcessProvider.callCredentialProcess,
 		}, nil
 	}
@@ -186,14 +276,39 @@ func NewCredentialProcessProvider(k keyring.Keyring, config *Config) (aws.Creden
 	return credentialProcessProvider, nil
 }
 
+// NewCredentialPluginProvider creates a provider to retrieve credentials from a credential plugin
+func NewCredentialPluginProvider(k keyring.Keyring, config *Config) (aws.CredentialsProvider, error) {
+	credentialPluginProvider := &CredentialPluginProvider{
+		Command:     config.CredentialPlugin,
+		ProfileName: config.ProfileName,
+		Region:      config.Region,
+		Mfa:         NewMfa(config),
+		Refresh:     config.RefreshSessions,
+	}
+
+	if config.useSessionCache() {
+		credentialPluginProvider.StateKeyring = &CredentialPluginStateKeyring{Keyring: k}
+		return &CachedSessionProvider{
+			SessionKey:      credentialPluginSessionKey(config),
+			Keyring:         &SessionKeyring{Keyring: k, Hooks: config.Hooks},
+			ExpiryWindow:    config.ExpiryWindow(),
+			Refresh:         config.RefreshSessions,
+			CredentialsFunc: credentialPluginProvider.callPlugin,
+		}, nil
+	}
+
+	return credentialPluginProvider, nil
+}
+
 type tempCredsCreator struct {
-	keyring    *CredentialKeyring
-	chainedMfa string
+	keyring     *CredentialKeyring
+	chainedMfa  string
+	prefetchers []prefetcher
 }
 
 func (t *tempCredsCreator) getSourceCreds(config *Config) (sourcecredsProvider aws.CredentialsProvider, err error) {
 	if config.HasSourceProfile() {
-		log.Printf("profile %s: sourcing credentials from profile %s", config.ProfileName, config.SourceProfile.ProfileName)
+		logf(LogFields{Profile: config.ProfileName}, "profile %s: sourcing credentials from profile %s", config.ProfileName, config.SourceProfile.ProfileName)
 		return t.GetProviderForProfile(config.SourceProfile)
 	}
 
@@ -203,7 +318,7 @@ func (t *tempCredsCreator) getSourceCreds(config *Config) (sourcecredsProvider a
 	}
 
 	if hasStoredCredentials {
-		log.Printf("profile %s: using stored credentials", config.ProfileName)
+		logf(LogFields{Profile: config.ProfileName, Provider: "stored"}, "profile %s: using stored credentials", config.ProfileName)
 		return NewMasterCredentialsProvider(t.keyring, config.ProfileName), nil
 	}
 
@@ -211,21 +326,34 @@ func (t *tempCredsCreator) getSourceCreds(config *Config) (sourcecredsProvider a
 }
 
 func (t *tempCredsCreator) GetProviderForProfile(config *Config) (aws.CredentialsProvider, error) {
+	p, err := t.getProviderForProfile(config)
+	if p, ok := p.(prefetcher); ok {
+		t.prefetchers = append(t.prefetchers, p)
+	}
+	return p, err
+}
+
+func (t *tempCredsCreator) getProviderForProfile(config *Config) (aws.CredentialsProvider, error) {
 	if config.HasSSOStartURL() || config.HasSSOSession() {
-		log.Printf("profile %s: using SSO role credentials", config.ProfileName)
+		logf(LogFields{Profile: config.ProfileName, Provider: "sso"}, "profile %s: using SSO role credentials", config.ProfileName)
 		return NewSSORoleCredentialsProvider(t.keyring.Keyring, config)
 	}
 
 	if config.HasWebIdentity() {
-		log.Printf("profile %s: using web identity", config.ProfileName)
+		logf(LogFields{Profile: config.ProfileName, Provider: "web_identity"}, "profile %s: using web identity", config.ProfileName)
 		return NewAssumeRoleWithWebIdentityProvider(t.keyring.Keyring, config)
 	}
 
 	if config.HasCredentialProcess() {
-		log.Printf("profile %s: using credential process", config.ProfileName)
+		logf(LogFields{Profile: config.ProfileName, Provider: "credential_process"}, "profile %s: using credential process", config.ProfileName)
 		return NewCredentialProcessProvider(t.keyring.Keyring, config)
 	}
 
+	if config.HasCredentialPlugin() {
+		logf(LogFields{Profile: config.ProfileName, Provider: "credential_plugin"}, "profile %s: using credential plugin", config.ProfileName)
+		return NewCredentialPluginProvider(t.keyring.Keyring, config)
+	}
+
 	sourcecredsProvider, err := t.getSourceCreds(config)
 	if err != nil {
 		return nil, err
@@ -236,18 +364,18 @@ func (t *tempCredsCreator) GetProviderForProfile(config *Config) (aws.Credential
 		if isMfaChained {
 			config.MfaSerial = ""
 		}
-		log.Printf("profile %s: using AssumeRole %s", config.ProfileName, mfaDetails(isMfaChained, config))
+		logf(LogFields{Profile: config.ProfileName, Provider: "assume_role"}, "profile %s: using AssumeRole %s", config.ProfileName, mfaDetails(isMfaChained, config))
 		return NewAssumeRoleProvider(sourcecredsProvider, t.keyring.Keyring, config)
 	}
 
 	canUseGetSessionToken, reason := config.CanUseGetSessionToken()
 	if canUseGetSessionToken {
 		t.chainedMfa = config.MfaSerial
-		log.Printf("profile %s: using GetSessionToken %s", config.ProfileName, mfaDetails(false, config))
+		logf(LogFields{Profile: config.ProfileName, Provider: "session_token"}, "profile %s: using GetSessionToken %s", config.ProfileName, mfaDetails(false, config))
 		return NewSessionTokenProvider(sourcecredsProvider, t.keyring.Keyring, config)
 	}
 
-	log.Printf("profile %s: skipping GetSessionToken because %s", config.ProfileName, reason)
+	logf(LogFields{Profile: config.ProfileName}, "profile %s: skipping GetSessionToken because %s", config.ProfileName, reason)
 	return sourcecredsProvider, nil
 }
 
@@ -263,10 +391,20 @@ func mfaDetails(mfaChained bool, config *Config) string {
 
 // NewTempCredentialsProvider creates a credential provider for the given config
 func NewTempCredentialsProvider(config *Config, keyring *CredentialKeyring) (aws.CredentialsProvider, error) {
+	if config.HasFakeCredentials() {
+		logf(LogFields{Profile: config.ProfileName, Provider: CredentialTypeFake}, "profile %s: using fake credentials", config.ProfileName)
+		return NewFakeCredentialsProvider(config), nil
+	}
+
 	t := tempCredsCreator{
 		keyring: keyring,
 	}
-	return t.GetProviderForProfile(config)
+	credsProvider, err := t.GetProviderForProfile(config)
+	if err != nil {
+		return nil, err
+	}
+	prefetchAll(t.prefetchers)
+	return withApproval(credsProvider, config), nil
 }
 
 func NewFederationTokenCredentialsProvider(ctx context.Context, profileName string, k *CredentialKeyring, config *Config) (aws.CredentialsProvider, error) {
@@ -276,11 +414,21 @@ func NewFederationTokenCredentialsProvider(ctx context.Context, profileName stri
 	}
 	masterCreds := NewMasterCredentialsProvider(k, credentialsName)
 
-	return NewFederationTokenProvider(ctx, masterCreds, config)
+	credsProvider, err := NewFederationTokenProvider(ctx, masterCreds, config)
+	if err != nil {
+		return nil, err
+	}
+	return withApproval(credsProvider, config), nil
 }
 
 func NewFederationTokenProvider(ctx context.Context, credsProvider aws.CredentialsProvider, config *Config) (*FederationTokenProvider, error) {
+	if err := checkSessionDuration(config, "GetFederationToken", config.GetFederationTokenDuration, MaxFederationTokenDuration); err != nil {
+		return nil, err
+	}
+
 	cfg := NewAwsConfigWithCredsProvider(credsProvider, config.Region, config.STSRegionalEndpoints)
+	AddProfileProxy(&cfg, config)
+	AddCredentialsIssuedHooks(&cfg, config)
 
 	currentUsername, err := GetUsernameFromSession(ctx, cfg)
 	if err != nil {
@@ -289,9 +437,11 @@ func NewFederationTokenProvider(ctx context.Context, credsProvider aws.Credentia
 
 	log.Printf("Using GetFederationToken for credentials")
 	return &FederationTokenProvider{
-		StsClient: sts.NewFromConfig(cfg),
-		Name:      currentUsername,
-		Duration:  config.GetFederationTokenDuration,
+		StsClient:  sts.NewFromConfig(cfg),
+		Name:       currentUsername,
+		Duration:   config.GetFederationTokenDuration,
+		Policy:     config.SessionPolicy,
+		PolicyARNs: config.SessionPolicyARNs,
 	}, nil
 }
 
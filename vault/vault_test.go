@@ -0,0 +1,35 @@
+package vault
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSSORegistrationScopes(t *testing.T) {
+	cases := []struct {
+		config   Config
+		expected string
+	}{
+		{Config{SSOStartURL: "https://example.awsapps.com/start"}, ""},
+		{Config{SSOSession: "acme"}, "sso:account:access"},
+		{Config{SSOSession: "acme", SSORegistrationScopes: "sso:account:access, codewhisperer:completions"}, "sso:account:access|codewhisperer:completions"},
+	}
+	for _, c := range cases {
+		if scopes := strings.Join(ssoRegistrationScopes(&c.config), "|"); scopes != c.expected {
+			t.Errorf("Expected scopes %q, got %q", c.expected, scopes)
+		}
+	}
+}
+
+func TestSessionParameters(t *testing.T) {
+	params := func(tags map[string]string, arns []string) map[string]interface{} {
+		return map[string]interface{}{"role_arn": "arn:aws:iam::123456789012:role/admin", "tags": tags, "policy_arns": arns}
+	}
+
+	if sessionParameters(params(map[string]string{"a": "1", "b": "2"}, nil)) != sessionParameters(params(map[string]string{"b": "2", "a": "1"}, nil)) {
+		t.Error("Expected the same parameters to give the same hash")
+	}
+	if sessionParameters(params(nil, []string{"a b"})) == sessionParameters(params(nil, []string{"a", "b"})) {
+		t.Error("Expected different parameters to give different hashes")
+	}
+}